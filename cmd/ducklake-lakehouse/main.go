@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/Yang92047111/ducklake-quick-start/internal/api"
 	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
@@ -16,11 +18,23 @@ func main() {
 	var (
 		csvFile       = flag.String("csv", "", "Path to CSV file to load")
 		jsonFile      = flag.String("json", "", "Path to JSON file to load")
+		inputFile     = flag.String("input", "", "Path to a file to load in any supported format")
+		inputFormat   = flag.String("format", "", "Format of the -input file: "+strings.Join(loader.Formats(), ", ")+" (default from its extension)")
+		compression   = flag.String("compression", "", "Compression of loaded files: gzip, zstd, bzip2 or none (default from the extension or contents)")
 		useMemory     = flag.Bool("memory", false, "Use in-memory storage instead of PostgreSQL or lakehouse")
 		useLakehouse  = flag.Bool("lakehouse", false, "Use lakehouse (Delta Lake) storage")
 		lakehousePath = flag.String("lakehouse-path", "./ducklake_data", "Path for lakehouse data storage")
 		serverMode    = flag.Bool("server", false, "Run in server mode")
 		port          = flag.String("port", "8080", "Server port")
+
+		quarantinePath     = flag.String("quarantine-path", "./ducklake_quarantine", "Directory for records rejected by validation")
+		quarantineList     = flag.Bool("quarantine-list", false, "List quarantined records")
+		quarantineFix      = flag.String("quarantine-fix", "", "ID of a quarantined record to fix with -quarantine-patch")
+		quarantinePatch    = flag.String("quarantine-patch", "", "JSON object of exercise fields to apply with -quarantine-fix")
+		quarantineReingest = flag.String("quarantine-reingest", "", "ID of a quarantined record to re-ingest, or \"all\"")
+		onDuplicate        = flag.String("on-duplicate", "warn", "Action for duplicate, near-duplicate and conflicting records: warn, skip, fail or off")
+
+		validationRules = flag.String("validation-rules", "", "Path to a YAML or JSON file of validation rules")
 	)
 	flag.Parse()
 
@@ -78,19 +92,45 @@ func main() {
 	}
 	defer repo.Close()
 
+	validator, err := loadValidator(repo, *validationRules)
+	if err != nil {
+		log.Fatalf("Failed to load validation rules: %v", err)
+	}
+
+	checks, err := batchChecksFor(*onDuplicate)
+	if err != nil {
+		log.Fatalf("Invalid -on-duplicate: %v", err)
+	}
+
+	// Invalid records are kept in the quarantine directory for review
+	quarantine, err := loader.NewQuarantine(*quarantinePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize quarantine: %v", err)
+	}
+
 	// Load data if files are specified
 	if *csvFile != "" {
-		if err := loadCSVData(repo, *csvFile); err != nil {
+		if err := loadInputData(repo, quarantine, validator, checks, *csvFile, "csv", *compression); err != nil {
 			log.Fatalf("Failed to load CSV data: %v", err)
 		}
 	}
 
 	if *jsonFile != "" {
-		if err := loadJSONData(repo, *jsonFile); err != nil {
+		if err := loadInputData(repo, quarantine, validator, checks, *jsonFile, "json", *compression); err != nil {
 			log.Fatalf("Failed to load JSON data: %v", err)
 		}
 	}
 
+	if *inputFile != "" {
+		if err := loadInputData(repo, quarantine, validator, checks, *inputFile, *inputFormat, *compression); err != nil {
+			log.Fatalf("Failed to load input data: %v", err)
+		}
+	}
+
+	if err := runQuarantineCommands(repo, quarantine, validator, *quarantineList, *quarantineFix, *quarantinePatch, *quarantineReingest); err != nil {
+		log.Fatalf("Quarantine command failed: %v", err)
+	}
+
 	// Start server if requested
 	if *serverMode {
 		log.Printf("Starting server on port %s", *port)
@@ -101,6 +141,8 @@ func main() {
 			// Use lakehouse handler with advanced features
 			log.Println("Starting server with lakehouse features enabled")
 			handler := api.NewLakehouseHandler(lakehouseRepo)
+			handler.SetQuarantine(quarantine)
+			handler.SetValidator(validator)
 			router = handler.SetupLakehouseRoutes()
 
 			// Display available lakehouse endpoints
@@ -109,6 +151,8 @@ func main() {
 			// Use standard handler
 			log.Println("Starting server with standard features")
 			handler := api.NewHandler(repo)
+			handler.SetQuarantine(quarantine)
+			handler.SetValidator(validator)
 			router = handler.SetupRoutes()
 		}
 
@@ -118,54 +162,178 @@ func main() {
 	log.Println("DuckLake Loader completed successfully")
 }
 
-func loadCSVData(repo storage.ExerciseRepository, filename string) error {
-	log.Printf("Loading CSV data from %s", filename)
+// loadInputData loads a file of any registered format, by default the format
+// of its extension, decompressing it with the named compression or the one
+// detected
+func loadInputData(repo storage.ExerciseRepository, quarantine *loader.Quarantine, validator *loader.Validator, checks storage.BatchChecks, filename, format, compression string) error {
+	log.Printf("Loading data from %s", filename)
 
-	csvLoader := loader.NewCSVLoader()
-	exercises, err := csvLoader.LoadFromCSV(filename)
+	records, err := loader.LoadRecords(filename, format, loader.FormatOptions{Compression: compression})
 	if err != nil {
 		return err
 	}
 
-	validator := loader.NewValidator()
-	for i, exercise := range exercises {
-		if err := validator.Validate(exercise); err != nil {
-			log.Printf("Validation error for exercise %d: %v", i+1, err)
-			continue
+	loaded, err := insertValidRecords(repo, quarantine, validator, checks, records)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully loaded %d exercises from %s", loaded, filename)
+	return nil
+}
+
+// insertValidRecords inserts the records that pass validation and fit the
+// schema of the repository and quarantines the rest, returning the number
+// inserted. Records caught by the cross-record checks are logged, skipped or
+// fail the load.
+func insertValidRecords(repo storage.ExerciseRepository, quarantine *loader.Quarantine, validator *loader.Validator, checks storage.BatchChecks, records []loader.SourceRecord) (int, error) {
+	storage.CheckRecords(repo, records)
+	valid, quarantined, err := quarantine.Separate(records, validator)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, record := range quarantined {
+		log.Printf("Quarantined %s:%d as %s: %v", record.SourceFile, record.SourceLine, record.ID, record.Errors)
+	}
+
+	valid, err = applyBatchChecks(repo, valid, checks)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(valid) > 0 {
+		if err := repo.InsertBatch(valid); err != nil {
+			return 0, err
 		}
 	}
 
-	if err := repo.InsertBatch(exercises); err != nil {
-		return err
+	return len(valid), nil
+}
+
+// runQuarantineCommands lists, fixes and re-ingests quarantined records as
+// requested on the command line
+func runQuarantineCommands(repo storage.ExerciseRepository, quarantine *loader.Quarantine, validator *loader.Validator, list bool, fixID, patch, reingest string) error {
+	if fixID != "" {
+		if patch == "" {
+			return fmt.Errorf("-quarantine-fix requires -quarantine-patch")
+		}
+		record, err := quarantine.Fix(fixID, []byte(patch), validator)
+		if err != nil {
+			return err
+		}
+		if record.Errors.HasErrors() {
+			log.Printf("Quarantined record %s is still invalid: %v", record.ID, record.Errors)
+		} else {
+			log.Printf("Quarantined record %s fixed and ready to re-ingest", record.ID)
+		}
+	}
+
+	switch reingest {
+	case "":
+	case "all":
+		records, err := quarantine.ReingestAll(validator, repo.InsertBatch)
+		if err != nil {
+			return err
+		}
+		log.Printf("Re-ingested %d quarantined records", len(records))
+	default:
+		if _, err := quarantine.Reingest(reingest, validator, repo.InsertBatch); err != nil {
+			return err
+		}
+		log.Printf("Re-ingested quarantined record %s", reingest)
+	}
+
+	if list {
+		records, err := quarantine.List()
+		if err != nil {
+			return err
+		}
+		log.Printf("%d quarantined records", len(records))
+		for _, record := range records {
+			log.Printf("  %s  %s:%d  %s  %v", record.ID, record.SourceFile, record.SourceLine, record.Exercise.Name, record.Errors)
+		}
 	}
 
-	log.Printf("Successfully loaded %d exercises from CSV", len(exercises))
 	return nil
 }
 
-func loadJSONData(repo storage.ExerciseRepository, filename string) error {
-	log.Printf("Loading JSON data from %s", filename)
+// batchChecksFor applies one action to every cross-record check; "off"
+// disables them
+func batchChecksFor(action string) (storage.BatchChecks, error) {
+	if action == "off" {
+		return storage.BatchChecks{}, nil
+	}
+
+	checkAction := storage.BatchCheckAction(action)
+	checks := storage.BatchChecks{Duplicates: checkAction, NearDuplicates: checkAction, IDConflicts: checkAction}
+	if err := checks.Validate(); err != nil {
+		return storage.BatchChecks{}, err
+	}
+	return checks, nil
+}
+
+// applyBatchChecks checks loaded exercises against the repository and each
+// other, returning the ones to insert
+func applyBatchChecks(repo storage.ExerciseRepository, exercises []loader.Exercise, checks storage.BatchChecks) ([]loader.Exercise, error) {
+	if !checks.Enabled() || len(exercises) == 0 {
+		return exercises, nil
+	}
 
-	jsonLoader := loader.NewJSONLoader()
-	exercises, err := jsonLoader.LoadFromJSON(filename)
+	existing, err := repo.GetAll()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read existing exercises: %w", err)
+	}
+
+	skipped := make(map[int]bool)
+	for _, finding := range storage.CheckBatch(existing, exercises, checks) {
+		exercise := exercises[finding.Index]
+		switch finding.Action {
+		case storage.BatchCheckFail:
+			return nil, fmt.Errorf("exercise %q %s", exercise.Name, finding.Message)
+		case storage.BatchCheckSkip:
+			skipped[finding.Index] = true
+			log.Printf("Skipped exercise %q: %s", exercise.Name, finding.Message)
+		default:
+			log.Printf("Warning: exercise %q %s", exercise.Name, finding.Message)
+		}
 	}
 
-	validator := loader.NewValidator()
+	accepted := make([]loader.Exercise, 0, len(exercises)-len(skipped))
 	for i, exercise := range exercises {
-		if err := validator.Validate(exercise); err != nil {
-			log.Printf("Validation error for exercise %d: %v", i+1, err)
-			continue
+		if !skipped[i] {
+			accepted = append(accepted, exercise)
 		}
 	}
+	return accepted, nil
+}
 
-	if err := repo.InsertBatch(exercises); err != nil {
-		return err
+// loadValidator returns the validator used for loading and by the API. Rules
+// read from a file are stored with a lakehouse table so that every writer of
+// the table shares them.
+func loadValidator(repo storage.ExerciseRepository, rulesFile string) (*loader.Validator, error) {
+	if rulesFile == "" {
+		if provider, ok := repo.(storage.ValidatorProvider); ok {
+			return provider.Validator(), nil
+		}
+		return loader.NewValidator(), nil
 	}
 
-	log.Printf("Successfully loaded %d exercises from JSON", len(exercises))
-	return nil
+	rules, err := loader.LoadValidationRules(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	validator, err := loader.NewValidatorWithRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation rules in %s: %w", rulesFile, err)
+	}
+
+	if lakehouseRepo, ok := repo.(storage.LakehouseRepository); ok {
+		if err := lakehouseRepo.SetValidationRules(context.Background(), rules); err != nil {
+			return nil, fmt.Errorf("failed to store validation rules: %w", err)
+		}
+	}
+	return validator, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -192,8 +360,10 @@ func displayLakehouseEndpoints() {
 	log.Println("Schema Management:")
 	log.Println("  GET    /api/v1/schema                      - Get current schema")
 	log.Println("  PUT    /api/v1/schema                      - Evolve schema")
-	log.Println("  GET    /api/v1/schema/history              - Get schema history")
+	log.Println("  GET    /api/v1/schema/history              - Get schema history and changes")
 	log.Println("  POST   /api/v1/schema/validate             - Validate schema compatibility")
+	log.Println("  POST   /api/v1/schema/columns/{name}/rename - Rename a column")
+	log.Println("  DELETE /api/v1/schema/columns/{name}       - Drop a column")
 	log.Println()
 	log.Println("Metadata & Catalog:")
 	log.Println("  GET    /api/v1/metadata                    - Get table metadata")
@@ -214,8 +384,36 @@ func displayLakehouseEndpoints() {
 	log.Println("Data Quality & Constraints:")
 	log.Println("  GET    /api/v1/constraints                 - Get constraints")
 	log.Println("  POST   /api/v1/constraints                 - Add constraint")
+	log.Println("  POST   /api/v1/constraints/validate        - Validate a batch against constraints")
+	log.Println("  POST   /api/v1/constraints/{name}/enable   - Enable constraint")
+	log.Println("  POST   /api/v1/constraints/{name}/disable  - Disable constraint")
 	log.Println("  DELETE /api/v1/constraints/{name}          - Remove constraint")
 	log.Println("  GET    /api/v1/data-quality                - Get data quality metrics")
+	log.Println("  GET    /api/v1/data-quality/outliers       - Get outlier detection rules")
+	log.Println("  PUT    /api/v1/data-quality/outliers       - Replace outlier detection rules")
+	log.Println("  GET    /api/v1/data-quality/checks         - Get scheduled quality checks")
+	log.Println("  PUT    /api/v1/data-quality/checks         - Configure scheduled quality checks")
+	log.Println("  POST   /api/v1/data-quality/checks/run     - Run quality checks now")
+	log.Println("  GET    /api/v1/data-quality/history        - Get quality check history")
+	log.Println("  GET    /api/v1/validation/rules            - Get validation rules")
+	log.Println("  PUT    /api/v1/validation/rules            - Replace validation rules")
+	log.Println()
+	log.Println("Quarantine:")
+	log.Println("  GET    /api/v1/quarantine                  - List records rejected by validation")
+	log.Println("  GET    /api/v1/quarantine/{id}             - Get a quarantined record")
+	log.Println("  PATCH  /api/v1/quarantine/{id}             - Fix fields of a quarantined record")
+	log.Println("  DELETE /api/v1/quarantine/{id}             - Discard a quarantined record")
+	log.Println("  POST   /api/v1/quarantine/{id}/reingest    - Re-ingest a fixed record")
+	log.Println("  POST   /api/v1/quarantine/reingest         - Re-ingest all fixed records")
+	log.Println()
+	log.Println("Batch & Merge:")
+	log.Println("  POST   /api/v1/lakehouse/batch/insert      - Insert a batch of exercises")
+	log.Println("  PUT    /api/v1/lakehouse/batch/update      - Update a batch of exercises")
+	log.Println("  DELETE /api/v1/lakehouse/batch/delete      - Delete a batch of exercises")
+	log.Println("  POST   /api/v1/lakehouse/bulk-load         - Bulk load from a file")
+	log.Println("  POST   /api/v1/lakehouse/merge             - Upsert exercises on key columns")
+	log.Println("  POST   /api/v1/lakehouse/delete-where      - Delete exercises matching a filter")
+	log.Println("  POST   /api/v1/lakehouse/update-where      - Update exercises matching a filter")
 	log.Println()
 	log.Println("Change Data Capture:")
 	log.Println("  GET    /api/v1/changes                     - Get changelog")
@@ -224,6 +422,7 @@ func displayLakehouseEndpoints() {
 	log.Println("Advanced Querying:")
 	log.Println("  POST   /api/v1/query/sql                   - SQL queries")
 	log.Println("  POST   /api/v1/query/filter                - Advanced filtering")
+	log.Println("  POST   /api/v1/query/explain               - Query plan and stage timings")
 	log.Println("  POST   /api/v1/query/aggregate             - Time window aggregations")
 	log.Println()
 	log.Println("Performance & Statistics:")
@@ -1,26 +1,52 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/Yang92047111/ducklake-quick-start/internal/api"
 	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
 	"github.com/Yang92047111/ducklake-quick-start/internal/storage"
 )
 
+// defaultBatchSize is the number of records loaded at a time
+const defaultBatchSize = 5000
+
 func main() {
 	var (
 		csvFile      = flag.String("csv", "", "Path to CSV file to load")
 		jsonFile     = flag.String("json", "", "Path to JSON file to load")
+		inputFile    = flag.String("input", "", "Path to a file to load in any supported format")
+		inputFormat  = flag.String("format", "", "Format of the -input file: "+strings.Join(loader.Formats(), ", ")+" (default from its extension)")
+		compression  = flag.String("compression", "", "Compression of loaded files: gzip, zstd, bzip2 or none (default from the extension or contents)")
 		useMemory    = flag.Bool("memory", false, "Use in-memory storage instead of PostgreSQL")
 		useLakehouse = flag.Bool("lakehouse", false, "Use lakehouse (Delta Lake) storage")
 		serverMode   = flag.Bool("server", false, "Run in server mode")
 		port         = flag.String("port", "8080", "Server port")
+
+		quarantineList     = flag.Bool("quarantine-list", false, "List quarantined records")
+		quarantineFix      = flag.String("quarantine-fix", "", "ID of a quarantined record to fix with -quarantine-patch")
+		quarantinePatch    = flag.String("quarantine-patch", "", "JSON object of exercise fields to apply with -quarantine-fix")
+		quarantineReingest = flag.String("quarantine-reingest", "", "ID of a quarantined record to re-ingest, or \"all\"")
+		onDuplicate        = flag.String("on-duplicate", "off", "Action for duplicate, near-duplicate and conflicting records: off, warn, skip or fail; checks read the existing table once")
+		mergeSchema        = flag.Bool("merge-schema", false, "Add columns found in the loaded file to the lakehouse schema")
+		batchSize          = flag.Int("batch-size", defaultBatchSize, "Number of records read and inserted at a time")
+		resumeAfter        = flag.Int64("resume-after", 0, "Skip the first records of the loaded file, to resume a load that stopped")
+
+		csvDelimiter = flag.String("csv-delimiter", "", "CSV field delimiter (default \",\")")
+		csvQuote     = flag.String("csv-quote", "", "CSV quote character (default '\"')")
+		csvTimezone  = flag.String("csv-timezone", "", "Timezone of CSV dates, such as Europe/Berlin (default UTC)")
+		csvDates     stringList
+		csvMapping   stringList
 	)
+	flag.Var(&csvDates, "csv-date-layout", "Go layout of CSV dates; repeat to try several (default 2006-01-02)")
+	flag.Var(&csvMapping, "csv-map", "Map a CSV header to a column, as \"Exercise Name=name\"; repeat for several")
 	flag.Parse()
 
 	log.Println("DuckLake Loader starting...")
@@ -59,23 +85,76 @@ func main() {
 	}
 	defer repo.Close()
 
+	validator, err := loadValidator(repo, getEnv("VALIDATION_RULES", ""))
+	if err != nil {
+		log.Fatalf("Failed to load validation rules: %v", err)
+	}
+
+	checks, err := batchChecksFor(*onDuplicate)
+	if err != nil {
+		log.Fatalf("Invalid -on-duplicate: %v", err)
+	}
+	options := storage.BatchOptions{BatchSize: *batchSize, Checks: checks, MergeSchema: *mergeSchema}
+
+	csvOptions, err := csvOptionsFor(*csvDelimiter, *csvQuote, *csvTimezone, csvDates, csvMapping)
+	if err != nil {
+		log.Fatalf("Invalid CSV options: %v", err)
+	}
+	csvLoader, err := loader.NewCSVLoaderWithOptions(csvOptions)
+	if err != nil {
+		log.Fatalf("Invalid CSV options: %v", err)
+	}
+
+	// Invalid records are kept in the quarantine directory for review
+	quarantine, err := loader.NewQuarantine(getEnv("QUARANTINE_PATH", "./quarantine"))
+	if err != nil {
+		log.Fatalf("Failed to initialize quarantine: %v", err)
+	}
+
+	// A resumed load continues one file
+	if *resumeAfter > 0 && countNonEmpty(*csvFile, *jsonFile, *inputFile) != 1 {
+		log.Fatalf("-resume-after requires exactly one of -csv, -json or -input")
+	}
+
+	config := loadConfig{
+		repo:        repo,
+		quarantine:  quarantine,
+		validator:   validator,
+		options:     options,
+		resumeAfter: *resumeAfter,
+		csvLoader:   csvLoader,
+		formats:     loader.FormatOptions{CSV: csvOptions, Compression: *compression},
+	}
+
 	// Load data if files are specified
 	if *csvFile != "" {
-		if err := loadCSVData(repo, *csvFile); err != nil {
+		if err := loadCSVData(config, *csvFile); err != nil {
 			log.Fatalf("Failed to load CSV data: %v", err)
 		}
 	}
 
 	if *jsonFile != "" {
-		if err := loadJSONData(repo, *jsonFile); err != nil {
+		if err := loadJSONData(config, *jsonFile); err != nil {
 			log.Fatalf("Failed to load JSON data: %v", err)
 		}
 	}
 
+	if *inputFile != "" {
+		if err := loadInputData(config, *inputFile, *inputFormat); err != nil {
+			log.Fatalf("Failed to load input data: %v", err)
+		}
+	}
+
+	if err := runQuarantineCommands(repo, quarantine, validator, *quarantineList, *quarantineFix, *quarantinePatch, *quarantineReingest); err != nil {
+		log.Fatalf("Quarantine command failed: %v", err)
+	}
+
 	// Start server if requested
 	if *serverMode {
 		log.Printf("Starting server on port %s", *port)
 		handler := api.NewHandler(repo)
+		handler.SetQuarantine(quarantine)
+		handler.SetValidator(validator)
 		router := handler.SetupRoutes()
 
 		log.Fatal(http.ListenAndServe(":"+*port, router))
@@ -84,56 +163,349 @@ func main() {
 	log.Println("DuckLake Loader completed successfully")
 }
 
-func loadCSVData(repo storage.ExerciseRepository, filename string) error {
-	log.Printf("Loading CSV data from %s", filename)
+// loadConfig is where and how files are loaded
+type loadConfig struct {
+	repo       storage.ExerciseRepository
+	quarantine *loader.Quarantine
+	validator  *loader.Validator
+	options    storage.BatchOptions
 
-	csvLoader := loader.NewCSVLoader()
-	exercises, err := csvLoader.LoadFromCSV(filename)
-	if err != nil {
-		return err
+	// resumeAfter is the number of records of the file to skip
+	resumeAfter int64
+
+	// csvLoader reads -csv files, by default with the default options;
+	// formats holds the options of -input files and the compression of
+	// every file
+	csvLoader *loader.CSVLoader
+	formats   loader.FormatOptions
+}
+
+func loadCSVData(config loadConfig, filename string) error {
+	csvLoader := config.csvLoader
+	if csvLoader == nil {
+		csvLoader = loader.NewCSVLoader()
 	}
+	return loadFile(config, filename, "CSV", func(input io.Reader) (loader.RecordReader, error) {
+		return csvLoader.NewRecordReader(input, filename)
+	})
+}
 
-	validator := loader.NewValidator()
-	for i, exercise := range exercises {
-		if err := validator.Validate(exercise); err != nil {
-			log.Printf("Validation error for exercise %d: %v", i+1, err)
-			continue
+func loadJSONData(config loadConfig, filename string) error {
+	return loadFile(config, filename, "JSON", func(input io.Reader) (loader.RecordReader, error) {
+		return loader.NewJSONLoader().NewRecordReader(input, filename)
+	})
+}
+
+// loadInputData loads a file of any registered format, by default the format
+// of its extension
+func loadInputData(config loadConfig, filename, format string) error {
+	if format == "" {
+		var ok bool
+		if format, ok = loader.FormatOf(filename); !ok {
+			return fmt.Errorf("cannot tell the format of %s from its extension, use -format", filename)
 		}
 	}
 
-	if err := repo.InsertBatch(exercises); err != nil {
+	return loadFile(config, filename, strings.ToUpper(format), func(input io.Reader) (loader.RecordReader, error) {
+		return loader.NewFormatReader(format, input, filename, config.formats)
+	})
+}
+
+// loadFile loads the records that newReader reads from a file, decompressing
+// it with the configured compression or the one detected
+func loadFile(config loadConfig, filename, format string, newReader func(io.Reader) (loader.RecordReader, error)) error {
+	log.Printf("Loading %s data from %s", format, filename)
+
+	input, err := loader.OpenInput(filename, config.formats.Compression)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", format, err)
+	}
+	defer input.Close()
+
+	reader, err := newReader(input)
+	if err != nil {
 		return err
 	}
 
-	log.Printf("Successfully loaded %d exercises from CSV", len(exercises))
+	loaded, err := loadRecords(config, reader)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully loaded %d exercises from %s", loaded, format)
 	return nil
 }
 
-func loadJSONData(repo storage.ExerciseRepository, filename string) error {
-	log.Printf("Loading JSON data from %s", filename)
+// loadRecords inserts the records of a reader a batch at a time, so that only
+// one batch is held in memory, returning the number inserted; cross-record
+// checks add a fixed-size hash per record they have seen. The first
+// resumeAfter records are skipped. An error stops the load after the batches
+// before it; it tells where to resume from.
+func loadRecords(config loadConfig, reader loader.RecordReader) (int, error) {
+	batchSize := config.options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
 
-	jsonLoader := loader.NewJSONLoader()
-	exercises, err := jsonLoader.LoadFromJSON(filename)
+	checker, err := newBatchChecker(config.repo, config.options.Checks)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	// Columns the load adds are widened when later batches need it
+	if config.options.MergeSchema {
+		config.options.MergedColumns = make(map[string]bool)
 	}
 
-	validator := loader.NewValidator()
-	for i, exercise := range exercises {
-		if err := validator.Validate(exercise); err != nil {
-			log.Printf("Validation error for exercise %d: %v", i+1, err)
-			continue
+	// done counts the records read whose batch was loaded or quarantined
+	loaded := 0
+	read, done := int64(0), config.resumeAfter
+	stopped := func(err error) error {
+		return fmt.Errorf("load stopped, rerun with -resume-after %d: %w", done, err)
+	}
+
+	batch := make([]loader.SourceRecord, 0, batchSize)
+	for {
+		record, err := reader.Next()
+		if err != nil && err != io.EOF {
+			return loaded, stopped(err)
+		}
+		if err == nil {
+			read++
+			if read <= config.resumeAfter {
+				continue
+			}
+			batch = append(batch, record)
+		}
+
+		if len(batch) == batchSize || err == io.EOF && len(batch) > 0 {
+			inserted, insertErr := insertValidRecords(config, checker, batch)
+			loaded += inserted
+			if insertErr != nil {
+				return loaded, stopped(insertErr)
+			}
+			batch = batch[:0]
+			done = read
+		}
+		if err == io.EOF {
+			return loaded, nil
 		}
 	}
+}
 
-	if err := repo.InsertBatch(exercises); err != nil {
-		return err
+// insertValidRecords inserts the records that pass validation and fit the
+// schema of the repository and quarantines the rest, returning the number
+// inserted. Records caught by the cross-record
+// checks are logged, skipped or fail the load. Merging the schema adds the
+// columns of the records that the lakehouse table does not have.
+func insertValidRecords(config loadConfig, checker *storage.BatchChecker, records []loader.SourceRecord) (int, error) {
+	if !config.options.MergeSchema {
+		storage.CheckRecords(config.repo, records)
+	}
+	valid, quarantined, err := config.quarantine.Separate(records, config.validator)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, record := range quarantined {
+		log.Printf("Quarantined %s:%d as %s: %v", record.SourceFile, record.SourceLine, record.ID, record.Errors)
+	}
+
+	valid, err = applyBatchChecks(checker, valid)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(valid) == 0 {
+		return 0, nil
+	}
+	if config.options.MergeSchema {
+		lakehouseRepo, ok := config.repo.(storage.LakehouseRepository)
+		if !ok {
+			return 0, fmt.Errorf("-merge-schema requires lakehouse storage")
+		}
+		if _, err := lakehouseRepo.InsertBatchWithOptions(context.Background(), valid, storage.BatchOptions{MergeSchema: true, MergedColumns: config.options.MergedColumns}); err != nil {
+			return 0, err
+		}
+	} else if err := config.repo.InsertBatch(valid); err != nil {
+		return 0, err
+	}
+
+	return len(valid), nil
+}
+
+// runQuarantineCommands lists, fixes and re-ingests quarantined records as
+// requested on the command line
+func runQuarantineCommands(repo storage.ExerciseRepository, quarantine *loader.Quarantine, validator *loader.Validator, list bool, fixID, patch, reingest string) error {
+	if fixID != "" {
+		if patch == "" {
+			return fmt.Errorf("-quarantine-fix requires -quarantine-patch")
+		}
+		record, err := quarantine.Fix(fixID, []byte(patch), validator)
+		if err != nil {
+			return err
+		}
+		if record.Errors.HasErrors() {
+			log.Printf("Quarantined record %s is still invalid: %v", record.ID, record.Errors)
+		} else {
+			log.Printf("Quarantined record %s fixed and ready to re-ingest", record.ID)
+		}
+	}
+
+	switch reingest {
+	case "":
+	case "all":
+		records, err := quarantine.ReingestAll(validator, repo.InsertBatch)
+		if err != nil {
+			return err
+		}
+		log.Printf("Re-ingested %d quarantined records", len(records))
+	default:
+		if _, err := quarantine.Reingest(reingest, validator, repo.InsertBatch); err != nil {
+			return err
+		}
+		log.Printf("Re-ingested quarantined record %s", reingest)
+	}
+
+	if list {
+		records, err := quarantine.List()
+		if err != nil {
+			return err
+		}
+		log.Printf("%d quarantined records", len(records))
+		for _, record := range records {
+			log.Printf("  %s  %s:%d  %s  %v", record.ID, record.SourceFile, record.SourceLine, record.Exercise.Name, record.Errors)
+		}
 	}
 
-	log.Printf("Successfully loaded %d exercises from JSON", len(exercises))
 	return nil
 }
 
+// countNonEmpty returns the number of values that are not empty
+func countNonEmpty(values ...string) int {
+	count := 0
+	for _, value := range values {
+		if value != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// csvOptionsFor builds the CSV options from the command line. Mappings are
+// given as header=column, and a delimiter of \t is a tab.
+func csvOptionsFor(delimiter, quote, timezone string, dateLayouts, mappings []string) (loader.CSVOptions, error) {
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+	options := loader.CSVOptions{Delimiter: delimiter, Quote: quote, Timezone: timezone, DateLayouts: dateLayouts}
+	for _, mapping := range mappings {
+		header, column, ok := strings.Cut(mapping, "=")
+		if !ok {
+			return loader.CSVOptions{}, fmt.Errorf("column mapping %q is not header=column", mapping)
+		}
+		if options.ColumnMapping == nil {
+			options.ColumnMapping = make(map[string]string)
+		}
+		options.ColumnMapping[header] = column
+	}
+	return options, nil
+}
+
+// batchChecksFor applies one action to every cross-record check; "off"
+// disables them
+func batchChecksFor(action string) (storage.BatchChecks, error) {
+	if action == "off" {
+		return storage.BatchChecks{}, nil
+	}
+
+	checkAction := storage.BatchCheckAction(action)
+	checks := storage.BatchChecks{Duplicates: checkAction, NearDuplicates: checkAction, IDConflicts: checkAction}
+	if err := checks.Validate(); err != nil {
+		return storage.BatchChecks{}, err
+	}
+	return checks, nil
+}
+
+// newBatchChecker reads the exercises in the repository once for the
+// cross-record checks of a load
+func newBatchChecker(repo storage.ExerciseRepository, checks storage.BatchChecks) (*storage.BatchChecker, error) {
+	var existing []loader.Exercise
+	if checks.Enabled() {
+		exercises, err := repo.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing exercises: %w", err)
+		}
+		existing = exercises
+	}
+	return storage.NewBatchChecker(existing, checks), nil
+}
+
+// applyBatchChecks checks loaded exercises against the repository and the
+// exercises checked before them, returning the ones to insert
+func applyBatchChecks(checker *storage.BatchChecker, exercises []loader.Exercise) ([]loader.Exercise, error) {
+	skipped := make(map[int]bool)
+	for _, finding := range checker.Check(exercises) {
+		exercise := exercises[finding.Index]
+		switch finding.Action {
+		case storage.BatchCheckFail:
+			return nil, fmt.Errorf("exercise %q %s", exercise.Name, finding.Message)
+		case storage.BatchCheckSkip:
+			skipped[finding.Index] = true
+			log.Printf("Skipped exercise %q: %s", exercise.Name, finding.Message)
+		default:
+			log.Printf("Warning: exercise %q %s", exercise.Name, finding.Message)
+		}
+	}
+
+	accepted := make([]loader.Exercise, 0, len(exercises)-len(skipped))
+	for i, exercise := range exercises {
+		if !skipped[i] {
+			accepted = append(accepted, exercise)
+		}
+	}
+	return accepted, nil
+}
+
+// loadValidator returns the validator used for loading and by the API. Rules
+// read from a file are stored with a lakehouse table so that every writer of
+// the table shares them.
+func loadValidator(repo storage.ExerciseRepository, rulesFile string) (*loader.Validator, error) {
+	if rulesFile == "" {
+		if provider, ok := repo.(storage.ValidatorProvider); ok {
+			return provider.Validator(), nil
+		}
+		return loader.NewValidator(), nil
+	}
+
+	rules, err := loader.LoadValidationRules(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	validator, err := loader.NewValidatorWithRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation rules in %s: %w", rulesFile, err)
+	}
+
+	if lakehouseRepo, ok := repo.(storage.LakehouseRepository); ok {
+		if err := lakehouseRepo.SetValidationRules(context.Background(), rules); err != nil {
+			return nil, fmt.Errorf("failed to store validation rules: %w", err)
+		}
+	}
+	return validator, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
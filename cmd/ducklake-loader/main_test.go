@@ -2,9 +2,13 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
 	"github.com/Yang92047111/ducklake-quick-start/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -55,13 +59,22 @@ func TestGetEnv(t *testing.T) {
 	}
 }
 
+func newTestQuarantine(t *testing.T) *loader.Quarantine {
+	t.Helper()
+
+	quarantine, err := loader.NewQuarantine(t.TempDir())
+	require.NoError(t, err)
+	return quarantine
+}
+
 func TestLoadCSVData(t *testing.T) {
 	// Create a memory repository for testing
 	repo := storage.NewMemoryRepository()
 	defer repo.Close()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator()}
 
 	t.Run("loads valid CSV file successfully", func(t *testing.T) {
-		err := loadCSVData(repo, "../../test/testdata/sample_exercises.csv")
+		err := loadCSVData(config, "../../test/testdata/sample_exercises.csv")
 		assert.NoError(t, err)
 
 		// Verify data was loaded
@@ -71,7 +84,7 @@ func TestLoadCSVData(t *testing.T) {
 	})
 
 	t.Run("returns error for non-existent file", func(t *testing.T) {
-		err := loadCSVData(repo, "non_existent_file.csv")
+		err := loadCSVData(config, "non_existent_file.csv")
 		assert.Error(t, err)
 	})
 
@@ -83,7 +96,7 @@ func TestLoadCSVData(t *testing.T) {
 		require.NoError(t, err)
 		defer os.Remove(tmpFile)
 
-		err = loadCSVData(repo, tmpFile)
+		err = loadCSVData(config, tmpFile)
 		// Should return error for malformed CSV
 		assert.Error(t, err)
 	})
@@ -93,9 +106,10 @@ func TestLoadJSONData(t *testing.T) {
 	// Create a memory repository for testing
 	repo := storage.NewMemoryRepository()
 	defer repo.Close()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator()}
 
 	t.Run("loads valid JSON file successfully", func(t *testing.T) {
-		err := loadJSONData(repo, "../../test/testdata/sample_exercises.json")
+		err := loadJSONData(config, "../../test/testdata/sample_exercises.json")
 		assert.NoError(t, err)
 
 		// Verify data was loaded
@@ -105,7 +119,7 @@ func TestLoadJSONData(t *testing.T) {
 	})
 
 	t.Run("returns error for non-existent file", func(t *testing.T) {
-		err := loadJSONData(repo, "non_existent_file.json")
+		err := loadJSONData(config, "non_existent_file.json")
 		assert.Error(t, err)
 	})
 
@@ -117,11 +131,80 @@ func TestLoadJSONData(t *testing.T) {
 		require.NoError(t, err)
 		defer os.Remove(tmpFile)
 
-		err = loadJSONData(repo, tmpFile)
+		err = loadJSONData(config, tmpFile)
 		assert.Error(t, err)
 	})
 }
 
+func TestLoadDataQuarantinesInvalidRecords(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	defer repo.Close()
+	quarantine := newTestQuarantine(t)
+	validator := loader.NewValidator()
+
+	csvFile := filepath.Join(t.TempDir(), "exercises.csv")
+	content := "id,name,type,duration,calories,date,description\n" +
+		"1,Morning Run,cardio,30,300,2024-01-15,Easy jog\n" +
+		"2,Juggling,circus,20,100,2024-01-15,Not a known type\n" +
+		"3,Swimming,cardio,0,400,2024-01-16,Zero duration\n" +
+		"4,Rowing,cardio,long,200,2024-01-17,Unparsable duration\n" +
+		"5,Cycling,cardio\n" +
+		"6,Yoga,flexibility,60,200,2024-01-18,Stretch\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(content), 0644))
+
+	require.NoError(t, loadCSVData(loadConfig{repo: repo, quarantine: quarantine, validator: validator, options: storage.BatchOptions{BatchSize: 1}}, csvFile))
+
+	exercises, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, exercises, 2)
+	assert.ElementsMatch(t, []string{"Morning Run", "Yoga"}, []string{exercises[0].Name, exercises[1].Name})
+
+	// Rows that could not be parsed are quarantined like invalid ones
+	records, err := quarantine.List()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	lines := map[string]int{}
+	for _, record := range records {
+		assert.Equal(t, csvFile, record.SourceFile)
+		require.NotEmpty(t, record.Errors)
+		lines[record.Exercise.Name] = record.SourceLine
+		if record.Exercise.Name == "Rowing" {
+			assert.Equal(t, "duration", record.Errors[0].Field)
+			assert.Equal(t, "long", record.Errors[0].Value)
+		}
+	}
+	assert.Equal(t, map[string]int{"Juggling": 3, "Swimming": 4, "Rowing": 5, "Cycling": 6}, lines)
+	for _, record := range records {
+		if record.Exercise.Name == "Rowing" || record.Exercise.Name == "Cycling" {
+			require.NoError(t, quarantine.Remove(record.ID))
+		}
+	}
+	records, err = quarantine.List()
+	require.NoError(t, err)
+
+	// Fix one record and re-ingest everything that now passes
+	var swimming loader.QuarantinedRecord
+	for _, record := range records {
+		if record.Exercise.Name == "Swimming" {
+			swimming = record
+		}
+	}
+	require.NoError(t, runQuarantineCommands(repo, quarantine, validator, true, swimming.ID, `{"duration": 45}`, "all"))
+
+	exercises, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 3)
+
+	records, err = quarantine.List()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "Juggling", records[0].Exercise.Name)
+
+	// A record that is still invalid stays quarantined
+	assert.Error(t, runQuarantineCommands(repo, quarantine, validator, false, "", "", records[0].ID))
+	assert.Error(t, runQuarantineCommands(repo, quarantine, validator, false, records[0].ID, "", ""))
+}
+
 func TestMainFunctionality(t *testing.T) {
 	// This test verifies that the main function can parse flags correctly
 	// We can't easily test the main function directly, but we can test flag parsing
@@ -181,3 +264,258 @@ func TestMainWithInvalidFlags(t *testing.T) {
 	assert.True(t, *serverMode)
 	assert.Equal(t, "8080", *port)
 }
+
+func TestLoadValidator(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte("types: [cardio, circus]\n"), 0644))
+
+	validator, err := loadValidator(storage.NewMemoryRepository(), "")
+	require.NoError(t, err)
+	assert.False(t, validator.IsValidType("circus"))
+
+	validator, err = loadValidator(storage.NewMemoryRepository(), rulesFile)
+	require.NoError(t, err)
+	assert.True(t, validator.IsValidType("circus"))
+
+	// Rules given to a lakehouse are stored with the table
+	lakehouse, err := storage.NewDeltaLakeRepository(filepath.Join(dir, "lake"), nil)
+	require.NoError(t, err)
+	defer lakehouse.Close()
+	_, err = loadValidator(lakehouse, rulesFile)
+	require.NoError(t, err)
+	assert.True(t, lakehouse.Validator().IsValidType("circus"))
+
+	validator, err = loadValidator(lakehouse, "")
+	require.NoError(t, err)
+	assert.True(t, validator.IsValidType("circus"))
+
+	require.NoError(t, os.WriteFile(rulesFile, []byte("types: []\n"), 0644))
+	_, err = loadValidator(storage.NewMemoryRepository(), rulesFile)
+	assert.Error(t, err)
+}
+
+func TestLoadDataBatchChecks(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	defer repo.Close()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator()}
+	csvFile := "../../test/testdata/sample_exercises.csv"
+
+	checks, err := batchChecksFor("skip")
+	require.NoError(t, err)
+	config.options.Checks = checks
+	require.NoError(t, loadCSVData(config, csvFile))
+	loaded, err := repo.GetAll()
+	require.NoError(t, err)
+
+	// Loading the same file again does not double the data
+	require.NoError(t, loadCSVData(config, csvFile))
+	exercises, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, len(loaded))
+
+	config.options.Checks, err = batchChecksFor("fail")
+	require.NoError(t, err)
+	assert.Error(t, loadCSVData(config, csvFile))
+
+	// The repository is read once per load, and records are checked against
+	// the batches before theirs
+	counting := &countingRepository{ExerciseRepository: storage.NewMemoryRepository()}
+	config.repo, config.options = counting, storage.BatchOptions{BatchSize: 1, Checks: checks}
+	repeatedFile := filepath.Join(t.TempDir(), "repeated.csv")
+	require.NoError(t, os.WriteFile(repeatedFile, []byte("name,type,duration,calories,date,description\nRunning,cardio,30,300,2024-01-15,Run\nCycling,cardio,45,400,2024-01-16,Ride\nRunning,cardio,30,300,2024-01-15,Run\n"), 0644))
+	require.NoError(t, loadCSVData(config, repeatedFile))
+	assert.Equal(t, 1, counting.reads)
+	exercises, err = counting.ExerciseRepository.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 2)
+
+	_, err = batchChecksFor("sometimes")
+	assert.Error(t, err)
+	checks, err = batchChecksFor("off")
+	require.NoError(t, err)
+	assert.False(t, checks.Enabled())
+}
+
+func TestLoadDataMergeSchema(t *testing.T) {
+	dir := t.TempDir()
+	lakehouse, err := storage.NewDeltaLakeRepository(filepath.Join(dir, "lake"), nil)
+	require.NoError(t, err)
+	defer lakehouse.Close()
+	config := loadConfig{repo: lakehouse, quarantine: newTestQuarantine(t), validator: loader.NewValidator()}
+
+	csvFile := filepath.Join(dir, "exercises.csv")
+	content := "id,name,type,duration,calories,date,description,heart_rate\n" +
+		"1,Morning Run,cardio,30,300,2024-01-15,Easy jog,150\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(content), 0644))
+
+	// Without merging, records with unknown columns are quarantined
+	require.NoError(t, loadCSVData(config, csvFile))
+	quarantined, err := config.quarantine.List()
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	assert.Equal(t, "heart_rate", quarantined[0].Errors[0].Field)
+
+	config.options.MergeSchema = true
+	require.NoError(t, loadCSVData(config, csvFile))
+
+	exercises, err := lakehouse.GetAll()
+	require.NoError(t, err)
+	require.Len(t, exercises, 1)
+	assert.Equal(t, 150, exercises[0].Extra["heart_rate"])
+
+	// A later batch widens a column an earlier batch of the load added
+	content = "name,type,duration,calories,date,cadence\n" +
+		"Tempo Run,cardio,40,420,2024-01-16,80\n" +
+		"Long Run,cardio,90,900,2024-01-17,82.5\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(content), 0644))
+	batches := config
+	batches.options.BatchSize = 1
+	require.NoError(t, loadCSVData(batches, csvFile))
+	exercises, err = lakehouse.GetAll()
+	require.NoError(t, err)
+	require.Len(t, exercises, 3)
+	assert.Equal(t, float64(80), exercises[1].Extra["cadence"])
+	assert.Equal(t, 82.5, exercises[2].Extra["cadence"])
+
+	config.repo = storage.NewMemoryRepository()
+	assert.ErrorContains(t, loadCSVData(config, csvFile), "requires lakehouse storage")
+}
+
+func TestLoadInputData(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewMemoryRepository()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator()}
+
+	ndjsonFile := filepath.Join(dir, "exercises.jsonl")
+	content := `{"name": "Morning Run", "type": "cardio", "duration": 30, "calories": 300, "date": "2024-01-15T00:00:00Z"}` + "\n" +
+		`{"name": "Evening Swim", "type": "cardio", "duration": 45, "calories": 400, "date": "2024-01-16T00:00:00Z"}` + "\n"
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(content), 0644))
+
+	// The format comes from the extension unless given
+	require.NoError(t, loadInputData(config, ndjsonFile, ""))
+	exercises, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 2)
+
+	assert.ErrorContains(t, loadInputData(config, ndjsonFile, "csv"), "CSV header has no name column")
+	assert.ErrorContains(t, loadInputData(config, filepath.Join(dir, "exercises.txt"), ""), "use -format")
+
+	// Compressed files are decompressed as they are read
+	require.NoError(t, loadCSVData(config, "../../test/testdata/sample_exercises.csv.bz2"))
+	exercises, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 7)
+	zstdConfig := config
+	zstdConfig.formats.Compression = "zstd"
+	assert.ErrorContains(t, loadJSONData(zstdConfig, ndjsonFile), "magic number mismatch")
+}
+
+func TestCSVOptionsFor(t *testing.T) {
+	options, err := csvOptionsFor(`\t`, "'", "UTC", []string{"02/01/2006"}, []string{"Exercise Name=name", "Avg HR=heart_rate"})
+	require.NoError(t, err)
+	assert.Equal(t, loader.CSVOptions{
+		Delimiter:     "\t",
+		Quote:         "'",
+		Timezone:      "UTC",
+		DateLayouts:   []string{"02/01/2006"},
+		ColumnMapping: map[string]string{"Exercise Name": "name", "Avg HR": "heart_rate"},
+	}, options)
+
+	_, err = csvOptionsFor("", "", "", nil, []string{"name"})
+	assert.Error(t, err)
+}
+
+func TestLoadDataInBatches(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	defer repo.Close()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator(), options: storage.BatchOptions{BatchSize: 2}}
+
+	require.NoError(t, loadCSVData(config, "../../test/testdata/sample_exercises.csv"))
+	exercises, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 5)
+
+	// At most a batch is read ahead of the records inserted
+	records, err := loader.NewJSONLoader().LoadRecordsFromJSON("../../test/testdata/sample_exercises.json")
+	require.NoError(t, err)
+	config.repo = storage.NewMemoryRepository()
+	reader := &sliceReader{records: records, repo: config.repo}
+	loaded, err := loadRecords(config, reader)
+	require.NoError(t, err)
+	assert.Equal(t, len(records), loaded)
+	assert.Equal(t, 2, reader.maxAhead)
+}
+
+func TestLoadDataResumes(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	defer repo.Close()
+	config := loadConfig{repo: repo, quarantine: newTestQuarantine(t), validator: loader.NewValidator(), options: storage.BatchOptions{BatchSize: 2}}
+
+	records, err := loader.NewJSONLoader().LoadRecordsFromJSON("../../test/testdata/sample_exercises.json")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	// A read error stops the load after the batches before it
+	reader := &failingReader{sliceReader: sliceReader{records: records, repo: repo}, failAt: 3}
+	loaded, err := loadRecords(config, reader)
+	assert.ErrorContains(t, err, "rerun with -resume-after 2")
+	assert.Equal(t, 2, loaded)
+
+	// Resuming loads the records after those
+	config.resumeAfter = 2
+	loaded, err = loadRecords(config, &sliceReader{records: records, repo: repo})
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded)
+	exercises, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, exercises, 3)
+}
+
+// failingReader fails when asked for the record at a position
+type failingReader struct {
+	sliceReader
+	failAt int
+}
+
+func (r *failingReader) Next() (loader.SourceRecord, error) {
+	if r.next+1 == r.failAt {
+		return loader.SourceRecord{}, fmt.Errorf("unexpected end of input")
+	}
+	return r.sliceReader.Next()
+}
+
+// countingRepository counts the reads of every exercise in a repository
+type countingRepository struct {
+	storage.ExerciseRepository
+	reads int
+}
+
+func (r *countingRepository) GetAll() ([]loader.Exercise, error) {
+	r.reads++
+	return r.ExerciseRepository.GetAll()
+}
+
+// sliceReader yields records from a slice, noting the most records read
+// ahead of those inserted into a repository
+type sliceReader struct {
+	records  []loader.SourceRecord
+	repo     storage.ExerciseRepository
+	next     int
+	maxAhead int
+}
+
+func (r *sliceReader) Next() (loader.SourceRecord, error) {
+	if r.next == len(r.records) {
+		return loader.SourceRecord{}, io.EOF
+	}
+	inserted, err := r.repo.GetAll()
+	if err != nil {
+		return loader.SourceRecord{}, err
+	}
+	r.next++
+	if ahead := r.next - len(inserted); ahead > r.maxAhead {
+		r.maxAhead = ahead
+	}
+	return r.records[r.next-1], nil
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -26,6 +27,27 @@ type BulkLoadRequest struct {
 	Options    storage.BulkLoadOptions `json:"options,omitempty"`
 }
 
+// MergeRequest represents a merge request. The actions default to updating
+// matched rows and inserting unmatched ones.
+type MergeRequest struct {
+	Source         []loader.Exercise   `json:"source"`
+	On             []string            `json:"on"`
+	WhenMatched    storage.MergeAction `json:"when_matched,omitempty"`
+	WhenNotMatched storage.MergeAction `json:"when_not_matched,omitempty"`
+}
+
+// DeleteWhereRequest represents a conditional delete request
+type DeleteWhereRequest struct {
+	Filter storage.Filter `json:"filter"`
+}
+
+// UpdateWhereRequest represents a conditional update request; Set maps
+// column names to their new values
+type UpdateWhereRequest struct {
+	Filter storage.Filter         `json:"filter"`
+	Set    map[string]interface{} `json:"set"`
+}
+
 // StreamCreateRequest represents a stream creation request
 type StreamCreateRequest struct {
 	Config storage.StreamConfig `json:"config"`
@@ -189,6 +211,134 @@ func (h *Handler) HandleBulkLoad(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+// HandleIngestedFiles lists the files that directory and pattern bulk loads
+// have ingested
+func (h *Handler) HandleIngestedFiles(w http.ResponseWriter, r *http.Request) {
+	lakeRepo, ok := h.repo.(storage.LakehouseRepository)
+	if !ok {
+		http.Error(w, "Lakehouse operations not supported", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	files, err := lakeRepo.GetIngestedFiles(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get ingested files: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": files,
+		"count": len(files),
+	})
+}
+
+// HandleMerge upserts exercises on a key in a single commit
+func (h *Handler) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if req.WhenMatched == "" {
+		req.WhenMatched = storage.MergeActionUpdate
+	}
+	if req.WhenNotMatched == "" {
+		req.WhenNotMatched = storage.MergeActionInsert
+	}
+
+	lakeRepo, ok := h.repo.(storage.LakehouseRepository)
+	if !ok {
+		http.Error(w, "Lakehouse operations not supported", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
+	defer cancel()
+
+	result, err := lakeRepo.Merge(ctx, req.Source, req.On, req.WhenMatched, req.WhenNotMatched)
+	if err != nil {
+		writeMutationError(w, "Merge", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleDeleteWhere deletes the exercises matching a filter in a single commit
+func (h *Handler) HandleDeleteWhere(w http.ResponseWriter, r *http.Request) {
+	var req DeleteWhereRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	lakeRepo, ok := h.repo.(storage.LakehouseRepository)
+	if !ok {
+		http.Error(w, "Lakehouse operations not supported", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	result, err := lakeRepo.DeleteWhere(ctx, req.Filter)
+	if err != nil {
+		writeMutationError(w, "Delete", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleUpdateWhere updates the exercises matching a filter in a single commit
+func (h *Handler) HandleUpdateWhere(w http.ResponseWriter, r *http.Request) {
+	var req UpdateWhereRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	lakeRepo, ok := h.repo.(storage.LakehouseRepository)
+	if !ok {
+		http.Error(w, "Lakehouse operations not supported", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	result, err := lakeRepo.UpdateWhere(ctx, req.Filter, req.Set)
+	if err != nil {
+		writeMutationError(w, "Update", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeMutationError reports a failed write, with constraint violations as
+// conflicts and anything else as a bad request
+func writeMutationError(w http.ResponseWriter, operation string, err error) {
+	var constraintErr *storage.ConstraintError
+	if errors.As(err, &constraintErr) {
+		http.Error(w, fmt.Sprintf("%s failed: %s", operation, err.Error()), http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s failed: %s", operation, err.Error()), http.StatusBadRequest)
+}
+
 // Streaming Endpoints
 
 // HandleStreamCreate creates a new stream
@@ -390,6 +540,10 @@ func (h *Handler) RegisterBatchStreamingRoutes(router *mux.Router) {
 	router.HandleFunc("/api/v1/lakehouse/batch/update", h.HandleBatchUpdate).Methods("PUT")
 	router.HandleFunc("/api/v1/lakehouse/batch/delete", h.HandleBatchDelete).Methods("DELETE")
 	router.HandleFunc("/api/v1/lakehouse/bulk-load", h.HandleBulkLoad).Methods("POST")
+	router.HandleFunc("/api/v1/lakehouse/bulk-load/files", h.HandleIngestedFiles).Methods("GET")
+	router.HandleFunc("/api/v1/lakehouse/merge", h.HandleMerge).Methods("POST")
+	router.HandleFunc("/api/v1/lakehouse/delete-where", h.HandleDeleteWhere).Methods("POST")
+	router.HandleFunc("/api/v1/lakehouse/update-where", h.HandleUpdateWhere).Methods("POST")
 
 	// Streaming operations
 	router.HandleFunc("/api/v1/lakehouse/streams", h.HandleStreamCreate).Methods("POST")
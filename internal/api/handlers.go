@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,7 +16,9 @@ import (
 )
 
 type Handler struct {
-	repo storage.ExerciseRepository
+	repo       storage.ExerciseRepository
+	quarantine *loader.Quarantine
+	rules      *loader.Validator
 }
 
 type ErrorResponse struct {
@@ -31,7 +34,28 @@ type HealthResponse struct {
 }
 
 func NewHandler(repo storage.ExerciseRepository) *Handler {
-	return &Handler{repo: repo}
+	return &Handler{repo: repo, rules: loader.NewValidator()}
+}
+
+// SetValidator sets the rules used to validate exercises for repositories
+// that do not keep their own
+func (h *Handler) SetValidator(validator *loader.Validator) {
+	h.rules = validator
+}
+
+// validator returns the repository's validator when it keeps validation
+// rules with the table, and the handler's otherwise
+func (h *Handler) validator() *loader.Validator {
+	if provider, ok := h.repo.(storage.ValidatorProvider); ok {
+		return provider.Validator()
+	}
+	return h.rules
+}
+
+// SetQuarantine enables the quarantine endpoints; it must be called before
+// the routes are set up
+func (h *Handler) SetQuarantine(quarantine *loader.Quarantine) {
+	h.quarantine = quarantine
 }
 
 // writeJSONError writes a structured JSON error response
@@ -113,24 +137,16 @@ func (h *Handler) GetExercisesByType(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate exercise type
-	exerciseType = strings.TrimSpace(strings.ToLower(exerciseType))
-	if exerciseType == "" {
+	if strings.TrimSpace(exerciseType) == "" {
 		h.writeJSONError(w, "Exercise type cannot be empty", http.StatusBadRequest)
 		return
 	}
 
-	// Validate against known exercise types
-	validTypes := []string{"cardio", "strength", "flexibility", "sports", "other"}
-	isValid := false
-	for _, validType := range validTypes {
-		if exerciseType == validType {
-			isValid = true
-			break
-		}
-	}
-
-	if !isValid {
-		h.writeJSONError(w, fmt.Sprintf("Invalid exercise type. Valid types are: %s", strings.Join(validTypes, ", ")), http.StatusBadRequest)
+	// Validate against known exercise types, querying the canonical form
+	validator := h.validator()
+	exerciseType, ok := validator.CanonicalType(exerciseType)
+	if !ok {
+		h.writeJSONError(w, fmt.Sprintf("Invalid exercise type. Valid types are: %s", strings.Join(validator.Types(), ", ")), http.StatusBadRequest)
 		return
 	}
 
@@ -234,14 +250,18 @@ func (h *Handler) CreateExercise(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate the exercise
-	validator := loader.NewValidator()
-	if err := validator.Validate(exercise); err != nil {
+	if err := h.validator().Validate(exercise); err != nil {
 		h.writeJSONError(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	// Insert the exercise
 	if err := h.repo.Insert(exercise); err != nil {
+		var unknown *storage.UnknownColumnError
+		if errors.As(err, &unknown) {
+			h.writeJSONError(w, fmt.Sprintf("Validation failed: %v", unknown), http.StatusBadRequest)
+			return
+		}
 		h.writeJSONError(w, fmt.Sprintf("Failed to create exercise: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -275,6 +295,9 @@ func (h *Handler) SetupRoutes() *mux.Router {
 	// Register batch and streaming routes if lakehouse repository is available
 	h.RegisterTestRoutes(r)
 
+	// Register quarantine routes if a quarantine is configured
+	h.registerQuarantineRoutes(r)
+
 	// Add middleware for logging requests
 	r.Use(loggingMiddleware)
 
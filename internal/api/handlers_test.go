@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -259,6 +260,44 @@ func TestHandler_GetExercisesByType_Validation(t *testing.T) {
 	}
 }
 
+func TestHandler_SetValidator(t *testing.T) {
+	handler := setupTestHandler()
+
+	rules := loader.DefaultValidationRules()
+	rules.Types = []string{"cardio", "climbing"}
+	validator, err := loader.NewValidatorWithRules(rules)
+	require.NoError(t, err)
+	handler.SetValidator(validator)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/exercises/type/climbing", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest("GET", "/exercises/type/strength", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Valid types are: cardio, climbing")
+
+	body := `{"name":"Bouldering","type":"climbing","duration":60,"calories":400,"date":"2024-01-20T00:00:00Z"}`
+	req = httptest.NewRequest("POST", "/api/v1/exercises", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	// Types are queried in their canonical form
+	req = httptest.NewRequest("GET", "/exercises/type/Climbing", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var exercises []loader.Exercise
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &exercises))
+	require.Len(t, exercises, 1)
+	assert.Equal(t, "Bouldering", exercises[0].Name)
+}
+
 func TestHandler_GetExercisesByDateRange_Validation(t *testing.T) {
 	handler := setupTestHandler()
 
@@ -396,3 +435,61 @@ func TestHandler_JSONErrorResponses(t *testing.T) {
 	assert.Equal(t, 400, errorResp.Code)
 	assert.Contains(t, errorResp.Message, "Invalid exercise type")
 }
+
+func TestHandler_Quarantine(t *testing.T) {
+	handler := setupTestHandler()
+	quarantine, err := loader.NewQuarantine(t.TempDir())
+	require.NoError(t, err)
+	handler.SetQuarantine(quarantine)
+	router := handler.SetupRoutes()
+
+	record, err := quarantine.Add(loader.SourceRecord{
+		Exercise: loader.Exercise{Name: "Rowing", Type: "cardio", Duration: 0, Calories: 200, Date: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		File:     "exercises.csv",
+		Line:     7,
+	}, loader.ValidationErrors{{Field: "duration", Message: "must be positive (in minutes)"}})
+	require.NoError(t, err)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("GET", "/api/v1/quarantine", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list struct {
+		Records []loader.QuarantinedRecord `json:"records"`
+		Count   int                        `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Count)
+	assert.Equal(t, "exercises.csv", list.Records[0].SourceFile)
+	assert.Equal(t, 7, list.Records[0].SourceLine)
+
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/api/v1/quarantine/ffff", "").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, serve("POST", "/api/v1/quarantine/"+record.ID+"/reingest", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("PATCH", "/api/v1/quarantine/"+record.ID, `{"duration":`).Code)
+
+	rr = serve("PATCH", "/api/v1/quarantine/"+record.ID, `{"duration": 25}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"valid":true`)
+
+	rr = serve("POST", "/api/v1/quarantine/"+record.ID+"/reingest", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	exercises, err := handler.repo.GetByType("cardio")
+	require.NoError(t, err)
+	assert.Len(t, exercises, 2)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/api/v1/quarantine/"+record.ID, "").Code)
+}
+
+func TestHandler_QuarantineRoutesRequireQuarantine(t *testing.T) {
+	router := setupTestHandler().SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/v1/quarantine", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
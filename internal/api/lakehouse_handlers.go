@@ -1,12 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
 	"github.com/Yang92047111/ducklake-quick-start/internal/storage"
 	"github.com/gorilla/mux"
 )
@@ -46,6 +52,8 @@ func (h *LakehouseHandler) SetupLakehouseRoutes() *mux.Router {
 	router.HandleFunc("/api/v1/schema", h.EvolveSchema).Methods("PUT")
 	router.HandleFunc("/api/v1/schema/history", h.GetSchemaHistory).Methods("GET")
 	router.HandleFunc("/api/v1/schema/validate", h.ValidateSchemaCompatibility).Methods("POST")
+	router.HandleFunc("/api/v1/schema/columns/{name}/rename", h.RenameColumn).Methods("POST")
+	router.HandleFunc("/api/v1/schema/columns/{name}", h.DropColumn).Methods("DELETE")
 
 	// Metadata and Catalog endpoints
 	router.HandleFunc("/api/v1/metadata", h.GetTableMetadata).Methods("GET")
@@ -66,8 +74,19 @@ func (h *LakehouseHandler) SetupLakehouseRoutes() *mux.Router {
 	// Data Quality endpoints
 	router.HandleFunc("/api/v1/constraints", h.GetConstraints).Methods("GET")
 	router.HandleFunc("/api/v1/constraints", h.AddConstraint).Methods("POST")
+	router.HandleFunc("/api/v1/constraints/validate", h.ValidateConstraints).Methods("POST")
+	router.HandleFunc("/api/v1/constraints/{name}/enable", h.EnableConstraint).Methods("POST")
+	router.HandleFunc("/api/v1/constraints/{name}/disable", h.DisableConstraint).Methods("POST")
 	router.HandleFunc("/api/v1/constraints/{name}", h.RemoveConstraint).Methods("DELETE")
 	router.HandleFunc("/api/v1/data-quality", h.GetDataQualityMetrics).Methods("GET")
+	router.HandleFunc("/api/v1/data-quality/outliers", h.GetOutlierRules).Methods("GET")
+	router.HandleFunc("/api/v1/data-quality/outliers", h.SetOutlierRules).Methods("PUT")
+	router.HandleFunc("/api/v1/data-quality/checks", h.GetQualityChecks).Methods("GET")
+	router.HandleFunc("/api/v1/data-quality/checks", h.SetQualityChecks).Methods("PUT")
+	router.HandleFunc("/api/v1/data-quality/checks/run", h.RunQualityChecks).Methods("POST")
+	router.HandleFunc("/api/v1/data-quality/history", h.GetQualityHistory).Methods("GET")
+	router.HandleFunc("/api/v1/validation/rules", h.GetValidationRules).Methods("GET")
+	router.HandleFunc("/api/v1/validation/rules", h.SetValidationRules).Methods("PUT")
 
 	// Streaming and Change Data Capture endpoints
 	router.HandleFunc("/api/v1/changes", h.GetChangelog).Methods("GET")
@@ -76,6 +95,7 @@ func (h *LakehouseHandler) SetupLakehouseRoutes() *mux.Router {
 	// Advanced Query endpoints
 	router.HandleFunc("/api/v1/query/sql", h.QueryWithSQL).Methods("POST")
 	router.HandleFunc("/api/v1/query/filter", h.QueryWithFilter).Methods("POST")
+	router.HandleFunc("/api/v1/query/explain", h.ExplainQuery).Methods("POST")
 	router.HandleFunc("/api/v1/query/aggregate", h.AggregateByTimeWindow).Methods("POST")
 
 	// Performance and Statistics endpoints
@@ -84,6 +104,9 @@ func (h *LakehouseHandler) SetupLakehouseRoutes() *mux.Router {
 	router.HandleFunc("/api/v1/indexes", h.CreateIndex).Methods("POST")
 	router.HandleFunc("/api/v1/indexes/{name}", h.DropIndex).Methods("DELETE")
 
+	// Batch, merge and streaming endpoints
+	h.RegisterBatchStreamingRoutes(router)
+
 	return router
 }
 
@@ -217,6 +240,58 @@ func (h *LakehouseHandler) EvolveSchema(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// RenameColumnRequest is the body of a column rename
+type RenameColumnRequest struct {
+	NewName string `json:"new_name"`
+}
+
+func (h *LakehouseHandler) RenameColumn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	var req RenameColumnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.NewName == "" {
+		h.writeJSONError(w, "new_name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.lakehouseRepo.RenameColumn(ctx, name, req.NewName); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to rename column: %v", err), http.StatusBadRequest)
+		return
+	}
+	h.writeCurrentSchema(w, r, fmt.Sprintf("Column %s renamed to %s", name, req.NewName))
+}
+
+func (h *LakehouseHandler) DropColumn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	if err := h.lakehouseRepo.DropColumn(ctx, name); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to drop column: %v", err), http.StatusBadRequest)
+		return
+	}
+	h.writeCurrentSchema(w, r, fmt.Sprintf("Column %s dropped", name))
+}
+
+// writeCurrentSchema responds with a message and the schema after a change
+func (h *LakehouseHandler) writeCurrentSchema(w http.ResponseWriter, r *http.Request, message string) {
+	schema, err := h.lakehouseRepo.GetCurrentSchema(r.Context())
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get current schema: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"schema":  schema,
+	})
+}
+
 func (h *LakehouseHandler) GetSchemaHistory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -226,9 +301,19 @@ func (h *LakehouseHandler) GetSchemaHistory(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Describe how each schema differs from the one before it
+	changes := make([]map[string]interface{}, 0, len(schemas))
+	for i := 1; i < len(schemas); i++ {
+		change := storage.SchemaChanges(&schemas[i-1], &schemas[i])
+		change["from_schema_id"] = schemas[i-1].ID
+		change["to_schema_id"] = schemas[i].ID
+		changes = append(changes, change)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"schemas": schemas,
+		"changes": changes,
 		"count":   len(schemas),
 	})
 }
@@ -415,63 +500,564 @@ func (h *LakehouseHandler) VacuumTable(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Placeholder implementations for remaining handlers
-// These would be fully implemented in a production system
+// Performance and Statistics Handlers
+
+func (h *LakehouseHandler) GetQueryStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	stats, err := h.lakehouseRepo.GetQueryStats(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get query statistics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// Advanced Query Handlers
+
+// queryRequest is the body of the query endpoints: a Filter, or a SQL
+// statement with its parameters
+type queryRequest struct {
+	storage.Filter
+	SQL    string        `json:"sql,omitempty"`
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// filter returns the Filter described by the request
+func (req queryRequest) filter() (storage.Filter, error) {
+	if req.SQL != "" {
+		return storage.ParseSQL(req.SQL, req.Params...)
+	}
+	return req.Filter, nil
+}
+
+func (h *LakehouseHandler) QueryWithSQL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.SQL == "" {
+		h.writeJSONError(w, "SQL statement is required", http.StatusBadRequest)
+		return
+	}
+
+	exercises, err := h.lakehouseRepo.QueryWithSQL(ctx, req.SQL, req.Params...)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to execute query: %v", err), http.StatusBadRequest)
+		return
+	}
 
-func (h *LakehouseHandler) GetConstraints(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"constraints": []interface{}{},
-		"message":     "Constraints feature not implemented in this demo",
+		"exercises": exercises,
+		"count":     len(exercises),
 	})
 }
 
-func (h *LakehouseHandler) AddConstraint(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "Constraints feature not implemented in this demo", http.StatusNotImplemented)
+func (h *LakehouseHandler) QueryWithFilter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var filter storage.Filter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	exercises, err := h.lakehouseRepo.QueryWithFilter(ctx, filter)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to execute query: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exercises": exercises,
+		"count":     len(exercises),
+	})
 }
 
-func (h *LakehouseHandler) RemoveConstraint(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "Constraints feature not implemented in this demo", http.StatusNotImplemented)
+func (h *LakehouseHandler) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := req.filter()
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Invalid SQL query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	explanation, err := h.lakehouseRepo.ExplainQuery(ctx, filter)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to explain query: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
 }
 
+func (h *LakehouseHandler) AggregateByTimeWindow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Window       storage.TimeWindow    `json:"window"`
+		Aggregations []storage.Aggregation `json:"aggregations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.lakehouseRepo.AggregateByTimeWindow(ctx, req.Window, req.Aggregations)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to aggregate: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"count":   len(results),
+	})
+}
+
+// Data Quality and Constraint Handlers
+
 func (h *LakehouseHandler) GetDataQualityMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	metrics, err := h.lakehouseRepo.GetDataQualityMetrics(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get data quality metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
+func (h *LakehouseHandler) GetOutlierRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	rules, err := h.lakehouseRepo.GetOutlierRules(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get outlier rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Data quality metrics not implemented in this demo",
+		"rules": rules,
+		"count": len(rules),
 	})
 }
 
-func (h *LakehouseHandler) GetChangelog(w http.ResponseWriter, r *http.Request) {
+// SetOutlierRules replaces the outlier rules used by the data quality metrics
+func (h *LakehouseHandler) SetOutlierRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Rules []storage.OutlierRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []storage.OutlierRule{}
+	}
+
+	if err := h.lakehouseRepo.SetOutlierRules(ctx, req.Rules); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to set outlier rules: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"changes": []interface{}{},
-		"message": "Changelog feature not implemented in this demo",
+		"rules": req.Rules,
+		"count": len(req.Rules),
 	})
 }
 
-func (h *LakehouseHandler) StreamChanges(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "Change streaming not implemented in this demo", http.StatusNotImplemented)
+func (h *LakehouseHandler) GetQualityChecks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	config, err := h.lakehouseRepo.GetQualityChecks(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get quality checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
 }
 
-func (h *LakehouseHandler) QueryWithSQL(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "SQL query feature not implemented in this demo", http.StatusNotImplemented)
+// SetQualityChecks replaces the expectations, schedule and webhook of the
+// quality checks
+func (h *LakehouseHandler) SetQualityChecks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req storage.QualityCheckConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.lakehouseRepo.SetQualityChecks(ctx, req); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to set quality checks: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	config, err := h.lakehouseRepo.GetQualityChecks(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get quality checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
 }
 
-func (h *LakehouseHandler) QueryWithFilter(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "Advanced filtering not implemented in this demo", http.StatusNotImplemented)
+// RunQualityChecks runs the quality checks immediately and records the run
+func (h *LakehouseHandler) RunQualityChecks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	result, err := h.lakehouseRepo.RunQualityChecks(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to run quality checks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
-func (h *LakehouseHandler) AggregateByTimeWindow(w http.ResponseWriter, r *http.Request) {
-	h.writeJSONError(w, "Time window aggregation not implemented in this demo", http.StatusNotImplemented)
+// GetQualityHistory returns recorded quality check runs, optionally bounded by
+// the RFC3339 from and to parameters and limited to the most recent runs
+func (h *LakehouseHandler) GetQualityHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	var from, to time.Time
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if text := query.Get(bound.name); text != "" {
+			parsed, err := time.Parse(time.RFC3339, text)
+			if err != nil {
+				h.writeJSONError(w, fmt.Sprintf("Invalid %s format. Use RFC3339 format", bound.name), http.StatusBadRequest)
+				return
+			}
+			*bound.value = parsed
+		}
+	}
+
+	limit := 0
+	if text := query.Get("limit"); text != "" {
+		parsed, err := strconv.Atoi(text)
+		if err != nil || parsed < 0 {
+			h.writeJSONError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	history, err := h.lakehouseRepo.GetQualityHistory(ctx, from, to)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get quality history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"history": history,
+		"count":   len(history),
+	})
 }
 
-func (h *LakehouseHandler) GetQueryStats(w http.ResponseWriter, r *http.Request) {
+func (h *LakehouseHandler) GetValidationRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	rules, err := h.lakehouseRepo.GetValidationRules(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get validation rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// SetValidationRules replaces the rules every write to the table is validated
+// against; settings left out of the body keep their default values
+func (h *LakehouseHandler) SetValidationRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rules, err := loader.ParseValidationRules(body)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.lakehouseRepo.SetValidationRules(ctx, rules); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to set validation rules: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.lakehouseRepo.GetValidationRules(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get validation rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *LakehouseHandler) GetConstraints(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	constraints, err := h.lakehouseRepo.GetConstraints(ctx)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get constraints: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"constraints": constraints,
+		"count":       len(constraints),
+	})
+}
+
+func (h *LakehouseHandler) AddConstraint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var constraint storage.Constraint
+	if err := json.NewDecoder(r.Body).Decode(&constraint); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.lakehouseRepo.AddConstraint(ctx, constraint); err != nil {
+		var constraintErr *storage.ConstraintError
+		if errors.As(err, &constraintErr) {
+			h.writeConstraintViolations(w, fmt.Sprintf("Failed to add constraint: %v", err), constraintErr.Violations, http.StatusConflict)
+			return
+		}
+		h.writeJSONError(w, fmt.Sprintf("Failed to add constraint: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	added, found := h.findConstraint(ctx, constraint.Name)
+	if !found {
+		h.writeJSONError(w, fmt.Sprintf("Constraint %s not found after adding it", constraint.Name), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(added)
+}
+
+func (h *LakehouseHandler) EnableConstraint(w http.ResponseWriter, r *http.Request) {
+	h.setConstraintEnabled(w, r, true)
+}
+
+func (h *LakehouseHandler) DisableConstraint(w http.ResponseWriter, r *http.Request) {
+	h.setConstraintEnabled(w, r, false)
+}
+
+// setConstraintEnabled toggles the constraint named in the route
+func (h *LakehouseHandler) setConstraintEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	if _, found := h.findConstraint(ctx, name); !found {
+		h.writeJSONError(w, fmt.Sprintf("Constraint %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	if err := h.lakehouseRepo.SetConstraintEnabled(ctx, name, enabled); err != nil {
+		var constraintErr *storage.ConstraintError
+		if errors.As(err, &constraintErr) {
+			h.writeConstraintViolations(w, fmt.Sprintf("Failed to enable constraint: %v", err), constraintErr.Violations, http.StatusConflict)
+			return
+		}
+		h.writeJSONError(w, fmt.Sprintf("Failed to update constraint: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	constraint, _ := h.findConstraint(ctx, name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(constraint)
+}
+
+func (h *LakehouseHandler) RemoveConstraint(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	if _, found := h.findConstraint(ctx, name); !found {
+		h.writeJSONError(w, fmt.Sprintf("Constraint %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	if err := h.lakehouseRepo.RemoveConstraint(ctx, name); err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to remove constraint: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Constraint %s removed", name),
+	})
+}
+
+// ValidateConstraints checks a candidate batch against all enabled constraints
+// without writing it and reports the violations of every row
+func (h *LakehouseHandler) ValidateConstraints(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Exercises []loader.Exercise `json:"exercises"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Exercises) == 0 {
+		h.writeJSONError(w, "No exercises provided", http.StatusBadRequest)
+		return
+	}
+
+	violations := []storage.ConstraintViolation{}
+	if err := h.lakehouseRepo.ValidateConstraints(ctx, req.Exercises); err != nil {
+		var constraintErr *storage.ConstraintError
+		if !errors.As(err, &constraintErr) {
+			h.writeJSONError(w, fmt.Sprintf("Failed to validate constraints: %v", err), http.StatusInternalServerError)
+			return
+		}
+		violations = constraintErr.Violations
+	}
+
+	type rowResult struct {
+		RowIndex   int                           `json:"row_index"`
+		Violations []storage.ConstraintViolation `json:"violations"`
+	}
+
+	rows := []rowResult{}
+	byRow := make(map[int]int)
+	for _, violation := range violations {
+		index, exists := byRow[violation.RowIndex]
+		if !exists {
+			index = len(rows)
+			byRow[violation.RowIndex] = index
+			rows = append(rows, rowResult{RowIndex: violation.RowIndex})
+		}
+		rows[index].Violations = append(rows[index].Violations, violation)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].RowIndex < rows[j].RowIndex })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":           len(violations) == 0,
+		"checked":         len(req.Exercises),
+		"invalid_rows":    len(rows),
+		"violation_count": len(violations),
+		"rows":            rows,
+	})
+}
+
+// findConstraint looks up a constraint by name
+func (h *LakehouseHandler) findConstraint(ctx context.Context, name string) (storage.Constraint, bool) {
+	constraints, err := h.lakehouseRepo.GetConstraints(ctx)
+	if err != nil {
+		return storage.Constraint{}, false
+	}
+
+	for _, constraint := range constraints {
+		if constraint.Name == name {
+			return constraint, true
+		}
+	}
+	return storage.Constraint{}, false
+}
+
+// writeConstraintViolations writes an error response listing constraint violations
+func (h *LakehouseHandler) writeConstraintViolations(w http.ResponseWriter, message string, violations []storage.ConstraintViolation, code int) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Query statistics not implemented in this demo",
+		"error":      http.StatusText(code),
+		"code":       code,
+		"message":    message,
+		"violations": violations,
 	})
 }
 
+// Placeholder implementations for remaining handlers
+// These would be fully implemented in a production system
+
+// GetChangelog returns the row changes committed between the from_version
+// and to_version parameters, both inclusive and unbounded by default
+func (h *LakehouseHandler) GetChangelog(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	fromVersion, toVersion := int64(0), int64(math.MaxInt64)
+	for _, bound := range []struct {
+		name  string
+		value *int64
+	}{{"from_version", &fromVersion}, {"to_version", &toVersion}} {
+		if text := query.Get(bound.name); text != "" {
+			parsed, err := strconv.ParseInt(text, 10, 64)
+			if err != nil || parsed < 0 {
+				h.writeJSONError(w, fmt.Sprintf("Invalid %s", bound.name), http.StatusBadRequest)
+				return
+			}
+			*bound.value = parsed
+		}
+	}
+
+	changes, err := h.lakehouseRepo.GetChangelog(ctx, fromVersion, toVersion)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to get changelog: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []storage.ChangeEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"changes": changes,
+		"count":   len(changes),
+	})
+}
+
+func (h *LakehouseHandler) StreamChanges(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONError(w, "Change streaming not implemented in this demo", http.StatusNotImplemented)
+}
+
 func (h *LakehouseHandler) GetIndexes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,579 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/Yang92047111/ducklake-quick-start/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestLakehouseHandler(t *testing.T) (*LakehouseHandler, *storage.DeltaLakeRepository) {
+	t.Helper()
+
+	repo, err := storage.NewDeltaLakeRepository(t.TempDir(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	exercises := []loader.Exercise{
+		{
+			Name:        "Running",
+			Type:        "cardio",
+			Duration:    30,
+			Calories:    300,
+			Date:        time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			Description: "Morning run",
+		},
+		{
+			Name:        "Push-ups",
+			Type:        "strength",
+			Duration:    15,
+			Calories:    100,
+			Date:        time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			Description: "Strength training",
+		},
+	}
+	require.NoError(t, repo.InsertBatch(exercises))
+
+	return NewLakehouseHandler(repo), repo
+}
+
+func TestLakehouseHandler_GetQueryStats(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	// Run a query so that there is something to report
+	req := httptest.NewRequest("GET", "/exercises/type/cardio", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest("GET", "/api/v1/stats/query", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var stats storage.QueryStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.TotalQueries)
+	assert.Equal(t, int64(1), stats.RecordsReturned)
+	require.Len(t, stats.TopQueries, 1)
+	assert.Equal(t, "SELECT * FROM exercises WHERE type = 'cardio'", stats.TopQueries[0].SQL)
+}
+
+func TestLakehouseHandler_ExplainQuery(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "filter body", body: `{"conditions":[{"field":"type","operator":"eq","value":"cardio"}]}`},
+		{name: "sql body", body: `{"sql":"SELECT * FROM exercises WHERE type = ?","params":["cardio"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/query/explain", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var explanation storage.QueryExplanation
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &explanation))
+			assert.Equal(t, "SELECT * FROM exercises WHERE type = 'cardio'", explanation.Query)
+			assert.Equal(t, int64(2), explanation.RecordsScanned)
+			assert.Equal(t, int64(1), explanation.ActualRows)
+			assert.NotEmpty(t, explanation.Stages)
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/query/explain", bytes.NewBufferString(`{"sql":"SELECT * FROM users"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_GetDataQualityMetrics(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	req := httptest.NewRequest("GET", "/api/v1/data-quality", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var metrics storage.DataQualityMetrics
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	assert.Equal(t, int64(2), metrics.TotalRecords)
+	assert.Equal(t, 100.0, metrics.ValidityScore)
+	assert.Equal(t, 100.0, metrics.CompletenessScore)
+	require.Len(t, metrics.Columns, 7)
+	assert.Equal(t, "id", metrics.Columns[0].Name)
+	assert.Equal(t, int64(2), metrics.UniqueValues["type"])
+}
+
+func TestLakehouseHandler_OutlierRules(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	body := `{"rules":[{"column":"duration","method":"fixed","group_by":"type","baselines":{"strength":{"max":10}}}]}`
+	req := httptest.NewRequest("PUT", "/api/v1/data-quality/outliers", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	req = httptest.NewRequest("GET", "/api/v1/data-quality/outliers", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"group_by":"type"`)
+
+	req = httptest.NewRequest("GET", "/api/v1/data-quality", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var metrics storage.DataQualityMetrics
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metrics))
+	strength, err := repo.GetByType("strength")
+	require.NoError(t, err)
+	require.Len(t, strength, 1)
+	assert.Equal(t, map[string][]int{"duration": {strength[0].ID}}, metrics.Outliers)
+
+	req = httptest.NewRequest("PUT", "/api/v1/data-quality/outliers", bytes.NewBufferString(`{"rules":[{"column":"duration","method":"magic"}]}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_ValidationRules(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	body := `{"types":["cardio","climbing"],"type_rules":{"climbing":{"calories":{"max":800}}}}`
+	req := httptest.NewRequest("PUT", "/api/v1/validation/rules", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var rules loader.ValidationRules
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rules))
+	assert.Equal(t, []string{"cardio", "climbing"}, rules.Types)
+	assert.Equal(t, 1440, *rules.Duration.Max)
+
+	// The table's rules apply to the exercise endpoints
+	exercise := `{"name":"Bouldering","type":"climbing","duration":60,"calories":900,"date":"2024-01-20T00:00:00Z"}`
+	req = httptest.NewRequest("POST", "/api/v1/exercises", bytes.NewBufferString(exercise))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "max 800")
+
+	req = httptest.NewRequest("GET", "/exercises/type/climbing", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	for _, invalid := range []string{`{"types":[]}`, `{"typos":["cardio"]}`, `{"name":{"pattern":"("}}`} {
+		req = httptest.NewRequest("PUT", "/api/v1/validation/rules", bytes.NewBufferString(invalid))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, invalid)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/validation/rules", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"climbing"`)
+}
+
+func TestLakehouseHandler_QualityChecks(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	alerts := make(chan map[string]interface{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer receiver.Close()
+
+	body := `{"expectations":[{"name":"enough_rows","metric":"total_records","operator":"gte","value":3}],"webhook_url":"` + receiver.URL + `"}`
+	req := httptest.NewRequest("PUT", "/api/v1/data-quality/checks", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest("POST", "/api/v1/data-quality/checks/run", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var result storage.QualityCheckResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		assert.False(t, result.Passed)
+
+		alert := <-alerts
+		assert.Equal(t, "data_quality.check_failed", alert["event"])
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/data-quality/history?limit=1", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		History []storage.QualityCheckResult `json:"history"`
+		Count   int                          `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Count)
+	require.Len(t, response.History[0].Expectations, 1)
+	assert.Equal(t, float64(2), response.History[0].Expectations[0].Actual)
+
+	req = httptest.NewRequest("GET", "/api/v1/data-quality/history?from=yesterday", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req = httptest.NewRequest("PUT", "/api/v1/data-quality/checks", bytes.NewBufferString(`{"expectations":[{"name":"x","metric":"freshness","operator":"eq"}]}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_Constraints(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/api/v1/constraints", `{"name":"positive_duration","type":"range","expression":"duration > 0 AND duration <= 600"}`)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var added storage.Constraint
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &added))
+	assert.True(t, added.Enabled)
+	assert.Equal(t, []string{"duration"}, added.Columns)
+
+	// Existing rows violate a stricter constraint
+	rr = serve("POST", "/api/v1/constraints", `{"name":"short","type":"range","expression":"duration < 20"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"violations"`)
+
+	rr = serve("POST", "/api/v1/constraints", `{"name":"broken","type":"check","expression":"duration >"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serve("POST", "/api/v1/constraints/validate", `{"exercises":[
+		{"name":"Walk","type":"cardio","duration":20,"calories":80,"date":"2024-01-16T00:00:00Z"},
+		{"name":"Ultra","type":"cardio","duration":900,"calories":5000,"date":"2024-01-16T00:00:00Z"}
+	]}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var validation struct {
+		Valid bool `json:"valid"`
+		Rows  []struct {
+			RowIndex   int                           `json:"row_index"`
+			Violations []storage.ConstraintViolation `json:"violations"`
+		} `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &validation))
+	assert.False(t, validation.Valid)
+	require.Len(t, validation.Rows, 1)
+	assert.Equal(t, 1, validation.Rows[0].RowIndex)
+	assert.Equal(t, "positive_duration", validation.Rows[0].Violations[0].Constraint)
+
+	rr = serve("POST", "/api/v1/constraints/positive_duration/disable", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = serve("POST", "/api/v1/constraints/validate", `{"exercises":[{"name":"Ultra","type":"cardio","duration":900,"calories":5000,"date":"2024-01-16T00:00:00Z"}]}`)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &validation))
+	assert.True(t, validation.Valid)
+
+	rr = serve("POST", "/api/v1/constraints/positive_duration/enable", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serve("GET", "/api/v1/constraints", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"count":1`)
+
+	rr = serve("DELETE", "/api/v1/constraints/positive_duration", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = serve("DELETE", "/api/v1/constraints/positive_duration", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = serve("POST", "/api/v1/constraints/missing/enable", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestLakehouseHandler_Merge(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	body := `{"on":["name","date"],"source":[
+		{"name":"Running","type":"cardio","duration":45,"calories":420,"date":"2024-01-15T00:00:00Z","description":"Tempo run"},
+		{"name":"Cycling","type":"cardio","duration":60,"calories":500,"date":"2024-01-16T00:00:00Z"}
+	]}`
+	req := httptest.NewRequest("POST", "/api/v1/lakehouse/merge", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var result storage.MergeResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Inserted)
+	assert.Equal(t, 1, result.Updated)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	req = httptest.NewRequest("POST", "/api/v1/lakehouse/merge", bytes.NewBufferString(`{"on":["weight"],"source":[]}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_BulkLoadDirectory(t *testing.T) {
+	handler, _ := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "runs.csv"), []byte("name,type\nCycling,cardio\n"), 0644))
+
+	body, err := json.Marshal(BulkLoadRequest{DataSource: storage.DataSource{Type: storage.DataSourceFile, Location: dir}})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/api/v1/lakehouse/bulk-load", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var result storage.BulkLoadResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	require.Len(t, result.Files, 1)
+	assert.Equal(t, storage.FileLoadLoaded, result.Files[0].Status)
+
+	req = httptest.NewRequest("GET", "/api/v1/lakehouse/bulk-load/files", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var listing struct {
+		Files []storage.IngestedFile `json:"files"`
+		Count int                    `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listing))
+	require.Equal(t, 1, listing.Count)
+	assert.Equal(t, filepath.Join(dir, "runs.csv"), listing.Files[0].Path)
+	assert.Equal(t, int64(1), listing.Files[0].Records)
+}
+
+func TestLakehouseHandler_ConditionalMutations(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/api/v1/lakehouse/update-where", `{
+		"filter":{"conditions":[{"field":"type","operator":"eq","value":"strength"}]},
+		"set":{"duration":20}
+	}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var result storage.MutationResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Affected)
+
+	rr = serve("POST", "/api/v1/lakehouse/delete-where", `{"filter":{"conditions":[{"field":"name","operator":"like","value":"Run%"}]}}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Affected)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, 20, all[0].Duration)
+
+	rr = serve("POST", "/api/v1/lakehouse/delete-where", `{"filter":{"conditions":[]}}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serve("GET", "/api/v1/changes?from_version=2", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var changelog struct {
+		Changes []storage.ChangeEvent `json:"changes"`
+		Count   int                   `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &changelog))
+	require.Equal(t, 2, changelog.Count)
+	assert.Equal(t, storage.ChangeTypeUpdate, changelog.Changes[0].Type)
+	assert.Equal(t, storage.ChangeTypeDelete, changelog.Changes[1].Type)
+
+	rr = serve("GET", "/api/v1/changes?to_version=abc", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_EvolvedColumns(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	schema, err := repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	schema.Fields = append(schema.Fields, storage.Field{Name: "intensity", Type: storage.FieldTypeString, Nullable: true, DefaultValue: "moderate"})
+	body, err := json.Marshal(schema)
+	require.NoError(t, err)
+	rr := serve("PUT", "/api/v1/schema", body)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = serve("POST", "/api/v1/exercises", []byte(`{"name":"Rowing","type":"cardio","duration":20,"calories":200,"date":"2024-01-16T00:00:00Z","intensity":"high"}`))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	// Keys that are not columns are rejected, naming the column
+	rr = serve("POST", "/api/v1/exercises", []byte(`{"name":"Rowing","type":"cardio","duration":20,"calories":200,"date":"2024-01-16T00:00:00Z","intensty":"high"}`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unknown column intensty")
+
+	rr = serve("POST", "/api/v1/query/filter", []byte(`{"conditions":[{"field":"intensity","operator":"eq","value":"high"}]}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Exercises []map[string]interface{} `json:"exercises"`
+		Count     int                      `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, 1, response.Count)
+	assert.Equal(t, "Rowing", response.Exercises[0]["name"])
+	assert.Equal(t, "high", response.Exercises[0]["intensity"])
+
+	// Existing rows report the default of the added column
+	rr = serve("GET", "/api/v1/exercises/1", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"intensity":"moderate"`)
+
+	rr = serve("GET", "/api/v1/schema/history", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var history struct {
+		Schemas []storage.Schema `json:"schemas"`
+		Changes []struct {
+			FromSchemaID int64    `json:"from_schema_id"`
+			ToSchemaID   int64    `json:"to_schema_id"`
+			AddedFields  []string `json:"added_fields"`
+		} `json:"changes"`
+		Count int `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	assert.Equal(t, 2, history.Count)
+	require.Len(t, history.Changes, 1)
+	assert.EqualValues(t, 1, history.Changes[0].FromSchemaID)
+	assert.EqualValues(t, 2, history.Changes[0].ToSchemaID)
+	assert.Equal(t, []string{"intensity"}, history.Changes[0].AddedFields)
+}
+
+func TestLakehouseHandler_RenameAndDropColumn(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/api/v1/schema/columns/duration/rename", `{"new_name":"duration_minutes"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Schema storage.Schema `json:"schema"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "duration_minutes", response.Schema.Fields[3].Name)
+	assert.Equal(t, "duration", response.Schema.Fields[3].PhysicalName)
+
+	// Exercises keep the renamed column in their duration field
+	rr = serve("GET", "/api/v1/exercises/1", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"duration":30`)
+	assert.NotContains(t, rr.Body.String(), `"duration_minutes"`)
+
+	rr = serve("DELETE", "/api/v1/schema/columns/description", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all[0].Description)
+
+	rr = serve("POST", "/api/v1/schema/columns/id/rename", `{"new_name":"exercise_id"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = serve("POST", "/api/v1/schema/columns/name/rename", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = serve("DELETE", "/api/v1/schema/columns/weight", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLakehouseHandler_NestedColumns(t *testing.T) {
+	handler, repo := setupTestLakehouseHandler(t)
+	router := handler.SetupLakehouseRoutes()
+
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	schema, err := repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	var nested []storage.Field
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"name":"sets","type":"array","nullable":true,"element":{"type":"struct","fields":[{"name":"reps","type":"int"}]}},
+		{"name":"metadata","type":"map","nullable":true,"key":{"type":"string"},"value":{"type":"string"}}
+	]`), &nested))
+	schema.Fields = append(schema.Fields, nested...)
+	body, err := json.Marshal(schema)
+	require.NoError(t, err)
+	rr := serve("PUT", "/api/v1/schema", body)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = serve("POST", "/api/v1/exercises", []byte(`{"name":"Bench press","type":"strength","duration":20,"calories":150,"date":"2024-01-16T00:00:00Z",
+		"sets":[{"reps":12},{"reps":8}],"metadata":{"device":"watch"}}`))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	rr = serve("POST", "/api/v1/query/filter", []byte(`{"conditions":[
+		{"field":"sets.reps","operator":"gt","value":10},
+		{"field":"metadata['device']","operator":"eq","value":"watch"}]}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Exercises []map[string]interface{} `json:"exercises"`
+		Count     int                      `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, 1, response.Count)
+	assert.Equal(t, []interface{}{map[string]interface{}{"reps": float64(12)}, map[string]interface{}{"reps": float64(8)}}, response.Exercises[0]["sets"])
+}
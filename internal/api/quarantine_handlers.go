@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/gorilla/mux"
+)
+
+// registerQuarantineRoutes adds the endpoints for reviewing records rejected
+// during loading
+func (h *Handler) registerQuarantineRoutes(r *mux.Router) {
+	if h.quarantine == nil {
+		return
+	}
+
+	r.HandleFunc("/api/v1/quarantine", h.ListQuarantine).Methods("GET")
+	r.HandleFunc("/api/v1/quarantine/reingest", h.ReingestQuarantine).Methods("POST")
+	r.HandleFunc("/api/v1/quarantine/{id}", h.GetQuarantinedRecord).Methods("GET")
+	r.HandleFunc("/api/v1/quarantine/{id}", h.FixQuarantinedRecord).Methods("PATCH")
+	r.HandleFunc("/api/v1/quarantine/{id}", h.DiscardQuarantinedRecord).Methods("DELETE")
+	r.HandleFunc("/api/v1/quarantine/{id}/reingest", h.ReingestQuarantinedRecord).Methods("POST")
+}
+
+// ListQuarantine handles GET requests for all quarantined records
+func (h *Handler) ListQuarantine(w http.ResponseWriter, r *http.Request) {
+	records, err := h.quarantine.List()
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to list quarantine: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"records": records,
+		"count":   len(records),
+	})
+}
+
+// GetQuarantinedRecord handles GET requests for a single quarantined record
+func (h *Handler) GetQuarantinedRecord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	record, err := h.quarantine.Get(id)
+	if err != nil {
+		h.writeQuarantineError(w, id, err)
+		return
+	}
+
+	h.writeJSONResponse(w, record)
+}
+
+// FixQuarantinedRecord handles PATCH requests that correct fields of a
+// quarantined record; the response shows whether it now passes validation
+func (h *Handler) FixQuarantinedRecord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeJSONError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	record, err := h.quarantine.Fix(id, patch, h.validator())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			h.writeQuarantineError(w, id, err)
+			return
+		}
+		h.writeJSONError(w, fmt.Sprintf("Invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"record": record,
+		"valid":  !record.Errors.HasErrors(),
+	})
+}
+
+// ReingestQuarantinedRecord handles POST requests to insert a fixed record and
+// release it from the quarantine
+func (h *Handler) ReingestQuarantinedRecord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	record, err := h.quarantine.Reingest(id, h.validator(), h.repo.InsertBatch)
+	if err != nil {
+		var validationErrors loader.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			h.writeJSONError(w, fmt.Sprintf("Record is still invalid: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		h.writeQuarantineError(w, id, err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"message": fmt.Sprintf("Quarantined record %s re-ingested", id),
+		"record":  record,
+	})
+}
+
+// ReingestQuarantine handles POST requests to insert every quarantined record
+// that now passes validation
+func (h *Handler) ReingestQuarantine(w http.ResponseWriter, r *http.Request) {
+	records, err := h.quarantine.ReingestAll(h.validator(), h.repo.InsertBatch)
+	if err != nil {
+		h.writeJSONError(w, fmt.Sprintf("Failed to re-ingest quarantine: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"reingested": records,
+		"count":      len(records),
+	})
+}
+
+// DiscardQuarantinedRecord handles DELETE requests that drop a quarantined
+// record without ingesting it
+func (h *Handler) DiscardQuarantinedRecord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := h.quarantine.Remove(id); err != nil {
+		h.writeQuarantineError(w, id, err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"message": fmt.Sprintf("Quarantined record %s discarded", id),
+	})
+}
+
+// writeQuarantineError reports unknown records as 404 and other failures as 500
+func (h *Handler) writeQuarantineError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, os.ErrNotExist) {
+		h.writeJSONError(w, fmt.Sprintf("Quarantined record %s not found", id), http.StatusNotFound)
+		return
+	}
+	h.writeJSONError(w, fmt.Sprintf("Quarantine operation failed: %v", err), http.StatusInternalServerError)
+}
@@ -0,0 +1,181 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// NewAvroRecordReader returns a reader of the exercises in an Avro object
+// container file, which decodes one block at a time. Records are matched to
+// exercises by field name; a record's Line is its position in the file.
+func NewAvroRecordReader(input io.Reader, source string) (RecordReader, error) {
+	ocf, err := goavro.NewOCFReader(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Avro: %w", err)
+	}
+
+	var schema interface{}
+	if err := json.Unmarshal([]byte(ocf.Codec().Schema()), &schema); err != nil {
+		return nil, fmt.Errorf("failed to read Avro schema: %w", err)
+	}
+	named := make(map[string]interface{})
+	collectAvroNames(schema, "", named)
+
+	return &avroReader{ocf: ocf, schema: schema, named: named, source: source}, nil
+}
+
+type avroReader struct {
+	ocf    *goavro.OCFReader
+	schema interface{}
+	named  map[string]interface{}
+	source string
+	count  int
+}
+
+func (r *avroReader) Next() (SourceRecord, error) {
+	if !r.ocf.Scan() {
+		if err := r.ocf.Err(); err != nil {
+			return SourceRecord{}, fmt.Errorf("failed to read Avro: %w", err)
+		}
+		return SourceRecord{}, io.EOF
+	}
+	r.count++
+
+	datum, err := r.ocf.Read()
+	if err != nil {
+		return SourceRecord{}, fmt.Errorf("failed to read Avro record %d: %w", r.count, err)
+	}
+	record := SourceRecord{File: r.source, Line: r.count}
+	values, ok := r.native(datum, r.schema).(map[string]interface{})
+	if !ok {
+		record.Errors = ValidationErrors{{Field: "record", Message: "is not an Avro record"}}
+		return record, nil
+	}
+	record.Exercise, record.Errors = exerciseFromValues(values)
+	return record, nil
+}
+
+// native converts a decoded Avro value to plain values: unions are
+// unwrapped to their value and bytes become text
+func (r *avroReader) native(value interface{}, schema interface{}) interface{} {
+	if name, ok := schema.(string); ok {
+		if definition, ok := r.named[name]; ok {
+			schema = definition
+		}
+	}
+
+	switch s := schema.(type) {
+	case []interface{}:
+		// Unions decode to a map from the name of the member type to its value
+		wrapped, ok := value.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return value
+		}
+		for name, member := range wrapped {
+			if definition, ok := r.named[name]; ok {
+				return r.native(member, definition)
+			}
+			for _, candidate := range s {
+				if avroTypeName(candidate) == name {
+					return r.native(member, candidate)
+				}
+			}
+			return member
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record":
+			record, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			fields, _ := s["fields"].([]interface{})
+			for _, field := range fields {
+				definition, _ := field.(map[string]interface{})
+				name, _ := definition["name"].(string)
+				if fieldValue, ok := record[name]; ok {
+					record[name] = r.native(fieldValue, definition["type"])
+				}
+			}
+			return record
+		case "array":
+			items, ok := value.([]interface{})
+			if !ok {
+				return value
+			}
+			for i, item := range items {
+				items[i] = r.native(item, s["items"])
+			}
+			return items
+		case "map":
+			entries, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			for key, entry := range entries {
+				entries[key] = r.native(entry, s["values"])
+			}
+			return entries
+		}
+	}
+
+	if data, ok := value.([]byte); ok {
+		return string(data)
+	}
+	return value
+}
+
+// avroTypeName returns the name under which a union holds a value of an
+// unnamed type
+func avroTypeName(schema interface{}) string {
+	switch s := schema.(type) {
+	case string:
+		return s
+	case map[string]interface{}:
+		typeName, _ := s["type"].(string)
+		if logicalType, ok := s["logicalType"].(string); ok {
+			return typeName + "." + logicalType
+		}
+		return typeName
+	}
+	return ""
+}
+
+// collectAvroNames records the definitions of the named types in a schema by
+// their full name and their short name
+func collectAvroNames(schema interface{}, namespace string, named map[string]interface{}) {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, member := range s {
+			collectAvroNames(member, namespace, named)
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "enum", "fixed":
+			if ns, _ := s["namespace"].(string); ns != "" {
+				namespace = ns
+			}
+			name, _ := s["name"].(string)
+			named[name] = s
+			if namespace != "" && !strings.Contains(name, ".") {
+				named[namespace+"."+name] = s
+			}
+			fields, _ := s["fields"].([]interface{})
+			for _, field := range fields {
+				if definition, ok := field.(map[string]interface{}); ok {
+					collectAvroNames(definition["type"], namespace, named)
+				}
+			}
+		case "array":
+			collectAvroNames(s["items"], namespace, named)
+		case "map":
+			collectAvroNames(s["values"], namespace, named)
+		default:
+			collectAvroNames(s["type"], namespace, named)
+		}
+	}
+}
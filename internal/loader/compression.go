@@ -0,0 +1,166 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of input files
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+)
+
+// compressionExtensions maps file extensions to the compression of the file
+var compressionExtensions = map[string]string{
+	".gz":   CompressionGzip,
+	".gzip": CompressionGzip,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+	".bz2":  CompressionBzip2,
+}
+
+// compressionMagic holds the bytes that compressed data starts with
+var compressionMagic = []struct {
+	compression string
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionBzip2, []byte("BZh")},
+}
+
+// CompressionOf returns the compression of a file named with a compression
+// extension, such as .gz
+func CompressionOf(filename string) (string, bool) {
+	compression, ok := compressionExtensions[strings.ToLower(filepath.Ext(filename))]
+	return compression, ok
+}
+
+// trimCompressionExt removes a compression extension from a file name, so
+// that runs.csv.gz is named as the CSV file it holds
+func trimCompressionExt(filename string) string {
+	if _, ok := CompressionOf(filename); ok {
+		return strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return filename
+}
+
+// OpenInput opens a file to load, decompressing it with the named
+// compression or, when that is empty, the compression of its extension or
+// magic bytes. Uncompressed files are returned as they are, so that readers
+// may seek in them.
+func OpenInput(filename, compression string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+
+	reader, closeReader, err := decompress(file, filename, compression)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if closeReader == nil {
+		return file, nil
+	}
+	return &decompressedFile{Reader: reader, file: file, closeReader: closeReader}, nil
+}
+
+type decompressedFile struct {
+	io.Reader
+	file        *os.File
+	closeReader func()
+}
+
+func (f *decompressedFile) Close() error {
+	f.closeReader()
+	return f.file.Close()
+}
+
+// decompress returns a reader of the decompressed data of input, and a
+// function releasing the decompressor, which is nil when input is not
+// compressed and is returned unchanged
+func decompress(input io.Reader, filename, compression string) (io.Reader, func(), error) {
+	if compression == "" {
+		compression, _ = CompressionOf(filename)
+	}
+	if compression == "" {
+		var err error
+		if compression, input, err = detectCompression(input); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch strings.ToLower(compression) {
+	case CompressionNone:
+		return input, nil, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		return reader, func() { reader.Close() }, nil
+	case CompressionZstd:
+		// With a concurrency of one the stream is decoded as it is read
+		reader, err := zstd.NewReader(input, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zstd data: %w", err)
+		}
+		return reader, reader.Close, nil
+	case CompressionBzip2:
+		return bzip2.NewReader(input), func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported compression %q, expected one of %s, %s, %s or %s",
+		compression, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionNone)
+}
+
+// detectCompression tells the compression of data from its first bytes.
+// Inputs that can seek are returned to where they were; others are buffered.
+func detectCompression(input io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 4)
+	var n int
+	if seeker, ok := input.(io.ReadSeeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", nil, err
+		}
+		if n, err = io.ReadFull(seeker, head); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", nil, err
+		}
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+	} else {
+		buffered := bufio.NewReader(input)
+		peeked, err := buffered.Peek(len(head))
+		if err != nil && err != io.EOF {
+			return "", nil, err
+		}
+		n = copy(head, peeked)
+		input = buffered
+	}
+
+	for _, candidate := range compressionMagic {
+		if !bytes.HasPrefix(head[:n], candidate.magic) {
+			continue
+		}
+		// bzip2 data goes on with its block size, a digit from 1 to 9
+		if candidate.compression == CompressionBzip2 && (n < 4 || head[3] < '1' || head[3] > '9') {
+			continue
+		}
+		return candidate.compression, input, nil
+	}
+	return CompressionNone, input, nil
+}
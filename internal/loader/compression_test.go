@@ -0,0 +1,125 @@
+package loader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const compressionTestCSV = "name,type,duration\nRun,cardio,30\nLift,strength,45\n"
+
+func gzipData(t *testing.T, data string) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func zstdData(t *testing.T, data string) []byte {
+	writer, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer writer.Close()
+	return writer.EncodeAll([]byte(data), nil)
+}
+
+func TestOpenInput(t *testing.T) {
+	dir := t.TempDir()
+	bzip2Data, err := os.ReadFile("../../test/testdata/sample_exercises.csv.bz2")
+	require.NoError(t, err)
+	plain, err := os.ReadFile("../../test/testdata/sample_exercises.csv")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		filename    string
+		data        []byte
+		compression string
+		expected    string
+	}{
+		{"gzip by extension", "runs.csv.gz", gzipData(t, compressionTestCSV), "", compressionTestCSV},
+		{"zstd by extension", "runs.csv.zst", zstdData(t, compressionTestCSV), "", compressionTestCSV},
+		{"bzip2 by extension", "runs.csv.bz2", bzip2Data, "", string(plain)},
+		{"gzip by magic bytes", "runs.csv", gzipData(t, compressionTestCSV), "", compressionTestCSV},
+		{"zstd by magic bytes", "runs.dat", zstdData(t, compressionTestCSV), "", compressionTestCSV},
+		{"bzip2 by magic bytes", "runs.dat", bzip2Data, "", string(plain)},
+		{"gzip by option", "runs.archive", gzipData(t, compressionTestCSV), "GZIP", compressionTestCSV},
+		{"none by option", "runs.csv.gz", []byte(compressionTestCSV), "none", compressionTestCSV},
+		{"uncompressed", "runs.csv", []byte(compressionTestCSV), "", compressionTestCSV},
+		{"short uncompressed", "runs.csv", []byte("BZ"), "", "BZ"},
+		{"text like bzip2", "runs.csv", []byte("BZh,x\n"), "", "BZh,x\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tt.filename)
+			require.NoError(t, os.WriteFile(filename, tt.data, 0644))
+
+			input, err := OpenInput(filename, tt.compression)
+			require.NoError(t, err)
+			defer input.Close()
+
+			data, err := io.ReadAll(input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
+
+	// Uncompressed files are returned as they are
+	uncompressed := filepath.Join(dir, "plain.csv")
+	require.NoError(t, os.WriteFile(uncompressed, []byte(compressionTestCSV), 0644))
+	input, err := OpenInput(uncompressed, "")
+	require.NoError(t, err)
+	defer input.Close()
+	assert.IsType(t, &os.File{}, input)
+
+	_, err = OpenInput(uncompressed, "lz4")
+	assert.ErrorContains(t, err, `unsupported compression "lz4"`)
+	_, err = OpenInput(uncompressed, "gzip")
+	assert.ErrorContains(t, err, "invalid gzip data")
+	_, err = OpenInput(filepath.Join(dir, "missing.csv.gz"), "")
+	assert.ErrorContains(t, err, "failed to open input file")
+}
+
+func TestDetectCompression_Stream(t *testing.T) {
+	compressed := gzipData(t, compressionTestCSV)
+
+	// Inputs that cannot seek are buffered, keeping the bytes looked at
+	reader, closeReader, err := decompress(io.MultiReader(bytes.NewReader(compressed)), "", "")
+	require.NoError(t, err)
+	defer closeReader()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, compressionTestCSV, string(data))
+
+	reader, closeReader, err = decompress(io.MultiReader(strings.NewReader(compressionTestCSV)), "", "")
+	require.NoError(t, err)
+	assert.Nil(t, closeReader)
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, compressionTestCSV, string(data))
+}
+
+func TestLoadRecords_Compressed(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "runs.csv.gz")
+	require.NoError(t, os.WriteFile(filename, gzipData(t, compressionTestCSV), 0644))
+
+	format, ok := FormatOf(filename)
+	require.True(t, ok)
+	assert.Equal(t, "csv", format)
+
+	records, err := LoadRecords(filename, "", FormatOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "Lift", records[1].Exercise.Name)
+	assert.Equal(t, 3, records[1].Line)
+}
@@ -1,81 +1,313 @@
 package loader
 
 import (
-	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-type CSVLoader struct{}
+// CSVOptions describes the shape of a CSV file. Columns are matched to
+// exercise fields by their header, ignoring case; ColumnMapping maps other
+// headers to field names, or renames extra columns. Only the name column is
+// required.
+type CSVOptions struct {
+	Delimiter     string            `json:"delimiter,omitempty"`
+	Quote         string            `json:"quote,omitempty"`
+	DateLayouts   []string          `json:"date_layouts,omitempty"`
+	Timezone      string            `json:"timezone,omitempty"`
+	ColumnMapping map[string]string `json:"column_mapping,omitempty"`
+}
+
+type CSVLoader struct {
+	delimiter   rune
+	quote       rune
+	dateLayouts []string
+	location    *time.Location
+	mapping     map[string]string
+}
 
 func NewCSVLoader() *CSVLoader {
-	return &CSVLoader{}
+	csvLoader, _ := NewCSVLoaderWithOptions(CSVOptions{})
+	return csvLoader
+}
+
+// NewCSVLoaderWithOptions returns a loader for CSV files of the given shape.
+// Empty options read comma-separated files with double quotes and
+// 2006-01-02 dates in UTC.
+func NewCSVLoaderWithOptions(options CSVOptions) (*CSVLoader, error) {
+	delimiter, err := csvRune(options.Delimiter, ',', "delimiter")
+	if err != nil {
+		return nil, err
+	}
+	quote, err := csvRune(options.Quote, '"', "quote")
+	if err != nil {
+		return nil, err
+	}
+	if delimiter == quote {
+		return nil, fmt.Errorf("CSV delimiter and quote must differ")
+	}
+
+	dateLayouts := options.DateLayouts
+	if len(dateLayouts) == 0 {
+		dateLayouts = []string{"2006-01-02"}
+	}
+
+	location := time.UTC
+	if options.Timezone != "" {
+		if location, err = time.LoadLocation(options.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid CSV timezone: %w", err)
+		}
+	}
+
+	mapping := make(map[string]string, len(options.ColumnMapping))
+	for header, column := range options.ColumnMapping {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return nil, fmt.Errorf("CSV column mapping for %q is empty", header)
+		}
+		mapping[normalizeHeader(header)] = column
+	}
+
+	return &CSVLoader{
+		delimiter:   delimiter,
+		quote:       quote,
+		dateLayouts: dateLayouts,
+		location:    location,
+		mapping:     mapping,
+	}, nil
+}
+
+// csvRune returns the single character of a delimiter or quote option
+func csvRune(value string, defaultRune rune, option string) (rune, error) {
+	if value == "" {
+		return defaultRune, nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == utf8.RuneError || r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("CSV %s must be a single character, got %q", option, value)
+	}
+	return r, nil
+}
+
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.TrimSpace(header))
 }
 
 func (c *CSVLoader) LoadFromCSV(filename string) ([]Exercise, error) {
+	records, err := c.LoadRecordsFromCSV(filename)
+	if err != nil {
+		return nil, err
+	}
+	return exercisesOf(records)
+}
+
+// LoadRecordsFromCSV loads exercises together with the line each was read from
+func (c *CSVLoader) LoadRecordsFromCSV(filename string) ([]SourceRecord, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open CSV file: %w", err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	return c.ReadRecordsFromCSV(file, filename)
+}
+
+// ReadRecordsFromCSV reads exercises from CSV data with a header row,
+// attributing them to the named source
+func (c *CSVLoader) ReadRecordsFromCSV(input io.Reader, source string) ([]SourceRecord, error) {
+	records, err := c.NewRecordReader(input, source)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV: %w", err)
+		return nil, err
 	}
+	return readAllRecords(records)
+}
 
-	if len(records) == 0 {
+// NewRecordReader reads the header of CSV data and returns a reader of the
+// exercises in the rows that follow, which reads one row at a time
+func (c *CSVLoader) NewRecordReader(input io.Reader, source string) (RecordReader, error) {
+	reader := newCSVReader(input, c.delimiter, c.quote)
+	header, _, err := reader.Read()
+	if err == io.EOF {
 		return nil, fmt.Errorf("CSV file is empty")
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
 
-	// Skip header row
-	exercises := make([]Exercise, 0, len(records)-1)
-	for i, record := range records[1:] {
-		exercise, err := c.parseCSVRecord(record, i+2)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing row %d: %w", i+2, err)
+	// Files saved by spreadsheets often start with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for _, title := range header {
+		if !utf8.ValidString(title) {
+			return nil, fmt.Errorf("CSV header is not valid UTF-8")
 		}
-		exercises = append(exercises, exercise)
 	}
+	columns, err := c.bindColumns(header)
+	if err != nil {
+		return nil, err
+	}
+	return &csvRecordReader{loader: c, reader: reader, columns: columns, source: source}, nil
+}
 
-	return exercises, nil
+type csvRecordReader struct {
+	loader  *CSVLoader
+	reader  *csvReader
+	columns []csvColumn
+	source  string
 }
 
-func (c *CSVLoader) parseCSVRecord(record []string, rowNum int) (Exercise, error) {
-	if len(record) < 7 {
-		return Exercise{}, fmt.Errorf("insufficient columns in row %d", rowNum)
+// Next returns the next row. Rows with the wrong number of fields, text that
+// is not valid UTF-8 or values that cannot be parsed are returned with their
+// Errors, so that they can be quarantined; only rows that cannot be split
+// into fields fail the read.
+func (r *csvRecordReader) Next() (SourceRecord, error) {
+	row, line, err := r.reader.Read()
+	if err == io.EOF {
+		return SourceRecord{}, io.EOF
 	}
-
-	id, err := strconv.Atoi(record[0])
 	if err != nil {
-		return Exercise{}, fmt.Errorf("invalid ID: %w", err)
+		return SourceRecord{}, fmt.Errorf("failed to read CSV: %w", err)
 	}
 
-	duration, err := strconv.Atoi(record[3])
-	if err != nil {
-		return Exercise{}, fmt.Errorf("invalid duration: %w", err)
+	var rowErrors ValidationErrors
+	if len(row) != len(r.columns) {
+		rowErrors = append(rowErrors, ValidationError{
+			Field:   "record",
+			Message: fmt.Sprintf("has %d fields, the header has %d", len(row), len(r.columns)),
+		})
+	}
+	for i, value := range row {
+		if utf8.ValidString(value) {
+			continue
+		}
+		field := "record"
+		if i < len(r.columns) && r.columns[i].name != "" {
+			field = r.columns[i].name
+		}
+		rowErrors = append(rowErrors, ValidationError{Field: field, Message: "is not valid UTF-8"})
 	}
 
-	calories, err := strconv.Atoi(record[4])
-	if err != nil {
-		return Exercise{}, fmt.Errorf("invalid calories: %w", err)
+	exercise, fieldErrors := r.loader.parseCSVRecord(r.columns, row)
+	return SourceRecord{Exercise: exercise, File: r.source, Line: line, Errors: append(rowErrors, fieldErrors...)}, nil
+}
+
+// csvColumn is where the values of a CSV column go: an exercise field, or an
+// extra column of that name
+type csvColumn struct {
+	name    string
+	isField bool
+}
+
+// bindColumns matches the header to exercise fields and extra columns
+func (c *CSVLoader) bindColumns(header []string) ([]csvColumn, error) {
+	columns := make([]csvColumn, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, title := range header {
+		name := strings.TrimSpace(title)
+		if mapped, ok := c.mapping[normalizeHeader(title)]; ok {
+			name = mapped
+		}
+		if name == "" {
+			continue
+		}
+
+		column := csvColumn{name: name}
+		for _, field := range exerciseFields {
+			if strings.EqualFold(name, field) {
+				column = csvColumn{name: field, isField: true}
+			}
+		}
+		if seen[column.name] {
+			return nil, fmt.Errorf("CSV header has more than one %s column", column.name)
+		}
+		seen[column.name] = true
+		columns[i] = column
 	}
 
-	date, err := time.Parse("2006-01-02", record[5])
+	if !seen["name"] {
+		return nil, fmt.Errorf("CSV header has no name column")
+	}
+	return columns, nil
+}
+
+// parseCSVRecord builds an exercise from the fields of a row that has them.
+// Missing and empty fields keep their zero value for the validator to judge;
+// empty extra columns are null. Values that cannot be parsed are returned as
+// errors and leave their field unset.
+func (c *CSVLoader) parseCSVRecord(columns []csvColumn, record []string) (Exercise, ValidationErrors) {
+	var exercise Exercise
+	var errors ValidationErrors
+	for i, column := range columns {
+		if column.name == "" || i >= len(record) {
+			continue
+		}
+		value := record[i]
+		if !column.isField {
+			if exercise.Extra == nil {
+				exercise.Extra = make(map[string]interface{})
+			}
+			if value == "" {
+				exercise.Extra[column.name] = nil
+			} else {
+				exercise.Extra[column.name] = value
+			}
+			continue
+		}
+		if err := c.setField(&exercise, column.name, value); err != nil {
+			errors = append(errors, ValidationError{Field: column.name, Message: err.Error(), Value: value})
+		}
+	}
+	return exercise, errors
+}
+
+// setField parses the value of an exercise field
+func (c *CSVLoader) setField(exercise *Exercise, field, value string) error {
+	trimmed := strings.TrimSpace(value)
+	var err error
+	switch field {
+	case "id":
+		exercise.ID, err = parseCSVInt(trimmed)
+	case "name":
+		exercise.Name = value
+	case "type":
+		exercise.Type = value
+	case "duration":
+		exercise.Duration, err = parseCSVInt(trimmed)
+	case "calories":
+		exercise.Calories, err = parseCSVInt(trimmed)
+	case "date":
+		exercise.Date, err = c.parseDate(trimmed)
+	case "description":
+		exercise.Description = value
+	}
+	return err
+}
+
+func parseCSVInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
 	if err != nil {
-		return Exercise{}, fmt.Errorf("invalid date format: %w", err)
+		return 0, fmt.Errorf("must be an integer")
 	}
+	return number, nil
+}
 
-	return Exercise{
-		ID:          id,
-		Name:        record[1],
-		Type:        record[2],
-		Duration:    duration,
-		Calories:    calories,
-		Date:        date,
-		Description: record[6],
-	}, nil
+// parseDate parses a date with the first layout that fits, in the configured
+// timezone
+func (c *CSVLoader) parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range c.dateLayouts {
+		if date, err := time.ParseInLocation(layout, value, c.location); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format, expected %s", strings.Join(c.dateLayouts, " or "))
 }
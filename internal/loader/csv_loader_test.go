@@ -1,6 +1,9 @@
 package loader
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,3 +37,148 @@ func TestCSVLoader_LoadFromCSV_FileNotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to open CSV file")
 }
+
+func TestCSVLoader_LoadRecordsFromCSV(t *testing.T) {
+	records, err := NewCSVLoader().LoadRecordsFromCSV("../../test/testdata/sample_exercises.csv")
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+
+	// Lines count from the header
+	assert.Equal(t, 2, records[0].Line)
+	assert.Equal(t, 6, records[4].Line)
+	assert.Equal(t, "../../test/testdata/sample_exercises.csv", records[0].File)
+}
+
+func TestCSVLoader_ExtraColumns(t *testing.T) {
+	input := "id,name,type,duration,calories,date,description,heart_rate,intensity\n" +
+		"1,Run,cardio,30,300,2024-01-15,Jog,150,high\n" +
+		"2,Walk,cardio,20,100,2024-01-16,Stroll,,low\n"
+
+	records, err := NewCSVLoader().ReadRecordsFromCSV(strings.NewReader(input), "extra.csv")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	// Columns after the exercise fields are kept as text, and empty ones as null
+	assert.Equal(t, map[string]interface{}{"heart_rate": "150", "intensity": "high"}, records[0].Exercise.Extra)
+	assert.Equal(t, map[string]interface{}{"heart_rate": nil, "intensity": "low"}, records[1].Exercise.Extra)
+	assert.Equal(t, "Jog", records[0].Exercise.Description)
+}
+
+func TestCSVLoader_Options(t *testing.T) {
+	csvLoader, err := NewCSVLoaderWithOptions(CSVOptions{
+		Delimiter:     ";",
+		Quote:         "'",
+		DateLayouts:   []string{"02/01/2006 15:04", "02/01/2006"},
+		Timezone:      "Europe/Berlin",
+		ColumnMapping: map[string]string{"Exercise Name": "name", "KCAL": "calories", "Avg HR": "heart_rate"},
+	})
+	require.NoError(t, err)
+
+	// Columns follow the header; id and description are left out
+	input := "Date;Exercise Name;Type;Duration;kcal;Avg HR\n" +
+		"15/01/2024 07:30;'Run; easy';cardio;30;300;150\n" +
+		"\n" +
+		"16/01/2024;'Coach''s\nspecial';strength;20;;\n"
+
+	records, err := csvLoader.ReadRecordsFromCSV(strings.NewReader(input), "gym.csv")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	first := records[0].Exercise
+	assert.Equal(t, "Run; easy", first.Name)
+	assert.Equal(t, 300, first.Calories)
+	assert.True(t, time.Date(2024, 1, 15, 7, 30, 0, 0, berlin).Equal(first.Date))
+	assert.Equal(t, map[string]interface{}{"heart_rate": "150"}, first.Extra)
+	assert.Zero(t, first.ID)
+
+	second := records[1]
+	assert.Equal(t, "Coach's\nspecial", second.Exercise.Name)
+	assert.Zero(t, second.Exercise.Calories)
+	assert.Equal(t, map[string]interface{}{"heart_rate": nil}, second.Exercise.Extra)
+	assert.Equal(t, 2, records[0].Line)
+	assert.Equal(t, 4, second.Line)
+}
+
+func TestCSVLoader_RowErrors(t *testing.T) {
+	input := "name,type,duration,date\n" +
+		"Run,cardio,long,15/01/2024\n" +
+		"Walk\n" +
+		"Swim,cardio,30,2024-01-16,extra\n" +
+		"Row,cardio,20,2024-01-17\n"
+
+	// Rows that cannot be parsed are returned with their errors
+	records, err := NewCSVLoader().ReadRecordsFromCSV(strings.NewReader(input), "bad.csv")
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "Run", records[0].Exercise.Name)
+	assert.Equal(t, ValidationErrors{
+		{Field: "duration", Message: "must be an integer", Value: "long"},
+		{Field: "date", Message: "invalid date format, expected 2006-01-02", Value: "15/01/2024"},
+	}, records[0].Errors)
+	assert.Equal(t, ValidationErrors{{Field: "record", Message: "has 1 fields, the header has 4"}}, records[1].Errors)
+	assert.Equal(t, "Walk", records[1].Exercise.Name)
+	assert.Equal(t, ValidationErrors{{Field: "record", Message: "has 5 fields, the header has 4"}}, records[2].Errors)
+	assert.Equal(t, 30, records[2].Exercise.Duration)
+	assert.Empty(t, records[3].Errors)
+	assert.Equal(t, []int{2, 3, 4, 5}, []int{records[0].Line, records[1].Line, records[2].Line, records[3].Line})
+
+	// Loading exercises without their positions fails on them
+	csvFile := filepath.Join(t.TempDir(), "bad.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte(input), 0644))
+	_, err = NewCSVLoader().LoadFromCSV(csvFile)
+	assert.ErrorContains(t, err, "error reading line 2: validation failed: duration: must be an integer (got: long)")
+}
+
+func TestCSVLoader_Encoding(t *testing.T) {
+	// A byte order mark before the header is dropped
+	input := "\ufeffname,type,note\n" +
+		"Run,cardio,caf\xe9\n" +
+		"Caf\xe9 \"run\",cardio,ok\n" +
+		"Café,cardio,\"ok\"\n"
+
+	records, err := NewCSVLoader().ReadRecordsFromCSV(strings.NewReader(input), "latin1.csv")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	// Text that is not valid UTF-8 is reported on its row, not replaced
+	assert.Equal(t, ValidationErrors{{Field: "note", Message: "is not valid UTF-8"}}, records[0].Errors)
+	assert.Equal(t, "caf\xe9", records[0].Exercise.Extra["note"])
+	assert.Equal(t, ValidationErrors{{Field: "name", Message: "is not valid UTF-8"}}, records[1].Errors)
+	assert.Empty(t, records[2].Errors)
+	assert.Equal(t, "Café", records[2].Exercise.Name)
+
+	_, err = NewCSVLoader().ReadRecordsFromCSV(strings.NewReader("n\xe4me,type\nRun,cardio\n"), "bad.csv")
+	assert.ErrorContains(t, err, "CSV header is not valid UTF-8")
+}
+
+func TestCSVLoader_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: "CSV file is empty"},
+		{name: "no name column", input: "id,type\n1,cardio\n", expected: "no name column"},
+		{name: "duplicate column", input: "name,Name\nRun,Run\n", expected: "more than one name column"},
+		{name: "unterminated quote", input: "name\n\"Run\n", expected: "line 2: unterminated quoted field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCSVLoader().ReadRecordsFromCSV(strings.NewReader(tt.input), "bad.csv")
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+
+	for _, options := range []CSVOptions{
+		{Delimiter: ";;"},
+		{Quote: ","},
+		{Timezone: "Mars/Olympus"},
+		{ColumnMapping: map[string]string{"Name": " "}},
+	} {
+		_, err := NewCSVLoaderWithOptions(options)
+		assert.Error(t, err, "%+v", options)
+	}
+}
@@ -0,0 +1,117 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvReader reads CSV records with a configurable delimiter and quote
+// character. Quoted fields may hold delimiters, newlines and doubled quotes;
+// blank lines are skipped. Bytes that are not valid UTF-8 are kept as they are
+// for the caller to report.
+type csvReader struct {
+	reader    *bufio.Reader
+	delimiter rune
+	quote     rune
+	line      int
+}
+
+func newCSVReader(input io.Reader, delimiter, quote rune) *csvReader {
+	return &csvReader{reader: bufio.NewReader(input), delimiter: delimiter, quote: quote}
+}
+
+// Read returns the next record and the line it starts on, or io.EOF when
+// there are no more records
+func (r *csvReader) Read() ([]string, int, error) {
+	var (
+		record      []string
+		field       strings.Builder
+		start       = r.line + 1
+		fieldStart  = true
+		quoted      bool
+		inQuotes    bool
+		quoteClosed bool
+	)
+
+	// write adds the rune just read to the field, or the byte it replaced
+	write := func(c rune, size int) {
+		if c == utf8.RuneError && size == 1 {
+			r.reader.UnreadRune()
+			b, _ := r.reader.ReadByte()
+			field.WriteByte(b)
+			return
+		}
+		field.WriteRune(c)
+	}
+
+	for {
+		c, size, err := r.reader.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, start, fmt.Errorf("line %d: unterminated quoted field", start)
+			}
+			if record == nil && field.Len() == 0 && !quoted {
+				return nil, 0, io.EOF
+			}
+			return append(record, field.String()), start, nil
+		}
+		if err != nil {
+			return nil, start, err
+		}
+
+		// Line endings are \n or \r\n, also within quoted fields
+		if c == '\r' {
+			if next, _, err := r.reader.ReadRune(); err == nil {
+				if next == '\n' {
+					c = '\n'
+				} else {
+					r.reader.UnreadRune()
+				}
+			}
+		}
+
+		if inQuotes {
+			switch {
+			case c == r.quote:
+				if next, _, err := r.reader.ReadRune(); err == nil {
+					if next == r.quote {
+						field.WriteRune(c)
+						continue
+					}
+					r.reader.UnreadRune()
+				}
+				inQuotes, quoteClosed = false, true
+			case c == '\n':
+				r.line++
+				field.WriteRune(c)
+			default:
+				write(c, size)
+			}
+			continue
+		}
+
+		switch {
+		case c == r.quote && fieldStart:
+			inQuotes, quoted, fieldStart = true, true, false
+		case c == r.delimiter:
+			record = append(record, field.String())
+			field.Reset()
+			fieldStart, quoteClosed = true, false
+		case c == '\n':
+			r.line++
+			if record == nil && field.Len() == 0 && !quoted {
+				start = r.line + 1
+				continue
+			}
+			return append(record, field.String()), start, nil
+		case quoteClosed:
+			return nil, start, fmt.Errorf("line %d: unexpected %q after quoted field", r.line+1, c)
+		default:
+			write(c, size)
+			fieldStart = false
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package loader
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -13,6 +18,111 @@ type Exercise struct {
 	Calories    int       `json:"calories" csv:"calories"`
 	Date        time.Time `json:"date" csv:"date"`
 	Description string    `json:"description" csv:"description"`
+
+	// Extra holds columns beyond the fields above, keyed by column name. In
+	// JSON they appear alongside the fields, and an extra column named like a
+	// field replaces its value.
+	Extra map[string]interface{} `json:"-" csv:"-"`
+}
+
+// exerciseFields are the JSON names of the Exercise fields in their order
+var exerciseFields = []string{"id", "name", "type", "duration", "calories", "date", "description"}
+
+// isExerciseField reports whether a JSON key names an Exercise field; like
+// encoding/json, it ignores case
+func isExerciseField(key string) bool {
+	for _, field := range exerciseFields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the fields followed by the extra columns
+func (e Exercise) MarshalJSON() ([]byte, error) {
+	type plain Exercise
+	if len(e.Extra) == 0 {
+		return json.Marshal(plain(e))
+	}
+
+	values := map[string]interface{}{
+		"id":          e.ID,
+		"name":        e.Name,
+		"type":        e.Type,
+		"duration":    e.Duration,
+		"calories":    e.Calories,
+		"date":        e.Date,
+		"description": e.Description,
+	}
+	keys := append([]string(nil), exerciseFields...)
+	extra := make([]string, 0, len(e.Extra))
+	for key, value := range e.Extra {
+		if _, ok := values[key]; !ok {
+			extra = append(extra, key)
+		}
+		values[key] = value
+	}
+	sort.Strings(extra)
+	keys = append(keys, extra...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(values[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode column %s: %w", key, err)
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes the fields and keeps any other keys as extra columns
+func (e *Exercise) UnmarshalJSON(data []byte) error {
+	type plain Exercise
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+
+	var columns map[string]json.RawMessage
+	if err := json.Unmarshal(data, &columns); err != nil {
+		return err
+	}
+	for key, raw := range columns {
+		if isExerciseField(key) {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if e.Extra == nil {
+			e.Extra = make(map[string]interface{})
+		}
+		e.Extra[key] = value
+	}
+	return nil
+}
+
+// SourceRecord is an exercise with the position it was loaded from. Errors
+// holds the problems found reading it, such as values that could not be
+// parsed; such a record is quarantined rather than loaded.
+type SourceRecord struct {
+	Exercise Exercise
+	File     string
+	Line     int
+	Errors   ValidationErrors
 }
 
 // ExerciseLoader defines the interface for loading exercise data
@@ -21,3 +131,16 @@ type ExerciseLoader interface {
 	LoadFromJSON(filename string) ([]Exercise, error)
 	Validate(exercise Exercise) error
 }
+
+// exercisesOf returns the exercises of loaded records, failing on the first
+// record that could not be read
+func exercisesOf(records []SourceRecord) ([]Exercise, error) {
+	exercises := make([]Exercise, len(records))
+	for i, record := range records {
+		if record.Errors.HasErrors() {
+			return nil, fmt.Errorf("error reading line %d: %w", record.Line, record.Errors)
+		}
+		exercises[i] = record.Exercise
+	}
+	return exercises, nil
+}
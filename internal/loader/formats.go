@@ -0,0 +1,146 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FormatOptions configures the readers of formats that take options, and
+// the compression of files loaded by name, which is detected when empty
+type FormatOptions struct {
+	CSV         CSVOptions `json:"csv,omitempty"`
+	Compression string     `json:"compression,omitempty"`
+}
+
+// FormatReader returns a reader of the records in data of a format,
+// attributing them to the named source
+type FormatReader func(input io.Reader, source string, options FormatOptions) (RecordReader, error)
+
+var (
+	formatsMutex sync.RWMutex
+	formats      = map[string]FormatReader{}
+
+	// formatExtensions maps file extensions to the format of the file
+	formatExtensions = map[string]string{}
+)
+
+func init() {
+	RegisterFormat("csv", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		csvLoader, err := NewCSVLoaderWithOptions(options.CSV)
+		if err != nil {
+			return nil, err
+		}
+		return csvLoader.NewRecordReader(input, source)
+	}, ".csv")
+	RegisterFormat("json", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		return NewJSONLoader().NewRecordReader(input, source)
+	}, ".json")
+	RegisterFormat("ndjson", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		return NewJSONLoader().NewNDJSONRecordReader(input, source), nil
+	}, ".ndjson", ".jsonl")
+	RegisterFormat("avro", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		return NewAvroRecordReader(input, source)
+	}, ".avro")
+	RegisterFormat("parquet", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		return NewParquetRecordReader(input, source)
+	}, ".parquet")
+}
+
+// RegisterFormat makes a format available by name and by the extensions of
+// its files, replacing any format registered under the same name
+func RegisterFormat(name string, reader FormatReader, extensions ...string) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+
+	name = strings.ToLower(name)
+	formats[name] = reader
+	for _, extension := range extensions {
+		formatExtensions[strings.ToLower(extension)] = name
+	}
+}
+
+// Formats returns the names of the registered formats in order
+func Formats() []string {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatOf returns the format of a file named with a registered extension,
+// looking past a compression extension
+func FormatOf(filename string) (string, bool) {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+
+	format, ok := formatExtensions[strings.ToLower(filepath.Ext(trimCompressionExt(filename)))]
+	return format, ok
+}
+
+// NewFormatReader returns a reader of the records in data of the named format
+func NewFormatReader(format string, input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+	formatsMutex.RLock()
+	reader, ok := formats[strings.ToLower(format)]
+	formatsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return reader(input, source, options)
+}
+
+// LoadRecords loads the records of a file, in the named format or, when the
+// format is empty, in the format of its extension
+func LoadRecords(filename, format string, options FormatOptions) ([]SourceRecord, error) {
+	if format == "" {
+		var ok bool
+		if format, ok = FormatOf(filename); !ok {
+			return nil, fmt.Errorf("cannot tell the format of %s from its extension", filename)
+		}
+	}
+
+	input, err := OpenInput(filename, options.Compression)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	reader, err := NewFormatReader(format, input, filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return readAllRecords(reader)
+}
+
+// exerciseFromValues builds an exercise from the column values of a record
+// read from a typed format, keeping unknown columns as extra columns. Dates
+// may be times or text in RFC 3339 or 2006-01-02 form. Values that do not fit
+// their field are returned as the errors of the record.
+func exerciseFromValues(values map[string]interface{}) (Exercise, ValidationErrors) {
+	for key, value := range values {
+		if !strings.EqualFold(key, "date") {
+			continue
+		}
+		if text, ok := value.(string); ok {
+			if date, err := time.Parse("2006-01-02", text); err == nil {
+				values[key] = date
+			}
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return Exercise{}, ValidationErrors{{Field: "record", Message: err.Error()}}
+	}
+	return decodeExercise(data)
+}
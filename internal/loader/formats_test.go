@@ -0,0 +1,138 @@
+package loader
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatRegistry(t *testing.T) {
+	assert.Subset(t, Formats(), []string{"avro", "csv", "json", "ndjson", "parquet"})
+
+	for filename, expected := range map[string]string{
+		"runs.csv":         "csv",
+		"runs.JSON":        "json",
+		"runs.jsonl":       "ndjson",
+		"dir/runs.parquet": "parquet",
+		"runs.avro":        "avro",
+	} {
+		format, ok := FormatOf(filename)
+		assert.True(t, ok, filename)
+		assert.Equal(t, expected, format, filename)
+	}
+	_, ok := FormatOf("runs.txt")
+	assert.False(t, ok)
+
+	_, err := NewFormatReader("xml", strings.NewReader(""), "runs.xml", FormatOptions{})
+	assert.ErrorContains(t, err, `unsupported format "xml", expected one of avro, csv`)
+
+	// Formats take their options
+	reader, err := NewFormatReader("CSV", strings.NewReader("name;type\nRun;cardio\n"), "runs.csv", FormatOptions{CSV: CSVOptions{Delimiter: ";"}})
+	require.NoError(t, err)
+	record, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "cardio", record.Exercise.Type)
+
+	// New formats can be registered
+	RegisterFormat("lines", func(input io.Reader, source string, options FormatOptions) (RecordReader, error) {
+		return NewJSONLoader().NewNDJSONRecordReader(input, source), nil
+	}, ".lines")
+	defer func() {
+		formatsMutex.Lock()
+		delete(formats, "lines")
+		delete(formatExtensions, ".lines")
+		formatsMutex.Unlock()
+	}()
+
+	linesFile := filepath.Join(t.TempDir(), "runs.lines")
+	require.NoError(t, os.WriteFile(linesFile, []byte(`{"name": "Run"}`+"\n"), 0644))
+	records, err := LoadRecords(linesFile, "", FormatOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, linesFile, records[0].File)
+
+	_, err = LoadRecords(filepath.Join(t.TempDir(), "runs.txt"), "", FormatOptions{})
+	assert.ErrorContains(t, err, "cannot tell the format")
+}
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "Exercise",
+	"namespace": "ducklake",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "name", "type": "string"},
+		{"name": "type", "type": ["null", "string"]},
+		{"name": "duration", "type": "int"},
+		{"name": "date", "type": {"type": "int", "logicalType": "date"}},
+		{"name": "heart_rate", "type": ["null", "double"]},
+		{"name": "equipment", "type": ["null", {
+			"type": "record",
+			"name": "Equipment",
+			"fields": [{"name": "label", "type": "bytes"}]
+		}]}
+	]
+}`
+
+func writeTestAvro(t *testing.T, records []map[string]interface{}) []byte {
+	var data bytes.Buffer
+	writer, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &data, Schema: testAvroSchema})
+	require.NoError(t, err)
+	require.NoError(t, writer.Append(records))
+	return data.Bytes()
+}
+
+func TestAvroRecordReader(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	data := writeTestAvro(t, []map[string]interface{}{
+		{
+			"id": int64(1), "name": "Run", "type": goavro.Union("string", "cardio"), "duration": int32(30), "date": date,
+			"heart_rate": goavro.Union("double", 150.5),
+			"equipment":  goavro.Union("ducklake.Equipment", map[string]interface{}{"label": []byte("treadmill")}),
+		},
+		{
+			"id": int64(2), "name": "Lift", "type": nil, "duration": int32(45), "date": date.AddDate(0, 0, 1),
+			"heart_rate": nil, "equipment": nil,
+		},
+	})
+
+	records, err := readTestRecords(t, "avro", data)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	run := records[0]
+	assert.Equal(t, 1, run.Line)
+	assert.Equal(t, "runs.avro", run.File)
+	assert.Equal(t, 1, run.Exercise.ID)
+	assert.Equal(t, "cardio", run.Exercise.Type)
+	assert.Equal(t, 30, run.Exercise.Duration)
+	assert.True(t, date.Equal(run.Exercise.Date))
+	assert.Equal(t, 150.5, run.Exercise.Extra["heart_rate"])
+	assert.Equal(t, map[string]interface{}{"label": "treadmill"}, run.Exercise.Extra["equipment"])
+
+	lift := records[1]
+	assert.Equal(t, 2, lift.Line)
+	assert.Empty(t, lift.Exercise.Type)
+	assert.Nil(t, lift.Exercise.Extra["heart_rate"])
+
+	_, err = NewAvroRecordReader(strings.NewReader("not avro"), "runs.avro")
+	assert.ErrorContains(t, err, "failed to read Avro")
+}
+
+// readTestRecords reads every record of data in a format
+func readTestRecords(t *testing.T, format string, data []byte) ([]SourceRecord, error) {
+	t.Helper()
+	reader, err := NewFormatReader(format, bytes.NewReader(data), "runs."+format, FormatOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return readAllRecords(reader)
+}
@@ -1,9 +1,14 @@
 package loader
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"time"
 )
 
 type JSONLoader struct{}
@@ -13,17 +18,141 @@ func NewJSONLoader() *JSONLoader {
 }
 
 func (j *JSONLoader) LoadFromJSON(filename string) ([]Exercise, error) {
+	records, err := j.LoadRecordsFromJSON(filename)
+	if err != nil {
+		return nil, err
+	}
+	return exercisesOf(records)
+}
+
+// LoadRecordsFromJSON loads exercises from a JSON array together with the line
+// each array element starts on
+func (j *JSONLoader) LoadRecordsFromJSON(filename string) ([]SourceRecord, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open JSON file: %w", err)
 	}
 	defer file.Close()
 
-	var exercises []Exercise
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&exercises); err != nil {
+	return j.ReadRecordsFromJSON(file, filename)
+}
+
+// ReadRecordsFromJSON reads exercises from a JSON array, attributing them to
+// the named source
+func (j *JSONLoader) ReadRecordsFromJSON(reader io.Reader, source string) ([]SourceRecord, error) {
+	records, err := j.NewRecordReader(reader, source)
+	if err != nil {
+		return nil, err
+	}
+	return readAllRecords(records)
+}
+
+// NewRecordReader returns a reader of the exercises in a JSON array, which
+// decodes one array element at a time
+func (j *JSONLoader) NewRecordReader(reader io.Reader, source string) (RecordReader, error) {
+	tracker := newLineTracker(reader)
+	decoder := json.NewDecoder(tracker)
+	if token, err := decoder.Token(); err != nil {
 		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	} else if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("failed to decode JSON: expected an array of exercises")
+	}
+
+	return &jsonArrayReader{decoder: decoder, tracker: tracker, source: source}, nil
+}
+
+type jsonArrayReader struct {
+	decoder *json.Decoder
+	tracker *lineTracker
+	source  string
+	done    bool
+}
+
+func (r *jsonArrayReader) Next() (SourceRecord, error) {
+	if r.done {
+		return SourceRecord{}, io.EOF
+	}
+	if !r.decoder.More() {
+		r.done = true
+		if _, err := r.decoder.Token(); err != nil {
+			return SourceRecord{}, fmt.Errorf("failed to decode JSON: %w", err)
+		}
+		return SourceRecord{}, io.EOF
+	}
+
+	// An element that is well-formed JSON but not an exercise is a record
+	// with errors; the elements after it can still be read
+	start := r.decoder.InputOffset()
+	var data json.RawMessage
+	if err := r.decoder.Decode(&data); err != nil {
+		return SourceRecord{}, fmt.Errorf("failed to decode JSON: %w", err)
 	}
+	record := SourceRecord{File: r.source, Line: r.tracker.elementLine(start)}
+	record.Exercise, record.Errors = decodeExercise(data)
+	return record, nil
+}
+
+// LoadRecordsFromNDJSON loads exercises from newline-delimited JSON, one
+// object per line
+func (j *JSONLoader) LoadRecordsFromNDJSON(filename string) ([]SourceRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NDJSON file: %w", err)
+	}
+	defer file.Close()
+
+	return readAllRecords(j.NewNDJSONRecordReader(file, filename))
+}
+
+// NewNDJSONRecordReader returns a reader of exercises from newline-delimited
+// JSON. Blank lines are skipped.
+func (j *JSONLoader) NewNDJSONRecordReader(reader io.Reader, source string) RecordReader {
+	return &ndjsonReader{reader: bufio.NewReader(reader), source: source}
+}
 
-	return exercises, nil
+type ndjsonReader struct {
+	reader *bufio.Reader
+	source string
+	line   int
+}
+
+func (r *ndjsonReader) Next() (SourceRecord, error) {
+	for {
+		data, err := r.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return SourceRecord{}, fmt.Errorf("failed to read NDJSON: %w", err)
+		}
+		if len(data) == 0 && err == io.EOF {
+			return SourceRecord{}, io.EOF
+		}
+		r.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		record := SourceRecord{File: r.source, Line: r.line}
+		record.Exercise, record.Errors = decodeExercise(data)
+		return record, nil
+	}
+}
+
+// decodeExercise decodes an exercise from a JSON object, returning the
+// problems found as the errors of its record
+func decodeExercise(data []byte) (Exercise, ValidationErrors) {
+	var exercise Exercise
+	err := json.Unmarshal(data, &exercise)
+	if err == nil {
+		return exercise, nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return exercise, ValidationErrors{{Field: typeErr.Field, Message: fmt.Sprintf("must be %s, not a JSON %s", typeErr.Type, typeErr.Value)}}
+	case errors.As(err, &timeErr):
+		return exercise, ValidationErrors{{Field: "date", Message: "invalid date format, expected RFC 3339", Value: timeErr.Value}}
+	}
+	return exercise, ValidationErrors{{Field: "record", Message: fmt.Sprintf("invalid JSON: %v", err)}}
 }
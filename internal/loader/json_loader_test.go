@@ -1,6 +1,9 @@
 package loader
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -34,3 +37,54 @@ func TestJSONLoader_LoadFromJSON_FileNotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to open JSON file")
 }
+
+func TestJSONLoader_LoadRecordsFromJSON(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "exercises.json")
+	content := `[
+  {"id": 1, "name": "Run", "type": "cardio", "duration": 30, "calories": 300, "date": "2024-01-15T00:00:00Z"},
+
+  {
+    "id": 2,
+    "name": "Lift",
+    "type": "strength",
+    "duration": 20,
+    "calories": 150,
+    "date": "2024-01-16T00:00:00Z"
+  }, {"id": 3, "name": "Stretch", "type": "flexibility", "duration": 10, "calories": 30, "date": "2024-01-17T00:00:00Z"}
+]`
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	records, err := NewJSONLoader().LoadRecordsFromJSON(filename)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, 2, records[0].Line)
+	assert.Equal(t, 4, records[1].Line)
+	assert.Equal(t, 11, records[2].Line)
+	assert.Equal(t, "Lift", records[1].Exercise.Name)
+	assert.Equal(t, filename, records[2].File)
+
+	require.NoError(t, os.WriteFile(filename, []byte(`{"id": 1}`), 0644))
+	_, err = NewJSONLoader().LoadRecordsFromJSON(filename)
+	assert.ErrorContains(t, err, "expected an array")
+}
+
+func TestExercise_JSONExtraColumns(t *testing.T) {
+	data := []byte(`{"id":1,"name":"Rowing","type":"cardio","duration":20,"calories":200,"date":"2024-01-15T00:00:00Z","description":"","intensity":"high","heart_rate":150}`)
+
+	var exercise Exercise
+	require.NoError(t, json.Unmarshal(data, &exercise))
+	assert.Equal(t, "Rowing", exercise.Name)
+	assert.Equal(t, map[string]interface{}{"intensity": "high", "heart_rate": float64(150)}, exercise.Extra)
+
+	// Extra columns are written after the fields in name order
+	encoded, err := json.Marshal(exercise)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1,"name":"Rowing","type":"cardio","duration":20,"calories":200,"date":"2024-01-15T00:00:00Z","description":"","heart_rate":150,"intensity":"high"}`, string(encoded))
+
+	// An extra column named like a field replaces its value
+	exercise.Extra = map[string]interface{}{"calories": 200.5}
+	encoded, err = json.Marshal(exercise)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"calories":200.5`)
+	assert.NotContains(t, string(encoded), `"calories":200,`)
+}
@@ -0,0 +1,277 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// parquetReadRows is the number of rows decoded at a time
+const parquetReadRows = 256
+
+// julianEpoch is the Julian day of the Unix epoch, for INT96 timestamps
+const julianEpoch = 2440588
+
+// parquetCodecs are the compression codecs the Parquet reader can decode
+var parquetCodecs = map[format.CompressionCodec]bool{
+	format.Uncompressed: true,
+	format.Snappy:       true,
+	format.Gzip:         true,
+	format.Brotli:       true,
+	format.Zstd:         true,
+	format.Lz4Raw:       true,
+}
+
+// NewParquetRecordReader returns a reader of the exercises in a Parquet file,
+// which decodes a few rows at a time. Only flat schemas are supported;
+// columns are matched to exercises by name and a record's Line is its row.
+// Files using nested or repeated columns, or a compression codec or encoding
+// the reader cannot decode, are rejected before any row is read. Files are
+// read in place when the input can seek, and buffered otherwise.
+func NewParquetRecordReader(input io.Reader, source string) (RecordReader, error) {
+	data, size, err := parquetInput(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Parquet: %w", err)
+	}
+
+	file, err := openParquetFile(data, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Parquet: %w", err)
+	}
+	columns, err := parquetColumns(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Parquet: %w", err)
+	}
+	if err := checkParquetChunks(file, columns); err != nil {
+		return nil, fmt.Errorf("failed to read Parquet: %w", err)
+	}
+
+	return &parquetReader{
+		rowGroups: file.RowGroups(),
+		columns:   columns,
+		source:    source,
+		buffer:    make([]parquet.Row, parquetReadRows),
+	}, nil
+}
+
+// parquetInput returns random access to a Parquet file and its size
+func parquetInput(input io.Reader) (io.ReaderAt, int64, error) {
+	if file, ok := input.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		return file, size, nil
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// openParquetFile reads the metadata of a Parquet file. The library panics on
+// some malformed schemas, which are reported as errors.
+func openParquetFile(data io.ReaderAt, size int64) (file *parquet.File, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			file, err = nil, fmt.Errorf("invalid file metadata: %v", r)
+		}
+	}()
+	return parquet.OpenFile(data, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+}
+
+// parquetColumns returns the columns of a flat schema in the order of their
+// values in a row
+func parquetColumns(file *parquet.File) ([]*parquet.Column, error) {
+	columns := file.Root().Columns()
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("schema has no columns")
+	}
+
+	for _, column := range columns {
+		if !column.Leaf() {
+			return nil, fmt.Errorf("column %s is nested, only flat schemas are supported", column.Name())
+		}
+		if column.Repeated() {
+			return nil, fmt.Errorf("column %s is repeated, only flat schemas are supported", column.Name())
+		}
+	}
+	return columns, nil
+}
+
+// checkParquetChunks rejects column chunks that cannot be read: chunks kept
+// in other files, and compression codecs or encodings that cannot be decoded
+func checkParquetChunks(file *parquet.File, columns []*parquet.Column) error {
+	for _, rowGroup := range file.Metadata().RowGroups {
+		for i, chunk := range rowGroup.Columns {
+			name := strings.Join(chunk.MetaData.PathInSchema, ".")
+			if i < len(columns) {
+				name = columns[i].Name()
+			}
+
+			if chunk.FilePath != "" {
+				return fmt.Errorf("column %s is stored in another file, %s", name, chunk.FilePath)
+			}
+			if !parquetCodecs[chunk.MetaData.Codec] {
+				return fmt.Errorf("column %s uses the unsupported compression codec %s", name, chunk.MetaData.Codec)
+			}
+			for _, used := range chunk.MetaData.Encoding {
+				if _, unsupported := parquet.LookupEncoding(used).(encoding.NotSupported); unsupported {
+					return fmt.Errorf("column %s uses the unsupported encoding %s", name, used)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type parquetReader struct {
+	rowGroups []parquet.RowGroup
+	columns   []*parquet.Column
+	source    string
+
+	// rows reads the current row group; buffer holds rows decoded from it
+	// and next is the position of the next row to return
+	rows     parquet.Rows
+	rowGroup int
+	buffer   []parquet.Row
+	buffered int
+	next     int
+	count    int
+}
+
+func (r *parquetReader) Next() (SourceRecord, error) {
+	for r.next >= r.buffered {
+		if err := r.readRows(); err != nil {
+			return SourceRecord{}, err
+		}
+	}
+
+	row := r.buffer[r.next]
+	r.next++
+	r.count++
+
+	values := make(map[string]interface{}, len(r.columns))
+	for _, value := range row {
+		if column := value.Column(); column >= 0 && column < len(r.columns) {
+			values[r.columns[column].Name()] = parquetValue(r.columns[column], value)
+		}
+	}
+
+	record := SourceRecord{File: r.source, Line: r.count}
+	record.Exercise, record.Errors = exerciseFromValues(values)
+	return record, nil
+}
+
+// readRows decodes the next rows into the buffer, moving on to the next row
+// group when the current one has no more. It returns io.EOF after the last.
+func (r *parquetReader) readRows() error {
+	if r.rows == nil {
+		if r.rowGroup >= len(r.rowGroups) {
+			return io.EOF
+		}
+		r.rows = r.rowGroups[r.rowGroup].Rows()
+	}
+
+	n, err := r.rows.ReadRows(r.buffer)
+	r.buffered, r.next = n, 0
+	if err == io.EOF || err == nil && n == 0 {
+		r.rows.Close()
+		r.rows = nil
+		r.rowGroup++
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Parquet row group %d: %w", r.rowGroup, err)
+	}
+	return nil
+}
+
+// parquetValue converts a value to the column's logical type: dates and
+// timestamps become times, decimals floats and bytes text
+func parquetValue(column *parquet.Column, value parquet.Value) interface{} {
+	if value.IsNull() {
+		return nil
+	}
+
+	var physical interface{}
+	switch value.Kind() {
+	case parquet.Boolean:
+		physical = value.Boolean()
+	case parquet.Int32:
+		physical = int64(value.Int32())
+	case parquet.Int64:
+		physical = value.Int64()
+	case parquet.Int96:
+		int96 := value.Int96()
+		nanos := int64(uint64(int96[1])<<32 | uint64(int96[0]))
+		days := int64(int96[2]) - julianEpoch
+		return time.Unix(days*86400, nanos).UTC()
+	case parquet.Float:
+		physical = float64(value.Float())
+	case parquet.Double:
+		physical = value.Double()
+	default:
+		physical = value.ByteArray()
+	}
+
+	logical := column.Type().LogicalType()
+	switch {
+	case logical == nil:
+	case logical.Date != nil:
+		if days, ok := physical.(int64); ok {
+			return time.Unix(days*86400, 0).UTC()
+		}
+	case logical.Timestamp != nil:
+		if number, ok := physical.(int64); ok {
+			switch unit := logical.Timestamp.Unit; {
+			case unit.Millis != nil:
+				return time.UnixMilli(number).UTC()
+			case unit.Micros != nil:
+				return time.UnixMicro(number).UTC()
+			default:
+				return time.Unix(0, number).UTC()
+			}
+		}
+	case logical.Decimal != nil:
+		return decimalValue(physical, int(logical.Decimal.Scale))
+	}
+
+	if data, ok := physical.([]byte); ok {
+		return string(data)
+	}
+	return physical
+}
+
+// decimalValue converts the unscaled value of a decimal to a float
+func decimalValue(value interface{}, scale int) interface{} {
+	unscaled := new(big.Int)
+	switch number := value.(type) {
+	case int64:
+		unscaled.SetInt64(number)
+	case []byte:
+		// Big-endian two's complement
+		unscaled.SetBytes(number)
+		if len(number) > 0 && number[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(number))))
+		}
+	default:
+		return value
+	}
+
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	result, _ := new(big.Float).Quo(new(big.Float).SetInt(unscaled), new(big.Float).SetInt(divisor)).Float64()
+	return result
+}
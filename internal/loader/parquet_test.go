@@ -0,0 +1,213 @@
+package loader
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parquetTestData holds Parquet files written by other implementations
+const parquetTestData = "../../test/testdata/parquet"
+
+type testParquetExercise struct {
+	Name      string   `parquet:"name"`
+	Type      *string  `parquet:"type,optional,dict"`
+	Duration  int32    `parquet:"duration"`
+	Calories  int64    `parquet:"calories"`
+	Date      int32    `parquet:"date,date"`
+	Finished  int64    `parquet:"finished,timestamp(millisecond)"`
+	HeartRate *float64 `parquet:"heart_rate,optional"`
+}
+
+// writeTestParquet writes rows to a Parquet file with row groups of at most
+// two rows
+func writeTestParquet(t *testing.T, rows []testParquetExercise, options ...parquet.WriterOption) []byte {
+	var file bytes.Buffer
+	writer := parquet.NewGenericWriter[testParquetExercise](&file, append([]parquet.WriterOption{parquet.MaxRowsPerRowGroup(2)}, options...)...)
+	_, err := writer.Write(rows)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return file.Bytes()
+}
+
+func TestParquetRecordReader(t *testing.T) {
+	day := func(d int) int32 {
+		return int32(time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+	}
+	cardio, strength := "cardio", "strength"
+	heartRate, squatRate := 150.5, 120.0
+	finished := time.Date(2024, 1, 15, 7, 30, 0, 0, time.UTC)
+	data := writeTestParquet(t, []testParquetExercise{
+		{Name: "Run", Type: &cardio, Duration: 30, Calories: 300, Date: day(15), Finished: finished.UnixMilli(), HeartRate: &heartRate},
+		{Name: "Lift", Duration: 45, Calories: 200, Date: day(16)},
+		{Name: "Squat", Type: &strength, Duration: 20, Calories: 150, Date: day(17), HeartRate: &squatRate},
+	}, parquet.Compression(&parquet.Snappy))
+
+	check := func(t *testing.T, records []SourceRecord) {
+		require.Len(t, records, 3)
+		assert.Equal(t, []int{1, 2, 3}, []int{records[0].Line, records[1].Line, records[2].Line})
+
+		run := records[0].Exercise
+		assert.Empty(t, records[0].Errors)
+		assert.Equal(t, "Run", run.Name)
+		assert.Equal(t, "cardio", run.Type)
+		assert.Equal(t, 30, run.Duration)
+		assert.Equal(t, 300, run.Calories)
+		assert.True(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC).Equal(run.Date))
+		assert.Equal(t, 150.5, run.Extra["heart_rate"])
+		assert.Equal(t, "2024-01-15T07:30:00Z", run.Extra["finished"])
+
+		lift := records[1].Exercise
+		assert.Equal(t, "Lift", lift.Name)
+		assert.Empty(t, lift.Type)
+		assert.Nil(t, lift.Extra["heart_rate"])
+
+		squat := records[2].Exercise
+		assert.Equal(t, "strength", squat.Type)
+		assert.Equal(t, float64(120), squat.Extra["heart_rate"])
+	}
+
+	// Read in place from a file
+	parquetFile := filepath.Join(t.TempDir(), "runs.parquet")
+	require.NoError(t, os.WriteFile(parquetFile, data, 0644))
+	records, err := LoadRecords(parquetFile, "", FormatOptions{})
+	require.NoError(t, err)
+	check(t, records)
+
+	// Buffered from a stream
+	reader, err := NewParquetRecordReader(io.MultiReader(bytes.NewReader(data)), "runs.parquet")
+	require.NoError(t, err)
+	records, err = readAllRecords(reader)
+	require.NoError(t, err)
+	check(t, records)
+}
+
+func TestParquetRecordReader_OtherWriters(t *testing.T) {
+	timestamp := func(month, minute int) string {
+		return time.Date(2009, time.Month(month), 1, 0, minute, 0, 0, time.UTC).Format(time.RFC3339)
+	}
+
+	tests := []struct {
+		file   string
+		rows   int
+		first  Exercise
+		second Exercise
+	}{
+		{
+			file: "alltypes_plain.parquet",
+			rows: 8,
+			first: Exercise{ID: 4, Extra: map[string]interface{}{
+				"bool_col": true, "tinyint_col": float64(0), "smallint_col": float64(0), "int_col": float64(0),
+				"bigint_col": float64(0), "float_col": float64(0), "double_col": float64(0),
+				"date_string_col": "03/01/09", "string_col": "0", "timestamp_col": timestamp(3, 0),
+			}},
+			second: Exercise{ID: 5, Extra: map[string]interface{}{
+				"bool_col": false, "tinyint_col": float64(1), "smallint_col": float64(1), "int_col": float64(1),
+				"bigint_col": float64(10), "float_col": float64(float32(1.1)), "double_col": 10.1,
+				"date_string_col": "03/01/09", "string_col": "1", "timestamp_col": timestamp(3, 1),
+			}},
+		},
+		{
+			file:   "alltypes_plain.snappy.parquet",
+			rows:   2,
+			first:  Exercise{ID: 6},
+			second: Exercise{ID: 7},
+		},
+		{
+			file:   "alltypes_dictionary.parquet",
+			rows:   2,
+			first:  Exercise{ID: 0},
+			second: Exercise{ID: 1},
+		},
+		{
+			file:   "delta_length_byte_array.parquet",
+			rows:   1000,
+			first:  Exercise{Extra: map[string]interface{}{"FRUIT": "apple_banana_mango0"}},
+			second: Exercise{Extra: map[string]interface{}{"FRUIT": "apple_banana_mango1"}},
+		},
+		{
+			file:   "lz4_raw_compressed.parquet",
+			rows:   4,
+			first:  Exercise{Extra: map[string]interface{}{"c0": float64(1593604800), "c1": "abc", "v11": float64(42)}},
+			second: Exercise{Extra: map[string]interface{}{"c0": float64(1593604800), "c1": "def", "v11": 7.7}},
+		},
+		{
+			file:   "int32_decimal.parquet",
+			rows:   24,
+			first:  Exercise{Extra: map[string]interface{}{"value": float64(1)}},
+			second: Exercise{Extra: map[string]interface{}{"value": float64(2)}},
+		},
+		{
+			file:   "fixed_length_decimal.parquet",
+			rows:   24,
+			first:  Exercise{Extra: map[string]interface{}{"value": float64(1)}},
+			second: Exercise{Extra: map[string]interface{}{"value": float64(2)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			records, err := LoadRecords(filepath.Join(parquetTestData, tt.file), "", FormatOptions{})
+			require.NoError(t, err)
+			require.Len(t, records, tt.rows)
+			for _, record := range records {
+				assert.Empty(t, record.Errors)
+			}
+
+			assert.Equal(t, tt.first.ID, records[0].Exercise.ID)
+			assert.Equal(t, tt.second.ID, records[1].Exercise.ID)
+			for column, value := range tt.first.Extra {
+				assert.Equal(t, value, records[0].Exercise.Extra[column], column)
+			}
+			for column, value := range tt.second.Extra {
+				assert.Equal(t, value, records[1].Exercise.Extra[column], column)
+			}
+		})
+	}
+}
+
+// lzoCodec stores pages as they are but marks them as LZO compressed
+type lzoCodec struct{}
+
+func (lzoCodec) String() string                            { return "LZO" }
+func (lzoCodec) CompressionCodec() format.CompressionCodec { return format.LZO }
+func (lzoCodec) Encode(dst, src []byte) ([]byte, error)    { return append(dst[:0], src...), nil }
+func (lzoCodec) Decode(dst, src []byte) ([]byte, error)    { return append(dst[:0], src...), nil }
+
+func TestParquetRecordReader_Errors(t *testing.T) {
+	_, err := NewParquetRecordReader(bytes.NewReader([]byte("PAR1 not parquet at all")), "bad.parquet")
+	assert.ErrorContains(t, err, "failed to read Parquet")
+
+	_, err = NewParquetRecordReader(bytes.NewReader([]byte("PAR1")), "short.parquet")
+	assert.ErrorContains(t, err, "failed to read Parquet")
+
+	// Nested and repeated columns are not supported
+	for file, column := range map[string]string{
+		"datapage_v2.snappy.parquet": "e",
+		"list_columns.parquet":       "int64_list",
+	} {
+		_, err := LoadRecords(filepath.Join(parquetTestData, file), "", FormatOptions{})
+		assert.ErrorContains(t, err, "column "+column+" is nested, only flat schemas are supported", file)
+	}
+
+	// Compression codecs that cannot be decoded are rejected up front
+	data := writeTestParquet(t, []testParquetExercise{{Name: "Run"}}, parquet.Compression(lzoCodec{}))
+	_, err = NewParquetRecordReader(bytes.NewReader(data), "lzo.parquet")
+	assert.ErrorContains(t, err, "column name uses the unsupported compression codec LZO")
+
+	// Corrupt pages fail when their row group is read
+	data = writeTestParquet(t, []testParquetExercise{{Name: "Run", Duration: 30}}, parquet.Compression(&parquet.Snappy))
+	copy(data[4:], bytes.Repeat([]byte{0xff}, 16))
+	reader, err := NewParquetRecordReader(bytes.NewReader(data), "corrupt.parquet")
+	require.NoError(t, err)
+	_, err = reader.Next()
+	assert.ErrorContains(t, err, "failed to read Parquet row group 0")
+}
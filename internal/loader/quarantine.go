@@ -0,0 +1,314 @@
+package loader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuarantinedRecord is a rejected exercise kept for review
+type QuarantinedRecord struct {
+	ID            string           `json:"id"`
+	Exercise      Exercise         `json:"exercise"`
+	Errors        ValidationErrors `json:"errors"`
+	SourceFile    string           `json:"source_file"`
+	SourceLine    int              `json:"source_line"`
+	QuarantinedAt time.Time        `json:"quarantined_at"`
+	UpdatedAt     time.Time        `json:"updated_at,omitempty"`
+}
+
+// Quarantine stores rejected records as JSON files in a directory so that
+// they can be listed, fixed and re-ingested
+type Quarantine struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func NewQuarantine(dir string) (*Quarantine, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	return &Quarantine{dir: dir}, nil
+}
+
+// Separate validates loaded records, quarantines the invalid ones and those
+// that could not be read, and returns the valid exercises
+func (q *Quarantine) Separate(records []SourceRecord, validator *Validator) ([]Exercise, []QuarantinedRecord, error) {
+	valid := make([]Exercise, 0, len(records))
+	quarantined := make([]QuarantinedRecord, 0)
+
+	for _, record := range records {
+		validationErrors := recordErrors(record, validator)
+		if !validationErrors.HasErrors() {
+			valid = append(valid, record.Exercise)
+			continue
+		}
+
+		rejected, err := q.Add(record, validationErrors)
+		if err != nil {
+			return nil, nil, err
+		}
+		quarantined = append(quarantined, *rejected)
+	}
+
+	return valid, quarantined, nil
+}
+
+// Add quarantines a record with its validation errors
+func (q *Quarantine) Add(record SourceRecord, validationErrors ValidationErrors) (*QuarantinedRecord, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	id, err := newQuarantineID()
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := &QuarantinedRecord{
+		ID:            id,
+		Exercise:      record.Exercise,
+		Errors:        validationErrors,
+		SourceFile:    record.File,
+		SourceLine:    record.Line,
+		QuarantinedAt: time.Now(),
+	}
+	if err := q.write(rejected); err != nil {
+		return nil, err
+	}
+	return rejected, nil
+}
+
+// List returns the quarantined records, oldest first
+func (q *Quarantine) List() ([]QuarantinedRecord, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantine: %w", err)
+	}
+
+	records := make([]QuarantinedRecord, 0, len(paths))
+	for _, path := range paths {
+		record, err := q.read(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].QuarantinedAt.Equal(records[j].QuarantinedAt) {
+			return records[i].QuarantinedAt.Before(records[j].QuarantinedAt)
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records, nil
+}
+
+// Get returns a quarantined record. Unknown IDs return an error wrapping
+// os.ErrNotExist.
+func (q *Quarantine) Get(id string) (*QuarantinedRecord, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.read(id)
+}
+
+// Fix applies a JSON patch of exercise fields to a quarantined record and
+// validates it again; the record stays quarantined until it is re-ingested
+func (q *Quarantine) Fix(id string, patch []byte, validator *Validator) (*QuarantinedRecord, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	record, err := q.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	exercise := record.Exercise
+	if err := json.Unmarshal(patch, &exercise); err != nil {
+		return nil, fmt.Errorf("invalid fix: %w", err)
+	}
+
+	record.Exercise = exercise
+	record.Errors = validationErrorsOf(validator.Validate(exercise))
+	record.UpdatedAt = time.Now()
+	if err := q.write(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Reingest inserts a quarantined record that now passes validation and
+// removes it from the quarantine. A record that is still invalid is left in
+// place and its ValidationErrors are returned.
+func (q *Quarantine) Reingest(id string, validator *Validator, insert func([]Exercise) error) (*QuarantinedRecord, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	record, err := q.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if validationErrors := validationErrorsOf(validator.Validate(record.Exercise)); validationErrors.HasErrors() {
+		return nil, validationErrors
+	}
+
+	if err := insert([]Exercise{record.Exercise}); err != nil {
+		return nil, fmt.Errorf("failed to insert record %s: %w", id, err)
+	}
+	if err := q.remove(id); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ReingestAll inserts every quarantined record that now passes validation in
+// a single batch and returns them; invalid records stay quarantined
+func (q *Quarantine) ReingestAll(validator *Validator, insert func([]Exercise) error) ([]QuarantinedRecord, error) {
+	records, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	fixed := make([]QuarantinedRecord, 0)
+	exercises := make([]Exercise, 0)
+	for _, record := range records {
+		if validationErrorsOf(validator.Validate(record.Exercise)).HasErrors() {
+			continue
+		}
+		fixed = append(fixed, record)
+		exercises = append(exercises, record.Exercise)
+	}
+	if len(fixed) == 0 {
+		return fixed, nil
+	}
+
+	if err := insert(exercises); err != nil {
+		return nil, fmt.Errorf("failed to insert records: %w", err)
+	}
+	for _, record := range fixed {
+		if err := q.remove(record.ID); err != nil {
+			return nil, err
+		}
+	}
+	return fixed, nil
+}
+
+// Remove discards a quarantined record
+func (q *Quarantine) Remove(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, err := q.read(id); err != nil {
+		return err
+	}
+	return q.remove(id)
+}
+
+func (q *Quarantine) read(id string) (*QuarantinedRecord, error) {
+	path, err := q.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("quarantined record %s: %w", id, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to read quarantined record %s: %w", id, err)
+	}
+
+	var record QuarantinedRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quarantined record %s: %w", id, err)
+	}
+	return &record, nil
+}
+
+func (q *Quarantine) write(record *QuarantinedRecord) error {
+	path, err := q.path(record.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantined record: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write quarantined record: %w", err)
+	}
+	return nil
+}
+
+func (q *Quarantine) remove(id string) error {
+	path, err := q.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove quarantined record %s: %w", id, err)
+	}
+	return nil
+}
+
+// path maps an ID to its file, rejecting IDs that are not generated hex IDs
+// so that they cannot escape the quarantine directory
+func (q *Quarantine) path(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", fmt.Errorf("quarantined record %s: %w", id, os.ErrNotExist)
+	}
+	return filepath.Join(q.dir, id+".json"), nil
+}
+
+func newQuarantineID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate quarantine id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// recordErrors returns the errors found reading a record followed by its
+// validation errors on other fields, which a value that could not be read
+// would only repeat
+func recordErrors(record SourceRecord, validator *Validator) ValidationErrors {
+	found := append(ValidationErrors(nil), record.Errors...)
+	read := make(map[string]bool, len(record.Errors))
+	for _, readError := range record.Errors {
+		read[readError.Field] = true
+	}
+	for _, validationError := range validationErrorsOf(validator.Validate(record.Exercise)) {
+		if !read[validationError.Field] {
+			found = append(found, validationError)
+		}
+	}
+	return found
+}
+
+// validationErrorsOf converts the result of Validate into ValidationErrors
+func validationErrorsOf(err error) ValidationErrors {
+	if err == nil {
+		return nil
+	}
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return validationErrors
+	}
+	return ValidationErrors{{Field: "record", Message: err.Error()}}
+}
@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine_Lifecycle(t *testing.T) {
+	quarantine, err := NewQuarantine(t.TempDir())
+	require.NoError(t, err)
+	validator := NewValidator()
+
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	records := []SourceRecord{
+		{Exercise: Exercise{ID: 1, Name: "Run", Type: "cardio", Duration: 30, Calories: 300, Date: date}, File: "in.csv", Line: 2},
+		{Exercise: Exercise{ID: 2, Name: "Swim", Type: "cardio", Duration: 0, Calories: 300, Date: date}, File: "in.csv", Line: 3},
+		{Exercise: Exercise{ID: 3, Name: "X", Type: "circus", Duration: 10, Calories: 50, Date: date}, File: "in.csv", Line: 4},
+	}
+
+	valid, quarantined, err := quarantine.Separate(records, validator)
+	require.NoError(t, err)
+	require.Len(t, valid, 1)
+	assert.Equal(t, "Run", valid[0].Name)
+	require.Len(t, quarantined, 2)
+	assert.Equal(t, 3, quarantined[0].SourceLine)
+	assert.Equal(t, "duration", quarantined[0].Errors[0].Field)
+	assert.Len(t, quarantined[1].Errors, 2)
+
+	// Errors found reading a record come first, without the validation
+	// errors they cause
+	unread := SourceRecord{
+		Exercise: Exercise{Name: "Row", Type: "cardio", Calories: 300, Date: date},
+		File:     "in.csv", Line: 5,
+		Errors: ValidationErrors{{Field: "duration", Message: "must be an integer", Value: "long"}},
+	}
+	_, rejected, err := quarantine.Separate([]SourceRecord{unread}, validator)
+	require.NoError(t, err)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, unread.Errors, rejected[0].Errors)
+	require.NoError(t, quarantine.Remove(rejected[0].ID))
+
+	listed, err := quarantine.List()
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	// Fixing re-validates without releasing the record
+	swim := quarantined[0].ID
+	fixed, err := quarantine.Fix(swim, []byte(`{"duration": 40}`), validator)
+	require.NoError(t, err)
+	assert.Empty(t, fixed.Errors)
+	assert.Equal(t, "Swim", fixed.Exercise.Name)
+	assert.Equal(t, 40, fixed.Exercise.Duration)
+	assert.False(t, fixed.UpdatedAt.IsZero())
+
+	_, err = quarantine.Fix(swim, []byte(`{"duration": "long"}`), validator)
+	assert.Error(t, err)
+
+	var inserted []Exercise
+	insert := func(exercises []Exercise) error {
+		inserted = append(inserted, exercises...)
+		return nil
+	}
+
+	// Invalid records are not re-ingested
+	_, err = quarantine.Reingest(quarantined[1].ID, validator, insert)
+	var validationErrors ValidationErrors
+	require.True(t, errors.As(err, &validationErrors))
+	assert.Empty(t, inserted)
+
+	released, err := quarantine.Reingest(swim, validator, insert)
+	require.NoError(t, err)
+	assert.Equal(t, swim, released.ID)
+	require.Len(t, inserted, 1)
+	assert.Equal(t, 40, inserted[0].Duration)
+
+	_, err = quarantine.Get(swim)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// Failed inserts leave records quarantined
+	_, err = quarantine.Fix(quarantined[1].ID, []byte(`{"name": "Juggling", "type": "other"}`), validator)
+	require.NoError(t, err)
+	_, err = quarantine.ReingestAll(validator, func([]Exercise) error { return errors.New("database down") })
+	assert.ErrorContains(t, err, "database down")
+
+	all, err := quarantine.ReingestAll(validator, insert)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.Len(t, inserted, 2)
+
+	listed, err = quarantine.List()
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+}
+
+func TestQuarantine_UnknownRecords(t *testing.T) {
+	quarantine, err := NewQuarantine(t.TempDir())
+	require.NoError(t, err)
+
+	for _, id := range []string{"0123456789abcdef", "../escape", ""} {
+		_, err := quarantine.Get(id)
+		assert.True(t, errors.Is(err, os.ErrNotExist), "id %q", id)
+		assert.True(t, errors.Is(quarantine.Remove(id), os.ErrNotExist), "id %q", id)
+	}
+}
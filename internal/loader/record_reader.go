@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"bytes"
+	"io"
+)
+
+// RecordReader reads exercises one at a time, so that files of any size can
+// be loaded in bounded memory
+type RecordReader interface {
+	// Next returns the next record, or io.EOF when there are no more
+	Next() (SourceRecord, error)
+}
+
+// readAllRecords reads every record of a reader
+func readAllRecords(reader RecordReader) ([]SourceRecord, error) {
+	records := make([]SourceRecord, 0)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// lineTracker passes reads through and keeps the bytes read since the last
+// element it was asked about, so that elements decoded from a stream can be
+// given the line they start on
+type lineTracker struct {
+	reader  io.Reader
+	pending []byte
+	offset  int64
+	line    int
+}
+
+func newLineTracker(reader io.Reader) *lineTracker {
+	return &lineTracker{reader: reader, line: 1}
+}
+
+func (t *lineTracker) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	t.pending = append(t.pending, p[:n]...)
+	return n, err
+}
+
+// elementLine returns the line of the element that starts after any
+// whitespace and separating comma at offset, forgetting the bytes before it.
+// Offsets must not decrease between calls.
+func (t *lineTracker) elementLine(offset int64) int {
+	skip := int(offset - t.offset)
+	if skip > len(t.pending) {
+		skip = len(t.pending)
+	}
+	for skip < len(t.pending) && bytes.IndexByte([]byte(" \t\r\n,"), t.pending[skip]) >= 0 {
+		skip++
+	}
+
+	t.line += bytes.Count(t.pending[:skip], []byte("\n"))
+	t.pending = append(t.pending[:0], t.pending[skip:]...)
+	t.offset += int64(skip)
+	return t.line
+}
@@ -0,0 +1,129 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReader fails every read, showing that a reader did not read ahead
+// of the records asked for
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the first record")
+}
+
+func TestRecordReaders_Stream(t *testing.T) {
+	jsonLoader := NewJSONLoader()
+	csvLoader := NewCSVLoader()
+
+	readers := map[string]func(io.Reader) (RecordReader, error){
+		"json": func(input io.Reader) (RecordReader, error) {
+			return jsonLoader.NewRecordReader(input, "stream.json")
+		},
+		"ndjson": func(input io.Reader) (RecordReader, error) {
+			return jsonLoader.NewNDJSONRecordReader(input, "stream.ndjson"), nil
+		},
+		"csv": func(input io.Reader) (RecordReader, error) {
+			return csvLoader.NewRecordReader(input, "stream.csv")
+		},
+	}
+	inputs := map[string]string{
+		"json":   `[{"name": "Run", "type": "cardio"}`,
+		"ndjson": "{\"name\": \"Run\", \"type\": \"cardio\"}\n",
+		"csv":    "name,type\nRun,cardio\n",
+	}
+
+	for format, newReader := range readers {
+		t.Run(format, func(t *testing.T) {
+			reader, err := newReader(io.MultiReader(strings.NewReader(inputs[format]), failingReader{}))
+			require.NoError(t, err)
+
+			record, err := reader.Next()
+			require.NoError(t, err)
+			assert.Equal(t, "Run", record.Exercise.Name)
+
+			_, err = reader.Next()
+			assert.ErrorContains(t, err, "read past the first record")
+		})
+	}
+}
+
+func TestJSONLoader_RecordReaderMemory(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("[\n")
+	for i := 1; i <= 2000; i++ {
+		if i > 1 {
+			input.WriteString(",\n")
+		}
+		fmt.Fprintf(&input, `  {"id": %d, "name": "Run %d", "type": "cardio"}`, i, i)
+	}
+	input.WriteString("\n]\n")
+
+	reader, err := NewJSONLoader().NewRecordReader(strings.NewReader(input.String()), "large.json")
+	require.NoError(t, err)
+
+	count := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		count++
+		assert.Equal(t, count+1, record.Line)
+
+		// Only the bytes read ahead of the decoder are kept for line counting
+		assert.Less(t, len(reader.(*jsonArrayReader).tracker.pending), 8192)
+	}
+	assert.Equal(t, 2000, count)
+}
+
+func TestJSONLoader_NDJSON(t *testing.T) {
+	input := "{\"id\": 1, \"name\": \"Run\", \"heart_rate\": 150}\n" +
+		"\n" +
+		"  {\"id\": 2, \"name\": \"Lift\"}  \r\n" +
+		"{\"id\": 3, \"name\": \"Swim\"}"
+
+	records, err := readAllRecords(NewJSONLoader().NewNDJSONRecordReader(strings.NewReader(input), "log.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []int{1, 3, 4}, []int{records[0].Line, records[1].Line, records[2].Line})
+	assert.Equal(t, "Swim", records[2].Exercise.Name)
+	assert.Equal(t, map[string]interface{}{"heart_rate": float64(150)}, records[0].Exercise.Extra)
+
+	// Lines that are not exercises are records with errors
+	input = "{\"id\": 1}\n[1, 2]\n{\"name\": \"Row\", \"duration\": \"long\"}\n{\"name\": \"Swim\", \"date\": \"May 1st\"}\n{\"name\": \n{\"id\": 6}\n"
+	records, err = readAllRecords(NewJSONLoader().NewNDJSONRecordReader(strings.NewReader(input), "bad.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Empty(t, records[0].Errors)
+	assert.Equal(t, "record", records[1].Errors[0].Field)
+	assert.Equal(t, ValidationError{Field: "duration", Message: "must be int, not a JSON string"}, records[2].Errors[0])
+	assert.Equal(t, "Row", records[2].Exercise.Name)
+	assert.Equal(t, "date", records[3].Errors[0].Field)
+	assert.Equal(t, 5, records[4].Line)
+	assert.Contains(t, records[4].Errors[0].Message, "invalid JSON")
+	assert.Empty(t, records[5].Errors)
+}
+
+func TestJSONLoader_RecordErrors(t *testing.T) {
+	input := `[{"name": "Run"}, {"name": "Row", "duration": "long"}, ["Swim"], {"name": "Lift"}]`
+	records, err := NewJSONLoader().ReadRecordsFromJSON(strings.NewReader(input), "log.json")
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "duration", records[1].Errors[0].Field)
+	assert.Equal(t, "record", records[2].Errors[0].Field)
+	assert.Equal(t, "Lift", records[3].Exercise.Name)
+	assert.Empty(t, records[3].Errors)
+
+	// Malformed JSON leaves the rest of the array unreadable
+	_, err = NewJSONLoader().ReadRecordsFromJSON(strings.NewReader(`[{"name": "Run"}, {"name": }]`), "log.json")
+	assert.ErrorContains(t, err, "failed to decode JSON")
+}
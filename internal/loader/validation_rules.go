@@ -0,0 +1,191 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bounds is an inclusive numeric range; a nil end is unbounded
+type Bounds struct {
+	Min *int `json:"min,omitempty" yaml:"min,omitempty"`
+	Max *int `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+// NameRules constrain exercise names. An empty Pattern allows letters,
+// numbers, spaces, hyphens and apostrophes.
+type NameRules struct {
+	MinLength int    `json:"min_length" yaml:"min_length"`
+	MaxLength int    `json:"max_length" yaml:"max_length"`
+	Pattern   string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// DateRules constrain exercise dates
+type DateRules struct {
+	MinYear     int  `json:"min_year" yaml:"min_year"`
+	AllowFuture bool `json:"allow_future" yaml:"allow_future"`
+}
+
+// DescriptionRules constrain exercise descriptions
+type DescriptionRules struct {
+	MaxLength int    `json:"max_length" yaml:"max_length"`
+	Pattern   string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// TypeRules override the duration and calorie bounds for one exercise type;
+// unset ends fall back to the global bounds
+type TypeRules struct {
+	Duration Bounds `json:"duration" yaml:"duration"`
+	Calories Bounds `json:"calories" yaml:"calories"`
+}
+
+// ValidationRules configure a Validator
+type ValidationRules struct {
+	Types       []string             `json:"types" yaml:"types"`
+	Name        NameRules            `json:"name" yaml:"name"`
+	Duration    Bounds               `json:"duration" yaml:"duration"`
+	Calories    Bounds               `json:"calories" yaml:"calories"`
+	Date        DateRules            `json:"date" yaml:"date"`
+	Description DescriptionRules     `json:"description" yaml:"description"`
+	TypeRules   map[string]TypeRules `json:"type_rules,omitempty" yaml:"type_rules,omitempty"`
+}
+
+// DefaultValidationRules returns the rules used by NewValidator
+func DefaultValidationRules() ValidationRules {
+	return ValidationRules{
+		Types:       []string{"cardio", "strength", "flexibility", "sports", "other"},
+		Name:        NameRules{MinLength: 2, MaxLength: 100},
+		Duration:    Bounds{Min: intPtr(1), Max: intPtr(1440)},
+		Calories:    Bounds{Min: intPtr(0), Max: intPtr(10000)},
+		Date:        DateRules{MinYear: 1900},
+		Description: DescriptionRules{MaxLength: 1000},
+	}
+}
+
+// LoadValidationRules reads rules from a YAML or JSON file
+func LoadValidationRules(filename string) (ValidationRules, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ValidationRules{}, fmt.Errorf("failed to read validation rules: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return ParseValidationRules(data)
+	}
+
+	rules := DefaultValidationRules()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil {
+		return ValidationRules{}, fmt.Errorf("failed to parse validation rules: %w", err)
+	}
+	return rules, nil
+}
+
+// ParseValidationRules parses JSON rules. Settings that are left out keep
+// their default values.
+func ParseValidationRules(data []byte) (ValidationRules, error) {
+	rules := DefaultValidationRules()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return ValidationRules{}, fmt.Errorf("failed to parse validation rules: %w", err)
+	}
+	return rules, nil
+}
+
+// NewValidatorWithRules returns a validator for the given rules, rejecting
+// rules that are inconsistent or have invalid patterns
+func NewValidatorWithRules(rules ValidationRules) (*Validator, error) {
+	if len(rules.Types) == 0 {
+		return nil, fmt.Errorf("validation rules must allow at least one type")
+	}
+
+	types := make([]string, 0, len(rules.Types))
+	seen := make(map[string]bool)
+	for _, exerciseType := range rules.Types {
+		normalized := strings.TrimSpace(strings.ToLower(exerciseType))
+		if normalized == "" {
+			return nil, fmt.Errorf("validation rules contain an empty type")
+		}
+		if seen[normalized] {
+			return nil, fmt.Errorf("validation rules list type %s more than once", normalized)
+		}
+		seen[normalized] = true
+		types = append(types, normalized)
+	}
+	rules.Types = types
+
+	if rules.Name.MinLength < 0 || rules.Name.MaxLength < rules.Name.MinLength {
+		return nil, fmt.Errorf("invalid name length range %d-%d", rules.Name.MinLength, rules.Name.MaxLength)
+	}
+	if rules.Description.MaxLength < 0 {
+		return nil, fmt.Errorf("invalid description max length %d", rules.Description.MaxLength)
+	}
+	if err := rules.Duration.validate("duration"); err != nil {
+		return nil, err
+	}
+	if err := rules.Calories.validate("calories"); err != nil {
+		return nil, err
+	}
+
+	typeRules := make(map[string]TypeRules, len(rules.TypeRules))
+	for exerciseType, override := range rules.TypeRules {
+		normalized := strings.TrimSpace(strings.ToLower(exerciseType))
+		if !seen[normalized] {
+			return nil, fmt.Errorf("type rules given for unknown type %s", exerciseType)
+		}
+		if err := rules.Duration.merge(override.Duration).validate(normalized + " duration"); err != nil {
+			return nil, err
+		}
+		if err := rules.Calories.merge(override.Calories).validate(normalized + " calories"); err != nil {
+			return nil, err
+		}
+		typeRules[normalized] = override
+	}
+	rules.TypeRules = typeRules
+
+	validator := &Validator{rules: rules}
+
+	var err error
+	if rules.Name.Pattern != "" {
+		if validator.namePattern, err = regexp.Compile(rules.Name.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+	}
+	if rules.Description.Pattern != "" {
+		if validator.descriptionPattern, err = regexp.Compile(rules.Description.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid description pattern: %w", err)
+		}
+	}
+
+	return validator, nil
+}
+
+// merge returns the bounds with the ends set in override replaced
+func (b Bounds) merge(override Bounds) Bounds {
+	if override.Min != nil {
+		b.Min = override.Min
+	}
+	if override.Max != nil {
+		b.Max = override.Max
+	}
+	return b
+}
+
+func (b Bounds) validate(field string) error {
+	if b.Min != nil && b.Max != nil && *b.Min > *b.Max {
+		return fmt.Errorf("invalid %s bounds: min %d exceeds max %d", field, *b.Min, *b.Max)
+	}
+	return nil
+}
+
+func intPtr(value int) *int {
+	return &value
+}
@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator_WithRules(t *testing.T) {
+	rules := DefaultValidationRules()
+	rules.Types = []string{"Cardio", "yoga"}
+	rules.Name = NameRules{MinLength: 3, MaxLength: 20, Pattern: `^[A-Z]`}
+	rules.Duration.Max = intPtr(120)
+	rules.Date = DateRules{MinYear: 2000, AllowFuture: true}
+	rules.TypeRules = map[string]TypeRules{
+		"yoga": {Duration: Bounds{Max: intPtr(90)}, Calories: Bounds{Max: intPtr(500)}},
+	}
+
+	validator, err := NewValidatorWithRules(rules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cardio", "yoga"}, validator.Types())
+	assert.True(t, validator.IsValidType(" YOGA "))
+	canonical, ok := validator.CanonicalType(" YOGA ")
+	assert.True(t, ok)
+	assert.Equal(t, "yoga", canonical)
+	assert.False(t, validator.IsValidType("strength"))
+
+	base := Exercise{Name: "Flow", Type: "yoga", Duration: 60, Calories: 200, Date: time.Now().AddDate(0, 0, 7)}
+	assert.NoError(t, validator.Validate(base), "future dates are allowed")
+
+	tests := []struct {
+		name     string
+		modify   func(*Exercise)
+		field    string
+		errorMsg string
+	}{
+		{"type not allowed", func(e *Exercise) { e.Type = "strength" }, "type", "must be one of: cardio, yoga"},
+		{"name pattern", func(e *Exercise) { e.Name = "flow" }, "name", "must match pattern ^[A-Z]"},
+		{"name length", func(e *Exercise) { e.Name = "Fl" }, "name", "must be at least 3 characters long"},
+		{"per-type duration", func(e *Exercise) { e.Duration = 100 }, "duration", "cannot exceed 90 minutes"},
+		{"per-type calories", func(e *Exercise) { e.Calories = 600 }, "calories", "seems unreasonably high (max 500)"},
+		{"min year", func(e *Exercise) { e.Date = time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC) }, "date", "cannot be before year 2000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exercise := base
+			tt.modify(&exercise)
+
+			err := validator.Validate(exercise)
+			var validationErrors ValidationErrors
+			require.ErrorAs(t, err, &validationErrors)
+			require.Len(t, validationErrors, 1)
+			assert.Equal(t, tt.field, validationErrors[0].Field)
+			assert.Contains(t, validationErrors[0].Message, tt.errorMsg)
+		})
+	}
+
+	// Other types keep the global bounds
+	cardio := base
+	cardio.Type = "cardio"
+	cardio.Duration = 100
+	assert.NoError(t, validator.Validate(cardio))
+	cardio.Duration = 121
+	assert.ErrorContains(t, validator.Validate(cardio), "cannot exceed 2 hours (120 minutes)")
+}
+
+func TestNewValidatorWithRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ValidationRules)
+	}{
+		{"no types", func(r *ValidationRules) { r.Types = nil }},
+		{"duplicate type", func(r *ValidationRules) { r.Types = []string{"cardio", "Cardio"} }},
+		{"inverted bounds", func(r *ValidationRules) { r.Calories = Bounds{Min: intPtr(10), Max: intPtr(5)} }},
+		{"inverted name length", func(r *ValidationRules) { r.Name.MaxLength = 1 }},
+		{"bad pattern", func(r *ValidationRules) { r.Description.Pattern = "(" }},
+		{"unknown type rules", func(r *ValidationRules) { r.TypeRules = map[string]TypeRules{"circus": {}} }},
+		{"inverted type bounds", func(r *ValidationRules) {
+			r.TypeRules = map[string]TypeRules{"cardio": {Duration: Bounds{Max: intPtr(0)}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultValidationRules()
+			tt.modify(&rules)
+			_, err := NewValidatorWithRules(rules)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadValidationRules(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlFile := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+types: [cardio, circus]
+calories:
+  max: 5000
+type_rules:
+  circus:
+    duration:
+      max: 180
+`), 0644))
+
+	rules, err := LoadValidationRules(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cardio", "circus"}, rules.Types)
+	assert.Equal(t, 5000, *rules.Calories.Max)
+	assert.Equal(t, 0, *rules.Calories.Min, "unset bounds keep their defaults")
+	assert.Equal(t, 1900, rules.Date.MinYear)
+	assert.Equal(t, 180, *rules.TypeRules["circus"].Duration.Max)
+
+	jsonFile := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"name": {"min_length": 1, "max_length": 50}}`), 0644))
+	rules, err = LoadValidationRules(jsonFile)
+	require.NoError(t, err)
+	assert.Equal(t, NameRules{MinLength: 1, MaxLength: 50}, rules.Name)
+	assert.Equal(t, DefaultValidationRules().Types, rules.Types)
+
+	// Misspelled settings are rejected rather than ignored
+	require.NoError(t, os.WriteFile(yamlFile, []byte("duration:\n  maximum: 10\n"), 0644))
+	_, err = LoadValidationRules(yamlFile)
+	assert.Error(t, err)
+
+	_, err = LoadValidationRules(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -2,19 +2,75 @@ package loader
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
 )
 
+// Validator checks exercises against a set of ValidationRules. It is safe
+// for concurrent use.
 type Validator struct {
-	ValidTypes []string
+	rules              ValidationRules
+	namePattern        *regexp.Regexp
+	descriptionPattern *regexp.Regexp
+
+	// fieldNames are the names errors are reported under for fields stored
+	// under another name
+	fieldNames map[string]string
 }
 
+// NewValidator returns a validator using DefaultValidationRules
 func NewValidator() *Validator {
-	return &Validator{
-		ValidTypes: []string{"cardio", "strength", "flexibility", "sports", "other"},
+	rules := DefaultValidationRules()
+	return &Validator{rules: rules}
+}
+
+// Rules returns the rules the validator enforces
+func (v *Validator) Rules() ValidationRules {
+	return v.rules
+}
+
+// WithFieldNames returns a validator with the same rules that reports the
+// errors of the fields in names under the names they map to, such as the
+// columns they are stored in
+func (v *Validator) WithFieldNames(names map[string]string) *Validator {
+	renamed := *v
+	renamed.fieldNames = names
+	return &renamed
+}
+
+// renameFields reports errors under the field names of the validator
+func (v *Validator) renameFields(errors ValidationErrors) ValidationErrors {
+	for i := range errors {
+		if name, ok := v.fieldNames[errors[i].Field]; ok {
+			errors[i].Field = name
+		}
 	}
+	return errors
+}
+
+// Types returns the allowed exercise types in their canonical form
+func (v *Validator) Types() []string {
+	return append([]string(nil), v.rules.Types...)
+}
+
+// CanonicalType returns the allowed exercise type matching a type, ignoring
+// case and surrounding space, in the form the rules list it
+func (v *Validator) CanonicalType(exerciseType string) (string, bool) {
+	normalized := strings.TrimSpace(strings.ToLower(exerciseType))
+	for _, validType := range v.rules.Types {
+		if normalized == validType {
+			return validType, true
+		}
+	}
+	return "", false
+}
+
+// IsValidType reports whether an exercise type is allowed, ignoring case
+func (v *Validator) IsValidType(exerciseType string) bool {
+	_, ok := v.CanonicalType(exerciseType)
+	return ok
 }
 
 // ValidationError provides structured validation error information
@@ -64,10 +120,10 @@ func (v *Validator) Validate(exercise Exercise) error {
 	errors = append(errors, v.validateType(exercise.Type)...)
 
 	// Validate duration
-	errors = append(errors, v.validateDuration(exercise.Duration)...)
+	errors = append(errors, v.validateDuration(exercise.Duration, exercise.Type)...)
 
 	// Validate calories
-	errors = append(errors, v.validateCalories(exercise.Calories)...)
+	errors = append(errors, v.validateCalories(exercise.Calories, exercise.Type)...)
 
 	// Validate date
 	errors = append(errors, v.validateDate(exercise.Date)...)
@@ -76,7 +132,7 @@ func (v *Validator) Validate(exercise Exercise) error {
 	errors = append(errors, v.validateDescription(exercise.Description)...)
 
 	if errors.HasErrors() {
-		return errors
+		return v.renameFields(errors)
 	}
 
 	return nil
@@ -94,24 +150,32 @@ func (v *Validator) validateName(name string) []ValidationError {
 		return errors
 	}
 
-	if len(trimmed) < 2 {
+	if len(trimmed) < v.rules.Name.MinLength {
 		errors = append(errors, ValidationError{
 			Field:   "name",
-			Message: "must be at least 2 characters long",
+			Message: fmt.Sprintf("must be at least %d characters long", v.rules.Name.MinLength),
 			Value:   trimmed,
 		})
 	}
 
-	if len(trimmed) > 100 {
+	if len(trimmed) > v.rules.Name.MaxLength {
 		errors = append(errors, ValidationError{
 			Field:   "name",
-			Message: "must be no more than 100 characters long",
+			Message: fmt.Sprintf("must be no more than %d characters long", v.rules.Name.MaxLength),
 			Value:   fmt.Sprintf("%d chars", len(trimmed)),
 		})
 	}
 
-	// Check for valid characters (letters, numbers, spaces, basic punctuation)
-	if !isValidName(trimmed) {
+	if v.namePattern != nil {
+		if !v.namePattern.MatchString(trimmed) {
+			errors = append(errors, ValidationError{
+				Field:   "name",
+				Message: fmt.Sprintf("must match pattern %s", v.namePattern),
+				Value:   trimmed,
+			})
+		}
+	} else if !isValidName(trimmed) {
+		// Check for valid characters (letters, numbers, spaces, basic punctuation)
 		errors = append(errors, ValidationError{
 			Field:   "name",
 			Message: "contains invalid characters (only letters, numbers, spaces, hyphens, and apostrophes allowed)",
@@ -134,19 +198,10 @@ func (v *Validator) validateType(exerciseType string) []ValidationError {
 		return errors
 	}
 
-	// Check if type is in valid list
-	isValid := false
-	for _, validType := range v.ValidTypes {
-		if trimmed == validType {
-			isValid = true
-			break
-		}
-	}
-
-	if !isValid {
+	if !v.IsValidType(trimmed) {
 		errors = append(errors, ValidationError{
 			Field:   "type",
-			Message: fmt.Sprintf("must be one of: %s", strings.Join(v.ValidTypes, ", ")),
+			Message: fmt.Sprintf("must be one of: %s", strings.Join(v.rules.Types, ", ")),
 			Value:   trimmed,
 		})
 	}
@@ -154,22 +209,30 @@ func (v *Validator) validateType(exerciseType string) []ValidationError {
 	return errors
 }
 
-func (v *Validator) validateDuration(duration int) []ValidationError {
+func (v *Validator) validateDuration(duration int, exerciseType string) []ValidationError {
 	var errors []ValidationError
+	bounds := v.bounds(v.rules.Duration, exerciseType, func(rules TypeRules) Bounds { return rules.Duration })
 
-	if duration <= 0 {
+	if bounds.Min != nil && duration < *bounds.Min {
+		message := fmt.Sprintf("must be at least %d minutes", *bounds.Min)
+		if *bounds.Min == 1 {
+			message = "must be positive (in minutes)"
+		}
 		errors = append(errors, ValidationError{
 			Field:   "duration",
-			Message: "must be positive (in minutes)",
+			Message: message,
 			Value:   fmt.Sprintf("%d", duration),
 		})
 	}
 
-	// Reasonable upper limit (24 hours = 1440 minutes)
-	if duration > 1440 {
+	if bounds.Max != nil && duration > *bounds.Max {
+		message := fmt.Sprintf("cannot exceed %d minutes", *bounds.Max)
+		if *bounds.Max%60 == 0 && *bounds.Max > 60 {
+			message = fmt.Sprintf("cannot exceed %d hours (%d minutes)", *bounds.Max/60, *bounds.Max)
+		}
 		errors = append(errors, ValidationError{
 			Field:   "duration",
-			Message: "cannot exceed 24 hours (1440 minutes)",
+			Message: message,
 			Value:   fmt.Sprintf("%d", duration),
 		})
 	}
@@ -177,22 +240,26 @@ func (v *Validator) validateDuration(duration int) []ValidationError {
 	return errors
 }
 
-func (v *Validator) validateCalories(calories int) []ValidationError {
+func (v *Validator) validateCalories(calories int, exerciseType string) []ValidationError {
 	var errors []ValidationError
+	bounds := v.bounds(v.rules.Calories, exerciseType, func(rules TypeRules) Bounds { return rules.Calories })
 
-	if calories < 0 {
+	if bounds.Min != nil && calories < *bounds.Min {
+		message := fmt.Sprintf("must be at least %d", *bounds.Min)
+		if *bounds.Min == 0 {
+			message = "cannot be negative"
+		}
 		errors = append(errors, ValidationError{
 			Field:   "calories",
-			Message: "cannot be negative",
+			Message: message,
 			Value:   fmt.Sprintf("%d", calories),
 		})
 	}
 
-	// Reasonable upper limit (10,000 calories is extreme but possible)
-	if calories > 10000 {
+	if bounds.Max != nil && calories > *bounds.Max {
 		errors = append(errors, ValidationError{
 			Field:   "calories",
-			Message: "seems unreasonably high (max 10,000)",
+			Message: fmt.Sprintf("seems unreasonably high (max %d)", *bounds.Max),
 			Value:   fmt.Sprintf("%d", calories),
 		})
 	}
@@ -200,6 +267,15 @@ func (v *Validator) validateCalories(calories int) []ValidationError {
 	return errors
 }
 
+// bounds applies the per-type override for an exercise type, if any
+func (v *Validator) bounds(global Bounds, exerciseType string, override func(TypeRules) Bounds) Bounds {
+	rules, ok := v.rules.TypeRules[strings.TrimSpace(strings.ToLower(exerciseType))]
+	if !ok {
+		return global
+	}
+	return global.merge(override(rules))
+}
+
 func (v *Validator) validateDate(date time.Time) []ValidationError {
 	var errors []ValidationError
 
@@ -212,7 +288,7 @@ func (v *Validator) validateDate(date time.Time) []ValidationError {
 	}
 
 	now := time.Now()
-	if date.After(now) {
+	if !v.rules.Date.AllowFuture && date.After(now) {
 		errors = append(errors, ValidationError{
 			Field:   "date",
 			Message: "cannot be in the future",
@@ -221,10 +297,10 @@ func (v *Validator) validateDate(date time.Time) []ValidationError {
 	}
 
 	// Don't allow dates too far in the past (e.g., before 1900)
-	if date.Year() < 1900 {
+	if date.Year() < v.rules.Date.MinYear {
 		errors = append(errors, ValidationError{
 			Field:   "date",
-			Message: "cannot be before year 1900",
+			Message: fmt.Sprintf("cannot be before year %d", v.rules.Date.MinYear),
 			Value:   date.Format("2006-01-02"),
 		})
 	}
@@ -235,14 +311,21 @@ func (v *Validator) validateDate(date time.Time) []ValidationError {
 func (v *Validator) validateDescription(description string) []ValidationError {
 	var errors []ValidationError
 
-	if len(description) > 1000 {
+	if len(description) > v.rules.Description.MaxLength {
 		errors = append(errors, ValidationError{
 			Field:   "description",
-			Message: "must be no more than 1000 characters long",
+			Message: fmt.Sprintf("must be no more than %d characters long", v.rules.Description.MaxLength),
 			Value:   fmt.Sprintf("%d chars", len(description)),
 		})
 	}
 
+	if v.descriptionPattern != nil && description != "" && !v.descriptionPattern.MatchString(description) {
+		errors = append(errors, ValidationError{
+			Field:   "description",
+			Message: fmt.Sprintf("must match pattern %s", v.descriptionPattern),
+		})
+	}
+
 	// Check for potentially malicious content (basic check)
 	if containsSuspiciousContent(description) {
 		errors = append(errors, ValidationError{
@@ -297,11 +380,11 @@ func (v *Validator) ValidatePartial(exercise Exercise) error {
 	}
 
 	if exercise.Duration != 0 {
-		errors = append(errors, v.validateDuration(exercise.Duration)...)
+		errors = append(errors, v.validateDuration(exercise.Duration, exercise.Type)...)
 	}
 
 	if exercise.Calories != 0 {
-		errors = append(errors, v.validateCalories(exercise.Calories)...)
+		errors = append(errors, v.validateCalories(exercise.Calories, exercise.Type)...)
 	}
 
 	if !exercise.Date.IsZero() {
@@ -313,7 +396,7 @@ func (v *Validator) ValidatePartial(exercise Exercise) error {
 	}
 
 	if errors.HasErrors() {
-		return errors
+		return v.renameFields(errors)
 	}
 
 	return nil
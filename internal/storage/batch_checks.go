@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Cross-record checks run on ingest, complementing the per-record validator
+
+// BatchCheck names a cross-record check
+type BatchCheck string
+
+const (
+	BatchCheckDuplicate     BatchCheck = "duplicate"
+	BatchCheckNearDuplicate BatchCheck = "near_duplicate"
+	BatchCheckIDConflict    BatchCheck = "id_conflict"
+)
+
+// BatchCheckAction is what a check does with the records it catches
+type BatchCheckAction string
+
+const (
+	BatchCheckOff  BatchCheckAction = ""
+	BatchCheckWarn BatchCheckAction = "warn"
+	BatchCheckSkip BatchCheckAction = "skip"
+	BatchCheckFail BatchCheckAction = "fail"
+)
+
+// BatchChecks configures the cross-record checks of a load. Duplicates are
+// records with the same content as another, ignoring IDs; near-duplicates
+// share name, type and day but differ otherwise, such as in casing; ID
+// conflicts reuse the ID of a different record. Checks without an action are
+// disabled.
+type BatchChecks struct {
+	Duplicates     BatchCheckAction `json:"duplicates,omitempty"`
+	NearDuplicates BatchCheckAction `json:"near_duplicates,omitempty"`
+	IDConflicts    BatchCheckAction `json:"id_conflicts,omitempty"`
+}
+
+// BatchCheckFinding is a record caught by a cross-record check
+type BatchCheckFinding struct {
+	Index   int              `json:"index"`
+	Check   BatchCheck       `json:"check"`
+	Action  BatchCheckAction `json:"action"`
+	Message string           `json:"message"`
+}
+
+// Enabled reports whether any check is enabled
+func (c BatchChecks) Enabled() bool {
+	return c.Duplicates != BatchCheckOff || c.NearDuplicates != BatchCheckOff || c.IDConflicts != BatchCheckOff
+}
+
+// Validate rejects unknown actions
+func (c BatchChecks) Validate() error {
+	for check, action := range map[BatchCheck]BatchCheckAction{
+		BatchCheckDuplicate:     c.Duplicates,
+		BatchCheckNearDuplicate: c.NearDuplicates,
+		BatchCheckIDConflict:    c.IDConflicts,
+	} {
+		switch action {
+		case BatchCheckOff, BatchCheckWarn, BatchCheckSkip, BatchCheckFail:
+		default:
+			return fmt.Errorf("unsupported action %q for %s check", action, check)
+		}
+	}
+	return nil
+}
+
+// CheckBatch compares every record of a batch with the existing rows and the
+// records before it in the batch. Each record is reported at most once:
+// duplicates take precedence over ID conflicts, which take precedence over
+// near-duplicates.
+func CheckBatch(existing, batch []loader.Exercise, checks BatchChecks) []BatchCheckFinding {
+	return NewBatchChecker(existing, checks).Check(batch)
+}
+
+// BatchChecker runs the cross-record checks over the consecutive batches of
+// a load, so that the existing rows are read once rather than per batch.
+// Every checked record is remembered and compared with the later batches; it
+// is remembered by hashes of its keys, so that the memory a record takes does
+// not grow with its content.
+type BatchChecker struct {
+	checks   BatchChecks
+	contents map[recordHash]recordSource
+	similar  map[recordHash]recordSource
+	ids      map[int]batchCheckRecord
+	checked  int
+}
+
+// NewBatchChecker returns a checker of batches against the existing rows
+func NewBatchChecker(existing []loader.Exercise, checks BatchChecks) *BatchChecker {
+	c := &BatchChecker{
+		checks:   checks,
+		contents: make(map[recordHash]recordSource),
+		similar:  make(map[recordHash]recordSource),
+		ids:      make(map[int]batchCheckRecord),
+	}
+	for _, exercise := range existing {
+		c.remember(exercise, recordSource{existing: true, position: exercise.ID})
+	}
+	return c
+}
+
+// Check compares every record of a batch with the existing rows and the
+// records checked before it, as CheckBatch does. Finding indexes are
+// positions in the batch; records of earlier batches are named by their
+// position in the load.
+func (c *BatchChecker) Check(batch []loader.Exercise) []BatchCheckFinding {
+	findings := make([]BatchCheckFinding, 0)
+	if !c.checks.Enabled() {
+		return findings
+	}
+
+	for i, exercise := range batch {
+		content := sha256.Sum256([]byte(contentKey(exercise)))
+		finding := BatchCheckFinding{Index: i}
+
+		if source, ok := c.contents[content]; ok {
+			finding.Check, finding.Action = BatchCheckDuplicate, c.checks.Duplicates
+			finding.Message = fmt.Sprintf("duplicates %s", source)
+		} else if other, ok := c.ids[exercise.ID]; ok && exercise.ID != 0 && other.content != content {
+			finding.Check, finding.Action = BatchCheckIDConflict, c.checks.IDConflicts
+			finding.Message = fmt.Sprintf("ID %d conflicts with %s", exercise.ID, other.source)
+		} else if source, ok := c.similar[sha256.Sum256([]byte(similarityKey(exercise)))]; ok {
+			finding.Check, finding.Action = BatchCheckNearDuplicate, c.checks.NearDuplicates
+			finding.Message = fmt.Sprintf("nearly duplicates %s (same name, type and date)", source)
+		}
+		if finding.Action != BatchCheckOff {
+			findings = append(findings, finding)
+		}
+
+		c.remember(exercise, recordSource{position: c.checked + i})
+	}
+	c.checked += len(batch)
+
+	return findings
+}
+
+// remember notes a record for the checks of the records after it, keeping
+// the first record seen with each key
+func (c *BatchChecker) remember(exercise loader.Exercise, source recordSource) {
+	content := sha256.Sum256([]byte(contentKey(exercise)))
+	if _, ok := c.contents[content]; !ok {
+		c.contents[content] = source
+	}
+	similar := sha256.Sum256([]byte(similarityKey(exercise)))
+	if _, ok := c.similar[similar]; !ok {
+		c.similar[similar] = source
+	}
+	if _, ok := c.ids[exercise.ID]; !ok && exercise.ID != 0 {
+		c.ids[exercise.ID] = batchCheckRecord{source: source, content: content}
+	}
+}
+
+// recordHash is the hash of a key of a record
+type recordHash = [sha256.Size]byte
+
+// recordSource is where a record seen by a BatchChecker comes from: the ID of
+// an existing row, or the position of a record in the load
+type recordSource struct {
+	existing bool
+	position int
+}
+
+func (s recordSource) String() string {
+	if s.existing {
+		return fmt.Sprintf("existing record %d", s.position)
+	}
+	return fmt.Sprintf("record at index %d", s.position)
+}
+
+// batchCheckRecord is a record seen by a BatchChecker
+type batchCheckRecord struct {
+	source  recordSource
+	content recordHash
+}
+
+// contentKey identifies a record by everything but its ID
+func contentKey(exercise loader.Exercise) string {
+	parts := []string{
+		exercise.Name,
+		exercise.Type,
+		fmt.Sprint(exercise.Duration),
+		fmt.Sprint(exercise.Calories),
+		exercise.Date.UTC().Format(time.RFC3339Nano),
+		exercise.Description,
+	}
+
+	// Null extra columns are the same as missing ones
+	columns := make([]string, 0, len(exercise.Extra))
+	for column, value := range exercise.Extra {
+		if value != nil {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		parts = append(parts, column+"="+indexKey(exercise.Extra[column]))
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// similarityKey identifies a record by its name, type and day, ignoring case
+func similarityKey(exercise loader.Exercise) string {
+	return strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(exercise.Name)),
+		strings.ToLower(strings.TrimSpace(exercise.Type)),
+		exercise.Date.UTC().Format("2006-01-02"),
+	}, "\x00")
+}
+
+// newBatchChecker returns a checker of batches against the rows of the table,
+// which it reads only when a check is enabled
+func (d *DeltaLakeRepository) newBatchChecker(checks BatchChecks) (*BatchChecker, error) {
+	if err := checks.Validate(); err != nil {
+		return nil, err
+	}
+
+	var existing []loader.Exercise
+	if checks.Enabled() {
+		d.mutex.RLock()
+		rows, err := d.getAllFromFiles()
+		d.mutex.RUnlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing records: %w", err)
+		}
+		existing = rows
+	}
+	return NewBatchChecker(existing, checks), nil
+}
+
+// applyBatchChecks checks the exercises of a batch, records the findings on
+// the result and returns the exercises to insert. indexes holds the position
+// of each exercise in the batch, and the positions of those returned are
+// returned with them. A finding whose action is fail aborts the batch.
+func applyBatchChecks(checker *BatchChecker, exercises []loader.Exercise, indexes []int, result *BatchResult) ([]loader.Exercise, []int, error) {
+	skipped := make(map[int]bool)
+	var failed []string
+	for _, finding := range checker.Check(exercises) {
+		exercise := exercises[finding.Index]
+		index := indexes[finding.Index]
+		result.Errors = append(result.Errors, BatchError{
+			Index:  index,
+			Error:  finding.Message,
+			Record: fmt.Sprintf("ID: %d, Name: %s", exercise.ID, exercise.Name),
+			Check:  finding.Check,
+			Action: finding.Action,
+		})
+
+		switch finding.Action {
+		case BatchCheckSkip:
+			skipped[finding.Index] = true
+		case BatchCheckFail:
+			failed = append(failed, fmt.Sprintf("record %d %s", index, finding.Message))
+		}
+	}
+
+	if len(failed) > 0 {
+		return nil, nil, fmt.Errorf("batch check failed: %s", strings.Join(failed, "; "))
+	}
+
+	accepted := make([]loader.Exercise, 0, len(exercises)-len(skipped))
+	acceptedIndexes := make([]int, 0, len(exercises)-len(skipped))
+	for i, exercise := range exercises {
+		if !skipped[i] {
+			accepted = append(accepted, exercise)
+			acceptedIndexes = append(acceptedIndexes, indexes[i])
+		}
+	}
+	result.SkippedCount = len(skipped)
+	return accepted, acceptedIndexes, nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBatch(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	existing := []loader.Exercise{
+		{ID: 1, Name: "Running", Type: "cardio", Duration: 30, Calories: 300, Date: date},
+	}
+	batch := []loader.Exercise{
+		{ID: 0, Name: "Running", Type: "cardio", Duration: 30, Calories: 300, Date: date},
+		{ID: 0, Name: "running ", Type: "Cardio", Duration: 35, Calories: 310, Date: date.Add(time.Hour)},
+		{ID: 1, Name: "Cycling", Type: "cardio", Duration: 60, Calories: 500, Date: date},
+		{ID: 7, Name: "Yoga", Type: "flexibility", Duration: 60, Calories: 150, Date: date},
+		{ID: 7, Name: "Yoga", Type: "flexibility", Duration: 45, Calories: 150, Date: date},
+		{ID: 0, Name: "Swimming", Type: "cardio", Duration: 45, Calories: 400, Date: date},
+	}
+	checks := BatchChecks{Duplicates: BatchCheckSkip, NearDuplicates: BatchCheckWarn, IDConflicts: BatchCheckFail}
+
+	findings := CheckBatch(existing, batch, checks)
+	assert.Equal(t, []BatchCheckFinding{
+		{Index: 0, Check: BatchCheckDuplicate, Action: BatchCheckSkip, Message: "duplicates existing record 1"},
+		{Index: 1, Check: BatchCheckNearDuplicate, Action: BatchCheckWarn, Message: "nearly duplicates existing record 1 (same name, type and date)"},
+		{Index: 2, Check: BatchCheckIDConflict, Action: BatchCheckFail, Message: "ID 1 conflicts with existing record 1"},
+		{Index: 4, Check: BatchCheckIDConflict, Action: BatchCheckFail, Message: "ID 7 conflicts with record at index 3"},
+	}, findings)
+
+	// Disabled checks report nothing
+	findings = CheckBatch(existing, batch, BatchChecks{NearDuplicates: BatchCheckWarn})
+	require.Len(t, findings, 1)
+	assert.Equal(t, 1, findings[0].Index)
+	assert.Empty(t, CheckBatch(existing, batch, BatchChecks{}))
+
+	assert.Error(t, BatchChecks{Duplicates: "ignore"}.Validate())
+}
+
+func TestBatchChecker(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	existing := []loader.Exercise{
+		{ID: 1, Name: "Running", Type: "cardio", Duration: 30, Calories: 300, Date: date},
+	}
+	checker := NewBatchChecker(existing, BatchChecks{Duplicates: BatchCheckSkip, IDConflicts: BatchCheckFail})
+
+	assert.Equal(t, []BatchCheckFinding{
+		{Index: 1, Check: BatchCheckDuplicate, Action: BatchCheckSkip, Message: "duplicates existing record 1"},
+	}, checker.Check([]loader.Exercise{
+		{ID: 7, Name: "Yoga", Type: "flexibility", Duration: 60, Calories: 150, Date: date},
+		{Name: "Running", Type: "cardio", Duration: 30, Calories: 300, Date: date},
+	}))
+
+	// Later batches are checked against the earlier ones, named by their
+	// position in the load
+	assert.Equal(t, []BatchCheckFinding{
+		{Index: 0, Check: BatchCheckIDConflict, Action: BatchCheckFail, Message: "ID 7 conflicts with record at index 0"},
+		{Index: 1, Check: BatchCheckDuplicate, Action: BatchCheckSkip, Message: "duplicates record at index 2"},
+	}, checker.Check([]loader.Exercise{
+		{ID: 7, Name: "Yoga", Type: "flexibility", Duration: 45, Calories: 150, Date: date},
+		{Name: "Yoga", Type: "flexibility", Duration: 45, Calories: 150, Date: date},
+	}))
+}
+
+func TestDeltaLakeRepository_InsertBatchWithOptions_Checks(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	// Re-running a load skips the records that are already there
+	rerun := append(sampleExercises(), loader.Exercise{
+		Name: "Rowing", Type: "cardio", Duration: 20, Calories: 250, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC),
+	})
+	result, err := repo.InsertBatchWithOptions(ctx, rerun, BatchOptions{Checks: BatchChecks{Duplicates: BatchCheckSkip}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.SuccessCount)
+	assert.Equal(t, 4, result.SkippedCount)
+	require.Len(t, result.Errors, 4)
+	assert.Equal(t, BatchCheckDuplicate, result.Errors[0].Check)
+	assert.Equal(t, BatchCheckSkip, result.Errors[0].Action)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	// Warnings are reported but the records are inserted
+	result, err = repo.InsertBatchWithOptions(ctx, rerun[4:], BatchOptions{Checks: BatchChecks{Duplicates: BatchCheckWarn}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.SuccessCount)
+	assert.Len(t, result.Errors, 1)
+
+	// Failing checks abort the batch before anything is written
+	version := result.Version
+	_, err = repo.InsertBatchWithOptions(ctx, rerun, BatchOptions{Checks: BatchChecks{Duplicates: BatchCheckFail}})
+	assert.ErrorContains(t, err, "batch check failed")
+	history, err := repo.GetVersionHistory(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, version, history[len(history)-1].ID)
+
+	_, err = repo.InsertBatchWithOptions(ctx, rerun, BatchOptions{Checks: BatchChecks{IDConflicts: "drop"}})
+	assert.Error(t, err)
+}
+
+func TestDeltaLakeRepository_BulkLoad_Checks(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	csvFile := filepath.Join(t.TempDir(), "exercises.csv")
+	content := "id,name,type,duration,calories,date,description\n" +
+		"1,Morning Run,cardio,30,300,2024-01-15,Easy jog\n" +
+		"2,Swimming,cardio,45,400,2024-01-16,Laps\n" +
+		"3,morning run,Cardio,30,300,2024-01-15,Easy jog\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(content), 0644))
+
+	source := DataSource{Type: DataSourceFile, Location: csvFile, Format: DataFormatCSV}
+	options := BulkLoadOptions{Checks: BatchChecks{Duplicates: BatchCheckSkip, NearDuplicates: BatchCheckSkip}}
+
+	result, err := repo.BulkLoad(ctx, source, options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+	assert.Equal(t, int64(1), result.RecordsSkipped)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, int64(4), result.Errors[0].Line)
+	assert.Equal(t, BatchCheckNearDuplicate, result.Errors[0].Check)
+
+	result, err = repo.BulkLoad(ctx, source, options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), result.RecordsLoaded)
+	assert.Equal(t, int64(3), result.RecordsSkipped)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
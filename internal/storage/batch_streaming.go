@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +15,16 @@ import (
 
 // InsertBatchWithOptions inserts a batch of exercises with configurable options
 func (d *DeltaLakeRepository) InsertBatchWithOptions(ctx context.Context, exercises []loader.Exercise, options BatchOptions) (*BatchResult, error) {
+	checker, err := d.newBatchChecker(options.Checks)
+	if err != nil {
+		return &BatchResult{ProcessedCount: len(exercises)}, err
+	}
+	return d.insertBatch(ctx, exercises, options, checker)
+}
+
+// insertBatch inserts a batch of exercises in one commit, checking them with
+// a checker that may have seen the batches before it
+func (d *DeltaLakeRepository) insertBatch(ctx context.Context, exercises []loader.Exercise, options BatchOptions, checker *BatchChecker) (*BatchResult, error) {
 	startTime := time.Now()
 	result := &BatchResult{
 		ProcessedCount: len(exercises),
@@ -43,11 +52,27 @@ func (d *DeltaLakeRepository) InsertBatchWithOptions(ctx context.Context, exerci
 		}
 	}
 
+	// Rows that do not fit the schema are rejected on their own; merging the
+	// schema makes them fit
+	exercises, indexes := d.rejectNonconformingRows(exercises, options.MergeSchema, result)
+
+	exercises, indexes, err := applyBatchChecks(checker, exercises, indexes, result)
+	if err != nil {
+		return result, err
+	}
+	if len(exercises) == 0 && (result.SkippedCount > 0 || result.ErrorCount > 0) {
+		result.Duration = time.Since(startTime)
+		result.Version = d.currentVersion
+		return result, nil
+	}
+
 	// Begin transaction
 	tx, err := d.BeginTransaction(timeoutCtx)
 	if err != nil {
 		return result, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	tx.(*deltaTransaction).mergeSchema = options.MergeSchema
+	tx.(*deltaTransaction).mergedColumns = options.MergedColumns
 
 	// Process in batches
 	for i := 0; i < len(exercises); i += options.BatchSize {
@@ -57,7 +82,7 @@ func (d *DeltaLakeRepository) InsertBatchWithOptions(ctx context.Context, exerci
 		}
 
 		batch := exercises[i:end]
-		if err := d.processBatch(timeoutCtx, tx, batch, result, options.SkipErrors); err != nil {
+		if err := d.processBatch(timeoutCtx, tx, batch, indexes[i:end], result, options.SkipErrors); err != nil {
 			if !options.SkipErrors {
 				d.RollbackTransaction(timeoutCtx, tx)
 				return result, fmt.Errorf("batch processing failed: %w", err)
@@ -65,6 +90,12 @@ func (d *DeltaLakeRepository) InsertBatchWithOptions(ctx context.Context, exerci
 		}
 	}
 
+	if options.ingestedFile != nil {
+		file := *options.ingestedFile
+		file.Records += int64(result.SuccessCount)
+		tx.(*deltaTransaction).ingestedFile = &file
+	}
+
 	// Commit transaction
 	if err := d.CommitTransaction(timeoutCtx, tx); err != nil {
 		return result, fmt.Errorf("failed to commit transaction: %w", err)
@@ -162,6 +193,9 @@ func (d *DeltaLakeRepository) BulkLoad(ctx context.Context, dataSource DataSourc
 	if options.Timeout == 0 {
 		options.Timeout = 1 * time.Hour
 	}
+	if options.MergeSchema {
+		options.mergedColumns = make(map[string]bool)
+	}
 
 	// Create context with timeout
 	timeoutCtx, cancel := context.WithTimeout(ctx, options.Timeout)
@@ -180,7 +214,7 @@ func (d *DeltaLakeRepository) BulkLoad(ctx context.Context, dataSource DataSourc
 // Helper methods for batch processing
 
 func (d *DeltaLakeRepository) validateBatch(exercises []loader.Exercise) error {
-	validator := loader.NewValidator()
+	validator := d.Validator()
 	for i, exercise := range exercises {
 		if err := validator.Validate(exercise); err != nil {
 			return fmt.Errorf("validation failed at index %d: %w", i, err)
@@ -189,18 +223,51 @@ func (d *DeltaLakeRepository) validateBatch(exercises []loader.Exercise) error {
 	return nil
 }
 
-func (d *DeltaLakeRepository) processBatch(ctx context.Context, tx Transaction, batch []loader.Exercise, result *BatchResult, skipErrors bool) error {
+// rejectNonconformingRows records the exercises that do not fit the current
+// schema as errors on the result, unless the schema is merged, and returns the
+// others with their positions in the batch
+func (d *DeltaLakeRepository) rejectNonconformingRows(exercises []loader.Exercise, mergeSchema bool, result *BatchResult) ([]loader.Exercise, []int) {
+	indexes := make([]int, len(exercises))
+	for i := range exercises {
+		indexes[i] = i
+	}
+	if mergeSchema {
+		return exercises, indexes
+	}
+
+	accepted := make([]loader.Exercise, 0, len(exercises))
+	acceptedIndexes := make([]int, 0, len(exercises))
+	for i, exercise := range exercises {
+		if err := d.CheckRow(exercise); err != nil {
+			result.ErrorCount++
+			result.Errors = append(result.Errors, BatchError{
+				Index:  i,
+				Error:  err.Error(),
+				Record: fmt.Sprintf("ID: %d, Name: %s", exercise.ID, exercise.Name),
+				Column: rowError(err).Field,
+			})
+			continue
+		}
+		accepted = append(accepted, exercise)
+		acceptedIndexes = append(acceptedIndexes, i)
+	}
+	return accepted, acceptedIndexes
+}
+
+// processBatch inserts a slice of a batch; indexes holds the position of each
+// exercise in the whole batch
+func (d *DeltaLakeRepository) processBatch(ctx context.Context, tx Transaction, batch []loader.Exercise, indexes []int, result *BatchResult, skipErrors bool) error {
 	for i, exercise := range batch {
 		if err := tx.Insert(exercise); err != nil {
 			result.ErrorCount++
 			result.Errors = append(result.Errors, BatchError{
-				Index:  i,
+				Index:  indexes[i],
 				Error:  err.Error(),
 				Record: fmt.Sprintf("ID: %d, Name: %s", exercise.ID, exercise.Name),
 			})
 
 			if !skipErrors {
-				return fmt.Errorf("failed to insert exercise at index %d: %w", i, err)
+				return fmt.Errorf("failed to insert exercise at index %d: %w", indexes[i], err)
 			}
 		} else {
 			result.SuccessCount++
@@ -210,22 +277,28 @@ func (d *DeltaLakeRepository) processBatch(ctx context.Context, tx Transaction,
 }
 
 func (d *DeltaLakeRepository) bulkLoadFromFile(ctx context.Context, dataSource DataSource, options BulkLoadOptions) (*BulkLoadResult, error) {
+	info, err := os.Stat(dataSource.Location)
+	if err == nil && info.IsDir() || err != nil && isFilePattern(dataSource.Location) {
+		return d.bulkLoadFiles(ctx, dataSource, options)
+	}
+	return d.bulkLoadFile(ctx, dataSource, options)
+}
+
+// bulkLoadFile loads the single file of a data source
+func (d *DeltaLakeRepository) bulkLoadFile(ctx context.Context, dataSource DataSource, options BulkLoadOptions) (*BulkLoadResult, error) {
 	result := &BulkLoadResult{}
 
-	file, err := os.Open(dataSource.Location)
+	input, err := loader.OpenInput(dataSource.Location, options.Compression)
 	if err != nil {
-		return result, fmt.Errorf("failed to open file: %w", err)
+		return result, err
 	}
-	defer file.Close()
+	defer input.Close()
 
-	switch dataSource.Format {
-	case DataFormatJSON:
-		return d.bulkLoadJSON(ctx, file, options)
-	case DataFormatCSV:
-		return d.bulkLoadCSV(ctx, file, options)
-	default:
-		return result, fmt.Errorf("unsupported format: %s", dataSource.Format)
+	reader, err := recordReaderFor(input, dataSource, options)
+	if err != nil {
+		return result, err
 	}
+	return d.bulkLoadStream(ctx, reader, options)
 }
 
 func (d *DeltaLakeRepository) bulkLoadFromHTTP(ctx context.Context, dataSource DataSource, options BulkLoadOptions) (*BulkLoadResult, error) {
@@ -233,74 +306,153 @@ func (d *DeltaLakeRepository) bulkLoadFromHTTP(ctx context.Context, dataSource D
 	return &BulkLoadResult{}, fmt.Errorf("HTTP data source not implemented yet")
 }
 
-func (d *DeltaLakeRepository) bulkLoadJSON(ctx context.Context, reader io.Reader, options BulkLoadOptions) (*BulkLoadResult, error) {
-	result := &BulkLoadResult{}
+// recordReaderFor returns a reader of the records in a file, in the format
+// of the data source or, when it has none, the format of the file's extension
+func recordReaderFor(input io.Reader, dataSource DataSource, options BulkLoadOptions) (loader.RecordReader, error) {
+	format := string(dataSource.Format)
+	if format == "" {
+		var ok bool
+		if format, ok = loader.FormatOf(dataSource.Location); !ok {
+			return nil, fmt.Errorf("no format given for %s and none known for its extension", dataSource.Location)
+		}
+	}
 
-	var exercises []loader.Exercise
-	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&exercises); err != nil {
-		return result, fmt.Errorf("failed to decode JSON: %w", err)
+	reader, err := loader.NewFormatReader(format, input, dataSource.Location, loader.FormatOptions{CSV: options.CSV})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", format, err)
 	}
+	return reader, nil
+}
 
-	batchResult, err := d.InsertBatchWithOptions(ctx, exercises, BatchOptions{
-		BatchSize:    options.BatchSize,
-		ParallelJobs: options.ParallelJobs,
-		Timeout:      options.Timeout,
-		SkipErrors:   options.SkipErrors,
-	})
+// bulkLoadStream inserts records as they are read, committing them a batch at
+// a time so that only one batch is held in memory. Records that could not be
+// read are reported and counted as errored. An error reading the file or
+// committing a batch stops the load; the batches before it stay committed and
+// the error tells the ResumeAfter option that continues the load.
+func (d *DeltaLakeRepository) bulkLoadStream(ctx context.Context, reader loader.RecordReader, options BulkLoadOptions) (*BulkLoadResult, error) {
+	startTime := time.Now()
+	result := &BulkLoadResult{ResumeAfter: options.ResumeAfter}
 
+	// The rows already in the table are read once for the whole load
+	checker, err := d.newBatchChecker(options.Checks)
 	if err != nil {
 		return result, err
 	}
 
-	result.RecordsLoaded = int64(batchResult.SuccessCount)
-	result.RecordsErrored = int64(batchResult.ErrorCount)
-	result.Duration = batchResult.Duration
-	result.Version = batchResult.Version
+	var read int64
+	batch := make([]loader.SourceRecord, 0, options.BatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, stoppedLoadError(result, err)
+		}
 
-	return result, nil
-}
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, stoppedLoadError(result, err)
+		}
+		read++
+		if read <= options.ResumeAfter {
+			continue
+		}
 
-func (d *DeltaLakeRepository) bulkLoadCSV(ctx context.Context, reader io.Reader, options BulkLoadOptions) (*BulkLoadResult, error) {
-	// Use the existing CSV loader
-	csvLoader := loader.NewCSVLoader()
+		if record.Errors.HasErrors() {
+			result.RecordsErrored++
+			result.Errors = append(result.Errors, BulkError{
+				Line:   int64(record.Line),
+				Column: record.Errors[0].Field,
+				Error:  record.Errors.Error(),
+			})
+		} else {
+			batch = append(batch, record)
+		}
 
-	// Create a temporary file from the reader
-	tempFile, err := os.CreateTemp("", "bulk_load_*.csv")
-	if err != nil {
-		return &BulkLoadResult{}, fmt.Errorf("failed to create temp file: %w", err)
+		if len(batch) == options.BatchSize {
+			if err := d.bulkLoadRecords(ctx, batch, options.withProgress(result.RecordsLoaded, read), checker, result); err != nil {
+				return result, stoppedLoadError(result, err)
+			}
+			batch = batch[:0]
+			result.ResumeAfter = read
+		}
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	if _, err := io.Copy(tempFile, reader); err != nil {
-		return &BulkLoadResult{}, fmt.Errorf("failed to copy data: %w", err)
+	if len(batch) > 0 {
+		if err := d.bulkLoadRecords(ctx, batch, options.withProgress(result.RecordsLoaded, 0), checker, result); err != nil {
+			return result, stoppedLoadError(result, err)
+		}
+	} else if result.Version == 0 {
+		d.mutex.RLock()
+		result.Version = d.currentVersion
+		d.mutex.RUnlock()
 	}
-
-	exercises, err := csvLoader.LoadFromCSV(tempFile.Name())
-	if err != nil {
-		return &BulkLoadResult{}, fmt.Errorf("failed to load CSV: %w", err)
+	if read > result.ResumeAfter {
+		result.ResumeAfter = read
 	}
 
-	batchResult, err := d.InsertBatchWithOptions(ctx, exercises, BatchOptions{
-		BatchSize:    options.BatchSize,
-		ParallelJobs: options.ParallelJobs,
-		Timeout:      options.Timeout,
-		SkipErrors:   options.SkipErrors,
-	})
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
 
-	if err != nil {
-		return &BulkLoadResult{}, err
-	}
+// withProgress returns the options of a batch that ends after record read of
+// the file, or ends the file when read is 0, after loaded records of the load
+// committed before it
+func (o BulkLoadOptions) withProgress(loaded, read int64) BulkLoadOptions {
+	if o.ingestedFile != nil {
+		file := *o.ingestedFile
+		file.Records += loaded
+		file.ResumeAfter = read
+		o.ingestedFile = &file
+	}
+	return o
+}
 
-	result := &BulkLoadResult{
-		RecordsLoaded:  int64(batchResult.SuccessCount),
-		RecordsErrored: int64(batchResult.ErrorCount),
-		Duration:       batchResult.Duration,
-		Version:        batchResult.Version,
+// stoppedLoadError adds to the error that stopped a load the point it can be
+// resumed from
+func stoppedLoadError(result *BulkLoadResult, err error) error {
+	return fmt.Errorf("load stopped, resume after record %d: %w", result.ResumeAfter, err)
+}
+
+// bulkLoadRecords inserts a batch of loaded records in one commit, adding to
+// the result and reporting batch errors against the lines the records were
+// read from
+func (d *DeltaLakeRepository) bulkLoadRecords(ctx context.Context, records []loader.SourceRecord, options BulkLoadOptions, checker *BatchChecker, result *BulkLoadResult) error {
+	exercises := make([]loader.Exercise, len(records))
+	for i, record := range records {
+		exercises[i] = record.Exercise
+	}
+
+	batchResult, err := d.insertBatch(ctx, exercises, BatchOptions{
+		BatchSize:     options.BatchSize,
+		ParallelJobs:  options.ParallelJobs,
+		Timeout:       options.Timeout,
+		SkipErrors:    options.SkipErrors,
+		Checks:        options.Checks,
+		MergeSchema:   options.MergeSchema,
+		MergedColumns: options.mergedColumns,
+		ingestedFile:  options.ingestedFile,
+	}, checker)
+
+	for _, batchError := range batchResult.Errors {
+		result.Errors = append(result.Errors, BulkError{
+			Line:    int64(records[batchError.Index].Line),
+			Column:  batchError.Column,
+			Error:   batchError.Error,
+			Content: batchError.Record,
+			Check:   batchError.Check,
+			Action:  batchError.Action,
+		})
+	}
+	if err != nil {
+		return err
 	}
 
-	return result, nil
+	result.RecordsLoaded += int64(batchResult.SuccessCount)
+	result.RecordsSkipped += int64(batchResult.SkippedCount)
+	result.RecordsErrored += int64(batchResult.ErrorCount)
+	result.Version = batchResult.Version
+	return nil
 }
 
 // Streaming Implementation
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_BulkLoadBatches(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	before := repo.currentVersion
+
+	var lines []string
+	for i := 1; i <= 5; i++ {
+		lines = append(lines, fmt.Sprintf(`{"name": "Run %d", "type": "cardio", "duration": 30, "calories": 300, "date": "2024-01-15T00:00:00Z"}`, i))
+	}
+	ndjsonFile := filepath.Join(t.TempDir(), "exercises.ndjson")
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(strings.Join(lines, "\n")), 0644))
+	source := DataSource{Type: DataSourceFile, Location: ndjsonFile, Format: DataFormatNDJSON}
+
+	// Every batch is its own commit
+	result, err := repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), result.RecordsLoaded)
+	assert.Equal(t, before+3, result.Version)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	// A failing batch stops the load after the batches before it
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0",
+	}))
+	lines[3] = `{"name": "Run 4", "type": "cardio", "duration": 0}`
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(strings.Join(lines, "\n")), 0644))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 2})
+	assert.ErrorContains(t, err, "positive_duration")
+	assert.ErrorContains(t, err, "resume after record 2")
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+	assert.Equal(t, int64(2), result.ResumeAfter)
+
+	all, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 7)
+
+	// Once fixed, the load resumes after the records it committed
+	lines[3] = `{"name": "Run 4", "type": "cardio", "duration": 30}`
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(strings.Join(lines, "\n")), 0644))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 2, ResumeAfter: result.ResumeAfter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.RecordsLoaded)
+	assert.Equal(t, int64(5), result.ResumeAfter)
+
+	all, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 10)
+
+	// Checks compare records with those of earlier batches
+	repeated := []string{lines[0], `{"name": "Swim", "type": "cardio", "duration": 45}`, `{"name": "Swim", "type": "cardio", "duration": 45}`}
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(strings.Join(repeated, "\n")), 0644))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 1, Checks: BatchChecks{Duplicates: BatchCheckSkip}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+	assert.Equal(t, int64(2), result.RecordsSkipped)
+
+	// An empty file loads nothing
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte("\n"), 0644))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, result.RecordsLoaded)
+	assert.Equal(t, repo.currentVersion, result.Version)
+}
+
+func TestDeltaLakeRepository_BulkLoadFormats(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var avroData bytes.Buffer
+	writer, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:      &avroData,
+		Schema: `{"type": "record", "name": "Exercise", "fields": [{"name": "name", "type": "string"}, {"name": "type", "type": "string"}, {"name": "duration", "type": "int"}]}`,
+	})
+	require.NoError(t, err)
+	require.NoError(t, writer.Append([]map[string]interface{}{
+		{"name": "Run", "type": "cardio", "duration": int32(30)},
+		{"name": "Swim", "type": "cardio", "duration": int32(45)},
+	}))
+
+	// The format is given, whatever the file is called
+	avroFile := filepath.Join(dir, "exercises.bin")
+	require.NoError(t, os.WriteFile(avroFile, avroData.Bytes(), 0644))
+	result, err := repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: avroFile, Format: DataFormatAvro}, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+
+	// Or taken from the extension
+	csvFile := filepath.Join(dir, "exercises.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte("name;type\nLift;strength\n"), 0644))
+	result, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: csvFile}, BulkLoadOptions{CSV: loader.CSVOptions{Delimiter: ";"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Run", "Swim", "Lift"}, exerciseNames(all))
+
+	_, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: avroFile}, BulkLoadOptions{})
+	assert.ErrorContains(t, err, "no format given")
+	_, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: avroFile, Format: "xml"}, BulkLoadOptions{})
+	assert.ErrorContains(t, err, `unsupported format "xml"`)
+}
+
+func TestDeltaLakeRepository_BulkLoadCompressed(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte("name,type\nRun,cardio\nLift,strength\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	// Detected from the extension, which also names the format
+	archive := filepath.Join(dir, "exercises.csv.gz")
+	require.NoError(t, os.WriteFile(archive, compressed.Bytes(), 0644))
+	result, err := repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: archive}, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+
+	// Or given as an option
+	export := filepath.Join(dir, "exercises.export")
+	require.NoError(t, os.WriteFile(export, compressed.Bytes(), 0644))
+	result, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: export, Format: DataFormatCSV}, BulkLoadOptions{Compression: "gzip"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+
+	_, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: export, Format: DataFormatCSV}, BulkLoadOptions{Compression: "zip"})
+	assert.ErrorContains(t, err, `unsupported compression "zip"`)
+}
+
+func TestDeltaLakeRepository_BulkLoadRowErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	// Rows that cannot be read are reported and the rest still load
+	csvFile := filepath.Join(t.TempDir(), "exercises.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte("name,type,duration\nRun,cardio,30\nRow,cardio,long\nSwim,cardio\nLift,strength,45\n"), 0644))
+	result, err := repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: csvFile}, BulkLoadOptions{BatchSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+	assert.Equal(t, int64(2), result.RecordsErrored)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, int64(3), result.Errors[0].Line)
+	assert.Equal(t, "duration", result.Errors[0].Column)
+	assert.Equal(t, int64(4), result.Errors[1].Line)
+	assert.Equal(t, "record", result.Errors[1].Column)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Run", "Lift"}, exerciseNames(all))
+}
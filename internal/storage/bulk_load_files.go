@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// isFilePattern reports whether a location is a glob pattern
+func isFilePattern(location string) bool {
+	return strings.ContainsAny(location, "*?[")
+}
+
+// bulkLoadFiles loads the files of a directory or glob pattern one after
+// another, skipping files already ingested that are unchanged. Files are
+// recorded in the table metadata as their batches commit. A file that fails
+// is reported and the load goes on with the next; batches it committed before
+// failing stay committed, and the next run resumes the file after them while
+// it is unchanged.
+func (d *DeltaLakeRepository) bulkLoadFiles(ctx context.Context, dataSource DataSource, options BulkLoadOptions) (*BulkLoadResult, error) {
+	startTime := time.Now()
+	result := &BulkLoadResult{Files: make([]FileLoadResult, 0)}
+	if options.ResumeAfter > 0 {
+		return result, fmt.Errorf("resume_after applies to single files; directory and pattern loads resume their files themselves")
+	}
+	switch options.ChangedPartialFiles {
+	case PartialFileFail, PartialFileResume, PartialFileRestart:
+	default:
+		return result, fmt.Errorf("unsupported changed_partial_files %q", options.ChangedPartialFiles)
+	}
+
+	paths, err := sourceFiles(dataSource)
+	if err != nil {
+		return result, err
+	}
+
+	failed := 0
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		fileResult, fileErrors := d.bulkLoadSourceFile(ctx, path, dataSource, options)
+		result.Files = append(result.Files, fileResult)
+		result.RecordsLoaded += fileResult.RecordsLoaded
+		result.RecordsSkipped += fileResult.RecordsSkipped
+		result.RecordsErrored += fileResult.RecordsErrored
+		result.Errors = append(result.Errors, fileErrors...)
+		if fileResult.Status == FileLoadFailed {
+			failed++
+		}
+	}
+
+	d.mutex.RLock()
+	result.Version = d.currentVersion
+	d.mutex.RUnlock()
+	result.Duration = time.Since(startTime)
+
+	if failed > 0 {
+		return result, fmt.Errorf("failed to load %d of %d files", failed, len(paths))
+	}
+	return result, nil
+}
+
+// bulkLoadSourceFile loads one file of a directory or pattern unless it was
+// ingested before, returning its result and the errors of its records. Every
+// batch commit records how far the file got, so that a load that stops
+// resumes after the last committed batch.
+func (d *DeltaLakeRepository) bulkLoadSourceFile(ctx context.Context, path string, dataSource DataSource, options BulkLoadOptions) (FileLoadResult, []BulkError) {
+	fileResult := FileLoadResult{Path: path}
+	fail := func(err error) FileLoadResult {
+		fileResult.Status = FileLoadFailed
+		fileResult.Error = err.Error()
+		return fileResult
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fail(err), nil
+	}
+	recorded, unchanged, checksum, err := d.checkIngested(path, info)
+	if err != nil {
+		return fail(err), nil
+	}
+	ingested := &IngestedFile{Path: path, Size: info.Size(), ModTime: info.ModTime(), Checksum: checksum}
+	switch {
+	case recorded == nil || recorded.ResumeAfter == 0 && !unchanged:
+	case recorded.ResumeAfter == 0:
+		fileResult.Status = FileLoadSkipped
+		return fileResult, nil
+	case unchanged || options.ChangedPartialFiles == PartialFileResume:
+		options.ResumeAfter = recorded.ResumeAfter
+		ingested.Records = recorded.Records
+	case options.ChangedPartialFiles != PartialFileRestart:
+		return fail(fmt.Errorf("file changed after a load of it stopped after record %d; load it again with changed_partial_files %q or %q",
+			recorded.ResumeAfter, PartialFileResume, PartialFileRestart)), nil
+	}
+	ingested.IngestedAt = time.Now()
+	options.ingestedFile = ingested
+
+	dataSource.Location = path
+	loadResult, err := d.bulkLoadFile(ctx, dataSource, options)
+	fileResult.RecordsLoaded = loadResult.RecordsLoaded
+	fileResult.RecordsSkipped = loadResult.RecordsSkipped
+	fileResult.RecordsErrored = loadResult.RecordsErrored
+	fileResult.Version = loadResult.Version
+
+	fileErrors := loadResult.Errors
+	for i := range fileErrors {
+		fileErrors[i].File = path
+	}
+	if err != nil {
+		fileResult.ResumeAfter = loadResult.ResumeAfter
+		return fail(err), fileErrors
+	}
+
+	// A file whose last batch committed nothing is recorded on its own
+	d.mutex.RLock()
+	current := d.ingestedFiles[path]
+	d.mutex.RUnlock()
+	if current == nil || current.Checksum != checksum || current.ResumeAfter != 0 {
+		ingested.Records += loadResult.RecordsLoaded
+		ingested.Version = loadResult.Version
+		if err := d.recordIngestedFile(ingested); err != nil {
+			return fail(fmt.Errorf("failed to record ingested file: %w", err)), fileErrors
+		}
+	}
+
+	fileResult.Status = FileLoadLoaded
+	return fileResult, fileErrors
+}
+
+// sourceFiles returns the absolute paths of the files below a directory, or
+// of those matching a glob pattern, in order. Hidden files and files whose
+// names start with an underscore are left out, and so are files of unknown
+// formats when the data source has no format.
+func sourceFiles(dataSource DataSource) ([]string, error) {
+	var paths []string
+	include := func(path string) {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return
+		}
+		if _, ok := loader.FormatOf(path); !ok && dataSource.Format == "" {
+			return
+		}
+		paths = append(paths, path)
+	}
+
+	if isFilePattern(dataSource.Location) {
+		if _, err := os.Stat(dataSource.Location); err != nil {
+			matches, err := filepath.Glob(dataSource.Location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern %s: %w", dataSource.Location, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", dataSource.Location)
+			}
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+					include(match)
+				}
+			}
+			return absolutePaths(paths)
+		}
+	}
+
+	err := filepath.WalkDir(dataSource.Location, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != dataSource.Location && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			include(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dataSource.Location, err)
+	}
+	return absolutePaths(paths)
+}
+
+func absolutePaths(paths []string) ([]string, error) {
+	for i, path := range paths {
+		absolute, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = absolute
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// checkIngested returns the record of a file if it was ingested, whether the
+// file is unchanged since, and its checksum. Files of the recorded size and
+// modification time are taken as unchanged without reading them.
+func (d *DeltaLakeRepository) checkIngested(path string, info os.FileInfo) (*IngestedFile, bool, string, error) {
+	d.mutex.RLock()
+	recorded := d.ingestedFiles[path]
+	d.mutex.RUnlock()
+
+	if recorded != nil && recorded.Size == info.Size() && recorded.ModTime.Equal(info.ModTime()) {
+		return recorded, true, recorded.Checksum, nil
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return nil, false, "", err
+	}
+	return recorded, recorded != nil && recorded.Checksum == checksum, checksum, nil
+}
+
+// fileChecksum returns the hex SHA-256 of a file's contents
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (d *DeltaLakeRepository) recordIngestedFile(file *IngestedFile) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.ingestedFiles[file.Path] = file
+	return d.saveMetadata()
+}
+
+// GetIngestedFiles returns the files that directory and pattern bulk loads
+// have ingested, in order of path
+func (d *DeltaLakeRepository) GetIngestedFiles(ctx context.Context) ([]IngestedFile, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	files := make([]IngestedFile, 0, len(d.ingestedFiles))
+	for _, file := range d.ingestedFiles {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSourceFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func fileStatuses(files []FileLoadResult) map[string]FileLoadStatus {
+	statuses := make(map[string]FileLoadStatus, len(files))
+	for _, file := range files {
+		statuses[filepath.Base(file.Path)] = file.Status
+	}
+	return statuses
+}
+
+func TestDeltaLakeRepository_BulkLoadDirectory(t *testing.T) {
+	lakePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(lakePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeSourceFiles(t, dir, map[string]string{
+		"january.csv":          "name,type\nRun,cardio\nLift,strength\n",
+		"february.ndjson":      `{"name": "Swim", "type": "cardio"}` + "\n",
+		"archive/march.json":   `[{"name": "Row", "type": "cardio"}]`,
+		"notes.txt":            "not exercises",
+		".january.csv.swp":     "editor state",
+		"_SUCCESS":             "",
+		"_staging/april.csv":   "name\nHidden\n",
+		"archive/.old/may.csv": "name\nHidden\n",
+	})
+	source := DataSource{Type: DataSourceFile, Location: dir}
+
+	result, err := repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), result.RecordsLoaded)
+	assert.Equal(t, map[string]FileLoadStatus{
+		"january.csv":     FileLoadLoaded,
+		"february.ndjson": FileLoadLoaded,
+		"march.json":      FileLoadLoaded,
+	}, fileStatuses(result.Files))
+	for _, file := range result.Files {
+		assert.True(t, filepath.IsAbs(file.Path))
+		assert.NotZero(t, file.Version)
+	}
+
+	ingested, err := repo.GetIngestedFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, ingested, 3)
+	assert.Equal(t, filepath.Join(dir, "archive", "march.json"), ingested[0].Path)
+	assert.Len(t, ingested[0].Checksum, 64)
+	assert.Equal(t, int64(1), ingested[0].Records)
+	january := ingested[2]
+	assert.Equal(t, int64(len("name,type\nRun,cardio\nLift,strength\n")), january.Size)
+
+	// A re-run skips the files it ingested, also once they are touched
+	touched := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "january.csv"), touched, touched))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, result.RecordsLoaded)
+	assert.Equal(t, map[string]FileLoadStatus{
+		"january.csv":     FileLoadSkipped,
+		"february.ndjson": FileLoadSkipped,
+		"march.json":      FileLoadSkipped,
+	}, fileStatuses(result.Files))
+
+	// Changed and new files are loaded, and the record survives a restart
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(lakePath, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	writeSourceFiles(t, dir, map[string]string{
+		"february.ndjson": `{"name": "Swim", "type": "cardio"}` + "\n" + `{"name": "Dive", "type": "cardio"}` + "\n",
+		"june.csv":        "name\nStretch\n",
+	})
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.RecordsLoaded)
+	assert.Equal(t, map[string]FileLoadStatus{
+		"january.csv":     FileLoadSkipped,
+		"february.ndjson": FileLoadLoaded,
+		"march.json":      FileLoadSkipped,
+		"june.csv":        FileLoadLoaded,
+	}, fileStatuses(result.Files))
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 7)
+}
+
+func TestDeltaLakeRepository_BulkLoadPattern(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeSourceFiles(t, dir, map[string]string{
+		"runs-1.csv":  "name,type\nRun,cardio\n",
+		"runs-2.csv":  "name,type\nJog,cardio\n",
+		"lifts-1.csv": "name,type\nLift,strength\n",
+		"runs-3.dat":  "name,type\nSprint,cardio\n",
+	})
+
+	result, err := repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: filepath.Join(dir, "runs-*")}, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]FileLoadStatus{"runs-1.csv": FileLoadLoaded, "runs-2.csv": FileLoadLoaded}, fileStatuses(result.Files))
+
+	// A format makes files of any name part of the load
+	result, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: filepath.Join(dir, "runs-*"), Format: DataFormatCSV}, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]FileLoadStatus{
+		"runs-1.csv": FileLoadSkipped,
+		"runs-2.csv": FileLoadSkipped,
+		"runs-3.dat": FileLoadLoaded,
+	}, fileStatuses(result.Files))
+
+	_, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: filepath.Join(dir, "swims-*")}, BulkLoadOptions{})
+	assert.ErrorContains(t, err, "no files match")
+}
+
+func TestDeltaLakeRepository_BulkLoadChangedPartialFile(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0",
+	}))
+
+	// The third record of each file stops its load after the first batch
+	lines := func(prefix string, last int) string {
+		return `{"name": "` + prefix + ` a", "type": "cardio", "duration": 30}` + "\n" +
+			`{"name": "` + prefix + ` b", "type": "cardio", "duration": 40}` + "\n" +
+			`{"name": "` + prefix + ` c", "type": "cardio", "duration": ` + fmt.Sprint(last) + `}` + "\n"
+	}
+	dir := t.TempDir()
+	writeSourceFiles(t, dir, map[string]string{"rides.ndjson": lines("Ride", 0), "runs.ndjson": lines("Run", 0)})
+	source := DataSource{Type: DataSourceFile, Location: dir}
+	options := BulkLoadOptions{BatchSize: 2}
+
+	result, err := repo.BulkLoad(ctx, source, options)
+	assert.ErrorContains(t, err, "failed to load 2 of 2 files")
+	assert.Equal(t, int64(4), result.RecordsLoaded)
+
+	// Progress is recorded with the batch that made it
+	ingested, err := repo.GetIngestedFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, ingested, 2)
+	assert.Equal(t, int64(2), ingested[1].Records)
+	assert.Equal(t, int64(2), ingested[1].ResumeAfter)
+	assert.Equal(t, repo.currentVersion, ingested[1].Version)
+
+	// Fixed files are not silently loaded from the start again
+	writeSourceFiles(t, dir, map[string]string{"rides.ndjson": lines("Ride", 50), "runs.ndjson": lines("Run", 50)})
+	result, err = repo.BulkLoad(ctx, source, options)
+	assert.ErrorContains(t, err, "failed to load 2 of 2 files")
+	assert.Contains(t, result.Files[0].Error, `file changed after a load of it stopped after record 2; load it again with changed_partial_files "resume" or "restart"`)
+	assert.Zero(t, result.RecordsLoaded)
+
+	restart := options
+	restart.ChangedPartialFiles = PartialFileRestart
+	result, err = repo.BulkLoad(ctx, DataSource{Type: DataSourceFile, Location: filepath.Join(dir, "rides*")}, restart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.RecordsLoaded)
+
+	resume := options
+	resume.ChangedPartialFiles = PartialFileResume
+	result, err = repo.BulkLoad(ctx, source, resume)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+	assert.Equal(t, map[string]FileLoadStatus{"rides.ndjson": FileLoadSkipped, "runs.ndjson": FileLoadLoaded}, fileStatuses(result.Files))
+
+	runs, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorLike, Value: "Run%"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Run a", "Run b", "Run c"}, exerciseNames(runs))
+	ingested, err = repo.GetIngestedFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 3}, []int64{ingested[0].Records, ingested[1].Records})
+	assert.Equal(t, []int64{0, 0}, []int64{ingested[0].ResumeAfter, ingested[1].ResumeAfter})
+
+	resume.ChangedPartialFiles = "overwrite"
+	_, err = repo.BulkLoad(ctx, source, resume)
+	assert.ErrorContains(t, err, `unsupported changed_partial_files "overwrite"`)
+}
+
+func TestDeltaLakeRepository_BulkLoadFailedFile(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeSourceFiles(t, dir, map[string]string{
+		"a.csv": "name,type\nRun,cardio\n",
+		"b.csv": "name,type\nRun,cardio\n",
+		"c.csv": "name,type\nLift,strength\n",
+	})
+	source := DataSource{Type: DataSourceFile, Location: dir}
+
+	// The other files load, and the failed one is tried again next time
+	failDuplicates := BulkLoadOptions{Checks: BatchChecks{Duplicates: BatchCheckFail}}
+	result, err := repo.BulkLoad(ctx, source, failDuplicates)
+	assert.ErrorContains(t, err, "failed to load 1 of 3 files")
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+	require.Len(t, result.Files, 3)
+	assert.Equal(t, FileLoadFailed, result.Files[1].Status)
+	assert.Contains(t, result.Files[1].Error, "batch check failed")
+
+	ingested, err := repo.GetIngestedFiles(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ingested, 2)
+
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+	assert.Equal(t, map[string]FileLoadStatus{
+		"a.csv": FileLoadSkipped,
+		"b.csv": FileLoadLoaded,
+		"c.csv": FileLoadSkipped,
+	}, fileStatuses(result.Files))
+
+	// A file that stops partway resumes after the batches it committed
+	writeSourceFiles(t, dir, map[string]string{
+		"e.ndjson": `{"name": "Row", "type": "cardio"}` + "\n" + `{"name": "Ski", "type": "cardio"}` + "\n" + `{"name": "Lift", "type": "strength"}` + "\n",
+	})
+	failDuplicates.BatchSize = 1
+	result, err = repo.BulkLoad(ctx, source, failDuplicates)
+	assert.ErrorContains(t, err, "failed to load 1 of 4 files")
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+	assert.Equal(t, int64(2), result.Files[3].ResumeAfter)
+	assert.Contains(t, result.Files[3].Error, "resume after record 2")
+
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+	ingested, err = repo.GetIngestedFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, ingested, 4)
+	assert.Equal(t, int64(3), ingested[3].Records)
+	assert.Zero(t, ingested[3].ResumeAfter)
+
+	_, err = repo.BulkLoad(ctx, source, BulkLoadOptions{ResumeAfter: 1})
+	assert.ErrorContains(t, err, "resume_after applies to single files")
+
+	// Records caught by checks name the file they came from
+	writeSourceFiles(t, dir, map[string]string{"d.csv": "name,type\nRow,cardio\nRow,cardio\n"})
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{Checks: BatchChecks{Duplicates: BatchCheckSkip}})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Errors)
+	for _, bulkError := range result.Errors {
+		assert.Equal(t, filepath.Join(dir, "d.csv"), bulkError.File)
+	}
+}
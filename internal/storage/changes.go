@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// maxChangeLogEvents bounds the change events kept in memory; the oldest
+// events are dropped first
+const maxChangeLogEvents = 100000
+
+// diffChanges returns the row changes that turn the before rows into the
+// after rows, matching rows by ID. Rows that are written unchanged produce no
+// event.
+func diffChanges(before, after []loader.Exercise) []ChangeEvent {
+	previous := make(map[int]loader.Exercise, len(before))
+	for _, exercise := range before {
+		previous[exercise.ID] = exercise
+	}
+	current := make(map[int]bool, len(after))
+	for _, exercise := range after {
+		current[exercise.ID] = true
+	}
+
+	var changes []ChangeEvent
+	for _, exercise := range before {
+		if !current[exercise.ID] {
+			old := exercise
+			changes = append(changes, ChangeEvent{Type: ChangeTypeDelete, RecordID: &old.ID, Before: &old})
+		}
+	}
+	for _, exercise := range after {
+		row := exercise
+		old, existed := previous[row.ID]
+		switch {
+		case !existed:
+			changes = append(changes, ChangeEvent{Type: ChangeTypeInsert, RecordID: &row.ID, After: &row})
+		case contentKey(old) != contentKey(row):
+			changes = append(changes, ChangeEvent{Type: ChangeTypeUpdate, RecordID: &row.ID, Before: &old, After: &row})
+		}
+	}
+	return changes
+}
+
+// recordChanges appends the row changes of a committed transaction to the
+// change log. The caller must hold the write lock.
+func (d *DeltaLakeRepository) recordChanges(changes []ChangeEvent, version *Version, txID string) {
+	for _, change := range changes {
+		change.Timestamp = version.Timestamp
+		change.Version = version.ID
+		change.Operation = Operation{
+			Type:      OperationTypeWrite,
+			Timestamp: version.Timestamp,
+			Details:   map[string]interface{}{"transaction": txID},
+		}
+		if change.Type == ChangeTypeDelete {
+			change.Operation.Type = OperationTypeDelete
+		}
+		d.changeLog = append(d.changeLog, change)
+	}
+
+	if overflow := len(d.changeLog) - maxChangeLogEvents; overflow > 0 {
+		d.changeLog = append([]ChangeEvent(nil), d.changeLog[overflow:]...)
+	}
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Column mapping gives every column a stable ID and a physical name under
+// which data files store its values. Renaming a column only changes its
+// logical name and dropping one only removes it from the schema, so neither
+// rewrites data, and earlier versions keep reading through their own schema.
+
+// physicalName returns the name under which data files store a field. Fields
+// written before column mapping use their logical name.
+func (f Field) physicalName() string {
+	if f.PhysicalName != "" {
+		return f.PhysicalName
+	}
+	return f.Name
+}
+
+// ensureColumnMapping assigns column IDs to the fields of schemas written
+// before column mapping. Columns could not be renamed then, so a name
+// identifies the same column in every schema and is its physical name. The
+// caller must hold the write lock.
+func (d *DeltaLakeRepository) ensureColumnMapping() {
+	ids := make([]int64, 0, len(d.schemas))
+	for id := range d.schemas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var maxColumnID int64
+	for _, id := range ids {
+		if d.schemas[id].MaxColumnID > maxColumnID {
+			maxColumnID = d.schemas[id].MaxColumnID
+		}
+	}
+
+	columnIDs := make(map[string]int64)
+	for _, id := range ids {
+		schema := d.schemas[id]
+		for i := range schema.Fields {
+			field := &schema.Fields[i]
+			if field.ID == 0 {
+				if _, ok := columnIDs[field.Name]; !ok {
+					maxColumnID++
+					columnIDs[field.Name] = maxColumnID
+				}
+				field.ID = columnIDs[field.Name]
+			}
+			if field.PhysicalName == "" {
+				field.PhysicalName = field.Name
+			}
+		}
+		schema.MaxColumnID = maxColumnID
+	}
+}
+
+// matchColumn returns the current column a field of a new schema refers to:
+// the column with its ID, or without an ID the column with its name. The
+// caller must hold the read lock.
+func (d *DeltaLakeRepository) matchColumn(field Field) (Field, bool) {
+	for _, current := range d.currentSchema.Fields {
+		if field.ID != 0 && current.ID == field.ID || field.ID == 0 && current.Name == field.Name {
+			return current, true
+		}
+	}
+	return Field{}, false
+}
+
+// assignColumnMapping gives the fields of a validated new schema the ID and
+// physical name of the column they refer to, and new columns fresh ones. The
+// caller must hold the write lock.
+func (d *DeltaLakeRepository) assignColumnMapping(newSchema *Schema) {
+	maxColumnID := d.currentSchema.MaxColumnID
+	for i := range newSchema.Fields {
+		field := &newSchema.Fields[i]
+		if current, ok := d.matchColumn(*field); ok {
+			field.ID = current.ID
+			field.PhysicalName = current.physicalName()
+			continue
+		}
+		maxColumnID++
+		field.ID = maxColumnID
+		field.PhysicalName = fmt.Sprintf("col-%d", maxColumnID)
+	}
+	newSchema.MaxColumnID = maxColumnID
+}
+
+// checkColumnUnused reports an error when a column that is about to be
+// renamed or removed is used by a constraint, index or partitioning. Outlier
+// rules follow their columns instead; see remapOutlierRules. The caller must
+// hold the read lock.
+func (d *DeltaLakeRepository) checkColumnUnused(name, change string) error {
+	var users []string
+	for _, constraint := range d.constraints {
+		if containsColumn(constraintColumns(constraint), name) {
+			users = append(users, fmt.Sprintf("constraint %s", constraint.Name))
+		}
+	}
+	indexNames := make([]string, 0, len(d.indexes))
+	for indexName, index := range d.indexes {
+		if containsColumn(index.Columns, name) {
+			indexNames = append(indexNames, indexName)
+		}
+	}
+	sort.Strings(indexNames)
+	for _, indexName := range indexNames {
+		users = append(users, fmt.Sprintf("index %s", indexName))
+	}
+	if containsColumn(d.partitionFields(), name) {
+		users = append(users, "table partitioning")
+	}
+
+	if len(users) > 0 {
+		return fmt.Errorf("field %s cannot be %s: it is used by %s", name, change, strings.Join(users, ", "))
+	}
+	return nil
+}
+
+// remapOutlierRules points the outlier rules at the new names of renamed
+// columns and removes the rules on dropped columns. The caller must hold the
+// write lock.
+func (d *DeltaLakeRepository) remapOutlierRules(oldSchema, newSchema *Schema) {
+	newNames := make(map[int64]string, len(newSchema.Fields))
+	for _, field := range newSchema.Fields {
+		newNames[field.ID] = field.Name
+	}
+	renamed := make(map[string]string, len(oldSchema.Fields))
+	for _, field := range oldSchema.Fields {
+		if name, ok := newNames[field.ID]; ok {
+			renamed[field.Name] = name
+		}
+	}
+
+	rules := make([]OutlierRule, 0, len(d.outlierRules))
+	for _, rule := range d.outlierRules {
+		column, ok := renamed[rule.Column]
+		if !ok {
+			continue
+		}
+		rule.Column = column
+		if rule.GroupBy != "" {
+			if rule.GroupBy, ok = renamed[rule.GroupBy]; !ok {
+				continue
+			}
+		}
+		rules = append(rules, rule)
+	}
+	d.outlierRules = rules
+}
+
+// constraintColumns returns the columns a constraint reads
+func constraintColumns(constraint Constraint) []string {
+	compiled, err := compileConstraint(constraint)
+	if err != nil {
+		return constraint.Columns
+	}
+
+	return compiled.columns()
+}
+
+func containsColumn(columns []string, name string) bool {
+	for _, column := range columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameColumn gives a column a new name in a metadata-only commit. Data
+// files keep the column under its physical name, and earlier versions read
+// it under its old name.
+func (d *DeltaLakeRepository) RenameColumn(ctx context.Context, name, newName string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if name == "id" {
+		return fmt.Errorf("field id cannot be renamed")
+	}
+	newSchema, err := d.editSchema(name, func(fields []Field, i int) []Field {
+		fields[i].Name = newName
+		return fields
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.evolveSchemaLocked(newSchema, fmt.Sprintf("Column %s renamed to %s", name, newName))
+}
+
+// DropColumn removes a column from the schema in a metadata-only commit.
+// Data files keep its values, so earlier versions still read them.
+func (d *DeltaLakeRepository) DropColumn(ctx context.Context, name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	newSchema, err := d.editSchema(name, func(fields []Field, i int) []Field {
+		return append(fields[:i], fields[i+1:]...)
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.evolveSchemaLocked(newSchema, fmt.Sprintf("Column %s dropped", name))
+}
+
+// editSchema returns a copy of the current schema with the fields changed by
+// edit, which receives the position of the named column. The caller must hold
+// the read lock.
+func (d *DeltaLakeRepository) editSchema(name string, edit func(fields []Field, i int) []Field) (*Schema, error) {
+	newSchema := *d.currentSchema
+	newSchema.Fields = make([]Field, len(d.currentSchema.Fields))
+	copy(newSchema.Fields, d.currentSchema.Fields)
+
+	for i, field := range newSchema.Fields {
+		if field.Name == name {
+			newSchema.Fields = edit(newSchema.Fields, i)
+			return &newSchema, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown column %s", name)
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_RenameColumn(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	before := repo.currentVersion
+
+	require.NoError(t, repo.RenameColumn(ctx, "duration", "duration_minutes"))
+
+	// The rename is a metadata-only commit
+	version := repo.versions[repo.currentVersion]
+	assert.Equal(t, dataFileName(before), version.DataFile)
+	assert.Equal(t, "Column duration renamed to duration_minutes", version.Description)
+	field, ok := repo.schemaField("duration_minutes")
+	require.True(t, ok)
+	assert.Equal(t, "duration", field.PhysicalName)
+	_, ok = repo.schemaField("duration")
+	assert.False(t, ok)
+
+	// Outlier rules follow the column
+	rules, err := repo.GetOutlierRules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "duration_minutes", rules[0].Column)
+
+	// The column stays bound to its Exercise field and is read under its new
+	// name only
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assert.Equal(t, 30, all[0].Duration)
+	assert.Nil(t, all[0].Extra)
+
+	// It is written through the field or under its new name
+	require.NoError(t, repo.Insert(loader.Exercise{Name: "Rowing", Type: "cardio", Calories: 200, Date: all[0].Date,
+		Extra: map[string]interface{}{"duration_minutes": 20}}))
+	changed := all[0]
+	changed.Duration = 50
+	require.NoError(t, repo.Update(changed))
+	_, err = repo.UpdateWhere(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Yoga"}}},
+		map[string]interface{}{"duration_minutes": 75})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	long, err := repo.QueryWithFilter(ctx, Filter{
+		Conditions: []Condition{{Field: "duration_minutes", Operator: OperatorGreaterThanOrEqual, Value: 20}},
+		SortBy:     []SortField{{Field: "duration_minutes"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Rowing", "Swimming", "Running", "Yoga"}, exerciseNames(long))
+	assert.Equal(t, []int{20, 45, 50, 75}, []int{long[0].Duration, long[1].Duration, long[2].Duration, long[3].Duration})
+	assert.Nil(t, long[0].Extra)
+
+	// Earlier versions keep the original name
+	old, err := repo.GetByVersion(ctx, before)
+	require.NoError(t, err)
+	require.Len(t, old, 4)
+	assert.Equal(t, 60, old[3].Duration)
+	assert.Nil(t, old[3].Extra)
+
+	history, err := repo.GetSchemaHistory(ctx)
+	require.NoError(t, err)
+	changes := SchemaChanges(&history[0], &history[1])
+	assert.Equal(t, map[string]string{"duration": "duration_minutes"}, changes["renamed_fields"])
+	assert.Empty(t, changes["added_fields"])
+	assert.Empty(t, changes["removed_fields"])
+}
+
+func TestDeltaLakeRepository_RenameColumnInsertAndValidate(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	require.NoError(t, repo.RenameColumn(ctx, "duration", "duration_minutes"))
+
+	rowing := loader.Exercise{Name: "Rowing", Type: "cardio", Duration: 20, Calories: 200, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, repo.CheckRow(rowing))
+	require.NoError(t, repo.InsertBatch([]loader.Exercise{rowing}))
+
+	// Rules on the new name apply to the field
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration_minutes > 0",
+	}))
+	rowing.Duration = 0
+	assert.ErrorContains(t, repo.Insert(rowing), "duration_minutes = 0 violates duration_minutes > 0")
+
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	// Rows read back validate, and errors name the column
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+	assert.Equal(t, 20, all[4].Duration)
+	validator := repo.Validator()
+	for _, row := range all {
+		assert.NoError(t, validator.Validate(row), row.Name)
+		assert.NoError(t, repo.CheckRow(row), row.Name)
+	}
+
+	var validationErrors loader.ValidationErrors
+	require.ErrorAs(t, validator.Validate(rowing), &validationErrors)
+	assert.Equal(t, "duration_minutes", validationErrors[0].Field)
+}
+
+func TestDeltaLakeRepository_DropColumn(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	before := repo.currentVersion
+
+	require.NoError(t, repo.DropColumn(ctx, "description"))
+	assert.Equal(t, dataFileName(before), repo.versions[repo.currentVersion].DataFile)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all[0].Description)
+
+	old, err := repo.GetByVersion(ctx, before)
+	require.NoError(t, err)
+	assert.Equal(t, "Morning run", old[0].Description)
+
+	// A column added under a dropped name is a new column
+	evolveWith(t, repo, Field{Name: "description", Type: FieldTypeString, Nullable: true})
+	field, ok := repo.schemaField("description")
+	require.True(t, ok)
+	assert.NotEqual(t, "description", field.PhysicalName)
+
+	all, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all[0].Description)
+
+	require.NoError(t, repo.Insert(loader.Exercise{Name: "Rowing", Type: "cardio", Duration: 20, Calories: 200, Date: all[0].Date, Description: "Erg"}))
+	rowing, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "description", Operator: OperatorEqual, Value: "Erg"}}})
+	require.NoError(t, err)
+	require.Len(t, rowing, 1)
+	assert.Equal(t, "Rowing", rowing[0].Name)
+}
+
+func TestDeltaLakeRepository_ColumnMappingErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0",
+	}))
+	require.NoError(t, repo.CreateIndex(ctx, "idx_type", []string{"type"}))
+
+	assert.ErrorContains(t, repo.RenameColumn(ctx, "id", "exercise_id"), "cannot be renamed")
+	assert.ErrorContains(t, repo.DropColumn(ctx, "id"), "field id cannot be removed")
+	assert.ErrorContains(t, repo.RenameColumn(ctx, "weight", "mass"), "unknown column weight")
+	assert.ErrorContains(t, repo.RenameColumn(ctx, "name", "type"), "listed more than once")
+	assert.ErrorContains(t, repo.RenameColumn(ctx, "duration", "minutes"), "used by constraint positive_duration")
+	assert.ErrorContains(t, repo.DropColumn(ctx, "type"), "used by index idx_type")
+
+	schema, err := repo.GetCurrentSchema(ctx)
+	require.NoError(t, err)
+	schema.Fields = append(schema.Fields, Field{ID: 99, Name: "ghost", Type: FieldTypeString, Nullable: true})
+	assert.ErrorContains(t, repo.EvolveSchema(ctx, schema), "unknown column id 99")
+
+	// A schema carrying a column's ID under a new name renames it
+	schema, err = repo.GetCurrentSchema(ctx)
+	require.NoError(t, err)
+	for i := range schema.Fields {
+		if schema.Fields[i].Name == "calories" {
+			schema.Fields[i].Name = "kcal"
+		}
+	}
+	require.NoError(t, repo.EvolveSchema(ctx, schema))
+	field, ok := repo.schemaField("kcal")
+	require.True(t, ok)
+	assert.Equal(t, "calories", field.PhysicalName)
+}
+
+func TestDeltaLakeRepository_ColumnMappingUpgrade(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	require.NoError(t, repo.Close())
+
+	// Strip the column mapping as written before it existed
+	metadataPath := filepath.Join(basePath, "_delta_log", "metadata.json")
+	data, err := os.ReadFile(metadataPath)
+	require.NoError(t, err)
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	schema := metadata["schema"].(map[string]interface{})
+	delete(schema, "max_column_id")
+	for _, field := range schema["fields"].([]interface{}) {
+		delete(field.(map[string]interface{}), "id")
+		delete(field.(map[string]interface{}), "physical_name")
+	}
+	delete(metadata, "schemas")
+	data, err = json.Marshal(metadata)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(metadataPath, data, 0644))
+
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	for i, field := range repo.currentSchema.Fields {
+		assert.EqualValues(t, i+1, field.ID)
+		assert.Equal(t, field.Name, field.PhysicalName)
+	}
+	assert.EqualValues(t, 7, repo.currentSchema.MaxColumnID)
+
+	require.NoError(t, repo.RenameColumn(context.Background(), "duration", "duration_minutes"))
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, 30, all[0].Duration)
+}
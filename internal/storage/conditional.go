@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// DeleteWhere deletes every row matching the filter in a single commit
+func (d *DeltaLakeRepository) DeleteWhere(ctx context.Context, filter Filter) (*MutationResult, error) {
+	startTime := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.validateMutationFilter(filter); err != nil {
+		return nil, err
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current data: %w", err)
+	}
+
+	result := &MutationResult{}
+	tx := d.beginTransactionLocked()
+	renamed := renamedFields(d.currentSchema)
+	for _, exercise := range exercises {
+		if !d.matchesFilter(columnView(exercise, renamed), filter) {
+			continue
+		}
+		if err := tx.Delete(exercise.ID); err != nil {
+			d.rollbackTransactionInternal(tx)
+			return nil, fmt.Errorf("failed to delete exercise %d: %w", exercise.ID, err)
+		}
+		result.Matched++
+	}
+	result.Affected = result.Matched
+
+	return d.finishMutation(tx, result, startTime)
+}
+
+// UpdateWhere sets the assigned columns of every row matching the filter in a
+// single commit. Assignments are keyed by column name; the id column cannot be
+// assigned.
+func (d *DeltaLakeRepository) UpdateWhere(ctx context.Context, filter Filter, assignments map[string]interface{}) (*MutationResult, error) {
+	startTime := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.validateMutationFilter(filter); err != nil {
+		return nil, err
+	}
+	if len(assignments) == 0 {
+		return nil, fmt.Errorf("update requires at least one assignment")
+	}
+	var scratch loader.Exercise
+	for column, value := range assignments {
+		if err := d.assignColumn(&scratch, column, value); err != nil {
+			return nil, err
+		}
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current data: %w", err)
+	}
+
+	result := &MutationResult{}
+	tx := d.beginTransactionLocked()
+	renamed := renamedFields(d.currentSchema)
+	for _, exercise := range exercises {
+		if !d.matchesFilter(columnView(exercise, renamed), filter) {
+			continue
+		}
+		result.Matched++
+
+		updated := exercise
+		for column, value := range assignments {
+			d.assignColumn(&updated, column, value)
+		}
+		if contentKey(updated) == contentKey(exercise) {
+			continue
+		}
+		if err := tx.Update(updated); err != nil {
+			d.rollbackTransactionInternal(tx)
+			return nil, fmt.Errorf("failed to update exercise %d: %w", exercise.ID, err)
+		}
+		result.Affected++
+	}
+
+	return d.finishMutation(tx, result, startTime)
+}
+
+// finishMutation commits a conditional mutation, or discards it when it
+// affects no rows so that no empty version is created. The caller must hold
+// the write lock.
+func (d *DeltaLakeRepository) finishMutation(tx *deltaTransaction, result *MutationResult, startTime time.Time) (*MutationResult, error) {
+	if result.Affected == 0 {
+		d.rollbackTransactionInternal(tx)
+	} else if err := d.commitTransactionLocked(tx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	result.Version = d.currentVersion
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+// validateMutationFilter checks the filter of a conditional mutation. At
+// least one condition is required so that a mistaken request cannot rewrite
+// the whole table. The caller must hold the read lock.
+func (d *DeltaLakeRepository) validateMutationFilter(filter Filter) error {
+	if len(filter.Conditions) == 0 {
+		return fmt.Errorf("filter requires at least one condition")
+	}
+	if len(filter.SortBy) > 0 || filter.Limit != nil || filter.Offset != nil || len(filter.GroupBy) > 0 || len(filter.Having) > 0 {
+		return fmt.Errorf("filter cannot sort, paginate or group rows")
+	}
+
+	for _, condition := range filter.Conditions {
+		if _, ok := d.schemaPathField(condition.Field); !ok {
+			return fmt.Errorf("unknown column %s", condition.Field)
+		}
+		switch condition.Operator {
+		case OperatorEqual, OperatorNotEqual, OperatorGreaterThan, OperatorGreaterThanOrEqual,
+			OperatorLessThan, OperatorLessThanOrEqual, OperatorIn, OperatorNotIn,
+			OperatorLike, OperatorNotLike, OperatorIsNull, OperatorIsNotNull, OperatorBetween:
+		default:
+			return fmt.Errorf("unsupported operator %q", condition.Operator)
+		}
+	}
+	return nil
+}
+
+// assignColumn sets a column of the schema to a value of its type. Columns
+// that are not bound to an Exercise field, or were widened, are set in Extra.
+// The caller must hold the read lock.
+func (d *DeltaLakeRepository) assignColumn(exercise *loader.Exercise, column string, value interface{}) error {
+	field, ok := d.schemaField(column)
+	if !ok {
+		return fmt.Errorf("unknown column %s", column)
+	}
+	if name, fieldType, bound := exerciseFieldOf(field, d.currentSchema); bound && field.Type == fieldType {
+		return setExerciseField(exercise, name, value)
+	}
+
+	converted, err := convertField(value, field, column, true)
+	if err != nil {
+		return err
+	}
+	if converted == nil && !field.Nullable {
+		return fmt.Errorf("column %s cannot be null", column)
+	}
+
+	// Rows read from the table share their Extra map with the table
+	extra := make(map[string]interface{}, len(exercise.Extra)+1)
+	for name, value := range exercise.Extra {
+		extra[name] = value
+	}
+	extra[column] = converted
+	exercise.Extra = extra
+	return nil
+}
+
+// setExerciseField assigns a value to a named column of an exercise
+func setExerciseField(exercise *loader.Exercise, field string, value interface{}) error {
+	switch field {
+	case "id":
+		return fmt.Errorf("column id cannot be assigned")
+	case "name", "type", "description":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("column %s expects a string, got %v", field, value)
+		}
+		switch field {
+		case "name":
+			exercise.Name = text
+		case "type":
+			exercise.Type = text
+		default:
+			exercise.Description = text
+		}
+	case "duration", "calories":
+		number, ok := toFloat(value)
+		if !ok || number != math.Trunc(number) || math.Abs(number) > math.MaxInt32 {
+			return fmt.Errorf("column %s expects an integer, got %v", field, value)
+		}
+		if field == "duration" {
+			exercise.Duration = int(number)
+		} else {
+			exercise.Calories = int(number)
+		}
+	case "date":
+		date, ok := toTime(value)
+		if !ok {
+			return fmt.Errorf("column date expects an RFC3339 or YYYY-MM-DD date, got %v", value)
+		}
+		exercise.Date = date
+	default:
+		return fmt.Errorf("unknown column %s", field)
+	}
+	return nil
+}
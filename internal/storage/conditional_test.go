@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_DeleteWhere(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	version := repo.currentVersion
+
+	result, err := repo.DeleteWhere(ctx, Filter{Conditions: []Condition{
+		{Field: "name", Operator: OperatorLike, Value: "%ing"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 2, result.Affected)
+	assert.Equal(t, version+1, result.Version)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "Push-ups", all[0].Name)
+	assert.Equal(t, "Yoga", all[1].Name)
+
+	// Both deletes are recorded in the version's change events
+	changes, err := repo.GetChangelog(ctx, result.Version, result.Version)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	for _, change := range changes {
+		assert.Equal(t, ChangeTypeDelete, change.Type)
+		assert.Equal(t, OperationTypeDelete, change.Operation.Type)
+		require.NotNil(t, change.Before)
+		assert.Equal(t, *change.RecordID, change.Before.ID)
+		assert.Nil(t, change.After)
+	}
+
+	// Deleting nothing creates no version
+	result, err = repo.DeleteWhere(ctx, Filter{Conditions: []Condition{
+		{Field: "name", Operator: OperatorEqual, Value: "Running"},
+	}})
+	require.NoError(t, err)
+	assert.Zero(t, result.Matched)
+	assert.Equal(t, version+1, result.Version)
+}
+
+func TestDeltaLakeRepository_UpdateWhere(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	version := repo.currentVersion
+
+	filter := Filter{Conditions: []Condition{{Field: "type", Operator: OperatorEqual, Value: "cardio"}}}
+	result, err := repo.UpdateWhere(ctx, filter, map[string]interface{}{
+		"description": "Redacted",
+		"calories":    float64(0),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 2, result.Affected)
+	assert.Equal(t, version+1, result.Version)
+
+	cardio, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	require.Len(t, cardio, 2)
+	for _, exercise := range cardio {
+		assert.Equal(t, "Redacted", exercise.Description)
+		assert.Zero(t, exercise.Calories)
+	}
+
+	changes, err := repo.GetChangelog(ctx, result.Version, result.Version)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, ChangeTypeUpdate, changes[0].Type)
+	assert.Equal(t, "Morning run", changes[0].Before.Description)
+	assert.Equal(t, "Redacted", changes[0].After.Description)
+
+	// Rows that already hold the values are matched but not affected
+	result, err = repo.UpdateWhere(ctx, filter, map[string]interface{}{"description": "Redacted"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Matched)
+	assert.Zero(t, result.Affected)
+	assert.Equal(t, version+1, result.Version)
+}
+
+func TestDeltaLakeRepository_ConditionalMutationErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0 AND duration <= 1440",
+	}))
+	version := repo.currentVersion
+
+	cardio := Filter{Conditions: []Condition{{Field: "type", Operator: OperatorEqual, Value: "cardio"}}}
+	limit := 1
+	tests := []struct {
+		name        string
+		filter      Filter
+		assignments map[string]interface{}
+		expected    string
+	}{
+		{name: "empty filter", assignments: map[string]interface{}{"duration": 10}, expected: "at least one condition"},
+		{name: "limited filter", filter: Filter{Conditions: cardio.Conditions, Limit: &limit}, assignments: map[string]interface{}{"duration": 10}, expected: "cannot sort, paginate or group"},
+		{name: "unknown filter column", filter: Filter{Conditions: []Condition{{Field: "weight", Operator: OperatorEqual, Value: 1}}}, assignments: map[string]interface{}{"duration": 10}, expected: "unknown column weight"},
+		{name: "unknown operator", filter: Filter{Conditions: []Condition{{Field: "name", Operator: "matches", Value: "x"}}}, assignments: map[string]interface{}{"duration": 10}, expected: "unsupported operator"},
+		{name: "no assignments", filter: cardio, expected: "at least one assignment"},
+		{name: "id assignment", filter: cardio, assignments: map[string]interface{}{"id": 5}, expected: "cannot be assigned"},
+		{name: "fractional integer", filter: cardio, assignments: map[string]interface{}{"duration": 1.5}, expected: "expects an integer"},
+		{name: "invalid date", filter: cardio, assignments: map[string]interface{}{"date": "yesterday"}, expected: "expects an RFC3339"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.UpdateWhere(ctx, tt.filter, tt.assignments)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+
+	_, err := repo.DeleteWhere(ctx, Filter{})
+	assert.ErrorContains(t, err, "at least one condition")
+
+	// Constraint violations abort the whole update
+	_, err = repo.UpdateWhere(ctx, cardio, map[string]interface{}{"duration": 2000})
+	var constraintErr *ConstraintError
+	require.True(t, errors.As(err, &constraintErr), "got %v", err)
+	assert.Len(t, constraintErr.Violations, 2)
+	assert.Equal(t, version, repo.currentVersion)
+
+	running, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	for _, exercise := range running {
+		assert.Less(t, exercise.Duration, 2000)
+	}
+}
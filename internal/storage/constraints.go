@@ -0,0 +1,477 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Constraint compilation and evaluation for DeltaLakeRepository
+
+// maxReportedViolations limits the violations listed in a ConstraintError message
+const maxReportedViolations = 5
+
+// compiledConstraint is a constraint with its expression parsed
+type compiledConstraint struct {
+	Constraint
+	check      exprNode
+	ranges     []rangeCheck
+	pattern    *regexp.Regexp
+	references []string
+}
+
+// rangeCheck is a single bound of a range constraint, normalized to column op bound
+type rangeCheck struct {
+	column string
+	op     string
+	bound  exprNode
+}
+
+// rowViolation is a violation found at a position of the evaluated rows
+type rowViolation struct {
+	position int
+	message  string
+}
+
+// Error lists the first violations with their constraint names and rows
+func (e *ConstraintError) Error() string {
+	parts := make([]string, 0, maxReportedViolations)
+	for i, violation := range e.Violations {
+		if i == maxReportedViolations {
+			parts = append(parts, fmt.Sprintf("and %d more", len(e.Violations)-maxReportedViolations))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s: row %d (id %d): %s", violation.Constraint, violation.RowIndex, violation.RecordID, violation.Message))
+	}
+
+	return fmt.Sprintf("%d constraint violation(s): %s", len(e.Violations), strings.Join(parts, "; "))
+}
+
+// compileConstraint validates a constraint definition and parses its expression.
+//
+// Expressions by type:
+//   - check: a boolean expression over columns, e.g. "calories <= duration * 20"
+//   - range: comparisons between columns and constants joined with AND, e.g.
+//     "duration > 0 AND duration <= 1440" or "calories BETWEEN 0 AND 10000"
+//   - regex: a regular expression every value of the columns must match
+//   - foreign_key: "REFERENCES exercises(column, ...)"
+//
+// not_null, unique and primary_key only use Columns.
+func compileConstraint(constraint Constraint) (*compiledConstraint, error) {
+	if constraint.Name == "" {
+		return nil, fmt.Errorf("constraint name is required")
+	}
+
+	compiled := &compiledConstraint{Constraint: constraint}
+
+	switch constraint.Type {
+	case ConstraintTypeNotNull, ConstraintTypeUnique, ConstraintTypePrimaryKey:
+		if err := requireColumns(constraint.Columns); err != nil {
+			return nil, err
+		}
+	case ConstraintTypeCheck:
+		if strings.TrimSpace(constraint.Expression) == "" {
+			return nil, fmt.Errorf("check constraint requires an expression")
+		}
+		check, err := parseExpression(constraint.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid check expression: %w", err)
+		}
+		compiled.check = check
+	case ConstraintTypeRange:
+		ranges, err := parseRangeExpression(constraint.Expression)
+		if err != nil {
+			return nil, err
+		}
+		compiled.ranges = ranges
+		if err := compiled.resolveRangeColumns(); err != nil {
+			return nil, err
+		}
+	case ConstraintTypeRegex:
+		if err := requireColumns(constraint.Columns); err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(constraint.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		compiled.pattern = pattern
+	case ConstraintTypeForeignKey:
+		if err := requireColumns(constraint.Columns); err != nil {
+			return nil, err
+		}
+		references, err := parseReferences(constraint.Expression)
+		if err != nil {
+			return nil, err
+		}
+		if len(references) != len(constraint.Columns) {
+			return nil, fmt.Errorf("foreign key has %d column(s) but references %d", len(constraint.Columns), len(references))
+		}
+		compiled.references = references
+	default:
+		return nil, fmt.Errorf("unsupported constraint type: %s", constraint.Type)
+	}
+
+	return compiled, nil
+}
+
+// requireColumns checks that a constraint names at least one column
+func requireColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("constraint requires at least one column")
+	}
+	return nil
+}
+
+// columns returns the columns a constraint reads
+func (c *compiledConstraint) columns() []string {
+	columns := append([]string{}, c.Columns...)
+	columns = append(columns, c.references...)
+	if c.check != nil {
+		columns = append(columns, expressionColumns(c.check)...)
+	}
+	return columns
+}
+
+// checkConstraintColumns checks that the columns a constraint reads exist in
+// the current schema, evolved and renamed columns included. The caller must
+// hold the read lock.
+func (d *DeltaLakeRepository) checkConstraintColumns(compiled *compiledConstraint) error {
+	for _, column := range compiled.columns() {
+		if _, ok := d.schemaField(column); !ok {
+			return fmt.Errorf("unknown column %s", column)
+		}
+	}
+	return nil
+}
+
+// parseRangeExpression extracts the bounds of a range constraint
+func parseRangeExpression(expression string) ([]rangeCheck, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("range constraint requires an expression with its bounds")
+	}
+
+	node, err := parseExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range expression: %w", err)
+	}
+
+	var ranges []rangeCheck
+	if err := collectRangeChecks(node, &ranges); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// collectRangeChecks walks an AND tree of comparisons between a column and a constant
+func collectRangeChecks(node exprNode, ranges *[]rangeCheck) error {
+	invalid := fmt.Errorf("range expression must join comparisons between a column and a constant with AND, got %s", node)
+
+	switch n := node.(type) {
+	case *binaryExpr:
+		if n.op == "AND" {
+			if err := collectRangeChecks(n.left, ranges); err != nil {
+				return err
+			}
+			return collectRangeChecks(n.right, ranges)
+		}
+
+		flipped := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<=", "=": "="}
+		if _, ok := flipped[n.op]; !ok {
+			return invalid
+		}
+		if column, ok := n.left.(*columnExpr); ok && len(expressionColumns(n.right)) == 0 {
+			*ranges = append(*ranges, rangeCheck{column: column.name, op: n.op, bound: n.right})
+			return nil
+		}
+		if column, ok := n.right.(*columnExpr); ok && len(expressionColumns(n.left)) == 0 {
+			*ranges = append(*ranges, rangeCheck{column: column.name, op: flipped[n.op], bound: n.left})
+			return nil
+		}
+	case *betweenExpr:
+		column, ok := n.operand.(*columnExpr)
+		if !ok || n.negated || len(expressionColumns(n.lower))+len(expressionColumns(n.upper)) > 0 {
+			return invalid
+		}
+		*ranges = append(*ranges,
+			rangeCheck{column: column.name, op: ">=", bound: n.lower},
+			rangeCheck{column: column.name, op: "<=", bound: n.upper},
+		)
+		return nil
+	}
+
+	return invalid
+}
+
+// resolveRangeColumns defaults the columns of a range constraint to those
+// bounded by its expression and checks that every listed column is bounded
+func (c *compiledConstraint) resolveRangeColumns() error {
+	bounded := make(map[string]bool)
+	order := make([]string, 0)
+	for _, check := range c.ranges {
+		if !bounded[check.column] {
+			bounded[check.column] = true
+			order = append(order, check.column)
+		}
+	}
+
+	if len(c.Columns) == 0 {
+		c.Columns = order
+		return nil
+	}
+
+	listed := make(map[string]bool, len(c.Columns))
+	for _, column := range c.Columns {
+		if !bounded[column] {
+			return fmt.Errorf("range expression has no bound for column %s", column)
+		}
+		listed[column] = true
+	}
+	for _, column := range order {
+		if !listed[column] {
+			return fmt.Errorf("range expression bounds column %s which is not in the constraint columns", column)
+		}
+	}
+	return nil
+}
+
+// parseReferences parses the "REFERENCES exercises(column, ...)" clause of a foreign key
+func parseReferences(expression string) ([]string, error) {
+	tokens, err := tokenizeSQL(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid foreign key expression: %w", err)
+	}
+
+	parser := &sqlParser{tokens: tokens}
+	if err := parser.expectKeyword("REFERENCES"); err != nil {
+		return nil, fmt.Errorf("foreign key expression must be REFERENCES exercises(column): %w", err)
+	}
+	table := parser.next()
+	if table.kind != sqlTokenIdent || !strings.EqualFold(table.text, "exercises") {
+		return nil, fmt.Errorf("foreign key references unknown table %q", table.text)
+	}
+	if !parser.symbol("(") {
+		return nil, fmt.Errorf("expected ( after table name in foreign key expression")
+	}
+
+	references := make([]string, 0)
+	for {
+		column, err := parser.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, column)
+		if parser.symbol(")") {
+			break
+		}
+		if !parser.symbol(",") {
+			return nil, fmt.Errorf("expected , or ) in foreign key expression")
+		}
+	}
+	if token := parser.peek(); token.kind != sqlTokenEOF {
+		return nil, fmt.Errorf("unexpected %q in foreign key expression", token.text)
+	}
+
+	return references, nil
+}
+
+// checkConstraints evaluates the enabled constraints against the rows of a
+// table. Only the rows at the given positions are reported, with RowIndex set
+// to their index in positions; uniqueness and references are still evaluated
+// against every row. A nil positions slice checks all rows.
+func checkConstraints(constraints []Constraint, rows []loader.Exercise, positions []int) ([]ConstraintViolation, error) {
+	if positions == nil {
+		positions = make([]int, len(rows))
+		for i := range rows {
+			positions[i] = i
+		}
+	}
+
+	// A row written several times is reported under the last write
+	rowIndex := make(map[int]int, len(positions))
+	for i, position := range positions {
+		rowIndex[position] = i
+	}
+	checked := make([]int, 0, len(rowIndex))
+	for position := range rowIndex {
+		checked = append(checked, position)
+	}
+	sort.Slice(checked, func(i, j int) bool { return rowIndex[checked[i]] < rowIndex[checked[j]] })
+
+	violations := make([]ConstraintViolation, 0)
+	for _, constraint := range constraints {
+		if !constraint.Enabled {
+			continue
+		}
+
+		compiled, err := compileConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %s: %w", constraint.Name, err)
+		}
+
+		for _, found := range compiled.evaluate(rows, checked) {
+			row := rows[found.position]
+			violations = append(violations, ConstraintViolation{
+				Constraint: constraint.Name,
+				Type:       constraint.Type,
+				RowIndex:   rowIndex[found.position],
+				RecordID:   row.ID,
+				Message:    found.message,
+				Record:     row,
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// evaluate returns the violations of the constraint among the checked positions
+func (c *compiledConstraint) evaluate(rows []loader.Exercise, checked []int) []rowViolation {
+	violations := make([]rowViolation, 0)
+	add := func(position int, format string, args ...interface{}) {
+		violations = append(violations, rowViolation{position: position, message: fmt.Sprintf(format, args...)})
+	}
+
+	switch c.Type {
+	case ConstraintTypeNotNull, ConstraintTypePrimaryKey:
+		for _, position := range checked {
+			for _, column := range c.Columns {
+				if value, _ := exerciseFieldValue(rows[position], column); isNullValue(value) {
+					add(position, "%s is null", column)
+				}
+			}
+		}
+	case ConstraintTypeCheck:
+		for _, position := range checked {
+			result, err := evalBool(c.check, rows[position])
+			if err != nil {
+				add(position, "check %s could not be evaluated: %v", c.Expression, err)
+			} else if result != nil && !*result {
+				add(position, "check %s failed", c.Expression)
+			}
+		}
+	case ConstraintTypeRange:
+		for _, position := range checked {
+			for _, check := range c.ranges {
+				if message := check.violation(rows[position]); message != "" {
+					add(position, "%s", message)
+				}
+			}
+		}
+	case ConstraintTypeRegex:
+		for _, position := range checked {
+			for _, column := range c.Columns {
+				value, _ := exerciseFieldValue(rows[position], column)
+				if isNullValue(value) {
+					continue
+				}
+				if text := valueText(value); !c.pattern.MatchString(text) {
+					add(position, "%s %s does not match %s", column, formatLiteral(value), c.Expression)
+				}
+			}
+		}
+	case ConstraintTypeForeignKey:
+		referenced := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			if key, ok := columnsKey(row, c.references); ok {
+				referenced[key] = true
+			}
+		}
+		for _, position := range checked {
+			if key, ok := columnsKey(rows[position], c.Columns); ok && !referenced[key] {
+				add(position, "(%s) = (%s) has no matching (%s) in exercises", strings.Join(c.Columns, ", "), columnsLiteral(rows[position], c.Columns), strings.Join(c.references, ", "))
+			}
+		}
+	}
+
+	if c.Type == ConstraintTypeUnique || c.Type == ConstraintTypePrimaryKey {
+		counts := make(map[string]int, len(rows))
+		for _, row := range rows {
+			if key, ok := columnsKey(row, c.Columns); ok {
+				counts[key]++
+			}
+		}
+		for _, position := range checked {
+			if key, ok := columnsKey(rows[position], c.Columns); ok && counts[key] > 1 {
+				add(position, "duplicate value (%s) = (%s)", strings.Join(c.Columns, ", "), columnsLiteral(rows[position], c.Columns))
+			}
+		}
+	}
+
+	return violations
+}
+
+// violation returns a message when the row is outside the bound, or "" otherwise
+func (r rangeCheck) violation(row loader.Exercise) string {
+	value, _ := exerciseFieldValue(row, r.column)
+	if isNullValue(value) {
+		return ""
+	}
+
+	bound, err := r.bound.eval(row)
+	if err != nil {
+		return fmt.Sprintf("bound of %s could not be evaluated: %v", r.column, err)
+	}
+	if bound == nil {
+		return ""
+	}
+
+	cmp, ok := compareValues(value, bound)
+	if !ok {
+		return fmt.Sprintf("%s %s cannot be compared with %s", r.column, formatLiteral(value), formatLiteral(bound))
+	}
+
+	var satisfied bool
+	switch r.op {
+	case "<":
+		satisfied = cmp < 0
+	case "<=":
+		satisfied = cmp <= 0
+	case ">":
+		satisfied = cmp > 0
+	case ">=":
+		satisfied = cmp >= 0
+	case "=":
+		satisfied = cmp == 0
+	}
+	if satisfied {
+		return ""
+	}
+
+	return fmt.Sprintf("%s = %s violates %s %s %s", r.column, formatLiteral(value), r.column, r.op, r.bound)
+}
+
+// columnsKey builds a comparison key from column values. It reports false when
+// any value is null, since nulls never conflict or reference anything.
+func columnsKey(row loader.Exercise, columns []string) (string, bool) {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		value, _ := exerciseFieldValue(row, column)
+		if isNullValue(value) {
+			return "", false
+		}
+		parts[i] = indexKey(value)
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// columnsLiteral renders column values as a SQL tuple body
+func columnsLiteral(row loader.Exercise, columns []string) string {
+	literals := make([]string, len(columns))
+	for i, column := range columns {
+		value, _ := exerciseFieldValue(row, column)
+		literals[i] = formatLiteral(value)
+	}
+	return strings.Join(literals, ", ")
+}
+
+// valueText renders a value as the text a regular expression is matched against
+func valueText(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return indexKey(value)
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConstraints(t *testing.T) {
+	rows := sampleExercises()
+	for i := range rows {
+		rows[i].ID = i + 1
+	}
+	rows[3].ID = 3 // duplicate of Swimming
+
+	tests := []struct {
+		name       string
+		constraint Constraint
+		violating  []int
+	}{
+		{
+			name:       "not null",
+			constraint: Constraint{Type: ConstraintTypeNotNull, Columns: []string{"description"}},
+			violating:  []int{3},
+		},
+		{
+			name:       "unique",
+			constraint: Constraint{Type: ConstraintTypeUnique, Columns: []string{"date"}},
+			violating:  []int{0, 1},
+		},
+		{
+			name:       "primary key",
+			constraint: Constraint{Type: ConstraintTypePrimaryKey, Columns: []string{"id"}},
+			violating:  []int{2, 3},
+		},
+		{
+			name:       "range with exclusive and inclusive bounds",
+			constraint: Constraint{Type: ConstraintTypeRange, Expression: "duration > 15 AND duration <= 45"},
+			violating:  []int{1, 3},
+		},
+		{
+			name:       "range with between and reversed comparison",
+			constraint: Constraint{Type: ConstraintTypeRange, Columns: []string{"calories"}, Expression: "calories BETWEEN 120 AND 10000 AND 350 >= calories"},
+			violating:  []int{1, 2},
+		},
+		{
+			name:       "regex",
+			constraint: Constraint{Type: ConstraintTypeRegex, Columns: []string{"name"}, Expression: "^[A-Z][a-z]+$"},
+			violating:  []int{1},
+		},
+		{
+			name:       "check with arithmetic and functions",
+			constraint: Constraint{Type: ConstraintTypeCheck, Expression: "calories <= duration * 9 AND LENGTH(name) > 4"},
+			violating:  []int{0, 3},
+		},
+		{
+			name:       "check with OR and IN",
+			constraint: Constraint{Type: ConstraintTypeCheck, Expression: "type IN ('cardio', 'strength') OR description IS NULL"},
+			violating:  []int{},
+		},
+		{
+			name:       "check with null operand passes",
+			constraint: Constraint{Type: ConstraintTypeCheck, Expression: "description LIKE '%a%'"},
+			violating:  []int{0, 1},
+		},
+		{
+			name:       "self referencing foreign key",
+			constraint: Constraint{Type: ConstraintTypeForeignKey, Columns: []string{"duration"}, Expression: "REFERENCES exercises(id)"},
+			violating:  []int{0, 1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.constraint.Name = "test"
+			tt.constraint.Enabled = true
+
+			violations, err := checkConstraints([]Constraint{tt.constraint}, rows, nil)
+			require.NoError(t, err)
+
+			indexes := map[int]bool{}
+			for _, violation := range violations {
+				assert.Equal(t, "test", violation.Constraint)
+				assert.NotEmpty(t, violation.Message)
+				indexes[violation.RowIndex] = true
+			}
+			expected := map[int]bool{}
+			for _, index := range tt.violating {
+				expected[index] = true
+			}
+			assert.Equal(t, expected, indexes)
+		})
+	}
+}
+
+func TestCompileConstraint_Errors(t *testing.T) {
+	invalid := []Constraint{
+		{Name: "no_columns", Type: ConstraintTypeUnique},
+		{Name: "empty_check", Type: ConstraintTypeCheck},
+		{Name: "bad_check", Type: ConstraintTypeCheck, Expression: "duration >"},
+		{Name: "unknown_function", Type: ConstraintTypeCheck, Expression: "SQRT(duration) > 1"},
+		{Name: "or_range", Type: ConstraintTypeRange, Expression: "duration > 0 OR duration < 100"},
+		{Name: "unbounded_column", Type: ConstraintTypeRange, Columns: []string{"calories"}, Expression: "duration > 0"},
+		{Name: "bad_regex", Type: ConstraintTypeRegex, Columns: []string{"name"}, Expression: "("},
+		{Name: "bad_reference", Type: ConstraintTypeForeignKey, Columns: []string{"id"}, Expression: "REFERENCES users(id)"},
+		{Name: "unknown_type", Type: ConstraintType("exclusion"), Columns: []string{"id"}},
+	}
+
+	for _, constraint := range invalid {
+		_, err := compileConstraint(constraint)
+		assert.Error(t, err, constraint.Name)
+	}
+}
+
+func TestDeltaLakeRepository_ConstraintsEnforcedOnCommit(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0 AND duration <= 1440",
+	}))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:    "unique_name_date",
+		Type:    ConstraintTypeUnique,
+		Columns: []string{"name", "date"},
+	}))
+
+	batch := []loader.Exercise{
+		{Name: "Walking", Type: "cardio", Duration: 20, Calories: 80, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{Name: "Marathon", Type: "cardio", Duration: 2000, Calories: 3000, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{Name: "Running", Type: "cardio", Duration: 25, Calories: 250, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+	}
+
+	err := repo.InsertBatch(batch)
+	require.Error(t, err)
+
+	var constraintErr *ConstraintError
+	require.True(t, errors.As(err, &constraintErr))
+	require.Len(t, constraintErr.Violations, 2)
+	assert.Equal(t, "positive_duration", constraintErr.Violations[0].Constraint)
+	assert.Equal(t, 1, constraintErr.Violations[0].RowIndex)
+	assert.Equal(t, "Marathon", constraintErr.Violations[0].Record.Name)
+	assert.Equal(t, "unique_name_date", constraintErr.Violations[1].Constraint)
+	assert.Equal(t, 2, constraintErr.Violations[1].RowIndex)
+	assert.Contains(t, err.Error(), "duration = 2000 violates duration <= 1440")
+
+	// The failed commit wrote nothing
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	// Updating the offending field in place is allowed
+	running := all[0]
+	running.Duration = 35
+	require.NoError(t, repo.Update(running))
+
+	// Validation reports the same violations without writing
+	err = repo.ValidateConstraints(ctx, batch)
+	require.True(t, errors.As(err, &constraintErr))
+	assert.Len(t, constraintErr.Violations, 2)
+	require.NoError(t, repo.ValidateConstraints(ctx, batch[:1]))
+}
+
+func TestDeltaLakeRepository_ConstraintsPersistAndValidateExistingData(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	// Yoga has no description, so the constraint cannot be added as valid
+	describe := Constraint{Name: "has_description", Type: ConstraintTypeNotNull, Columns: []string{"description"}}
+	err = repo.AddConstraint(ctx, describe)
+	require.Error(t, err)
+	var constraintErr *ConstraintError
+	require.True(t, errors.As(err, &constraintErr))
+	require.Len(t, constraintErr.Violations, 1)
+	assert.Equal(t, "Yoga", constraintErr.Violations[0].Record.Name)
+
+	// NOT VALID skips existing rows but still applies to new writes
+	describe.NotValid = true
+	require.NoError(t, repo.AddConstraint(ctx, describe))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{Name: "short_sessions", Type: ConstraintTypeRange, Expression: "duration <= 120"}))
+	require.NoError(t, repo.Close())
+
+	reopened, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	require.Len(t, reopened.constraints, 2)
+	assert.True(t, reopened.constraints[0].NotValid)
+	assert.Equal(t, []string{"duration"}, reopened.constraints[1].Columns)
+
+	err = reopened.Insert(loader.Exercise{Name: "Stretching", Type: "flexibility", Duration: 10, Calories: 20, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)})
+	require.True(t, errors.As(err, &constraintErr))
+	assert.Equal(t, "has_description", constraintErr.Violations[0].Constraint)
+
+	// Transactions are checked when they commit
+	tx, err := reopened.BeginTransaction(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Insert(loader.Exercise{Name: "Hike", Type: "cardio", Duration: 240, Calories: 900, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC), Description: "Trail"}))
+	err = reopened.CommitTransaction(ctx, tx)
+	require.True(t, errors.As(err, &constraintErr))
+	assert.Equal(t, "short_sessions", constraintErr.Violations[0].Constraint)
+	assert.False(t, tx.IsActive())
+}
+
+func TestDeltaLakeRepository_ConstraintsOnEvolvedColumns(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	evolveWith(t, repo, Field{Name: "heart_rate", Type: FieldTypeInt, Nullable: true, DefaultValue: float64(120)})
+	require.NoError(t, repo.RenameColumn(ctx, "calories", "kcal"))
+
+	// Added and renamed columns resolve through the schema
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{Name: "has_heart_rate", Type: ConstraintTypeNotNull, Columns: []string{"heart_rate"}}))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{Name: "heart_rate_range", Type: ConstraintTypeRange, Expression: "heart_rate BETWEEN 40 AND 220"}))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{Name: "effort", Type: ConstraintTypeCheck, Expression: "kcal <= heart_rate * 10"}))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{Name: "unique_kcal", Type: ConstraintTypeUnique, Columns: []string{"kcal"}}))
+
+	date := time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)
+	err := repo.Insert(loader.Exercise{Name: "Sprint", Type: "cardio", Duration: 10, Date: date,
+		Extra: map[string]interface{}{"heart_rate": 250, "kcal": 100}})
+	var constraintErr *ConstraintError
+	require.True(t, errors.As(err, &constraintErr))
+	assert.Equal(t, "heart_rate_range", constraintErr.Violations[0].Constraint)
+
+	err = repo.Insert(loader.Exercise{Name: "Jog", Type: "cardio", Duration: 10, Date: date,
+		Extra: map[string]interface{}{"heart_rate": 150, "kcal": 300}})
+	require.True(t, errors.As(err, &constraintErr))
+	assert.Equal(t, "unique_kcal", constraintErr.Violations[0].Constraint)
+
+	// Columns that are not in the schema are rejected, including renamed ones
+	for _, constraint := range []Constraint{
+		{Name: "unknown", Type: ConstraintTypeNotNull, Columns: []string{"weight"}},
+		{Name: "old_name", Type: ConstraintTypeCheck, Expression: "calories > 0"},
+		{Name: "unknown_reference", Type: ConstraintTypeForeignKey, Columns: []string{"id"}, Expression: "REFERENCES exercises(weight)"},
+	} {
+		assert.ErrorContains(t, repo.AddConstraint(ctx, constraint), "unknown column", constraint.Name)
+	}
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Data quality profiling for DeltaLakeRepository
+
+// histogramBuckets is the number of buckets in an ordered column histogram and
+// the number of most frequent values kept for a categorical one
+const histogramBuckets = 10
+
+// GetDataQualityMetrics profiles every schema field, flags outliers with the
+// configured rules and scores the table on completeness, validity (active
+// constraints and loader validation) and consistency (duplicate name/date pairs)
+func (d *DeltaLakeRepository) GetDataQualityMetrics(ctx context.Context) (*DataQualityMetrics, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data for quality analysis: %w", err)
+	}
+
+	return d.computeDataQualityMetrics(exercises)
+}
+
+// computeDataQualityMetrics computes the metrics of the given rows; the caller
+// must hold the lock
+func (d *DeltaLakeRepository) computeDataQualityMetrics(exercises []loader.Exercise) (*DataQualityMetrics, error) {
+	exercises = d.columnViews(exercises)
+	metrics := &DataQualityMetrics{
+		TotalRecords:         int64(len(exercises)),
+		NullValues:           make(map[string]int64),
+		UniqueValues:         make(map[string]int64),
+		DuplicateRecords:     0,
+		ConstraintViolations: make(map[string]int64),
+		DataTypeMismatches:   make(map[string]int64),
+		OutlierCounts:        make(map[string]int64),
+		ValidationErrors:     make(map[string]int64),
+		Columns:              make([]ColumnProfile, 0, len(d.currentSchema.Fields)),
+		LastUpdated:          time.Now(),
+	}
+
+	// Profile each column
+	var nullCount int64
+	for _, field := range d.currentSchema.Fields {
+		profile, mismatches := profileColumn(field, exercises)
+		metrics.Columns = append(metrics.Columns, profile)
+		metrics.NullValues[field.Name] = profile.NullCount
+		metrics.UniqueValues[field.Name] = profile.UniqueCount
+		if mismatches > 0 {
+			metrics.DataTypeMismatches[field.Name] = mismatches
+		}
+		nullCount += profile.NullCount
+	}
+
+	// Rows are invalid if they break an active constraint or fail validation
+	invalid := make(map[int]bool)
+	violations, err := checkConstraints(d.constraints, exercises, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check constraints: %w", err)
+	}
+	for _, violation := range violations {
+		metrics.ConstraintViolations[violation.Constraint]++
+		invalid[violation.RowIndex] = true
+	}
+
+	for i, exercise := range exercises {
+		if err := d.validator.Validate(exercise); err != nil {
+			invalid[i] = true
+			if validationErrors, ok := err.(loader.ValidationErrors); ok {
+				for _, validationError := range validationErrors {
+					metrics.ValidationErrors[validationError.Field]++
+				}
+			}
+		}
+	}
+	metrics.InvalidRecords = int64(len(invalid))
+
+	// Check for duplicates (simplified - by name and date)
+	seenExercises := make(map[string]bool)
+	for _, exercise := range exercises {
+		key := fmt.Sprintf("%s-%s", exercise.Name, exercise.Date.Format("2006-01-02"))
+		if seenExercises[key] {
+			metrics.DuplicateRecords++
+		} else {
+			seenExercises[key] = true
+		}
+	}
+
+	outliers, err := d.detectOutliers(d.outlierRules, exercises)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect outliers: %w", err)
+	}
+	metrics.Outliers = outliers
+	for column, ids := range metrics.Outliers {
+		metrics.OutlierCounts[column] = int64(len(ids))
+	}
+
+	// An empty table has nothing missing, invalid or duplicated
+	metrics.CompletenessScore = 100.0
+	metrics.ValidityScore = 100.0
+	metrics.ConsistencyScore = 100.0
+	if len(exercises) > 0 {
+		totalRecords := float64(len(exercises))
+		if totalCells := totalRecords * float64(len(d.currentSchema.Fields)); totalCells > 0 {
+			metrics.CompletenessScore = (totalCells - float64(nullCount)) / totalCells * 100
+		}
+		metrics.ValidityScore = (totalRecords - float64(metrics.InvalidRecords)) / totalRecords * 100
+		metrics.ConsistencyScore = (totalRecords - float64(metrics.DuplicateRecords)) / totalRecords * 100
+	}
+
+	return metrics, nil
+}
+
+// schemaFieldValue returns the value of a schema field for a record: an
+// Exercise field, or a column kept in Extra such as one added by schema
+// evolution. Records read from the table carry every column of the schema;
+// others read a missing column as its default value, or null when there is
+// none.
+func schemaFieldValue(exercise loader.Exercise, field Field) interface{} {
+	if value, ok := exerciseFieldValue(exercise, field.Name); ok {
+		return value
+	}
+	return field.DefaultValue
+}
+
+// profileColumn computes the profile of a field and counts the non-null values
+// that do not match its declared type
+func profileColumn(field Field, exercises []loader.Exercise) (ColumnProfile, int64) {
+	profile := ColumnProfile{
+		Name:     field.Name,
+		Type:     field.Type,
+		Nullable: field.Nullable,
+	}
+
+	var mismatches int64
+	values := make([]interface{}, 0, len(exercises))
+	counts := make(map[string]int64)
+	for _, exercise := range exercises {
+		value := schemaFieldValue(exercise, field)
+		if isNullValue(value) {
+			profile.NullCount++
+			continue
+		}
+		if !valueMatchesType(value, field.Type) {
+			mismatches++
+		}
+
+		values = append(values, value)
+		counts[indexKey(value)]++
+
+		if profile.Min == nil {
+			profile.Min, profile.Max = value, value
+			continue
+		}
+		if cmp, ok := compareValues(value, profile.Min); ok && cmp < 0 {
+			profile.Min = value
+		}
+		if cmp, ok := compareValues(value, profile.Max); ok && cmp > 0 {
+			profile.Max = value
+		}
+	}
+	profile.UniqueCount = int64(len(counts))
+
+	if len(values) > 0 {
+		if _, ordered := orderedValue(values[0]); ordered {
+			profile.Histogram = rangeHistogram(values)
+		} else {
+			profile.Histogram = valueHistogram(counts)
+		}
+	}
+
+	return profile, mismatches
+}
+
+// valueMatchesType reports whether a non-null value is of the given field type
+func valueMatchesType(value interface{}, fieldType FieldType) bool {
+	switch fieldType {
+	case FieldTypeInt:
+		number, ok := numericValue(value)
+		return ok && number == math.Trunc(number)
+	case FieldTypeFloat:
+		_, ok := numericValue(value)
+		return ok
+	case FieldTypeString:
+		_, ok := value.(string)
+		return ok
+	case FieldTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case FieldTypeTimestamp, FieldTypeDate:
+		_, ok := toTime(value)
+		return ok
+	case FieldTypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case FieldTypeMap, FieldTypeStruct:
+		_, ok := value.(map[string]interface{})
+		return ok
+	default:
+		return true
+	}
+}
+
+// orderedValue maps numbers and times onto a float64 scale for range histograms
+func orderedValue(value interface{}) (float64, bool) {
+	if number, ok := numericValue(value); ok {
+		return number, true
+	}
+	if t, ok := value.(time.Time); ok {
+		return float64(t.UnixNano()), true
+	}
+	return 0, false
+}
+
+// rangeHistogram splits the range of ordered values into equal-width buckets
+func rangeHistogram(values []interface{}) []HistogramBucket {
+	_, isTime := values[0].(time.Time)
+	bound := func(position float64) interface{} {
+		if isTime {
+			return time.Unix(0, int64(position)).UTC()
+		}
+		return position
+	}
+
+	points := make([]float64, 0, len(values))
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		point, ok := orderedValue(value)
+		if !ok {
+			continue
+		}
+		points = append(points, point)
+		low = math.Min(low, point)
+		high = math.Max(high, point)
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	if low == high {
+		return []HistogramBucket{{Lower: bound(low), Upper: bound(high), Count: int64(len(points))}}
+	}
+
+	width := (high - low) / histogramBuckets
+	buckets := make([]HistogramBucket, histogramBuckets)
+	for i := range buckets {
+		buckets[i].Lower = bound(low + float64(i)*width)
+		buckets[i].Upper = bound(low + float64(i+1)*width)
+	}
+	buckets[len(buckets)-1].Upper = bound(high)
+
+	for _, point := range points {
+		index := int((point - low) / width)
+		if index >= histogramBuckets {
+			index = histogramBuckets - 1
+		}
+		buckets[index].Count++
+	}
+
+	return buckets
+}
+
+// valueHistogram returns the most frequent values of a categorical column
+func valueHistogram(counts map[string]int64) []HistogramBucket {
+	buckets := make([]HistogramBucket, 0, len(counts))
+	for value, count := range counts {
+		buckets = append(buckets, HistogramBucket{Value: value, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Value < buckets[j].Value
+	})
+	if len(buckets) > histogramBuckets {
+		buckets = buckets[:histogramBuckets]
+	}
+	return buckets
+}
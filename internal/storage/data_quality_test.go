@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_GetDataQualityMetrics_EmptyTable(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+
+	metrics, err := repo.GetDataQualityMetrics(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(0), metrics.TotalRecords)
+	assert.Equal(t, 100.0, metrics.CompletenessScore)
+	assert.Equal(t, 100.0, metrics.ValidityScore)
+	assert.Equal(t, 100.0, metrics.ConsistencyScore)
+	assert.Len(t, metrics.Columns, 7)
+	for _, column := range metrics.Columns {
+		assert.Empty(t, column.Histogram)
+	}
+}
+
+func TestDeltaLakeRepository_GetDataQualityMetrics(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	exercises := append(sampleExercises(),
+		loader.Exercise{Name: "Running", Type: "cardio", Duration: 2000, Calories: 250, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+	)
+	require.NoError(t, repo.InsertBatch(exercises))
+
+	// NOT VALID leaves the existing long run in place
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "max_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration <= 240",
+		NotValid:   true,
+	}))
+
+	schema, err := repo.GetCurrentSchema(ctx)
+	require.NoError(t, err)
+	schema.Fields = append(schema.Fields,
+		Field{Name: "heart_rate", Type: FieldTypeInt, Nullable: true},
+		Field{Name: "intensity", Type: FieldTypeInt, Nullable: true, DefaultValue: "moderate"},
+	)
+	require.NoError(t, repo.EvolveSchema(ctx, schema))
+
+	metrics, err := repo.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), metrics.TotalRecords)
+	assert.Equal(t, int64(1), metrics.DuplicateRecords)
+	assert.Equal(t, int64(1), metrics.ConstraintViolations["max_duration"])
+	assert.Equal(t, int64(1), metrics.ValidationErrors["duration"])
+	assert.Equal(t, int64(1), metrics.InvalidRecords)
+	assert.InDelta(t, 80.0, metrics.ValidityScore, 0.001)
+	assert.InDelta(t, 80.0, metrics.ConsistencyScore, 0.001)
+
+	// Two descriptions and every heart rate are missing out of 45 cells
+	assert.Equal(t, int64(2), metrics.NullValues["description"])
+	assert.Equal(t, int64(5), metrics.NullValues["heart_rate"])
+	assert.InDelta(t, 38.0/45.0*100, metrics.CompletenessScore, 0.001)
+
+	// The default value does not match the declared type
+	assert.Equal(t, map[string]int64{"intensity": 5}, metrics.DataTypeMismatches)
+
+	require.Len(t, metrics.Columns, 9)
+	profiles := make(map[string]ColumnProfile)
+	for _, column := range metrics.Columns {
+		profiles[column.Name] = column
+	}
+
+	duration := profiles["duration"]
+	assert.Equal(t, int64(5), duration.UniqueCount)
+	assert.Equal(t, 15, duration.Min)
+	assert.Equal(t, 2000, duration.Max)
+	require.Len(t, duration.Histogram, histogramBuckets)
+	assert.Equal(t, int64(4), duration.Histogram[0].Count)
+	assert.Equal(t, int64(1), duration.Histogram[histogramBuckets-1].Count)
+
+	exerciseType := profiles["type"]
+	assert.Equal(t, int64(3), exerciseType.UniqueCount)
+	assert.Equal(t, HistogramBucket{Value: "cardio", Count: 3}, exerciseType.Histogram[0])
+
+	date := profiles["date"]
+	assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), date.Min)
+	assert.Equal(t, time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC), date.Max)
+
+	heartRate := profiles["heart_rate"]
+	assert.Equal(t, int64(0), heartRate.UniqueCount)
+	assert.Nil(t, heartRate.Min)
+	assert.Empty(t, heartRate.Histogram)
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Deletes that only remove rows record the removed positions in a deletion
+// vector instead of rewriting the data file. Readers skip the marked rows and
+// compaction folds the vectors back into new data files.
+
+// defaultDeletionVectorMaxRatio is the share of a data file's rows that may be
+// marked deleted before deletes rewrite the file
+const defaultDeletionVectorMaxRatio = 0.5
+
+// rowBitmap is a bitmap of row positions in a data file
+type rowBitmap []uint64
+
+func newRowBitmap(rows int) rowBitmap {
+	return make(rowBitmap, (rows+63)/64)
+}
+
+func (b rowBitmap) set(position int) {
+	b[position/64] |= 1 << (uint(position) % 64)
+}
+
+func (b rowBitmap) has(position int) bool {
+	word := position / 64
+	return word < len(b) && b[word]&(1<<(uint(position)%64)) != 0
+}
+
+func (b rowBitmap) cardinality() int {
+	count := 0
+	for _, word := range b {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// dataFileName returns the name of the data file written for a version
+func dataFileName(version int64) string {
+	return fmt.Sprintf("part-%05d-%05d.json", version, version)
+}
+
+// dataFileOf returns the data file holding the rows of a version. The caller
+// must hold the read lock.
+func (d *DeltaLakeRepository) dataFileOf(version int64) string {
+	if info, ok := d.versions[version]; ok && info.DataFile != "" {
+		return info.DataFile
+	}
+	return dataFileName(version)
+}
+
+// deletionVectorOf returns the deletion vector of a version, if any. The
+// caller must hold the read lock.
+func (d *DeltaLakeRepository) deletionVectorOf(version int64) *DeletionVector {
+	if info, ok := d.versions[version]; ok {
+		return info.DeletionVector
+	}
+	return nil
+}
+
+// readVersionData reads the rows of a version through the schema it was
+// written with, skipping rows marked in its deletion vector. The caller must
+// hold the read lock.
+func (d *DeltaLakeRepository) readVersionData(version int64) ([]loader.Exercise, error) {
+	rows, err := d.readDataFile(d.dataFileOf(version), d.schemaOf(version))
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := d.readDeletionVector(d.deletionVectorOf(version), len(rows))
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return rows, nil
+	}
+
+	live := make([]loader.Exercise, 0, len(rows))
+	for position, row := range rows {
+		if !deleted.has(position) {
+			live = append(live, row)
+		}
+	}
+	return live, nil
+}
+
+// readDataFile reads every row of a data file through a schema; a missing
+// file has none
+func (d *DeltaLakeRepository) readDataFile(name string, schema *Schema) ([]loader.Exercise, error) {
+	data, err := os.ReadFile(filepath.Join(d.basePath, name))
+	if os.IsNotExist(err) {
+		return []loader.Exercise{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal exercises: %w", err)
+	}
+
+	exercises := make([]loader.Exercise, len(rows))
+	for i, row := range rows {
+		exercises[i] = rowToExercise(row, schema)
+	}
+	return exercises, nil
+}
+
+// readDeletionVector reads the bitmap of a deletion vector for a data file
+// with the given number of rows; without a vector it returns nil
+func (d *DeltaLakeRepository) readDeletionVector(vector *DeletionVector, rows int) (rowBitmap, error) {
+	if vector == nil {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.basePath, vector.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deletion vector: %w", err)
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("deletion vector %s is corrupt", vector.Path)
+	}
+
+	bitmap := newRowBitmap(rows)
+	for i := 0; i < len(data)/8 && i < len(bitmap); i++ {
+		bitmap[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return bitmap, nil
+}
+
+// writeDeletionVector stores the bitmap of the rows deleted from a data file
+// as of a version
+func (d *DeltaLakeRepository) writeDeletionVector(version int64, bitmap rowBitmap) (*DeletionVector, error) {
+	data := make([]byte, len(bitmap)*8)
+	for i, word := range bitmap {
+		binary.LittleEndian.PutUint64(data[i*8:], word)
+	}
+
+	name := fmt.Sprintf("deletion_vector_%05d.bin", version)
+	if err := os.WriteFile(filepath.Join(d.basePath, name), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write deletion vector: %w", err)
+	}
+	return &DeletionVector{Path: name, Cardinality: int64(bitmap.cardinality())}, nil
+}
+
+// deletionVectorMaxRatio returns the configured share of rows that deletion
+// vectors may cover, or zero when they are disabled
+func (d *DeltaLakeRepository) deletionVectorMaxRatio() float64 {
+	switch ratio := d.config.DeletionVectorMaxRatio; {
+	case ratio < 0:
+		return 0
+	case ratio == 0:
+		return defaultDeletionVectorMaxRatio
+	default:
+		return ratio
+	}
+}
+
+// applyDeletes records the deletes of a transaction that writes no rows in a
+// deletion vector on the current data file. It returns nil when the file
+// should be rewritten instead: when deletion vectors are disabled, the file
+// is empty or too many of its rows would be marked deleted. The caller must
+// hold the write lock.
+func (d *DeltaLakeRepository) applyDeletes(tx *deltaTransaction) (*appliedChanges, error) {
+	maxRatio := d.deletionVectorMaxRatio()
+	if maxRatio == 0 {
+		return nil, nil
+	}
+
+	dataFile := d.dataFileOf(d.currentVersion)
+	rows, err := d.readDataFile(dataFile, d.currentSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	deleted, err := d.readDeletionVector(d.deletionVectorOf(d.currentVersion), len(rows))
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		deleted = newRowBitmap(len(rows))
+	}
+
+	pending := make(map[int]bool, len(tx.pendingDeletes))
+	for _, id := range tx.pendingDeletes {
+		pending[id] = true
+	}
+
+	var before, after []loader.Exercise
+	for position, row := range rows {
+		if deleted.has(position) {
+			continue
+		}
+		before = append(before, row)
+		if pending[row.ID] {
+			deleted.set(position)
+			continue
+		}
+		after = append(after, row)
+	}
+
+	if float64(deleted.cardinality()) > maxRatio*float64(len(rows)) {
+		return nil, nil
+	}
+
+	violations, err := checkConstraints(d.constraints, d.columnViews(after), []int{})
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, &ConstraintError{Violations: violations}
+	}
+
+	vector, err := d.writeDeletionVector(d.currentVersion+1, deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	d.metadata.LastModified = time.Now()
+	d.metadata.RecordCount = int64(len(after))
+
+	return &appliedChanges{
+		dataFile:       dataFile,
+		deletionVector: vector,
+		changes:        diffChanges(before, after),
+	}, nil
+}
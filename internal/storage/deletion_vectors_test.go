@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_DeletesUseDeletionVectors(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	base := repo.currentVersion
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+
+	// A single delete marks the row instead of rewriting the data file
+	require.NoError(t, repo.Delete(all[1].ID))
+	version := repo.versions[repo.currentVersion]
+	assert.Equal(t, dataFileName(base), version.DataFile)
+	require.NotNil(t, version.DeletionVector)
+	assert.EqualValues(t, 1, version.DeletionVector.Cardinality)
+	assert.NoFileExists(t, filepath.Join(basePath, dataFileName(repo.currentVersion)))
+	assert.FileExists(t, filepath.Join(basePath, version.DeletionVector.Path))
+
+	remaining, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Running", "Swimming", "Yoga"}, exerciseNames(remaining))
+
+	changes, err := repo.GetChangelog(ctx, repo.currentVersion, repo.currentVersion)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeTypeDelete, changes[0].Type)
+	assert.Equal(t, "Push-ups", changes[0].Before.Name)
+
+	// Later deletes extend the vector of the same file
+	_, err = repo.DeleteWhere(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Yoga"}}})
+	require.NoError(t, err)
+	version = repo.versions[repo.currentVersion]
+	assert.Equal(t, dataFileName(base), version.DataFile)
+	assert.EqualValues(t, 2, version.DeletionVector.Cardinality)
+
+	// Earlier versions keep their own vectors
+	rows, err := repo.readVersionData(repo.currentVersion - 1)
+	require.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// Deletion vectors are read back after reopening the table
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+	remaining, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Running", "Swimming"}, exerciseNames(remaining))
+
+	// Marking most of the file deleted rewrites it instead
+	require.NoError(t, repo.Delete(remaining[0].ID))
+	version = repo.versions[repo.currentVersion]
+	assert.Empty(t, version.DataFile)
+	assert.Nil(t, version.DeletionVector)
+	assert.FileExists(t, filepath.Join(basePath, dataFileName(repo.currentVersion)))
+
+	remaining, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Swimming"}, exerciseNames(remaining))
+}
+
+func TestDeltaLakeRepository_CompactFoldsDeletionVectors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(all[0].ID))
+
+	result, err := repo.Compact(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, result.DeletedRowsPurged)
+	assert.EqualValues(t, 3, result.RecordsProcessed)
+
+	version := repo.versions[repo.currentVersion]
+	require.NotNil(t, version)
+	assert.Nil(t, version.DeletionVector)
+
+	rows, err := repo.readDataFile(dataFileName(repo.currentVersion), repo.currentSchema)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Push-ups", "Swimming", "Yoga"}, exerciseNames(rows))
+
+	// Compacting again has nothing to purge
+	result, err = repo.Compact(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, result.DeletedRowsPurged)
+}
+
+func TestDeltaLakeRepository_DeletionVectorsDisabled(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, &DeltaConfig{DeletionVectorMaxRatio: -1})
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(all[0].ID))
+
+	assert.Nil(t, repo.versions[repo.currentVersion].DeletionVector)
+	assert.FileExists(t, filepath.Join(basePath, dataFileName(repo.currentVersion)))
+	entries, err := os.ReadDir(basePath)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "deletion_vector")
+	}
+}
+
+func TestRowBitmap(t *testing.T) {
+	bitmap := newRowBitmap(130)
+	for _, position := range []int{0, 63, 64, 129} {
+		bitmap.set(position)
+	}
+	assert.Equal(t, 4, bitmap.cardinality())
+	assert.True(t, bitmap.has(63))
+	assert.True(t, bitmap.has(64))
+	assert.False(t, bitmap.has(65))
+	assert.False(t, bitmap.has(500))
+}
+
+func exerciseNames(exercises []loader.Exercise) []string {
+	names := make([]string, len(exercises))
+	for i, exercise := range exercises {
+		names[i] = exercise.Name
+	}
+	return names
+}
@@ -18,20 +18,33 @@ type DeltaLakeRepository struct {
 	basePath       string
 	currentVersion int64
 	currentSchema  *Schema
+	schemas        map[int64]*Schema
 	metadata       *TableMetadata
 	transactions   map[string]*deltaTransaction
 	constraints    []Constraint
+	outlierRules   []OutlierRule
+	qualityChecks  *QualityCheckConfig
+	ingestedFiles  map[string]*IngestedFile
+	validator      *loader.Validator
 	indexes        map[string]*Index
 	versions       map[int64]*Version
 	changeLog      []ChangeEvent
 	mutex          sync.RWMutex
 
 	// Performance tracking
-	queryStats *QueryStats
+	queryStats   *queryStatsCollector
+	queryCache   *queryCache
+	indexLookups map[string]*indexLookup
+	indexMutex   sync.Mutex
 
 	// Batch and streaming support
 	streams map[string]Stream
 
+	// Scheduled quality checks
+	qualityScheduler *qualityScheduler
+	schedulerMutex   sync.Mutex
+	historyMutex     sync.Mutex
+
 	// Configuration
 	config *DeltaConfig
 }
@@ -46,6 +59,19 @@ type DeltaConfig struct {
 	AutoCompact        bool          `json:"auto_compact"`
 	CompressionCodec   string        `json:"compression_codec"`
 	PartitionFields    []string      `json:"partition_fields"`
+	QueryStatsWindow   int           `json:"query_stats_window,omitempty"`
+
+	// Query result cache limits; zero uses the defaults and a negative value disables the cache
+	QueryCacheMaxEntries int   `json:"query_cache_max_entries,omitempty"`
+	QueryCacheMaxBytes   int64 `json:"query_cache_max_bytes,omitempty"`
+
+	// Fraction of a data file's rows that deletes may mark in a deletion
+	// vector before the file is rewritten instead; zero uses the default and
+	// a negative value disables deletion vectors
+	DeletionVectorMaxRatio float64 `json:"deletion_vector_max_ratio,omitempty"`
+
+	// Shortest interval quality checks can be scheduled at; zero uses the default
+	MinQualityCheckInterval time.Duration `json:"min_quality_check_interval,omitempty"`
 }
 
 // deltaTransaction represents an active transaction
@@ -60,6 +86,16 @@ type deltaTransaction struct {
 	pendingWrites  []loader.Exercise
 	pendingDeletes []int
 	mutex          sync.RWMutex
+
+	// mergeSchema adds the unknown columns of the writes to the schema when
+	// the transaction commits; mergedColumns collects them across the commits
+	// of a load so that later ones can widen them
+	mergeSchema   bool
+	mergedColumns map[string]bool
+
+	// ingestedFile is how far a directory or pattern load got through its
+	// file, saved in the same commit as the batch that gets it there
+	ingestedFile *IngestedFile
 }
 
 // Index represents a table index
@@ -116,15 +152,18 @@ func NewDeltaLakeRepository(basePath string, config *DeltaConfig) (*DeltaLakeRep
 	}
 
 	repo := &DeltaLakeRepository{
-		basePath:     basePath,
-		config:       config,
-		transactions: make(map[string]*deltaTransaction),
-		constraints:  make([]Constraint, 0),
-		indexes:      make(map[string]*Index),
-		versions:     make(map[int64]*Version),
-		changeLog:    make([]ChangeEvent, 0),
-		queryStats:   &QueryStats{},
-		streams:      make(map[string]Stream),
+		basePath:      basePath,
+		config:        config,
+		transactions:  make(map[string]*deltaTransaction),
+		constraints:   make([]Constraint, 0),
+		outlierRules:  defaultOutlierRules(),
+		ingestedFiles: make(map[string]*IngestedFile),
+		validator:     loader.NewValidator(),
+		indexes:       make(map[string]*Index),
+		versions:      make(map[int64]*Version),
+		changeLog:     make([]ChangeEvent, 0),
+		indexLookups:  make(map[string]*indexLookup),
+		streams:       make(map[string]Stream),
 	}
 
 	// Initialize or load existing metadata
@@ -132,6 +171,14 @@ func NewDeltaLakeRepository(basePath string, config *DeltaConfig) (*DeltaLakeRep
 		return nil, fmt.Errorf("failed to initialize table: %w", err)
 	}
 
+	// Stats window and cache limits may come from the persisted configuration
+	repo.queryStats = newQueryStatsCollector(repo.config.QueryStatsWindow)
+	repo.queryCache = newQueryCache(repo.config)
+
+	if repo.qualityChecks != nil {
+		repo.scheduleQualityChecks(repo.qualityChecks.Interval)
+	}
+
 	return repo, nil
 }
 
@@ -156,6 +203,8 @@ func (d *DeltaLakeRepository) initializeTable() error {
 			},
 			CreatedAt: time.Now(),
 		}
+		d.schemas = map[int64]*Schema{d.currentSchema.ID: d.currentSchema}
+		d.ensureColumnMapping()
 
 		d.metadata = &TableMetadata{
 			Name:           "exercises",
@@ -194,15 +243,25 @@ func (d *DeltaLakeRepository) saveMetadata() error {
 	metadataPath := filepath.Join(d.basePath, "_delta_log", "metadata.json")
 
 	metadata := struct {
-		Schema   *Schema            `json:"schema"`
-		Metadata *TableMetadata     `json:"metadata"`
-		Versions map[int64]*Version `json:"versions"`
-		Config   *DeltaConfig       `json:"config"`
+		Schema        *Schema                  `json:"schema"`
+		Schemas       map[int64]*Schema        `json:"schemas,omitempty"`
+		Metadata      *TableMetadata           `json:"metadata"`
+		Versions      map[int64]*Version       `json:"versions"`
+		Config        *DeltaConfig             `json:"config"`
+		Constraints   []Constraint             `json:"constraints"`
+		OutlierRules  []OutlierRule            `json:"outlier_rules"`
+		QualityChecks *QualityCheckConfig      `json:"quality_checks,omitempty"`
+		IngestedFiles map[string]*IngestedFile `json:"ingested_files,omitempty"`
 	}{
-		Schema:   d.currentSchema,
-		Metadata: d.metadata,
-		Versions: d.versions,
-		Config:   d.config,
+		Schema:        d.currentSchema,
+		Schemas:       d.schemas,
+		Metadata:      d.metadata,
+		Versions:      d.versions,
+		Config:        d.config,
+		Constraints:   d.constraints,
+		OutlierRules:  d.outlierRules,
+		QualityChecks: d.qualityChecks,
+		IngestedFiles: d.ingestedFiles,
 	}
 
 	data, err := json.MarshalIndent(metadata, "", "  ")
@@ -223,10 +282,15 @@ func (d *DeltaLakeRepository) loadMetadata() error {
 	}
 
 	var metadata struct {
-		Schema   *Schema            `json:"schema"`
-		Metadata *TableMetadata     `json:"metadata"`
-		Versions map[int64]*Version `json:"versions"`
-		Config   *DeltaConfig       `json:"config"`
+		Schema        *Schema                  `json:"schema"`
+		Schemas       map[int64]*Schema        `json:"schemas,omitempty"`
+		Metadata      *TableMetadata           `json:"metadata"`
+		Versions      map[int64]*Version       `json:"versions"`
+		Config        *DeltaConfig             `json:"config"`
+		Constraints   []Constraint             `json:"constraints"`
+		OutlierRules  []OutlierRule            `json:"outlier_rules"`
+		QualityChecks *QualityCheckConfig      `json:"quality_checks,omitempty"`
+		IngestedFiles map[string]*IngestedFile `json:"ingested_files,omitempty"`
 	}
 
 	if err := json.Unmarshal(data, &metadata); err != nil {
@@ -234,11 +298,34 @@ func (d *DeltaLakeRepository) loadMetadata() error {
 	}
 
 	d.currentSchema = metadata.Schema
+	d.schemas = metadata.Schemas
+	if d.schemas == nil {
+		// Tables written before schemas were kept only know the current one
+		d.schemas = make(map[int64]*Schema)
+	}
+	d.schemas[d.currentSchema.ID] = d.currentSchema
+	d.ensureColumnMapping()
 	d.metadata = metadata.Metadata
 	d.versions = metadata.Versions
 	if metadata.Config != nil {
 		d.config = metadata.Config
 	}
+	if metadata.Constraints != nil {
+		d.constraints = metadata.Constraints
+	}
+	if metadata.OutlierRules != nil {
+		d.outlierRules = metadata.OutlierRules
+	}
+	d.qualityChecks = metadata.QualityChecks
+	if metadata.IngestedFiles != nil {
+		d.ingestedFiles = metadata.IngestedFiles
+	}
+
+	validator, err := validatorFromProperties(d.metadata.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to load validation rules: %w", err)
+	}
+	d.validator = validator.WithFieldNames(renamedFields(d.currentSchema))
 
 	// Find current version
 	maxVersion := int64(-1)
@@ -275,60 +362,39 @@ func (d *DeltaLakeRepository) InsertBatch(exercises []loader.Exercise) error {
 }
 
 func (d *DeltaLakeRepository) GetByID(id int) (*loader.Exercise, error) {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-
 	// This is a simplified implementation - in a real Delta Lake,
 	// this would read from parquet files
-	exercises, err := d.getAllFromFiles()
+	exercises, err := d.executeQuery(Filter{
+		Conditions: []Condition{{Field: "id", Operator: OperatorEqual, Value: id}},
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, exercise := range exercises {
-		if exercise.ID == id {
-			return &exercise, nil
-		}
+	if len(exercises) == 0 {
+		return nil, nil
 	}
 
-	return nil, nil
+	return &exercises[0], nil
 }
 
 func (d *DeltaLakeRepository) GetByDateRange(start, end time.Time) ([]loader.Exercise, error) {
-	exercises, err := d.getAllFromFiles()
-	if err != nil {
-		return nil, err
-	}
-
-	var result []loader.Exercise
-	for _, exercise := range exercises {
-		if (exercise.Date.Equal(start) || exercise.Date.After(start)) &&
-			(exercise.Date.Equal(end) || exercise.Date.Before(end)) {
-			result = append(result, exercise)
-		}
-	}
-
-	return result, nil
+	return d.executeQuery(Filter{
+		Conditions: []Condition{
+			{Field: "date", Operator: OperatorGreaterThanOrEqual, Value: start},
+			{Field: "date", Operator: OperatorLessThanOrEqual, Value: end},
+		},
+	})
 }
 
 func (d *DeltaLakeRepository) GetByType(exerciseType string) ([]loader.Exercise, error) {
-	exercises, err := d.getAllFromFiles()
-	if err != nil {
-		return nil, err
-	}
-
-	var result []loader.Exercise
-	for _, exercise := range exercises {
-		if exercise.Type == exerciseType {
-			result = append(result, exercise)
-		}
-	}
-
-	return result, nil
+	return d.executeQuery(Filter{
+		Conditions: []Condition{{Field: "type", Operator: OperatorEqual, Value: exerciseType}},
+	})
 }
 
 func (d *DeltaLakeRepository) GetAll() ([]loader.Exercise, error) {
-	return d.getAllFromFiles()
+	return d.executeQuery(Filter{})
 }
 
 func (d *DeltaLakeRepository) Update(exercise loader.Exercise) error {
@@ -362,6 +428,9 @@ func (d *DeltaLakeRepository) Delete(id int) error {
 }
 
 func (d *DeltaLakeRepository) Close() error {
+	// Stop scheduled checks before locking since a running check holds a read lock
+	d.scheduleQualityChecks(0)
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
@@ -378,34 +447,20 @@ func (d *DeltaLakeRepository) Close() error {
 
 // getAllFromFiles reads all exercises from the current version files
 func (d *DeltaLakeRepository) getAllFromFiles() ([]loader.Exercise, error) {
-	// Read from Delta Lake style part files
-	fileName := fmt.Sprintf("part-%05d-%05d.json", d.currentVersion, d.currentVersion)
-	dataPath := filepath.Join(d.basePath, fileName)
-
-	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
-		return []loader.Exercise{}, nil
-	}
-
-	data, err := os.ReadFile(dataPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read data file: %w", err)
-	}
-
-	var exercises []loader.Exercise
-	if err := json.Unmarshal(data, &exercises); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal exercises: %w", err)
-	}
-
-	return exercises, nil
+	return d.readVersionData(d.currentVersion)
 }
 
 // saveVersionData saves exercise data for a specific version
 func (d *DeltaLakeRepository) saveVersionData(version int64, exercises []loader.Exercise) error {
 	// Create data file with Delta Lake naming convention
-	fileName := fmt.Sprintf("part-%05d-%05d.json", version, version)
-	dataPath := filepath.Join(d.basePath, fileName)
+	dataPath := filepath.Join(d.basePath, dataFileName(version))
 
-	data, err := json.MarshalIndent(exercises, "", "  ")
+	rows := make([]map[string]interface{}, len(exercises))
+	for i, exercise := range exercises {
+		rows[i] = exerciseToRow(exercise, d.currentSchema)
+	}
+
+	data, err := json.MarshalIndent(rows, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal exercises: %w", err)
 	}
@@ -423,6 +478,12 @@ func (d *DeltaLakeRepository) BeginTransaction(ctx context.Context) (Transaction
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
+	return d.beginTransactionLocked(), nil
+}
+
+// beginTransactionLocked starts a new transaction. The caller must hold the
+// write lock.
+func (d *DeltaLakeRepository) beginTransactionLocked() *deltaTransaction {
 	txID := fmt.Sprintf("tx_%d_%d", time.Now().UnixNano(), len(d.transactions))
 
 	tx := &deltaTransaction{
@@ -438,7 +499,7 @@ func (d *DeltaLakeRepository) BeginTransaction(ctx context.Context) (Transaction
 	}
 
 	d.transactions[txID] = tx
-	return tx, nil
+	return tx
 }
 
 // CommitTransaction commits a transaction
@@ -451,6 +512,12 @@ func (d *DeltaLakeRepository) CommitTransaction(ctx context.Context, tx Transact
 		return fmt.Errorf("invalid transaction type")
 	}
 
+	return d.commitTransactionLocked(deltaTx)
+}
+
+// commitTransactionLocked commits a transaction. The caller must hold the
+// write lock.
+func (d *DeltaLakeRepository) commitTransactionLocked(deltaTx *deltaTransaction) error {
 	if !deltaTx.isActive {
 		return fmt.Errorf("transaction %s is not active", deltaTx.id)
 	}
@@ -460,8 +527,28 @@ func (d *DeltaLakeRepository) CommitTransaction(ctx context.Context, tx Transact
 		return fmt.Errorf("transaction has conflicts and cannot be committed")
 	}
 
-	// Apply pending operations
-	if err := d.applyTransactionChanges(deltaTx); err != nil {
+	// Columns merged into the schema are committed with the rows that add them
+	operations := deltaTx.operations
+	oldSchema, oldRules := d.currentSchema, d.outlierRules
+	if deltaTx.mergeSchema {
+		operation, err := d.mergeSchemaLocked(deltaTx.pendingWrites, deltaTx.mergedColumns)
+		if err != nil {
+			d.rollbackTransactionInternal(deltaTx)
+			return fmt.Errorf("failed to merge schema: %w", err)
+		}
+		if operation != nil {
+			operations = append([]Operation{*operation}, operations...)
+		}
+	}
+
+	// Apply pending operations; a transaction that fails to apply is aborted
+	applied, err := d.applyTransactionChanges(deltaTx)
+	if err != nil {
+		if d.currentSchema != oldSchema {
+			delete(d.schemas, d.currentSchema.ID)
+			d.currentSchema, d.outlierRules = oldSchema, oldRules
+		}
+		d.rollbackTransactionInternal(deltaTx)
 		return fmt.Errorf("failed to apply transaction changes: %w", err)
 	}
 
@@ -476,10 +563,18 @@ func (d *DeltaLakeRepository) CommitTransaction(ctx context.Context, tx Transact
 		Timestamp:   time.Now(),
 		Description: fmt.Sprintf("Transaction %s committed", deltaTx.id),
 		SchemaID:    d.currentSchema.ID,
-		Operations:  deltaTx.operations,
+		Operations:  operations,
+
+		DataFile:       applied.dataFile,
+		DeletionVector: applied.deletionVector,
 	}
 
 	d.versions[d.currentVersion] = version
+	d.recordChanges(applied.changes, version, deltaTx.id)
+	if file := deltaTx.ingestedFile; file != nil {
+		file.Version = d.currentVersion
+		d.ingestedFiles[file.Path] = file
+	}
 
 	// Save metadata
 	return d.saveMetadata()
@@ -513,50 +608,110 @@ func (d *DeltaLakeRepository) rollbackTransactionInternal(tx *deltaTransaction)
 	return nil
 }
 
-// applyTransactionChanges applies all pending changes from a transaction
-func (d *DeltaLakeRepository) applyTransactionChanges(tx *deltaTransaction) error {
+// appliedChanges describes what a transaction wrote: the data file of the new
+// version when it reuses an earlier file, the deletion vector on that file and
+// the row changes made
+type appliedChanges struct {
+	dataFile       string
+	deletionVector *DeletionVector
+	changes        []ChangeEvent
+}
+
+// applyTransactionChanges applies all pending changes from a transaction.
+// Transactions that only delete rows record them in a deletion vector where
+// possible; anything else writes a new data file. The resulting rows must
+// satisfy every enabled constraint.
+func (d *DeltaLakeRepository) applyTransactionChanges(tx *deltaTransaction) (*appliedChanges, error) {
+	if len(tx.pendingWrites) == 0 && len(tx.pendingDeletes) > 0 {
+		applied, err := d.applyDeletes(tx)
+		if err != nil || applied != nil {
+			return applied, err
+		}
+	}
+
+	// Written rows must fit the schema
+	writes := make([]loader.Exercise, len(tx.pendingWrites))
+	for i, exercise := range tx.pendingWrites {
+		conformed, err := d.conformToSchema(exercise)
+		if err != nil {
+			return nil, fmt.Errorf("invalid row %d: %w", i, err)
+		}
+		writes[i] = conformed
+	}
+
 	// Read current data
 	exercises, err := d.getAllFromFiles()
 	if err != nil {
-		return fmt.Errorf("failed to read current data: %w", err)
+		return nil, fmt.Errorf("failed to read current data: %w", err)
 	}
 
-	// Apply deletes
-	exerciseMap := make(map[int]loader.Exercise)
-	for _, exercise := range exercises {
-		exerciseMap[exercise.ID] = exercise
+	newExercises, positions := d.mergeChanges(exercises, writes, tx.pendingDeletes)
+
+	violations, err := checkConstraints(d.constraints, d.columnViews(newExercises), positions)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, &ConstraintError{Violations: violations}
+	}
+
+	// Save new version
+	if err := d.saveVersionData(d.currentVersion+1, newExercises); err != nil {
+		return nil, fmt.Errorf("failed to save version data: %w", err)
 	}
 
-	for _, deleteID := range tx.pendingDeletes {
-		delete(exerciseMap, deleteID)
+	// Update metadata
+	d.metadata.LastModified = time.Now()
+	d.metadata.RecordCount = int64(len(newExercises))
+
+	return &appliedChanges{changes: diffChanges(exercises, newExercises)}, nil
+}
+
+// mergeChanges applies deletes and then writes to the current rows. Existing
+// rows keep their order, updates replace rows in place and new rows are
+// appended with generated IDs when they have none. It returns the resulting
+// rows and, for every write, its position in them.
+func (d *DeltaLakeRepository) mergeChanges(exercises, writes []loader.Exercise, deletes []int) ([]loader.Exercise, []int) {
+	deleted := make(map[int]bool, len(deletes))
+	for _, id := range deletes {
+		deleted[id] = true
+	}
+
+	merged := make([]loader.Exercise, 0, len(exercises)+len(writes))
+	positionByID := make(map[int]int, len(exercises))
+	for _, exercise := range exercises {
+		if deleted[exercise.ID] {
+			continue
+		}
+		positionByID[exercise.ID] = len(merged)
+		merged = append(merged, exercise)
 	}
 
-	// Apply inserts and updates
+	// Generated IDs must not collide with existing or explicitly written ones
 	nextID := d.getNextID(exercises)
-	for _, exercise := range tx.pendingWrites {
+	if writtenNext := d.getNextID(writes); writtenNext > nextID {
+		nextID = writtenNext
+	}
+
+	positions := make([]int, len(writes))
+	for i, exercise := range writes {
 		if exercise.ID == 0 {
 			exercise.ID = nextID
 			nextID++
 		}
-		exerciseMap[exercise.ID] = exercise
-	}
 
-	// Convert back to slice
-	newExercises := make([]loader.Exercise, 0, len(exerciseMap))
-	for _, exercise := range exerciseMap {
-		newExercises = append(newExercises, exercise)
-	}
+		if position, exists := positionByID[exercise.ID]; exists {
+			merged[position] = exercise
+			positions[i] = position
+			continue
+		}
 
-	// Save new version
-	if err := d.saveVersionData(d.currentVersion+1, newExercises); err != nil {
-		return fmt.Errorf("failed to save version data: %w", err)
+		positionByID[exercise.ID] = len(merged)
+		positions[i] = len(merged)
+		merged = append(merged, exercise)
 	}
 
-	// Update metadata
-	d.metadata.LastModified = time.Now()
-	d.metadata.RecordCount = int64(len(newExercises))
-
-	return nil
+	return merged, positions
 }
 
 // getNextID finds the next available ID
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDeltaLake(t *testing.T, config *DeltaConfig) *DeltaLakeRepository {
+	t.Helper()
+
+	repo, err := NewDeltaLakeRepository(t.TempDir(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+func sampleExercises() []loader.Exercise {
+	return []loader.Exercise{
+		{Name: "Running", Type: "cardio", Duration: 30, Calories: 300, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Description: "Morning run"},
+		{Name: "Push-ups", Type: "strength", Duration: 15, Calories: 100, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Description: "Upper body"},
+		{Name: "Swimming", Type: "cardio", Duration: 45, Calories: 400, Date: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC), Description: "Pool laps"},
+		{Name: "Yoga", Type: "flexibility", Duration: 60, Calories: 150, Date: time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC), Description: ""},
+	}
+}
+
+func TestDeltaLakeRepository_QueryWithFilter(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	ctx := context.Background()
+
+	limit := 2
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{
+			name:     "equality on JSON number",
+			filter:   Filter{Conditions: []Condition{{Field: "duration", Operator: OperatorEqual, Value: float64(45)}}},
+			expected: []string{"Swimming"},
+		},
+		{
+			name: "range with sorting",
+			filter: Filter{
+				Conditions: []Condition{{Field: "calories", Operator: OperatorGreaterThanOrEqual, Value: 150}},
+				SortBy:     []SortField{{Field: "calories", Order: SortOrderDesc}},
+			},
+			expected: []string{"Swimming", "Running", "Yoga"},
+		},
+		{
+			name:     "in list",
+			filter:   Filter{Conditions: []Condition{{Field: "type", Operator: OperatorIn, Value: []interface{}{"strength", "flexibility"}}}, SortBy: []SortField{{Field: "name"}}},
+			expected: []string{"Push-ups", "Yoga"},
+		},
+		{
+			name:     "like pattern",
+			filter:   Filter{Conditions: []Condition{{Field: "name", Operator: OperatorLike, Value: "%ing"}}, SortBy: []SortField{{Field: "name"}}},
+			expected: []string{"Running", "Swimming"},
+		},
+		{
+			name:     "date between",
+			filter:   Filter{Conditions: []Condition{{Field: "date", Operator: OperatorBetween, Value: []interface{}{"2024-01-16", "2024-01-17"}}}, SortBy: []SortField{{Field: "date"}}},
+			expected: []string{"Swimming", "Yoga"},
+		},
+		{
+			name:     "is null",
+			filter:   Filter{Conditions: []Condition{{Field: "description", Operator: OperatorIsNull}}},
+			expected: []string{"Yoga"},
+		},
+		{
+			name:     "limit",
+			filter:   Filter{SortBy: []SortField{{Field: "duration"}}, Limit: &limit},
+			expected: []string{"Push-ups", "Running"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.QueryWithFilter(ctx, tt.filter)
+			require.NoError(t, err)
+
+			names := make([]string, len(result))
+			for i, exercise := range result {
+				names[i] = exercise.Name
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestDeltaLakeRepository_QueryStats(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	ctx := context.Background()
+
+	_, err := repo.GetAll()
+	require.NoError(t, err)
+	cardio, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	require.Len(t, cardio, 2)
+	_, err = repo.GetByType("cardio")
+	require.NoError(t, err)
+
+	stats, err := repo.GetQueryStats(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), stats.TotalQueries)
+	assert.Equal(t, int64(8), stats.RecordsScanned, "second lookup is served from the cache")
+	assert.Equal(t, int64(8), stats.RecordsReturned)
+	assert.InDelta(t, 1.0/3.0, stats.CacheHitRate, 0.001)
+	assert.Greater(t, stats.AverageLatency, time.Duration(0))
+	assert.Greater(t, stats.P95Latency, time.Duration(0))
+	require.Len(t, stats.TopQueries, 2)
+
+	counts := map[string]int64{}
+	for _, query := range stats.TopQueries {
+		counts[query.SQL] = query.Count
+	}
+	assert.Equal(t, int64(2), counts["SELECT * FROM exercises WHERE type = 'cardio'"])
+	assert.Equal(t, int64(1), counts["SELECT * FROM exercises"])
+}
+
+func TestDeltaLakeRepository_QueryStatsIndexAndPartitions(t *testing.T) {
+	repo := newTestDeltaLake(t, &DeltaConfig{PartitionFields: []string{"type"}})
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	ctx := context.Background()
+
+	// Partition pruning on the partition column
+	result, err := repo.GetByType("strength")
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	stats, err := repo.GetQueryStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.PartitionsPruned)
+	assert.Equal(t, int64(1), stats.RecordsScanned)
+
+	// Index lookup on a non-partition column
+	require.NoError(t, repo.CreateIndex(ctx, "idx_name", []string{"name"}))
+	found, err := repo.QueryWithFilter(ctx, Filter{
+		Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Yoga"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	stats, err = repo.GetQueryStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.IndexUsage["idx_name"])
+	assert.Equal(t, int64(2), stats.RecordsScanned)
+}
+
+func TestQueryStatsCollector_RollingWindow(t *testing.T) {
+	collector := newQueryStatsCollector(2)
+
+	collector.record(queryExecution{query: "slow", duration: 100 * time.Millisecond})
+	collector.record(queryExecution{query: "fast", duration: 10 * time.Millisecond})
+	collector.record(queryExecution{query: "fast", duration: 20 * time.Millisecond})
+
+	stats := collector.snapshot()
+	assert.Equal(t, int64(3), stats.TotalQueries)
+	assert.Equal(t, 15*time.Millisecond, stats.AverageLatency)
+	assert.Equal(t, 20*time.Millisecond, stats.P95Latency)
+	require.Len(t, stats.TopQueries, 1)
+	assert.Equal(t, "fast", stats.TopQueries[0].SQL)
+	assert.Equal(t, int64(2), stats.TopQueries[0].Count)
+}
+
+func TestDeltaLakeRepository_QueryCacheInvalidation(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	first, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Equal(t, 1, repo.queryCache.entryCount())
+
+	// Modifying a returned slice must not leak into the cache
+	first[0].Name = "changed"
+	cached, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	assert.NotEqual(t, "changed", cached[0].Name)
+
+	// A commit moves the table to a new version, so the next read misses
+	require.NoError(t, repo.Insert(loader.Exercise{Name: "Cycling", Type: "cardio", Duration: 50, Calories: 450, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)}))
+	updated, err := repo.GetByType("cardio")
+	require.NoError(t, err)
+	assert.Len(t, updated, 3)
+
+	stats, err := repo.GetQueryStats(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0/3.0, stats.CacheHitRate, 0.001)
+}
+
+func TestDeltaLakeRepository_QueryCacheCopiesExtra(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	evolveWith(t, repo, strengthFields()...)
+	require.NoError(t, repo.Insert(nestedExercise("Squat",
+		[]interface{}{map[string]interface{}{"reps": float64(5)}},
+		map[string]interface{}{"device": "phone"})))
+
+	// Extra columns and their nested values are not shared with the cache
+	for i := 0; i < 2; i++ {
+		first, err := repo.GetByType("strength")
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+		first[0].Extra["metadata"].(map[string]interface{})["device"] = "changed"
+		first[0].Extra["sets"].([]interface{})[0].(map[string]interface{})["reps"] = 99
+		first[0].Extra["added"] = true
+	}
+
+	cached, err := repo.GetByType("strength")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"device": "phone"}, cached[0].Extra["metadata"])
+	assert.Equal(t, 5, cached[0].Extra["sets"].([]interface{})[0].(map[string]interface{})["reps"])
+	assert.NotContains(t, cached[0].Extra, "added")
+}
+
+func TestDeltaLakeRepository_QueryCacheLimits(t *testing.T) {
+	repo := newTestDeltaLake(t, &DeltaConfig{QueryCacheMaxEntries: 2})
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	for _, exerciseType := range []string{"cardio", "strength", "flexibility"} {
+		_, err := repo.GetByType(exerciseType)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, repo.queryCache.entryCount())
+
+	// The least recently used entry was evicted
+	_, hit := repo.queryCache.get(repo.currentVersion, describeFilter(Filter{
+		Conditions: []Condition{{Field: "type", Operator: OperatorEqual, Value: "cardio"}},
+	}))
+	assert.False(t, hit)
+
+	disabled := newTestDeltaLake(t, &DeltaConfig{QueryCacheMaxBytes: -1})
+	require.NoError(t, disabled.InsertBatch(sampleExercises()))
+	for i := 0; i < 2; i++ {
+		_, err := disabled.GetByType("cardio")
+		require.NoError(t, err)
+	}
+	stats, err := disabled.GetQueryStats(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, stats.CacheHitRate)
+}
+
+func TestDeltaLakeRepository_AggregateByTimeWindow(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	ctx := context.Background()
+
+	window := TimeWindow{Size: 24 * time.Hour}
+	aggregations := []Aggregation{
+		{Function: AggregationCount, Field: "*"},
+		{Function: AggregationSum, Field: "calories"},
+		{Function: AggregationAvg, Field: "duration", Alias: "avg_minutes"},
+		{Function: AggregationMax, Field: "calories"},
+	}
+
+	results, err := repo.AggregateByTimeWindow(ctx, window, aggregations)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), results[0].Window)
+	assert.Equal(t, int64(2), results[0].Values["count"])
+	assert.Equal(t, 400.0, results[0].Values["sum_calories"])
+	assert.Equal(t, 22.5, results[0].Values["avg_minutes"])
+	assert.Equal(t, 300, results[0].Values["max_calories"])
+
+	// Hopping windows place each record in every window covering it
+	hopping, err := repo.AggregateByTimeWindow(ctx, TimeWindow{
+		Size:  48 * time.Hour,
+		Slide: 24 * time.Hour,
+		Start: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+	}, aggregations[:1])
+	require.NoError(t, err)
+	require.Len(t, hopping, 3)
+	assert.Equal(t, int64(3), hopping[0].Values["count"])
+	assert.Equal(t, int64(2), hopping[1].Values["count"])
+	assert.Equal(t, int64(1), hopping[2].Values["count"])
+
+	// Repeated aggregations are served from the cache
+	_, err = repo.AggregateByTimeWindow(ctx, window, aggregations)
+	require.NoError(t, err)
+	stats, err := repo.GetQueryStats(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0/3.0, stats.CacheHitRate, 0.001)
+
+	_, err = repo.AggregateByTimeWindow(ctx, window, []Aggregation{{Function: AggregationSum, Field: "name"}})
+	assert.Error(t, err)
+	_, err = repo.AggregateByTimeWindow(ctx, TimeWindow{}, aggregations)
+	assert.Error(t, err)
+}
+
+func TestDeltaLakeRepository_QueryWithSQL(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	result, err := repo.QueryWithSQL(context.Background(), "SELECT * FROM exercises WHERE type = ? ORDER BY calories DESC", "cardio")
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, "Swimming", result[0].Name)
+
+	_, err = repo.QueryWithSQL(context.Background(), "SELECT name FROM exercises")
+	assert.Error(t, err)
+}
+
+func TestDeltaLakeRepository_ExplainQuery(t *testing.T) {
+	repo := newTestDeltaLake(t, &DeltaConfig{PartitionFields: []string{"type"}})
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	ctx := context.Background()
+	require.NoError(t, repo.CreateIndex(ctx, "idx_name", []string{"name"}))
+
+	limit := 1
+	filter := Filter{
+		Conditions: []Condition{
+			{Field: "type", Operator: OperatorEqual, Value: "cardio"},
+			{Field: "calories", Operator: OperatorGreaterThan, Value: 100},
+		},
+		SortBy: []SortField{{Field: "calories", Order: SortOrderDesc}},
+		Limit:  &limit,
+	}
+
+	explanation, err := repo.ExplainQuery(ctx, filter)
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT * FROM exercises WHERE calories > 100 AND type = 'cardio' ORDER BY calories DESC LIMIT 1", explanation.Query)
+	assert.Equal(t, 1, explanation.FilesTotal)
+	assert.Equal(t, 1, explanation.FilesScanned)
+	assert.Equal(t, 3, explanation.PartitionsTotal)
+	assert.Equal(t, 2, explanation.PartitionsPruned)
+	assert.Empty(t, explanation.IndexUsed)
+	assert.False(t, explanation.FullScan)
+	assert.Equal(t, int64(1), explanation.EstimatedRows)
+	assert.Equal(t, int64(2), explanation.RecordsScanned)
+	assert.Equal(t, int64(1), explanation.ActualRows)
+	assert.False(t, explanation.Cached)
+
+	stages := make([]string, len(explanation.Stages))
+	for i, stage := range explanation.Stages {
+		stages[i] = stage.Name
+	}
+	assert.Equal(t, []string{"read", "plan", "filter", "sort", "limit"}, stages)
+	assert.Equal(t, int64(2), explanation.Stages[2].RowsOut)
+
+	// Explaining neither records statistics nor fills the cache
+	stats, err := repo.GetQueryStats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.TotalQueries)
+
+	// Index selection is reported with the condition it resolved
+	_, err = repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Yoga"}}})
+	require.NoError(t, err)
+	explanation, err = repo.ExplainQuery(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Yoga"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "idx_name", explanation.IndexUsed)
+	assert.Equal(t, "name = 'Yoga'", explanation.IndexCondition)
+	assert.Equal(t, int64(1), explanation.RecordsScanned)
+	assert.True(t, explanation.Cached)
+}
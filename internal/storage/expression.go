@@ -0,0 +1,683 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Boolean and arithmetic expressions over exercise columns, used by check and
+// range constraints. Expressions follow SQL semantics: NULL propagates through
+// operators, and a comparison with NULL is unknown rather than false.
+//
+//	expression := expression OR expression | expression AND expression | NOT expression
+//	            | value op value | value [NOT] IN (value, ...) | value [NOT] LIKE value
+//	            | value [NOT] BETWEEN value AND value | value IS [NOT] NULL
+//	value      := value (+ | - | * | /) value | -value | (expression)
+//	            | column | number | 'string' | TRUE | FALSE | NULL | function(value, ...)
+//
+// Supported functions are LENGTH, LOWER, UPPER, TRIM, ABS, COALESCE and NOW.
+
+// exprNode is a node of a parsed expression
+type exprNode interface {
+	eval(row loader.Exercise) (interface{}, error)
+	String() string
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+type columnExpr struct {
+	name string
+}
+
+type unaryExpr struct {
+	op      string
+	operand exprNode
+}
+
+type binaryExpr struct {
+	op          string
+	left, right exprNode
+}
+
+type inExpr struct {
+	operand exprNode
+	values  []exprNode
+	negated bool
+}
+
+type likeExpr struct {
+	operand, pattern exprNode
+	negated          bool
+}
+
+type betweenExpr struct {
+	operand, lower, upper exprNode
+	negated               bool
+}
+
+type isNullExpr struct {
+	operand exprNode
+	negated bool
+}
+
+type funcExpr struct {
+	name string
+	args []exprNode
+}
+
+// expressionFunctions lists the supported functions with their argument counts (-1 for variadic)
+var expressionFunctions = map[string]int{
+	"LENGTH":   1,
+	"LOWER":    1,
+	"UPPER":    1,
+	"TRIM":     1,
+	"ABS":      1,
+	"COALESCE": -1,
+	"NOW":      0,
+}
+
+// parseExpression parses an expression. The columns it references are checked
+// against a schema by its user; see checkConstraintColumns.
+func parseExpression(text string) (exprNode, error) {
+	tokens, err := tokenizeSQL(text)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &sqlParser{tokens: tokens}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != sqlTokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+	}
+
+	return node, nil
+}
+
+func (p *sqlParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (exprNode, error) {
+	if p.keyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", operand: operand}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *sqlParser) parsePredicate() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.peek(); token.kind == sqlTokenSymbol {
+		switch token.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := token.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.keyword("IS") {
+		negated := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{operand: left, negated: negated}, nil
+	}
+
+	negated := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if !p.symbol("(") {
+			return nil, fmt.Errorf("expected ( at position %d", p.peek().pos)
+		}
+		values := make([]exprNode, 0)
+		for {
+			value, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if p.symbol(")") {
+				break
+			}
+			if !p.symbol(",") {
+				return nil, fmt.Errorf("expected , or ) at position %d", p.peek().pos)
+			}
+		}
+		return &inExpr{operand: left, values: values, negated: negated}, nil
+	case p.keyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{operand: left, pattern: pattern, negated: negated}, nil
+	case p.keyword("BETWEEN"):
+		lower, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{operand: left, lower: lower, upper: upper, negated: negated}, nil
+	}
+
+	if negated {
+		return nil, fmt.Errorf("expected IN, LIKE or BETWEEN after NOT at position %d", p.peek().pos)
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !p.symbol("+") && !p.symbol("-") {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !p.symbol("*") && !p.symbol("/") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) parseUnary() (exprNode, error) {
+	if p.symbol("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *sqlParser) parsePrimary() (exprNode, error) {
+	if p.symbol("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, fmt.Errorf("expected ) at position %d", p.peek().pos)
+		}
+		return node, nil
+	}
+
+	token := p.peek()
+	if token.kind != sqlTokenIdent {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: value}, nil
+	}
+
+	switch strings.ToUpper(token.text) {
+	case "TRUE", "FALSE", "NULL":
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: value}, nil
+	}
+
+	p.next()
+	if !p.symbol("(") {
+		return &columnExpr{name: strings.ToLower(token.text)}, nil
+	}
+
+	name := strings.ToUpper(token.text)
+	arity, ok := expressionFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", token.text)
+	}
+
+	args := make([]exprNode, 0)
+	if !p.symbol(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.symbol(")") {
+				break
+			}
+			if !p.symbol(",") {
+				return nil, fmt.Errorf("expected , or ) at position %d", p.peek().pos)
+			}
+		}
+	}
+
+	if arity >= 0 && len(args) != arity {
+		return nil, fmt.Errorf("function %s expects %d argument(s), got %d", name, arity, len(args))
+	}
+	return &funcExpr{name: name, args: args}, nil
+}
+
+// expressionColumns returns the distinct columns referenced by an expression
+func expressionColumns(node exprNode) []string {
+	seen := make(map[string]bool)
+	columns := make([]string, 0)
+
+	var walk func(exprNode)
+	walk = func(node exprNode) {
+		switch n := node.(type) {
+		case *columnExpr:
+			if !seen[n.name] {
+				seen[n.name] = true
+				columns = append(columns, n.name)
+			}
+		case *unaryExpr:
+			walk(n.operand)
+		case *binaryExpr:
+			walk(n.left)
+			walk(n.right)
+		case *inExpr:
+			walk(n.operand)
+			for _, value := range n.values {
+				walk(value)
+			}
+		case *likeExpr:
+			walk(n.operand)
+			walk(n.pattern)
+		case *betweenExpr:
+			walk(n.operand)
+			walk(n.lower)
+			walk(n.upper)
+		case *isNullExpr:
+			walk(n.operand)
+		case *funcExpr:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(node)
+
+	return columns
+}
+
+// Evaluation
+
+func (e *literalExpr) eval(row loader.Exercise) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *columnExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, ok := exerciseFieldValue(row, e.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown column %s", e.name)
+	}
+	if isNullValue(value) {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (e *unaryExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, err := e.operand.eval(row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	if e.op == "NOT" {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("NOT requires a boolean operand, got %v", value)
+		}
+		return !b, nil
+	}
+
+	number, ok := numericValue(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %v", value)
+	}
+	return -number, nil
+}
+
+func (e *binaryExpr) eval(row loader.Exercise) (interface{}, error) {
+	if e.op == "AND" || e.op == "OR" {
+		return e.evalLogical(row)
+	}
+
+	left, err := e.left.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "+", "-", "*", "/":
+		l, okLeft := numericValue(left)
+		r, okRight := numericValue(right)
+		if !okLeft || !okRight {
+			return nil, fmt.Errorf("operator %s requires numeric operands, got %v and %v", e.op, left, right)
+		}
+		switch e.op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		default:
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return l / r, nil
+		}
+	}
+
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+	}
+
+	switch e.op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator %s", e.op)
+}
+
+// evalLogical implements three-valued AND and OR
+func (e *binaryExpr) evalLogical(row loader.Exercise) (interface{}, error) {
+	left, err := evalBool(e.left, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalBool(e.right, row)
+	if err != nil {
+		return nil, err
+	}
+
+	decisive := e.op == "OR"
+	if (left != nil && *left == decisive) || (right != nil && *right == decisive) {
+		return decisive, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+func (e *inExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, err := e.operand.eval(row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(e.values))
+	for _, node := range e.values {
+		candidate, err := node.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, candidate)
+	}
+
+	return containsValue(values, value) != e.negated, nil
+}
+
+func (e *likeExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, err := e.operand.eval(row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	pattern, err := e.pattern.eval(row)
+	if err != nil || pattern == nil {
+		return nil, err
+	}
+
+	return matchLike(fmt.Sprint(value), fmt.Sprint(pattern)) != e.negated, nil
+}
+
+func (e *betweenExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, err := e.operand.eval(row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	lower, err := e.lower.eval(row)
+	if err != nil || lower == nil {
+		return nil, err
+	}
+	upper, err := e.upper.eval(row)
+	if err != nil || upper == nil {
+		return nil, err
+	}
+
+	cmpLower, okLower := compareValues(value, lower)
+	cmpUpper, okUpper := compareValues(value, upper)
+	if !okLower || !okUpper {
+		return nil, fmt.Errorf("cannot compare %v with %v and %v", value, lower, upper)
+	}
+
+	return (cmpLower >= 0 && cmpUpper <= 0) != e.negated, nil
+}
+
+func (e *isNullExpr) eval(row loader.Exercise) (interface{}, error) {
+	value, err := e.operand.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	return (value == nil) != e.negated, nil
+}
+
+func (e *funcExpr) eval(row loader.Exercise) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, node := range e.args {
+		value, err := node.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	switch e.name {
+	case "COALESCE":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	case "NOW":
+		return time.Now(), nil
+	}
+
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	switch e.name {
+	case "LENGTH":
+		return len([]rune(fmt.Sprint(args[0]))), nil
+	case "LOWER":
+		return strings.ToLower(fmt.Sprint(args[0])), nil
+	case "UPPER":
+		return strings.ToUpper(fmt.Sprint(args[0])), nil
+	case "TRIM":
+		return strings.TrimSpace(fmt.Sprint(args[0])), nil
+	case "ABS":
+		number, ok := numericValue(args[0])
+		if !ok {
+			return nil, fmt.Errorf("ABS requires a numeric argument, got %v", args[0])
+		}
+		return math.Abs(number), nil
+	}
+
+	return nil, fmt.Errorf("unknown function %s", e.name)
+}
+
+// evalBool evaluates an expression that must produce a boolean or NULL
+func evalBool(node exprNode, row loader.Exercise) (*bool, error) {
+	value, err := node.eval(row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expression %s is not boolean", node)
+	}
+	return &b, nil
+}
+
+// Rendering
+
+func (e *literalExpr) String() string {
+	return formatLiteral(e.value)
+}
+
+func (e *columnExpr) String() string {
+	return e.name
+}
+
+func (e *unaryExpr) String() string {
+	if e.op == "NOT" {
+		return "NOT " + e.operand.String()
+	}
+	return "-" + e.operand.String()
+}
+
+func (e *binaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.left, e.op, e.right)
+}
+
+func (e *inExpr) String() string {
+	values := make([]string, len(e.values))
+	for i, value := range e.values {
+		values[i] = value.String()
+	}
+	keyword := "IN"
+	if e.negated {
+		keyword = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", e.operand, keyword, strings.Join(values, ", "))
+}
+
+func (e *likeExpr) String() string {
+	keyword := "LIKE"
+	if e.negated {
+		keyword = "NOT LIKE"
+	}
+	return fmt.Sprintf("%s %s %s", e.operand, keyword, e.pattern)
+}
+
+func (e *betweenExpr) String() string {
+	keyword := "BETWEEN"
+	if e.negated {
+		keyword = "NOT BETWEEN"
+	}
+	return fmt.Sprintf("%s %s %s AND %s", e.operand, keyword, e.lower, e.upper)
+}
+
+func (e *isNullExpr) String() string {
+	if e.negated {
+		return fmt.Sprintf("%s IS NOT NULL", e.operand)
+	}
+	return fmt.Sprintf("%s IS NULL", e.operand)
+}
+
+func (e *funcExpr) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.name, strings.Join(args, ", "))
+}
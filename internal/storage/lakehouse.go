@@ -28,6 +28,8 @@ type LakehouseRepository interface {
 	EvolveSchema(ctx context.Context, newSchema *Schema) error
 	GetSchemaHistory(ctx context.Context) ([]Schema, error)
 	ValidateSchemaCompatibility(ctx context.Context, newSchema *Schema) error
+	RenameColumn(ctx context.Context, name, newName string) error
+	DropColumn(ctx context.Context, name string) error
 
 	// Metadata and Catalog
 	GetTableMetadata(ctx context.Context) (*TableMetadata, error)
@@ -36,10 +38,20 @@ type LakehouseRepository interface {
 	OptimizeTable(ctx context.Context, options OptimizeOptions) (*OptimizeResult, error)
 
 	// Data Quality and Constraints
+	GetConstraints(ctx context.Context) ([]Constraint, error)
 	AddConstraint(ctx context.Context, constraint Constraint) error
+	SetConstraintEnabled(ctx context.Context, constraintName string, enabled bool) error
 	RemoveConstraint(ctx context.Context, constraintName string) error
 	ValidateConstraints(ctx context.Context, exercises []loader.Exercise) error
 	GetDataQualityMetrics(ctx context.Context) (*DataQualityMetrics, error)
+	GetOutlierRules(ctx context.Context) ([]OutlierRule, error)
+	SetOutlierRules(ctx context.Context, rules []OutlierRule) error
+	GetQualityChecks(ctx context.Context) (*QualityCheckConfig, error)
+	SetQualityChecks(ctx context.Context, config QualityCheckConfig) error
+	RunQualityChecks(ctx context.Context) (*QualityCheckResult, error)
+	GetQualityHistory(ctx context.Context, from, to time.Time) ([]QualityCheckResult, error)
+	GetValidationRules(ctx context.Context) (*loader.ValidationRules, error)
+	SetValidationRules(ctx context.Context, rules loader.ValidationRules) error
 
 	// Streaming and Change Data Capture
 	WatchChanges(ctx context.Context, from time.Time) (<-chan ChangeEvent, error)
@@ -54,13 +66,18 @@ type LakehouseRepository interface {
 	// Advanced Querying
 	QueryWithSQL(ctx context.Context, sql string, params ...interface{}) ([]loader.Exercise, error)
 	QueryWithFilter(ctx context.Context, filter Filter) ([]loader.Exercise, error)
+	ExplainQuery(ctx context.Context, filter Filter) (*QueryExplanation, error)
 	AggregateByTimeWindow(ctx context.Context, window TimeWindow, aggregations []Aggregation) ([]AggregationResult, error)
 
 	// Batch Processing
 	InsertBatchWithOptions(ctx context.Context, exercises []loader.Exercise, options BatchOptions) (*BatchResult, error)
 	UpdateBatch(ctx context.Context, exercises []loader.Exercise) (*BatchResult, error)
 	DeleteBatch(ctx context.Context, ids []int) (*BatchResult, error)
+	Merge(ctx context.Context, source []loader.Exercise, on []string, whenMatched, whenNotMatched MergeAction) (*MergeResult, error)
+	DeleteWhere(ctx context.Context, filter Filter) (*MutationResult, error)
+	UpdateWhere(ctx context.Context, filter Filter, assignments map[string]interface{}) (*MutationResult, error)
 	BulkLoad(ctx context.Context, dataSource DataSource, options BulkLoadOptions) (*BulkLoadResult, error)
+	GetIngestedFiles(ctx context.Context) ([]IngestedFile, error)
 
 	// Streaming Support
 	StartStream(ctx context.Context, config StreamConfig) (Stream, error)
@@ -99,6 +116,19 @@ type Version struct {
 	Properties  map[string]string `json:"properties,omitempty"`
 	Operations  []Operation       `json:"operations"`
 	ParentID    *int64            `json:"parent_id,omitempty"`
+
+	// Data file of the version when it reuses an earlier version's file,
+	// with the rows deleted from it since
+	DataFile       string          `json:"data_file,omitempty"`
+	DeletionVector *DeletionVector `json:"deletion_vector,omitempty"`
+}
+
+// DeletionVector marks rows of a data file as deleted without rewriting the
+// file. The positions of the deleted rows are kept as a bitmap in a separate
+// file.
+type DeletionVector struct {
+	Path        string `json:"path"`
+	Cardinality int64  `json:"cardinality"`
 }
 
 // Schema represents the table schema with evolution capabilities
@@ -109,15 +139,30 @@ type Schema struct {
 	CreatedAt   time.Time         `json:"created_at"`
 	Properties  map[string]string `json:"properties,omitempty"`
 	Constraints []Constraint      `json:"constraints,omitempty"`
+
+	// MaxColumnID is the highest column ID ever assigned, so that the IDs of
+	// dropped columns are not reused
+	MaxColumnID int64 `json:"max_column_id,omitempty"`
 }
 
-// Field represents a column in the schema
+// Field represents a column in the schema. With column mapping a column keeps
+// its ID and physical name when renamed; data files store values under the
+// physical name.
 type Field struct {
+	ID           int64             `json:"id,omitempty"`
 	Name         string            `json:"name"`
+	PhysicalName string            `json:"physical_name,omitempty"`
 	Type         FieldType         `json:"type"`
 	Nullable     bool              `json:"nullable"`
 	DefaultValue interface{}       `json:"default_value,omitempty"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
+
+	// Element is the type of the elements of an array, Key and Value the
+	// types of the keys and values of a map, and Fields the fields of a struct
+	Element *Field  `json:"element,omitempty"`
+	Key     *Field  `json:"key,omitempty"`
+	Value   *Field  `json:"value,omitempty"`
+	Fields  []Field `json:"fields,omitempty"`
 }
 
 // FieldType represents column data types
@@ -170,6 +215,7 @@ type Constraint struct {
 	Expression  string         `json:"expression"`
 	Columns     []string       `json:"columns,omitempty"`
 	Enabled     bool           `json:"enabled"`
+	NotValid    bool           `json:"not_valid,omitempty"`
 	CreatedAt   time.Time      `json:"created_at"`
 	Description string         `json:"description,omitempty"`
 }
@@ -187,6 +233,21 @@ const (
 	ConstraintTypeRegex      ConstraintType = "regex"
 )
 
+// ConstraintViolation describes a row that violates a constraint
+type ConstraintViolation struct {
+	Constraint string          `json:"constraint"`
+	Type       ConstraintType  `json:"type"`
+	RowIndex   int             `json:"row_index"`
+	RecordID   int             `json:"record_id"`
+	Message    string          `json:"message"`
+	Record     loader.Exercise `json:"record"`
+}
+
+// ConstraintError reports the constraint violations that prevented a write
+type ConstraintError struct {
+	Violations []ConstraintViolation `json:"violations"`
+}
+
 // DataQualityMetrics provides insights into data quality
 type DataQualityMetrics struct {
 	TotalRecords         int64            `json:"total_records"`
@@ -196,12 +257,119 @@ type DataQualityMetrics struct {
 	ConstraintViolations map[string]int64 `json:"constraint_violations"`
 	DataTypeMismatches   map[string]int64 `json:"data_type_mismatches"`
 	OutlierCounts        map[string]int64 `json:"outlier_counts"`
+	Outliers             map[string][]int `json:"outliers"`
+	InvalidRecords       int64            `json:"invalid_records"`
+	ValidationErrors     map[string]int64 `json:"validation_errors"`
+	Columns              []ColumnProfile  `json:"columns"`
 	CompletenessScore    float64          `json:"completeness_score"`
 	ValidityScore        float64          `json:"validity_score"`
 	ConsistencyScore     float64          `json:"consistency_score"`
 	LastUpdated          time.Time        `json:"last_updated"`
 }
 
+// OutlierRule configures outlier detection for a numeric column. With GroupBy
+// set, the detector runs separately over the rows of each group value, so
+// every group is judged against its own baseline.
+type OutlierRule struct {
+	Column    string                   `json:"column"`
+	Method    OutlierMethod            `json:"method"`
+	Threshold float64                  `json:"threshold,omitempty"`
+	GroupBy   string                   `json:"group_by,omitempty"`
+	Baselines map[string]OutlierBounds `json:"baselines,omitempty"`
+	OutlierBounds
+}
+
+// OutlierBounds are the fixed limits outside which a value is an outlier
+type OutlierBounds struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// OutlierMethod identifies an outlier detector
+type OutlierMethod string
+
+const (
+	OutlierMethodFixed  OutlierMethod = "fixed"
+	OutlierMethodIQR    OutlierMethod = "iqr"
+	OutlierMethodZScore OutlierMethod = "zscore"
+)
+
+// QualityCheckConfig schedules data quality checks for the table. A zero
+// Interval disables scheduling; checks can still be run on demand. In JSON
+// the interval is a duration such as "1h" or a number of seconds.
+type QualityCheckConfig struct {
+	Interval     time.Duration        `json:"interval"`
+	Expectations []QualityExpectation `json:"expectations"`
+	WebhookURL   string               `json:"webhook_url,omitempty"`
+}
+
+// QualityExpectation is a condition on a data quality metric, such as
+// completeness_score gte 99 or duplicate_records over name and date eq 0.
+// Columns narrows column metrics to the given columns, or sets the key of
+// duplicate_records.
+type QualityExpectation struct {
+	Name     string        `json:"name"`
+	Metric   QualityMetric `json:"metric"`
+	Columns  []string      `json:"columns,omitempty"`
+	Operator Operator      `json:"operator"`
+	Value    float64       `json:"value"`
+}
+
+// QualityMetric names a value derived from DataQualityMetrics
+type QualityMetric string
+
+const (
+	QualityMetricCompleteness         QualityMetric = "completeness_score"
+	QualityMetricValidity             QualityMetric = "validity_score"
+	QualityMetricConsistency          QualityMetric = "consistency_score"
+	QualityMetricTotalRecords         QualityMetric = "total_records"
+	QualityMetricInvalidRecords       QualityMetric = "invalid_records"
+	QualityMetricDuplicateRecords     QualityMetric = "duplicate_records"
+	QualityMetricNullValues           QualityMetric = "null_values"
+	QualityMetricOutliers             QualityMetric = "outliers"
+	QualityMetricDataTypeMismatches   QualityMetric = "data_type_mismatches"
+	QualityMetricConstraintViolations QualityMetric = "constraint_violations"
+)
+
+// QualityCheckResult is one run of the quality checks
+type QualityCheckResult struct {
+	RunAt        time.Time           `json:"run_at"`
+	Version      int64               `json:"version"`
+	Passed       bool                `json:"passed"`
+	Expectations []ExpectationResult `json:"expectations"`
+	Metrics      *DataQualityMetrics `json:"metrics,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	AlertError   string              `json:"alert_error,omitempty"`
+}
+
+// ExpectationResult is the outcome of a single expectation
+type ExpectationResult struct {
+	QualityExpectation
+	Actual float64 `json:"actual"`
+	Passed bool    `json:"passed"`
+}
+
+// ColumnProfile summarizes the values of a single schema field
+type ColumnProfile struct {
+	Name        string            `json:"name"`
+	Type        FieldType         `json:"type"`
+	Nullable    bool              `json:"nullable"`
+	NullCount   int64             `json:"null_count"`
+	UniqueCount int64             `json:"unique_count"`
+	Min         interface{}       `json:"min,omitempty"`
+	Max         interface{}       `json:"max,omitempty"`
+	Histogram   []HistogramBucket `json:"histogram,omitempty"`
+}
+
+// HistogramBucket counts values in a range for ordered columns, or the
+// occurrences of a single value for categorical ones
+type HistogramBucket struct {
+	Lower interface{} `json:"lower,omitempty"`
+	Upper interface{} `json:"upper,omitempty"`
+	Value string      `json:"value,omitempty"`
+	Count int64       `json:"count"`
+}
+
 // ChangeEvent represents a change to the table
 type ChangeEvent struct {
 	Type      ChangeType             `json:"type"`
@@ -302,11 +470,12 @@ type OptimizeResult struct {
 
 // CompactionResult contains compaction results
 type CompactionResult struct {
-	FilesCompacted   int           `json:"files_compacted"`
-	FilesCreated     int           `json:"files_created"`
-	RecordsProcessed int64         `json:"records_processed"`
-	SpaceReclaimed   int64         `json:"space_reclaimed"`
-	Duration         time.Duration `json:"duration"`
+	FilesCompacted    int           `json:"files_compacted"`
+	FilesCreated      int           `json:"files_created"`
+	RecordsProcessed  int64         `json:"records_processed"`
+	SpaceReclaimed    int64         `json:"space_reclaimed"`
+	DeletedRowsPurged int64         `json:"deleted_rows_purged"`
+	Duration          time.Duration `json:"duration"`
 }
 
 // QueryStats provides query performance metrics
@@ -328,9 +497,38 @@ type QueryInfo struct {
 	SQL           string        `json:"sql"`
 	ExecutionTime time.Duration `json:"execution_time"`
 	RecordsRead   int64         `json:"records_read"`
+	Count         int64         `json:"count"`
 	Timestamp     time.Time     `json:"timestamp"`
 }
 
+// QueryExplanation describes how a query was planned and executed
+type QueryExplanation struct {
+	Query            string        `json:"query"`
+	Version          int64         `json:"version"`
+	FilesTotal       int           `json:"files_total"`
+	FilesScanned     int           `json:"files_scanned"`
+	FilesPruned      int           `json:"files_pruned"`
+	PartitionsTotal  int           `json:"partitions_total"`
+	PartitionsPruned int           `json:"partitions_pruned"`
+	IndexUsed        string        `json:"index_used,omitempty"`
+	IndexCondition   string        `json:"index_condition,omitempty"`
+	FullScan         bool          `json:"full_scan"`
+	EstimatedRows    int64         `json:"estimated_rows"`
+	RecordsScanned   int64         `json:"records_scanned"`
+	ActualRows       int64         `json:"actual_rows"`
+	Cached           bool          `json:"cached"`
+	Stages           []QueryStage  `json:"stages"`
+	TotalTime        time.Duration `json:"total_time"`
+}
+
+// QueryStage reports the rows and time of one step of a query
+type QueryStage struct {
+	Name     string        `json:"name"`
+	RowsIn   int64         `json:"rows_in"`
+	RowsOut  int64         `json:"rows_out"`
+	Duration time.Duration `json:"duration"`
+}
+
 // Filter represents query filtering options
 type Filter struct {
 	Conditions []Condition `json:"conditions"`
@@ -420,6 +618,20 @@ type BatchOptions struct {
 	ParallelJobs  int           `json:"parallel_jobs"`
 	SkipErrors    bool          `json:"skip_errors"`
 	ValidateFirst bool          `json:"validate_first"`
+	Checks        BatchChecks   `json:"checks,omitempty"`
+
+	// MergeSchema adds the columns the exercises have and the table does not
+	// to the schema, in the same commit as the exercises
+	MergeSchema bool `json:"merge_schema,omitempty"`
+
+	// MergedColumns collects the columns merging the schema adds. Passing the
+	// same map to every batch of a load widens the columns the load added
+	// when a later batch has values they cannot hold.
+	MergedColumns map[string]bool `json:"-"`
+
+	// ingestedFile is the record of the file the batch was read from as of
+	// the end of the batch, committed with it
+	ingestedFile *IngestedFile
 }
 
 // BatchResult contains the result of batch operations
@@ -427,19 +639,55 @@ type BatchResult struct {
 	ProcessedCount int           `json:"processed_count"`
 	SuccessCount   int           `json:"success_count"`
 	ErrorCount     int           `json:"error_count"`
+	SkippedCount   int           `json:"skipped_count"`
 	Duration       time.Duration `json:"duration"`
 	Errors         []BatchError  `json:"errors,omitempty"`
 	Version        int64         `json:"version,omitempty"`
 }
 
-// BatchError represents an error in batch processing
+// MergeAction defines what a merge does with a row
+type MergeAction string
+
+const (
+	MergeActionUpdate MergeAction = "update"
+	MergeActionDelete MergeAction = "delete"
+	MergeActionInsert MergeAction = "insert"
+	MergeActionIgnore MergeAction = "ignore"
+)
+
+// MergeResult contains the result of a merge
+type MergeResult struct {
+	Inserted  int           `json:"inserted"`
+	Updated   int           `json:"updated"`
+	Deleted   int           `json:"deleted"`
+	Unchanged int           `json:"unchanged"`
+	Version   int64         `json:"version"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// MutationResult represents the result of a conditional update or delete.
+// Matched rows that an update leaves as they were are not affected.
+type MutationResult struct {
+	Matched  int           `json:"matched"`
+	Affected int           `json:"affected"`
+	Version  int64         `json:"version"`
+	Duration time.Duration `json:"duration"`
+}
+
+// BatchError represents an error in batch processing, or a record caught by a
+// cross-record check
 type BatchError struct {
-	Index  int    `json:"index"`
-	Error  string `json:"error"`
-	Record string `json:"record,omitempty"`
+	Index  int              `json:"index"`
+	Error  string           `json:"error"`
+	Record string           `json:"record,omitempty"`
+	Column string           `json:"column,omitempty"`
+	Check  BatchCheck       `json:"check,omitempty"`
+	Action BatchCheckAction `json:"action,omitempty"`
 }
 
-// DataSource represents a data source for bulk loading
+// DataSource represents a data source for bulk loading. The location of a
+// file source may be a directory, loaded with the files below it, or a glob
+// pattern; without a format, files of unknown formats are then left out.
 type DataSource struct {
 	Type       DataSourceType    `json:"type"`
 	Location   string            `json:"location"`
@@ -465,6 +713,7 @@ type DataFormat string
 const (
 	DataFormatJSON    DataFormat = "json"
 	DataFormatCSV     DataFormat = "csv"
+	DataFormatNDJSON  DataFormat = "ndjson"
 	DataFormatParquet DataFormat = "parquet"
 	DataFormatAvro    DataFormat = "avro"
 )
@@ -478,8 +727,42 @@ type BulkLoadOptions struct {
 	SkipErrors     bool          `json:"skip_errors"`
 	ValidateSchema bool          `json:"validate_schema"`
 	Compression    string        `json:"compression,omitempty"`
+	Checks         BatchChecks   `json:"checks,omitempty"`
+	MergeSchema    bool          `json:"merge_schema,omitempty"`
+
+	// ResumeAfter skips the first records of a file, to resume a load that
+	// stopped from the ResumeAfter of its result
+	ResumeAfter int64 `json:"resume_after,omitempty"`
+
+	// CSV describes the shape of CSV sources
+	CSV loader.CSVOptions `json:"csv,omitempty"`
+
+	// ChangedPartialFiles is what directory and pattern loads do with a file
+	// that changed since a load of it stopped partway; by default they fail it
+	ChangedPartialFiles PartialFileAction `json:"changed_partial_files,omitempty"`
+
+	// mergedColumns are the columns the load added by merging the schema
+	mergedColumns map[string]bool
+
+	// ingestedFile is the record of the file of a directory or pattern load
+	// from before the load, which every commit of the load updates
+	ingestedFile *IngestedFile
 }
 
+// PartialFileAction is what a directory or pattern load does with a file that
+// changed since a load of it stopped partway
+type PartialFileAction string
+
+const (
+	// PartialFileFail fails the file, as its committed records may no longer
+	// be the ones it starts with
+	PartialFileFail PartialFileAction = ""
+	// PartialFileResume loads the file after the records committed before
+	PartialFileResume PartialFileAction = "resume"
+	// PartialFileRestart loads the whole file again
+	PartialFileRestart PartialFileAction = "restart"
+)
+
 // BulkLoadResult contains the result of bulk loading
 type BulkLoadResult struct {
 	RecordsLoaded  int64         `json:"records_loaded"`
@@ -488,14 +771,62 @@ type BulkLoadResult struct {
 	Duration       time.Duration `json:"duration"`
 	Version        int64         `json:"version"`
 	Errors         []BulkError   `json:"errors,omitempty"`
+
+	// ResumeAfter is the number of records of the file that were committed
+	// or reported as errored, from the start of the file; a load that stopped
+	// resumes with it as its ResumeAfter option
+	ResumeAfter int64 `json:"resume_after,omitempty"`
+
+	// Files holds the result of each file of a directory or pattern
+	Files []FileLoadResult `json:"files,omitempty"`
+}
+
+// FileLoadResult is the result of loading one file of a bulk load
+type FileLoadResult struct {
+	Path           string         `json:"path"`
+	Status         FileLoadStatus `json:"status"`
+	RecordsLoaded  int64          `json:"records_loaded"`
+	RecordsSkipped int64          `json:"records_skipped"`
+	RecordsErrored int64          `json:"records_errored"`
+	Version        int64          `json:"version,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	ResumeAfter    int64          `json:"resume_after,omitempty"`
 }
 
-// BulkError represents an error in bulk loading
+// FileLoadStatus tells what a bulk load did with a file
+type FileLoadStatus string
+
+const (
+	FileLoadLoaded  FileLoadStatus = "loaded"
+	FileLoadSkipped FileLoadStatus = "skipped"
+	FileLoadFailed  FileLoadStatus = "failed"
+)
+
+// IngestedFile records a file loaded from a directory or pattern, so that
+// later loads of it skip the file while it is unchanged. A file whose load
+// stopped partway has a ResumeAfter, and later loads resume it from there
+// while it is unchanged; see BulkLoadOptions.ChangedPartialFiles otherwise.
+type IngestedFile struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Checksum    string    `json:"checksum"`
+	Records     int64     `json:"records"`
+	Version     int64     `json:"version"`
+	IngestedAt  time.Time `json:"ingested_at"`
+	ResumeAfter int64     `json:"resume_after,omitempty"`
+}
+
+// BulkError represents an error in bulk loading, or a record caught by a
+// cross-record check
 type BulkError struct {
-	Line    int64  `json:"line"`
-	Column  string `json:"column,omitempty"`
-	Error   string `json:"error"`
-	Content string `json:"content,omitempty"`
+	File    string           `json:"file,omitempty"`
+	Line    int64            `json:"line"`
+	Column  string           `json:"column,omitempty"`
+	Error   string           `json:"error"`
+	Content string           `json:"content,omitempty"`
+	Check   BatchCheck       `json:"check,omitempty"`
+	Action  BatchCheckAction `json:"action,omitempty"`
 }
 
 // StreamConfig configures streaming
@@ -2,11 +2,9 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
@@ -16,29 +14,53 @@ import (
 
 // GetByVersion retrieves data as it existed at a specific version
 func (d *DeltaLakeRepository) GetByVersion(ctx context.Context, version int64) ([]loader.Exercise, error) {
+	exec := startQuery(fmt.Sprintf("SELECT * FROM exercises VERSION AS OF %d", version))
+
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
+	exercises, err := d.getByVersionInternal(version)
+	if err != nil {
+		return nil, err
+	}
+
+	exec.recordsScanned = int64(len(exercises))
+	exec.recordsReturned = int64(len(exercises))
+	d.finishQuery(exec)
+
+	return exercises, nil
+}
+
+// getByVersionInternal reads the data of a version. The caller must hold the read lock.
+func (d *DeltaLakeRepository) getByVersionInternal(version int64) ([]loader.Exercise, error) {
 	if _, exists := d.versions[version]; !exists {
 		return nil, fmt.Errorf("version %d does not exist", version)
 	}
 
-	dataPath := filepath.Join(d.basePath, fmt.Sprintf("version_%d.json", version))
-	data, err := os.ReadFile(dataPath)
+	exercises, err := d.readVersionData(version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read version %d data: %w", version, err)
 	}
 
-	var exercises []loader.Exercise
-	if err := json.Unmarshal(data, &exercises); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal version %d data: %w", version, err)
-	}
-
 	return exercises, nil
 }
 
+// schemaOf returns the schema a version was written with. Versions whose
+// schema is unknown are read through the current schema. The caller must
+// hold the read lock.
+func (d *DeltaLakeRepository) schemaOf(version int64) *Schema {
+	if info, ok := d.versions[version]; ok {
+		if schema, ok := d.schemas[info.SchemaID]; ok {
+			return schema
+		}
+	}
+	return d.currentSchema
+}
+
 // GetByTimestamp retrieves data as it existed at a specific timestamp
 func (d *DeltaLakeRepository) GetByTimestamp(ctx context.Context, timestamp time.Time) ([]loader.Exercise, error) {
+	exec := startQuery(fmt.Sprintf("SELECT * FROM exercises TIMESTAMP AS OF '%s'", timestamp.UTC().Format(time.RFC3339)))
+
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
@@ -56,10 +78,20 @@ func (d *DeltaLakeRepository) GetByTimestamp(ctx context.Context, timestamp time
 	}
 
 	if targetVersion == -1 {
+		d.finishQuery(exec)
 		return []loader.Exercise{}, nil // No data existed at that time
 	}
 
-	return d.GetByVersion(ctx, targetVersion)
+	exercises, err := d.getByVersionInternal(targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	exec.recordsScanned = int64(len(exercises))
+	exec.recordsReturned = int64(len(exercises))
+	d.finishQuery(exec)
+
+	return exercises, nil
 }
 
 // GetVersionHistory returns the history of all versions
@@ -140,15 +172,64 @@ func (d *DeltaLakeRepository) GetCurrentSchema(ctx context.Context) (*Schema, er
 	return &schemaCopy, nil
 }
 
-// EvolveSchema evolves the table schema
+// EvolveSchema evolves the table schema. Fields that carry the ID of an
+// existing column keep its data, so giving one a new name renames the column.
 func (d *DeltaLakeRepository) EvolveSchema(ctx context.Context, newSchema *Schema) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
+	return d.evolveSchemaLocked(newSchema, "")
+}
+
+// evolveSchemaLocked commits a new schema as a metadata-only version. An
+// empty description describes the new schema version. The caller must hold
+// the write lock.
+func (d *DeltaLakeRepository) evolveSchemaLocked(newSchema *Schema, description string) error {
+	operation, err := d.installSchemaLocked(newSchema)
+	if err != nil {
+		return err
+	}
+
+	if description == "" {
+		description = fmt.Sprintf("Schema evolved to version %d", newSchema.Version)
+	}
+
+	// Create new version for schema change. Data files are read through the
+	// current schema, so the version keeps the files of its parent: added
+	// columns read as their default and widened columns are converted.
+	parentID := d.currentVersion
+	d.currentVersion++
+	version := &Version{
+		ID:          d.currentVersion,
+		Timestamp:   time.Now(),
+		Description: description,
+		SchemaID:    newSchema.ID,
+		RecordCount: d.metadata.RecordCount,
+		Operations:  []Operation{operation},
+		ParentID:    &parentID,
+
+		DataFile:       d.dataFileOf(parentID),
+		DeletionVector: d.deletionVectorOf(parentID),
+	}
+
+	d.versions[d.currentVersion] = version
+
+	// Update metadata
+	d.metadata.CurrentVersion = d.currentVersion
+	d.metadata.LastModified = time.Now()
+
+	return d.saveMetadata()
+}
+
+// installSchemaLocked validates a new schema and makes it the current one,
+// returning the operation that records the change. The caller must hold the
+// write lock and commit a version with the new schema.
+func (d *DeltaLakeRepository) installSchemaLocked(newSchema *Schema) (Operation, error) {
 	// Validate schema compatibility
 	if err := d.validateSchemaCompatibilityInternal(newSchema); err != nil {
-		return fmt.Errorf("schema is not compatible: %w", err)
+		return Operation{}, fmt.Errorf("schema is not compatible: %w", err)
 	}
+	d.assignColumnMapping(newSchema)
 
 	// Create new schema version
 	newSchema.ID = d.currentSchema.ID + 1
@@ -160,46 +241,37 @@ func (d *DeltaLakeRepository) EvolveSchema(ctx context.Context, newSchema *Schem
 
 	// Update current schema
 	d.currentSchema = newSchema
+	d.schemas[newSchema.ID] = newSchema
+	d.remapOutlierRules(&oldSchema, newSchema)
+	d.validator = d.validator.WithFieldNames(renamedFields(newSchema))
 
 	// Log schema change operation
-	operation := Operation{
+	return Operation{
 		Type:      OperationTypeSchema,
 		Timestamp: time.Now(),
 		Details: map[string]interface{}{
 			"old_schema_id": oldSchema.ID,
 			"new_schema_id": newSchema.ID,
-			"changes":       d.calculateSchemaChanges(&oldSchema, newSchema),
+			"changes":       SchemaChanges(&oldSchema, newSchema),
 		},
-	}
-
-	// Create new version for schema change
-	d.currentVersion++
-	version := &Version{
-		ID:          d.currentVersion,
-		Timestamp:   time.Now(),
-		Description: fmt.Sprintf("Schema evolved to version %d", newSchema.Version),
-		SchemaID:    newSchema.ID,
-		Operations:  []Operation{operation},
-		ParentID:    &d.currentVersion,
-	}
-
-	d.versions[d.currentVersion] = version
-
-	// Update metadata
-	d.metadata.CurrentVersion = d.currentVersion
-	d.metadata.LastModified = time.Now()
-
-	return d.saveMetadata()
+	}, nil
 }
 
-// GetSchemaHistory returns the history of schema changes
+// GetSchemaHistory returns every schema of the table, oldest first
 func (d *DeltaLakeRepository) GetSchemaHistory(ctx context.Context) ([]Schema, error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	// In a full implementation, this would read from schema history files
-	// For now, return current schema
-	return []Schema{*d.currentSchema}, nil
+	history := make([]Schema, 0, len(d.schemas))
+	for _, schema := range d.schemas {
+		schemaCopy := *schema
+		schemaCopy.Fields = make([]Field, len(schema.Fields))
+		copy(schemaCopy.Fields, schema.Fields)
+		history = append(history, schemaCopy)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].ID < history[j].ID })
+
+	return history, nil
 }
 
 // ValidateSchemaCompatibility validates if a new schema is compatible
@@ -210,19 +282,50 @@ func (d *DeltaLakeRepository) ValidateSchemaCompatibility(ctx context.Context, n
 	return d.validateSchemaCompatibilityInternal(newSchema)
 }
 
-// validateSchemaCompatibilityInternal internal schema validation
+// validateSchemaCompatibilityInternal internal schema validation. Fields are
+// matched to current columns by ID, or by name when they carry no ID.
 func (d *DeltaLakeRepository) validateSchemaCompatibilityInternal(newSchema *Schema) error {
-	currentFields := make(map[string]Field)
-	for _, field := range d.currentSchema.Fields {
-		currentFields[field.Name] = field
+	// Field names must be unique
+	seen := make(map[string]bool, len(newSchema.Fields))
+	for _, newField := range newSchema.Fields {
+		if seen[newField.Name] {
+			return fmt.Errorf("field %s is listed more than once", newField.Name)
+		}
+		seen[newField.Name] = true
 	}
 
+	kept := make(map[int64]bool, len(newSchema.Fields))
 	for _, newField := range newSchema.Fields {
-		if currentField, exists := currentFields[newField.Name]; exists {
+		if newField.Name == "" {
+			return fmt.Errorf("field name is required")
+		}
+		// Rows are identified by their id column
+		if newField.Name == "id" && newField.Type != FieldTypeInt {
+			return fmt.Errorf("field id must remain of type %s", FieldTypeInt)
+		}
+		if err := validateFieldType(newField, newField.Name); err != nil {
+			return err
+		}
+
+		currentField, exists := d.matchColumn(newField)
+		if newField.ID != 0 && !exists {
+			return fmt.Errorf("field %s has unknown column id %d", newField.Name, newField.ID)
+		}
+		if exists {
+			if kept[currentField.ID] {
+				return fmt.Errorf("column id %d is listed more than once", currentField.ID)
+			}
+			kept[currentField.ID] = true
+
+			if currentField.Name != newField.Name {
+				if err := d.checkColumnUnused(currentField.Name, "renamed"); err != nil {
+					return err
+				}
+			}
+
 			// Check if type change is compatible
-			if !d.isTypeCompatible(currentField.Type, newField.Type) {
-				return fmt.Errorf("field %s type change from %s to %s is not compatible",
-					newField.Name, currentField.Type, newField.Type)
+			if err := d.checkNestedCompatibility(currentField, newField, newField.Name); err != nil {
+				return err
 			}
 
 			// Check if nullable change is compatible
@@ -237,6 +340,21 @@ func (d *DeltaLakeRepository) validateSchemaCompatibilityInternal(newSchema *Sch
 		}
 	}
 
+	for _, currentField := range d.currentSchema.Fields {
+		if kept[currentField.ID] {
+			continue
+		}
+		if currentField.Name == "id" {
+			return fmt.Errorf("field id cannot be removed")
+		}
+		if err := d.checkColumnUnused(currentField.Name, "removed"); err != nil {
+			return err
+		}
+	}
+	if !seen["id"] {
+		return fmt.Errorf("field id cannot be removed")
+	}
+
 	return nil
 }
 
@@ -268,50 +386,62 @@ func (d *DeltaLakeRepository) isTypeCompatible(oldType, newType FieldType) bool
 	return false
 }
 
-// calculateSchemaChanges calculates the differences between schemas
-func (d *DeltaLakeRepository) calculateSchemaChanges(oldSchema, newSchema *Schema) map[string]interface{} {
-	changes := map[string]interface{}{
-		"added_fields":    []string{},
-		"removed_fields":  []string{},
-		"modified_fields": []string{},
+// SchemaChanges lists the fields added, removed, modified and renamed between
+// two schemas, each in name order. Fields are matched by column ID, or by
+// name when they have none.
+func SchemaChanges(oldSchema, newSchema *Schema) map[string]interface{} {
+	columnKey := func(field Field) string {
+		if field.ID != 0 {
+			return fmt.Sprintf("#%d", field.ID)
+		}
+		return field.Name
 	}
 
 	oldFields := make(map[string]Field)
 	for _, field := range oldSchema.Fields {
-		oldFields[field.Name] = field
+		oldFields[columnKey(field)] = field
 	}
 
 	newFields := make(map[string]Field)
 	for _, field := range newSchema.Fields {
-		newFields[field.Name] = field
+		newFields[columnKey(field)] = field
 	}
 
-	// Find added and modified fields
+	// Find added, modified and renamed fields
 	addedFields := []string{}
 	modifiedFields := []string{}
-	for name, newField := range newFields {
-		if oldField, exists := oldFields[name]; exists {
+	renamedFields := map[string]string{}
+	for key, newField := range newFields {
+		if oldField, exists := oldFields[key]; exists {
 			if oldField.Type != newField.Type || oldField.Nullable != newField.Nullable {
-				modifiedFields = append(modifiedFields, name)
+				modifiedFields = append(modifiedFields, newField.Name)
+			}
+			if oldField.Name != newField.Name {
+				renamedFields[oldField.Name] = newField.Name
 			}
 		} else {
-			addedFields = append(addedFields, name)
+			addedFields = append(addedFields, newField.Name)
 		}
 	}
 
 	// Find removed fields
 	removedFields := []string{}
-	for name := range oldFields {
-		if _, exists := newFields[name]; !exists {
-			removedFields = append(removedFields, name)
+	for key, oldField := range oldFields {
+		if _, exists := newFields[key]; !exists {
+			removedFields = append(removedFields, oldField.Name)
 		}
 	}
 
-	changes["added_fields"] = addedFields
-	changes["removed_fields"] = removedFields
-	changes["modified_fields"] = modifiedFields
+	sort.Strings(addedFields)
+	sort.Strings(removedFields)
+	sort.Strings(modifiedFields)
 
-	return changes
+	return map[string]interface{}{
+		"added_fields":    addedFields,
+		"removed_fields":  removedFields,
+		"modified_fields": modifiedFields,
+		"renamed_fields":  renamedFields,
+	}
 }
 
 // GetTableMetadata returns comprehensive table metadata
@@ -329,21 +459,13 @@ func (d *DeltaLakeRepository) GetTableMetadata(ctx context.Context) (*TableMetad
 	return &metadata, nil
 }
 
-// UpdateTableProperties updates table properties
+// UpdateTableProperties updates table properties. Setting the validation
+// rules property to an empty value restores the default rules.
 func (d *DeltaLakeRepository) UpdateTableProperties(ctx context.Context, properties map[string]string) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	if d.metadata.Properties == nil {
-		d.metadata.Properties = make(map[string]string)
-	}
-
-	for k, v := range properties {
-		d.metadata.Properties[k] = v
-	}
-
-	d.metadata.LastModified = time.Now()
-	return d.saveMetadata()
+	return d.applyTableProperties(properties)
 }
 
 // GetPartitions returns partition information (simplified implementation)
@@ -423,7 +545,19 @@ func (d *DeltaLakeRepository) OptimizeTable(ctx context.Context, options Optimiz
 
 // Data Quality and Constraints Implementation
 
-// AddConstraint adds a data quality constraint
+// GetConstraints returns the table constraints in the order they were added
+func (d *DeltaLakeRepository) GetConstraints(ctx context.Context) ([]Constraint, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	constraints := make([]Constraint, len(d.constraints))
+	copy(constraints, d.constraints)
+	return constraints, nil
+}
+
+// AddConstraint adds a data quality constraint. Existing rows must satisfy it
+// unless the constraint is added as NotValid, in which case only rows written
+// afterwards are checked.
 func (d *DeltaLakeRepository) AddConstraint(ctx context.Context, constraint Constraint) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
@@ -435,188 +569,115 @@ func (d *DeltaLakeRepository) AddConstraint(ctx context.Context, constraint Cons
 		}
 	}
 
+	compiled, err := compileConstraint(constraint)
+	if err == nil {
+		err = d.checkConstraintColumns(compiled)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid constraint %s: %w", constraint.Name, err)
+	}
+
+	constraint.Columns = compiled.Columns
 	constraint.CreatedAt = time.Now()
 	constraint.Enabled = true
-	d.constraints = append(d.constraints, constraint)
 
-	return d.saveMetadata()
-}
-
-// RemoveConstraint removes a data quality constraint
-func (d *DeltaLakeRepository) RemoveConstraint(ctx context.Context, constraintName string) error {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
+	if !constraint.NotValid {
+		exercises, err := d.getAllFromFiles()
+		if err != nil {
+			return fmt.Errorf("failed to read current data: %w", err)
+		}
 
-	for i, constraint := range d.constraints {
-		if constraint.Name == constraintName {
-			// Remove constraint by replacing with last element and truncating
-			d.constraints[i] = d.constraints[len(d.constraints)-1]
-			d.constraints = d.constraints[:len(d.constraints)-1]
-			return d.saveMetadata()
+		violations, err := checkConstraints([]Constraint{constraint}, d.columnViews(exercises), nil)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return fmt.Errorf("existing data violates constraint %s: %w", constraint.Name, &ConstraintError{Violations: violations})
 		}
 	}
 
-	return fmt.Errorf("constraint %s not found", constraintName)
+	d.constraints = append(d.constraints, constraint)
+
+	return d.saveMetadata()
 }
 
-// ValidateConstraints validates data against defined constraints
-func (d *DeltaLakeRepository) ValidateConstraints(ctx context.Context, exercises []loader.Exercise) error {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+// SetConstraintEnabled enables or disables a constraint. Rows written while a
+// constraint was disabled are validated when it is enabled again, unless the
+// constraint was added as NotValid.
+func (d *DeltaLakeRepository) SetConstraintEnabled(ctx context.Context, constraintName string, enabled bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	for _, constraint := range d.constraints {
-		if !constraint.Enabled {
+	for i := range d.constraints {
+		constraint := &d.constraints[i]
+		if constraint.Name != constraintName {
 			continue
 		}
-
-		for _, exercise := range exercises {
-			if err := d.validateConstraint(constraint, exercise); err != nil {
-				return fmt.Errorf("constraint %s violated: %w", constraint.Name, err)
-			}
+		if constraint.Enabled == enabled {
+			return nil
 		}
-	}
-
-	return nil
-}
 
-// validateConstraint validates a single exercise against a constraint
-func (d *DeltaLakeRepository) validateConstraint(constraint Constraint, exercise loader.Exercise) error {
-	switch constraint.Type {
-	case ConstraintTypeNotNull:
-		return d.validateNotNull(constraint, exercise)
-	case ConstraintTypeRange:
-		return d.validateRange(constraint, exercise)
-	case ConstraintTypeCheck:
-		return d.validateCheck(constraint, exercise)
-	default:
-		return fmt.Errorf("unsupported constraint type: %s", constraint.Type)
-	}
-}
-
-// validateNotNull validates not null constraints
-func (d *DeltaLakeRepository) validateNotNull(constraint Constraint, exercise loader.Exercise) error {
-	for _, column := range constraint.Columns {
-		switch column {
-		case "name":
-			if exercise.Name == "" {
-				return fmt.Errorf("name cannot be null")
-			}
-		case "type":
-			if exercise.Type == "" {
-				return fmt.Errorf("type cannot be null")
+		if enabled && !constraint.NotValid {
+			exercises, err := d.getAllFromFiles()
+			if err != nil {
+				return fmt.Errorf("failed to read current data: %w", err)
 			}
-		case "description":
-			if exercise.Description == "" && len(constraint.Columns) == 1 {
-				return fmt.Errorf("description cannot be null")
-			}
-		}
-	}
-	return nil
-}
 
-// validateRange validates range constraints
-func (d *DeltaLakeRepository) validateRange(constraint Constraint, exercise loader.Exercise) error {
-	// Simplified range validation - in production, this would parse the expression
-	for _, column := range constraint.Columns {
-		switch column {
-		case "duration":
-			if exercise.Duration < 0 || exercise.Duration > 1440 { // 24 hours max
-				return fmt.Errorf("duration must be between 0 and 1440 minutes")
+			candidate := *constraint
+			candidate.Enabled = true
+			violations, err := checkConstraints([]Constraint{candidate}, d.columnViews(exercises), nil)
+			if err != nil {
+				return err
 			}
-		case "calories":
-			if exercise.Calories < 0 || exercise.Calories > 10000 {
-				return fmt.Errorf("calories must be between 0 and 10000")
+			if len(violations) > 0 {
+				return fmt.Errorf("existing data violates constraint %s: %w", constraintName, &ConstraintError{Violations: violations})
 			}
 		}
+
+		constraint.Enabled = enabled
+		return d.saveMetadata()
 	}
-	return nil
+
+	return fmt.Errorf("constraint %s not found", constraintName)
 }
 
-// validateCheck validates check constraints
-func (d *DeltaLakeRepository) validateCheck(constraint Constraint, exercise loader.Exercise) error {
-	// Simplified check validation - in production, this would evaluate the expression
-	if constraint.Expression == "type IN ('cardio', 'strength', 'flexibility')" {
-		validTypes := map[string]bool{"cardio": true, "strength": true, "flexibility": true}
-		if !validTypes[exercise.Type] {
-			return fmt.Errorf("invalid exercise type: %s", exercise.Type)
+// RemoveConstraint removes a data quality constraint
+func (d *DeltaLakeRepository) RemoveConstraint(ctx context.Context, constraintName string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for i, constraint := range d.constraints {
+		if constraint.Name == constraintName {
+			d.constraints = append(d.constraints[:i], d.constraints[i+1:]...)
+			return d.saveMetadata()
 		}
 	}
-	return nil
+
+	return fmt.Errorf("constraint %s not found", constraintName)
 }
 
-// GetDataQualityMetrics returns data quality metrics
-func (d *DeltaLakeRepository) GetDataQualityMetrics(ctx context.Context) (*DataQualityMetrics, error) {
+// ValidateConstraints checks a candidate batch against the enabled constraints
+// as if it were written to the current version, without writing it. Violations
+// are returned as a *ConstraintError whose row indexes refer to the batch.
+func (d *DeltaLakeRepository) ValidateConstraints(ctx context.Context, exercises []loader.Exercise) error {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	exercises, err := d.getAllFromFiles()
+	current, err := d.getAllFromFiles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get data for quality analysis: %w", err)
+		return fmt.Errorf("failed to read current data: %w", err)
 	}
 
-	metrics := &DataQualityMetrics{
-		TotalRecords:         int64(len(exercises)),
-		NullValues:           make(map[string]int64),
-		UniqueValues:         make(map[string]int64),
-		DuplicateRecords:     0,
-		ConstraintViolations: make(map[string]int64),
-		DataTypeMismatches:   make(map[string]int64),
-		OutlierCounts:        make(map[string]int64),
-		LastUpdated:          time.Now(),
+	rows, positions := d.mergeChanges(current, exercises, nil)
+	violations, err := checkConstraints(d.constraints, d.columnViews(rows), positions)
+	if err != nil {
+		return err
 	}
-
-	// Calculate metrics
-	uniqueNames := make(map[string]bool)
-	uniqueTypes := make(map[string]bool)
-	seenExercises := make(map[string]bool)
-
-	for _, exercise := range exercises {
-		// Check for nulls
-		if exercise.Name == "" {
-			metrics.NullValues["name"]++
-		} else {
-			uniqueNames[exercise.Name] = true
-		}
-
-		if exercise.Type == "" {
-			metrics.NullValues["type"]++
-		} else {
-			uniqueTypes[exercise.Type] = true
-		}
-
-		if exercise.Description == "" {
-			metrics.NullValues["description"]++
-		}
-
-		// Check for duplicates (simplified - by name and date)
-		key := fmt.Sprintf("%s-%s", exercise.Name, exercise.Date.Format("2006-01-02"))
-		if seenExercises[key] {
-			metrics.DuplicateRecords++
-		} else {
-			seenExercises[key] = true
-		}
-
-		// Check for outliers
-		if exercise.Duration > 240 { // More than 4 hours
-			metrics.OutlierCounts["duration"]++
-		}
-		if exercise.Calories > 2000 {
-			metrics.OutlierCounts["calories"]++
-		}
+	if len(violations) > 0 {
+		return &ConstraintError{Violations: violations}
 	}
 
-	metrics.UniqueValues["name"] = int64(len(uniqueNames))
-	metrics.UniqueValues["type"] = int64(len(uniqueTypes))
-
-	// Calculate quality scores
-	totalFields := int64(len(exercises) * 7) // 7 fields per exercise
-	nullCount := metrics.NullValues["name"] + metrics.NullValues["type"] + metrics.NullValues["description"]
-
-	metrics.CompletenessScore = float64(totalFields-nullCount) / float64(totalFields) * 100
-	metrics.ValidityScore = 100.0 // Would calculate based on constraint violations
-	metrics.ConsistencyScore = float64(int64(len(exercises))-metrics.DuplicateRecords) / float64(len(exercises)) * 100
-
-	return metrics, nil
+	return nil
 }
 
 // Streaming and Change Data Capture Implementation
@@ -625,13 +686,17 @@ func (d *DeltaLakeRepository) GetDataQualityMetrics(ctx context.Context) (*DataQ
 func (d *DeltaLakeRepository) WatchChanges(ctx context.Context, from time.Time) (<-chan ChangeEvent, error) {
 	changeChan := make(chan ChangeEvent, 100)
 
+	d.mutex.RLock()
+	changeLog := append([]ChangeEvent(nil), d.changeLog...)
+	d.mutex.RUnlock()
+
 	// This is a simplified implementation
 	// In production, this would use file system watchers or database triggers
 	go func() {
 		defer close(changeChan)
 
 		// Send existing changes since 'from' time
-		for _, change := range d.changeLog {
+		for _, change := range changeLog {
 			if change.Timestamp.After(from) {
 				select {
 				case changeChan <- change:
@@ -698,19 +763,21 @@ func (d *DeltaLakeRepository) DropIndex(ctx context.Context, indexName string) e
 	}
 
 	delete(d.indexes, indexName)
+
+	d.indexMutex.Lock()
+	delete(d.indexLookups, indexName)
+	d.indexMutex.Unlock()
+
 	return d.saveMetadata()
 }
 
 // GetQueryStats returns query performance statistics
 func (d *DeltaLakeRepository) GetQueryStats(ctx context.Context) (*QueryStats, error) {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-
-	// Return current stats (would be populated by actual queries)
-	return d.queryStats, nil
+	return d.queryStats.snapshot(), nil
 }
 
-// Compact compacts table files
+// Compact compacts table files, folding deletion vectors back into a new data
+// file without the deleted rows
 func (d *DeltaLakeRepository) Compact(ctx context.Context) (*CompactionResult, error) {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
@@ -723,18 +790,42 @@ func (d *DeltaLakeRepository) Compact(ctx context.Context) (*CompactionResult, e
 		return nil, fmt.Errorf("failed to read data for compaction: %w", err)
 	}
 
+	var purged int64
+	if vector := d.deletionVectorOf(d.currentVersion); vector != nil {
+		purged = vector.Cardinality
+	}
+
 	// Create new compacted version
+	parentID := d.currentVersion
 	d.currentVersion++
 	if err := d.saveVersionData(d.currentVersion, exercises); err != nil {
 		return nil, fmt.Errorf("failed to save compacted data: %w", err)
 	}
 
+	d.versions[d.currentVersion] = &Version{
+		ID:          d.currentVersion,
+		Timestamp:   time.Now(),
+		Description: "Table compacted",
+		SchemaID:    d.currentSchema.ID,
+		RecordCount: int64(len(exercises)),
+		FileCount:   1,
+		Operations: []Operation{{
+			Type:           OperationTypeOptimize,
+			Timestamp:      time.Now(),
+			Details:        map[string]interface{}{"operation": "compact", "deleted_rows_purged": purged},
+			RecordsRead:    int64(len(exercises)) + purged,
+			RecordsWritten: int64(len(exercises)),
+		}},
+		ParentID: &parentID,
+	}
+
 	result := &CompactionResult{
-		FilesCompacted:   1,
-		FilesCreated:     1,
-		RecordsProcessed: int64(len(exercises)),
-		SpaceReclaimed:   0, // Would calculate actual space savings
-		Duration:         time.Since(startTime),
+		FilesCompacted:    1,
+		FilesCreated:      1,
+		RecordsProcessed:  int64(len(exercises)),
+		SpaceReclaimed:    0, // Would calculate actual space savings
+		DeletedRowsPurged: purged,
+		Duration:          time.Since(startTime),
 	}
 
 	// Update metadata
@@ -750,31 +841,34 @@ func (d *DeltaLakeRepository) Compact(ctx context.Context) (*CompactionResult, e
 
 // Advanced Querying Implementation (simplified stubs)
 
-// QueryWithSQL executes SQL queries (not implemented in this demo)
+// QueryWithSQL executes a SELECT statement by translating it into a Filter
 func (d *DeltaLakeRepository) QueryWithSQL(ctx context.Context, sql string, params ...interface{}) ([]loader.Exercise, error) {
-	return nil, fmt.Errorf("SQL querying not implemented in this demo")
+	filter, err := ParseSQL(sql, params...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SQL query: %w", err)
+	}
+
+	return d.executeQuery(filter)
 }
 
 // QueryWithFilter executes queries with advanced filtering
 func (d *DeltaLakeRepository) QueryWithFilter(ctx context.Context, filter Filter) ([]loader.Exercise, error) {
-	exercises, err := d.getAllFromFiles()
+	return d.executeQuery(filter)
+}
+
+// ExplainQuery plans and executes a filter without using the query cache and
+// reports the plan together with the rows and time of every stage
+func (d *DeltaLakeRepository) ExplainQuery(ctx context.Context, filter Filter) (*QueryExplanation, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	_, explanation, err := d.runQuery(filter)
 	if err != nil {
 		return nil, err
 	}
+	_, explanation.Cached = d.queryCache.get(d.currentVersion, explanation.Query)
 
-	// Apply basic filtering (simplified implementation)
-	var result []loader.Exercise
-	for _, exercise := range exercises {
-		if d.matchesFilter(exercise, filter) {
-			result = append(result, exercise)
-		}
-	}
-
-	// Apply sorting, limit, offset
-	result = d.applySorting(result, filter.SortBy)
-	result = d.applyPagination(result, filter.Limit, filter.Offset)
-
-	return result, nil
+	return explanation, nil
 }
 
 // matchesFilter checks if an exercise matches filter conditions
@@ -789,100 +883,175 @@ func (d *DeltaLakeRepository) matchesFilter(exercise loader.Exercise, filter Fil
 
 // matchesCondition checks if an exercise matches a single condition
 func (d *DeltaLakeRepository) matchesCondition(exercise loader.Exercise, condition Condition) bool {
-	var fieldValue interface{}
+	fieldValue, ok := exerciseFieldValue(exercise, condition.Field)
+	if ok {
+		return matchesValue(fieldValue, condition)
+	}
 
-	switch condition.Field {
-	case "id":
-		fieldValue = exercise.ID
-	case "name":
-		fieldValue = exercise.Name
-	case "type":
-		fieldValue = exercise.Type
-	case "duration":
-		fieldValue = exercise.Duration
-	case "calories":
-		fieldValue = exercise.Calories
-	case "date":
-		fieldValue = exercise.Date
-	case "description":
-		fieldValue = exercise.Description
-	default:
+	// A path into a nested column matches when any value it leads to does;
+	// negated operators match when none of them matches
+	column, segments, err := parseColumnPath(condition.Field)
+	if err != nil || len(segments) == 0 {
 		return false
 	}
+	columnValue, ok := exerciseFieldValue(exercise, column)
+	if !ok {
+		return false
+	}
+	values, spread := resolvePath(columnValue, segments)
+	if !spread {
+		return matchesValue(values[0], condition)
+	}
+
+	positive := condition
+	negated := true
+	switch condition.Operator {
+	case OperatorNotEqual:
+		positive.Operator = OperatorEqual
+	case OperatorNotIn:
+		positive.Operator = OperatorIn
+	case OperatorNotLike:
+		positive.Operator = OperatorLike
+	case OperatorIsNotNull:
+		positive.Operator = OperatorIsNull
+	default:
+		negated = false
+	}
+	for _, value := range values {
+		if matchesValue(value, positive) {
+			return !negated
+		}
+	}
+	return negated
+}
 
-	// Simplified condition matching
+// matchesValue checks if a column value matches a single condition
+func matchesValue(fieldValue interface{}, condition Condition) bool {
 	switch condition.Operator {
 	case OperatorEqual:
-		return fieldValue == condition.Value
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return ok && cmp == 0
 	case OperatorNotEqual:
-		return fieldValue != condition.Value
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return !ok || cmp != 0
 	case OperatorGreaterThan:
-		if intVal, ok := fieldValue.(int); ok {
-			if targetVal, ok := condition.Value.(int); ok {
-				return intVal > targetVal
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return ok && cmp > 0
+	case OperatorGreaterThanOrEqual:
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return ok && cmp >= 0
+	case OperatorLessThan:
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return ok && cmp < 0
+	case OperatorLessThanOrEqual:
+		cmp, ok := compareValues(fieldValue, condition.Value)
+		return ok && cmp <= 0
+	case OperatorIn:
+		return containsValue(toValueSlice(condition.Value), fieldValue)
+	case OperatorNotIn:
+		return !containsValue(toValueSlice(condition.Value), fieldValue)
+	case OperatorLike:
+		if strVal, ok := fieldValue.(string); ok {
+			if pattern, ok := condition.Value.(string); ok {
+				return matchLike(strVal, pattern)
 			}
 		}
-	case OperatorLike:
+	case OperatorNotLike:
 		if strVal, ok := fieldValue.(string); ok {
 			if pattern, ok := condition.Value.(string); ok {
-				return contains(strVal, pattern)
+				return !matchLike(strVal, pattern)
 			}
 		}
+	case OperatorIsNull:
+		return isNullValue(fieldValue)
+	case OperatorIsNotNull:
+		return !isNullValue(fieldValue)
+	case OperatorBetween:
+		bounds := toValueSlice(condition.Value)
+		if len(bounds) != 2 {
+			return false
+		}
+		lower, okLower := compareValues(fieldValue, bounds[0])
+		upper, okUpper := compareValues(fieldValue, bounds[1])
+		return okLower && okUpper && lower >= 0 && upper <= 0
 	}
 
 	return false
 }
 
-// contains checks if a string contains a pattern (simplified)
-func contains(str, pattern string) bool {
-	return len(str) >= len(pattern) && str[:len(pattern)] == pattern
+// exerciseFieldValue returns the value of a named column of an exercise
+func exerciseFieldValue(exercise loader.Exercise, field string) (interface{}, bool) {
+	if value, ok := exercise.Extra[field]; ok {
+		return value, true
+	}
+	return exerciseStructValue(exercise, field)
+}
+
+// exerciseStructValue returns the value of a typed Exercise field
+func exerciseStructValue(exercise loader.Exercise, field string) (interface{}, bool) {
+	switch field {
+	case "id":
+		return exercise.ID, true
+	case "name":
+		return exercise.Name, true
+	case "type":
+		return exercise.Type, true
+	case "duration":
+		return exercise.Duration, true
+	case "calories":
+		return exercise.Calories, true
+	case "date":
+		return exercise.Date, true
+	case "description":
+		return exercise.Description, true
+	default:
+		return nil, false
+	}
 }
 
 // applySorting applies sorting to results
 func (d *DeltaLakeRepository) applySorting(exercises []loader.Exercise, sortFields []SortField) []loader.Exercise {
-	// Simplified sorting implementation
 	if len(sortFields) == 0 {
 		return exercises
 	}
 
-	// For demo purposes, just sort by first field
-	if len(sortFields) > 0 {
-		sortField := sortFields[0]
-		sort.Slice(exercises, func(i, j int) bool {
-			var left, right interface{}
-
-			switch sortField.Field {
-			case "id":
-				left, right = exercises[i].ID, exercises[j].ID
-			case "name":
-				left, right = exercises[i].Name, exercises[j].Name
-			case "type":
-				left, right = exercises[i].Type, exercises[j].Type
-			case "duration":
-				left, right = exercises[i].Duration, exercises[j].Duration
-			case "calories":
-				left, right = exercises[i].Calories, exercises[j].Calories
-			case "date":
-				left, right = exercises[i].Date, exercises[j].Date
-			default:
-				return false
+	views := d.columnViews(exercises)
+	order := make([]int, len(exercises))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		for _, sortField := range sortFields {
+			left, okLeft := exerciseFieldValue(views[order[i]], sortField.Field)
+			right, okRight := exerciseFieldValue(views[order[j]], sortField.Field)
+			if !okLeft || !okRight {
+				continue
+			}
+
+			cmp, ok := compareValues(left, right)
+			if !ok || cmp == 0 {
+				continue
 			}
 
-			// Basic comparison logic
 			if sortField.Order == SortOrderDesc {
-				return fmt.Sprintf("%v", left) > fmt.Sprintf("%v", right)
+				return cmp > 0
 			}
-			return fmt.Sprintf("%v", left) < fmt.Sprintf("%v", right)
-		})
-	}
+			return cmp < 0
+		}
+		return false
+	})
 
-	return exercises
+	sorted := make([]loader.Exercise, len(order))
+	for i, position := range order {
+		sorted[i] = exercises[position]
+	}
+	return sorted
 }
 
 // applyPagination applies limit and offset to results
 func (d *DeltaLakeRepository) applyPagination(exercises []loader.Exercise, limit, offset *int) []loader.Exercise {
 	start := 0
-	if offset != nil {
+	if offset != nil && *offset > 0 {
 		start = *offset
 	}
 
@@ -891,7 +1060,7 @@ func (d *DeltaLakeRepository) applyPagination(exercises []loader.Exercise, limit
 	}
 
 	end := len(exercises)
-	if limit != nil {
+	if limit != nil && *limit >= 0 {
 		end = start + *limit
 		if end > len(exercises) {
 			end = len(exercises)
@@ -901,7 +1070,236 @@ func (d *DeltaLakeRepository) applyPagination(exercises []loader.Exercise, limit
 	return exercises[start:end]
 }
 
-// AggregateByTimeWindow performs time-based aggregations
+// AggregateByTimeWindow performs time-based aggregations over the date column.
+// Windows start at window.Start (or the Unix epoch when unset) and advance by
+// window.Slide, which defaults to the window size for tumbling windows.
 func (d *DeltaLakeRepository) AggregateByTimeWindow(ctx context.Context, window TimeWindow, aggregations []Aggregation) ([]AggregationResult, error) {
-	return nil, fmt.Errorf("time window aggregation not implemented in this demo")
+	if window.Size <= 0 {
+		return nil, fmt.Errorf("window size must be positive")
+	}
+	if window.Slide < 0 {
+		return nil, fmt.Errorf("window slide cannot be negative")
+	}
+	if len(aggregations) == 0 {
+		return nil, fmt.Errorf("at least one aggregation is required")
+	}
+	for _, aggregation := range aggregations {
+		switch aggregation.Function {
+		case AggregationCount, AggregationSum, AggregationAvg, AggregationMin, AggregationMax:
+		default:
+			return nil, fmt.Errorf("unsupported aggregation function: %s", aggregation.Function)
+		}
+	}
+
+	exec := startQuery(describeAggregation(window, aggregations))
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if cached, ok := d.queryCache.get(d.currentVersion, exec.query); ok {
+		results := copyAggregationResults(cached.([]AggregationResult))
+		exec.recordsReturned = int64(len(results))
+		exec.cacheHit = true
+		d.finishQuery(exec)
+		return results, nil
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := aggregateExercises(d.columnViews(exercises), window, aggregations)
+	if err != nil {
+		return nil, err
+	}
+	d.queryCache.put(d.currentVersion, exec.query, copyAggregationResults(results))
+
+	exec.recordsScanned = int64(len(exercises))
+	exec.recordsReturned = int64(len(results))
+	d.finishQuery(exec)
+
+	return results, nil
+}
+
+// aggregationAccumulator collects the running state of one aggregation in one window
+type aggregationAccumulator struct {
+	count   int64
+	sum     float64
+	numeric int64
+	min     interface{}
+	max     interface{}
+}
+
+// aggregateExercises groups exercises into time windows and evaluates the aggregations
+func aggregateExercises(exercises []loader.Exercise, window TimeWindow, aggregations []Aggregation) ([]AggregationResult, error) {
+	origin := window.Start
+	if origin.IsZero() {
+		origin = time.Unix(0, 0).UTC()
+	}
+	step := window.Slide
+	if step == 0 {
+		step = window.Size
+	}
+
+	buckets := make(map[int64][]aggregationAccumulator)
+	for _, exercise := range exercises {
+		date := exercise.Date
+		if !window.Start.IsZero() && date.Before(window.Start) {
+			continue
+		}
+		if !window.End.IsZero() && !date.Before(window.End) {
+			continue
+		}
+
+		// Walk back from the last window starting at or before the record
+		offset := date.Sub(origin)
+		last := int64(offset / step)
+		if offset < 0 && offset%step != 0 {
+			last--
+		}
+
+		for k := last; ; k-- {
+			start := origin.Add(time.Duration(k) * step)
+			if !start.Add(window.Size).After(date) {
+				break
+			}
+			if !window.Start.IsZero() && start.Before(window.Start) {
+				break
+			}
+
+			key := start.UnixNano()
+			accumulators, exists := buckets[key]
+			if !exists {
+				accumulators = make([]aggregationAccumulator, len(aggregations))
+				buckets[key] = accumulators
+			}
+
+			for i, aggregation := range aggregations {
+				if err := accumulators[i].add(exercise, aggregation); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	keys := make([]int64, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	results := make([]AggregationResult, 0, len(keys))
+	for _, key := range keys {
+		values := make(map[string]interface{}, len(aggregations))
+		for i, aggregation := range aggregations {
+			values[aggregationName(aggregation)] = buckets[key][i].result(aggregation.Function)
+		}
+		results = append(results, AggregationResult{
+			Window: time.Unix(0, key).UTC(),
+			Values: values,
+		})
+	}
+
+	return results, nil
+}
+
+// add folds one exercise into the accumulator
+func (a *aggregationAccumulator) add(exercise loader.Exercise, aggregation Aggregation) error {
+	if aggregation.Function == AggregationCount && (aggregation.Field == "" || aggregation.Field == "*") {
+		a.count++
+		return nil
+	}
+
+	value, ok := exerciseFieldValue(exercise, aggregation.Field)
+	if !ok {
+		return fmt.Errorf("unknown aggregation field: %s", aggregation.Field)
+	}
+	if isNullValue(value) {
+		return nil
+	}
+	a.count++
+
+	switch aggregation.Function {
+	case AggregationSum, AggregationAvg:
+		number, ok := numericValue(value)
+		if !ok {
+			return fmt.Errorf("cannot %s non-numeric field %s", aggregation.Function, aggregation.Field)
+		}
+		a.sum += number
+		a.numeric++
+	case AggregationMin:
+		if cmp, ok := compareValues(value, a.min); a.min == nil || (ok && cmp < 0) {
+			a.min = value
+		}
+	case AggregationMax:
+		if cmp, ok := compareValues(value, a.max); a.max == nil || (ok && cmp > 0) {
+			a.max = value
+		}
+	}
+
+	return nil
+}
+
+// result returns the final value of the accumulator
+func (a *aggregationAccumulator) result(function AggregationFunction) interface{} {
+	switch function {
+	case AggregationCount:
+		return a.count
+	case AggregationSum:
+		return a.sum
+	case AggregationAvg:
+		if a.numeric == 0 {
+			return nil
+		}
+		return a.sum / float64(a.numeric)
+	case AggregationMin:
+		return a.min
+	case AggregationMax:
+		return a.max
+	default:
+		return nil
+	}
+}
+
+// aggregationName returns the result key of an aggregation
+func aggregationName(aggregation Aggregation) string {
+	if aggregation.Alias != "" {
+		return aggregation.Alias
+	}
+	if aggregation.Field == "" || aggregation.Field == "*" {
+		return string(aggregation.Function)
+	}
+	return fmt.Sprintf("%s_%s", aggregation.Function, aggregation.Field)
+}
+
+// describeAggregation renders a time window aggregation as a normalized SQL statement
+func describeAggregation(window TimeWindow, aggregations []Aggregation) string {
+	selects := make([]string, len(aggregations))
+	for i, aggregation := range aggregations {
+		field := aggregation.Field
+		if field == "" {
+			field = "*"
+		}
+		selects[i] = fmt.Sprintf("%s(%s) AS %s", strings.ToUpper(string(aggregation.Function)), field, aggregationName(aggregation))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM exercises", strings.Join(selects, ", "))
+
+	var bounds []string
+	if !window.Start.IsZero() {
+		bounds = append(bounds, fmt.Sprintf("date >= %s", formatLiteral(window.Start)))
+	}
+	if !window.End.IsZero() {
+		bounds = append(bounds, fmt.Sprintf("date < %s", formatLiteral(window.End)))
+	}
+	if len(bounds) > 0 {
+		query += " WHERE " + strings.Join(bounds, " AND ")
+	}
+
+	slide := window.Slide
+	if slide == 0 {
+		slide = window.Size
+	}
+	return query + fmt.Sprintf(" GROUP BY WINDOW(date, '%s', '%s')", window.Size, slide)
 }
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Merge upserts source rows into the table in a single commit. Rows are
+// matched on the key columns in on: each matched table row is updated from,
+// deleted for or left alone by its source row according to whenMatched, and
+// unmatched source rows are inserted or ignored according to whenNotMatched.
+// Rows with a null key never match. Updates that change nothing are counted as
+// unchanged, so merging the same source twice does not create a new version.
+func (d *DeltaLakeRepository) Merge(ctx context.Context, source []loader.Exercise, on []string, whenMatched, whenNotMatched MergeAction) (*MergeResult, error) {
+	startTime := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.validateMerge(on, whenMatched, whenNotMatched); err != nil {
+		return nil, err
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current data: %w", err)
+	}
+
+	renamed := renamedFields(d.currentSchema)
+	targets := make(map[string][]int)
+	usedIDs := make(map[int]bool, len(exercises))
+	for i, exercise := range exercises {
+		usedIDs[exercise.ID] = true
+		if key, ok := columnsKey(columnView(exercise, renamed), on); ok {
+			targets[key] = append(targets[key], i)
+		}
+	}
+
+	result := &MergeResult{}
+	var writes []loader.Exercise
+	var deletes []int
+	sourceRows := make(map[string]int, len(source))
+
+	for i, row := range source {
+		key, ok := columnsKey(columnView(row, renamed), on)
+		if ok {
+			if first, exists := sourceRows[key]; exists {
+				return nil, fmt.Errorf("source rows %d and %d have the same merge key", first, i)
+			}
+			sourceRows[key] = i
+		}
+
+		matches := targets[key]
+		if !ok || len(matches) == 0 {
+			if whenNotMatched == MergeActionInsert {
+				// Keep the source ID unless it belongs to another row
+				if usedIDs[row.ID] {
+					row.ID = 0
+				}
+				if row.ID != 0 {
+					usedIDs[row.ID] = true
+				}
+				writes = append(writes, row)
+				result.Inserted++
+			}
+			continue
+		}
+
+		for _, index := range matches {
+			target := exercises[index]
+			switch whenMatched {
+			case MergeActionUpdate:
+				updated := row
+				updated.ID = target.ID
+				if contentKey(updated) == contentKey(target) {
+					result.Unchanged++
+					continue
+				}
+				writes = append(writes, updated)
+				result.Updated++
+			case MergeActionDelete:
+				deletes = append(deletes, target.ID)
+				result.Deleted++
+			default:
+				result.Unchanged++
+			}
+		}
+	}
+
+	if len(writes) > 0 || len(deletes) > 0 {
+		tx := d.beginTransactionLocked()
+		for _, id := range deletes {
+			if err := tx.Delete(id); err != nil {
+				d.rollbackTransactionInternal(tx)
+				return nil, fmt.Errorf("failed to delete exercise %d: %w", id, err)
+			}
+		}
+		for _, exercise := range writes {
+			if err := tx.Update(exercise); err != nil {
+				d.rollbackTransactionInternal(tx)
+				return nil, fmt.Errorf("failed to write exercise: %w", err)
+			}
+		}
+
+		if err := d.commitTransactionLocked(tx); err != nil {
+			return nil, fmt.Errorf("failed to commit merge: %w", err)
+		}
+	}
+
+	result.Version = d.currentVersion
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+// validateMerge checks the key columns and actions of a merge. The caller
+// must hold the read lock.
+func (d *DeltaLakeRepository) validateMerge(on []string, whenMatched, whenNotMatched MergeAction) error {
+	if len(on) == 0 {
+		return fmt.Errorf("merge requires at least one key column")
+	}
+	seen := make(map[string]bool, len(on))
+	for _, column := range on {
+		if _, ok := d.schemaField(column); !ok {
+			return fmt.Errorf("unknown merge key column %s", column)
+		}
+		if seen[column] {
+			return fmt.Errorf("merge key column %s is listed more than once", column)
+		}
+		seen[column] = true
+	}
+
+	switch whenMatched {
+	case MergeActionUpdate, MergeActionDelete, MergeActionIgnore:
+	default:
+		return fmt.Errorf("unsupported action %q for matched rows", whenMatched)
+	}
+	switch whenNotMatched {
+	case MergeActionInsert, MergeActionIgnore:
+	default:
+		return fmt.Errorf("unsupported action %q for unmatched rows", whenNotMatched)
+	}
+	return nil
+}
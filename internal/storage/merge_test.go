@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_Merge(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	version := repo.currentVersion
+
+	source := []loader.Exercise{
+		{Name: "Running", Type: "cardio", Duration: 40, Calories: 380, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Description: "Longer run"},
+		{Name: "Swimming", Type: "cardio", Duration: 45, Calories: 400, Date: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC), Description: "Pool laps"},
+		{Name: "Rowing", Type: "cardio", Duration: 20, Calories: 250, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+	}
+
+	result, err := repo.Merge(ctx, source, []string{"name", "date"}, MergeActionUpdate, MergeActionInsert)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Inserted)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Equal(t, version+1, result.Version)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+	byName := make(map[string]loader.Exercise)
+	for _, exercise := range all {
+		byName[exercise.Name] = exercise
+	}
+	assert.Equal(t, 40, byName["Running"].Duration)
+	assert.Equal(t, "Longer run", byName["Running"].Description)
+	assert.NotZero(t, byName["Rowing"].ID)
+
+	// Merging the same source again changes nothing
+	result, err = repo.Merge(ctx, source, []string{"name", "date"}, MergeActionUpdate, MergeActionInsert)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Unchanged)
+	assert.Zero(t, result.Inserted+result.Updated+result.Deleted)
+	assert.Equal(t, version+1, result.Version)
+
+	// Matching on ID deletes matched rows and ignores the rest
+	result, err = repo.Merge(ctx, []loader.Exercise{
+		{ID: byName["Yoga"].ID},
+		{ID: 999, Name: "Unknown"},
+	}, []string{"id"}, MergeActionDelete, MergeActionIgnore)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Deleted)
+	assert.Equal(t, 0, result.Inserted)
+	deleted, err := repo.GetByID(byName["Yoga"].ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+}
+
+func TestDeltaLakeRepository_MergeErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	version := repo.currentVersion
+
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		source         []loader.Exercise
+		on             []string
+		whenMatched    MergeAction
+		whenNotMatched MergeAction
+		expected       string
+	}{
+		{
+			name:           "no key columns",
+			whenMatched:    MergeActionUpdate,
+			whenNotMatched: MergeActionInsert,
+			expected:       "at least one key column",
+		},
+		{
+			name:           "unknown key column",
+			on:             []string{"weight"},
+			whenMatched:    MergeActionUpdate,
+			whenNotMatched: MergeActionInsert,
+			expected:       "unknown merge key column weight",
+		},
+		{
+			name:           "insert on match",
+			on:             []string{"name"},
+			whenMatched:    MergeActionInsert,
+			whenNotMatched: MergeActionInsert,
+			expected:       "unsupported action",
+		},
+		{
+			name:           "update without match",
+			on:             []string{"name"},
+			whenMatched:    MergeActionUpdate,
+			whenNotMatched: MergeActionUpdate,
+			expected:       "unsupported action",
+		},
+		{
+			name: "duplicate source keys",
+			source: []loader.Exercise{
+				{Name: "Running", Type: "cardio", Duration: 10, Calories: 100, Date: date},
+				{Name: "Running", Type: "cardio", Duration: 20, Calories: 200, Date: date},
+			},
+			on:             []string{"name"},
+			whenMatched:    MergeActionUpdate,
+			whenNotMatched: MergeActionInsert,
+			expected:       "same merge key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.Merge(ctx, tt.source, tt.on, tt.whenMatched, tt.whenNotMatched)
+			assert.ErrorContains(t, err, tt.expected)
+			assert.Equal(t, version, repo.currentVersion)
+		})
+	}
+}
+
+func TestDeltaLakeRepository_MergeRollsBackOnConstraintViolation(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0 AND duration <= 1440",
+	}))
+	version := repo.currentVersion
+
+	source := []loader.Exercise{
+		{Name: "Running", Type: "cardio", Duration: 2000, Calories: 300, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{Name: "Rowing", Type: "cardio", Duration: 20, Calories: 250, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+	}
+	_, err := repo.Merge(ctx, source, []string{"name"}, MergeActionUpdate, MergeActionInsert)
+	var constraintErr *ConstraintError
+	require.True(t, errors.As(err, &constraintErr), "got %v", err)
+	assert.Equal(t, version, repo.currentVersion)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
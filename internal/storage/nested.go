@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Nested columns hold arrays, maps and structs. Arrays describe their
+// elements with Field.Element, maps their values with Field.Value (keys are
+// strings) and structs their fields with Field.Fields. Filters reach into
+// nested values with paths such as sets.reps, sets[0].reps or
+// metadata['device'].
+
+// validateFieldType checks that a field, and the fields nested in it, have a
+// known and fully described type
+func validateFieldType(field Field, path string) error {
+	switch field.Type {
+	case FieldTypeInt, FieldTypeString, FieldTypeFloat, FieldTypeBoolean, FieldTypeTimestamp, FieldTypeDate:
+		return nil
+	case FieldTypeArray:
+		if field.Element == nil {
+			return fmt.Errorf("array field %s requires an element type", path)
+		}
+		return validateFieldType(*field.Element, path+"[]")
+	case FieldTypeMap:
+		if field.Value == nil {
+			return fmt.Errorf("map field %s requires a value type", path)
+		}
+		if field.Key != nil && field.Key.Type != FieldTypeString {
+			return fmt.Errorf("map field %s must have string keys", path)
+		}
+		return validateFieldType(*field.Value, path+"[]")
+	case FieldTypeStruct:
+		if len(field.Fields) == 0 {
+			return fmt.Errorf("struct field %s requires at least one field", path)
+		}
+		seen := make(map[string]bool, len(field.Fields))
+		for _, child := range field.Fields {
+			if child.Name == "" {
+				return fmt.Errorf("struct field %s has a field without a name", path)
+			}
+			if seen[child.Name] {
+				return fmt.Errorf("field %s.%s is listed more than once", path, child.Name)
+			}
+			seen[child.Name] = true
+			if err := validateFieldType(child, path+"."+child.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("field %s has unknown type %q", path, field.Type)
+	}
+}
+
+// checkNestedCompatibility checks that the nested types of a field can be
+// changed as in the new field: nested types follow the same widening rules as
+// columns, and struct fields may be added when nullable or defaulted
+func (d *DeltaLakeRepository) checkNestedCompatibility(oldField, newField Field, path string) error {
+	if !d.isTypeCompatible(oldField.Type, newField.Type) {
+		return fmt.Errorf("field %s type change from %s to %s is not compatible", path, oldField.Type, newField.Type)
+	}
+
+	switch newField.Type {
+	case FieldTypeArray:
+		if oldField.Element != nil {
+			return d.checkNestedCompatibility(*oldField.Element, *newField.Element, path+"[]")
+		}
+	case FieldTypeMap:
+		if oldField.Value != nil {
+			return d.checkNestedCompatibility(*oldField.Value, *newField.Value, path+"[]")
+		}
+	case FieldTypeStruct:
+		oldFields := make(map[string]Field, len(oldField.Fields))
+		for _, child := range oldField.Fields {
+			oldFields[child.Name] = child
+		}
+		for _, child := range newField.Fields {
+			childPath := path + "." + child.Name
+			oldChild, exists := oldFields[child.Name]
+			if !exists {
+				if !child.Nullable && child.DefaultValue == nil {
+					return fmt.Errorf("new field %s must be nullable or have a default value", childPath)
+				}
+				continue
+			}
+			if oldChild.Nullable && !child.Nullable {
+				return fmt.Errorf("field %s cannot change from nullable to non-nullable", childPath)
+			}
+			if err := d.checkNestedCompatibility(oldChild, child, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// convertField converts a value to the type of a field, including the values
+// nested in arrays, maps and structs; path names the value in errors. Missing
+// struct fields take their default value. Unknown struct fields are an error
+// when strict and dropped otherwise.
+func convertField(value interface{}, field Field, path string, strict bool) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch field.Type {
+	case FieldTypeArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			return value, fmt.Errorf("column %s expects an array, got %v", path, value)
+		}
+		if field.Element == nil {
+			return items, nil
+		}
+		converted := make([]interface{}, len(items))
+		for i, item := range items {
+			element, err := convertNested(item, *field.Element, fmt.Sprintf("%s[%d]", path, i), strict)
+			if err != nil {
+				return value, err
+			}
+			converted[i] = element
+		}
+		return converted, nil
+	case FieldTypeMap:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return value, fmt.Errorf("column %s expects a map, got %v", path, value)
+		}
+		if field.Value == nil {
+			return entries, nil
+		}
+		converted := make(map[string]interface{}, len(entries))
+		for key, entry := range entries {
+			entryValue, err := convertNested(entry, *field.Value, fmt.Sprintf("%s['%s']", path, key), strict)
+			if err != nil {
+				return value, err
+			}
+			converted[key] = entryValue
+		}
+		return converted, nil
+	case FieldTypeStruct:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return value, fmt.Errorf("column %s expects a struct, got %v", path, value)
+		}
+		if len(field.Fields) == 0 {
+			return entries, nil
+		}
+		converted := make(map[string]interface{}, len(field.Fields))
+		for _, child := range field.Fields {
+			entry, present := entries[child.Name]
+			if !present {
+				entry = child.DefaultValue
+			}
+			childValue, err := convertNested(entry, child, path+"."+child.Name, strict)
+			if err != nil {
+				return value, err
+			}
+			if present || childValue != nil {
+				converted[child.Name] = childValue
+			}
+		}
+		if strict {
+			for name := range entries {
+				if _, known := structField(field, name); !known {
+					return value, fmt.Errorf("column %s has no field %s", path, name)
+				}
+			}
+		}
+		return converted, nil
+	default:
+		converted, ok := convertValue(value, field.Type)
+		if !ok {
+			return value, fmt.Errorf("column %s expects a %s value, got %v", path, field.Type, value)
+		}
+		return converted, nil
+	}
+}
+
+// convertNested converts a value nested in an array, map or struct, which
+// must not be null unless its field is nullable
+func convertNested(value interface{}, field Field, path string, strict bool) (interface{}, error) {
+	converted, err := convertField(value, field, path, strict)
+	if err != nil {
+		return nil, err
+	}
+	if converted == nil && strict && !field.Nullable {
+		return nil, fmt.Errorf("column %s cannot be null", path)
+	}
+	return converted, nil
+}
+
+// pathSegment is a step of a column path: a struct field or map key, or an
+// array index
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseColumnPath splits a column path such as sets[0].reps or
+// metadata['device'] into the column name and the segments that follow it
+func parseColumnPath(path string) (string, []pathSegment, error) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		return path, nil, nil
+	}
+	column, rest := path[:end], path[end:]
+	if column == "" {
+		return "", nil, fmt.Errorf("path %q has no column", path)
+	}
+
+	var segments []pathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return "", nil, fmt.Errorf("path %q has an empty field name", path)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			closing := strings.IndexByte(rest, ']')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("path %q has an unclosed [", path)
+			}
+			inner := strings.TrimSpace(rest[1:closing])
+			rest = rest[closing+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return "", nil, fmt.Errorf("path %q has an invalid index %q", path, inner)
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		default:
+			return "", nil, fmt.Errorf("path %q has an unexpected %q", path, rest[0])
+		}
+	}
+	return column, segments, nil
+}
+
+// resolvePath follows path segments into a nested value. Field names applied
+// to an array reach into each of its elements, so the path can lead to
+// several values; spread reports when it did. Missing entries resolve to null.
+func resolvePath(value interface{}, segments []pathSegment) (values []interface{}, spread bool) {
+	values = []interface{}{value}
+	for _, segment := range segments {
+		next := make([]interface{}, 0, len(values))
+		for _, current := range values {
+			switch v := current.(type) {
+			case map[string]interface{}:
+				if segment.isIndex {
+					next = append(next, nil)
+				} else {
+					next = append(next, v[segment.key])
+				}
+			case []interface{}:
+				if segment.isIndex {
+					if segment.index < len(v) {
+						next = append(next, v[segment.index])
+					} else {
+						next = append(next, nil)
+					}
+					continue
+				}
+				spread = true
+				for _, element := range v {
+					if entries, ok := element.(map[string]interface{}); ok {
+						next = append(next, entries[segment.key])
+					} else {
+						next = append(next, nil)
+					}
+				}
+			default:
+				next = append(next, nil)
+			}
+		}
+		values = next
+	}
+	return values, spread
+}
+
+// schemaPathField returns the field a column path leads to in the current
+// schema. The caller must hold the read lock.
+func (d *DeltaLakeRepository) schemaPathField(path string) (Field, bool) {
+	column, segments, err := parseColumnPath(path)
+	if err != nil {
+		return Field{}, false
+	}
+	field, ok := d.schemaField(column)
+	if !ok {
+		return Field{}, false
+	}
+
+	for _, segment := range segments {
+		switch {
+		case field.Type == FieldTypeArray && field.Element != nil:
+			field = *field.Element
+			if !segment.isIndex {
+				// A field name reaches into each element
+				child, ok := structField(field, segment.key)
+				if !ok {
+					return Field{}, false
+				}
+				field = child
+			}
+		case field.Type == FieldTypeMap && field.Value != nil && !segment.isIndex:
+			field = *field.Value
+		case field.Type == FieldTypeStruct && !segment.isIndex:
+			child, ok := structField(field, segment.key)
+			if !ok {
+				return Field{}, false
+			}
+			field = child
+		default:
+			return Field{}, false
+		}
+	}
+	return field, true
+}
+
+// structField returns the named field of a struct field
+func structField(field Field, name string) (Field, bool) {
+	if field.Type != FieldTypeStruct {
+		return Field{}, false
+	}
+	for _, child := range field.Fields {
+		if child.Name == name {
+			return child, true
+		}
+	}
+	return Field{}, false
+}
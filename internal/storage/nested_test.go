@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// strengthFields are nested columns holding per-set data and device tags
+func strengthFields() []Field {
+	return []Field{
+		{Name: "sets", Type: FieldTypeArray, Nullable: true, Element: &Field{
+			Type: FieldTypeStruct,
+			Fields: []Field{
+				{Name: "reps", Type: FieldTypeInt},
+				{Name: "weight", Type: FieldTypeFloat, Nullable: true},
+			},
+		}},
+		{Name: "metadata", Type: FieldTypeMap, Nullable: true, Key: &Field{Type: FieldTypeString}, Value: &Field{Type: FieldTypeString}},
+	}
+}
+
+func nestedExercise(name string, sets []interface{}, metadata map[string]interface{}) loader.Exercise {
+	exercise := sampleExercises()[1]
+	exercise.Name = name
+	exercise.Extra = map[string]interface{}{"sets": sets, "metadata": metadata}
+	return exercise
+}
+
+func TestDeltaLakeRepository_NestedColumns(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	evolveWith(t, repo, strengthFields()...)
+
+	require.NoError(t, repo.InsertBatch([]loader.Exercise{
+		nestedExercise("Bench press",
+			[]interface{}{
+				map[string]interface{}{"reps": float64(12), "weight": 60},
+				map[string]interface{}{"reps": float64(8), "weight": 70},
+			},
+			map[string]interface{}{"device": "watch"}),
+		nestedExercise("Squat",
+			[]interface{}{map[string]interface{}{"reps": float64(5)}},
+			map[string]interface{}{"device": "phone", "gym": "home"}),
+	}))
+
+	// Nested values round-trip with their declared types
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	bench, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Bench press"}}})
+	require.NoError(t, err)
+	require.Len(t, bench, 1)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"reps": 12, "weight": float64(60)},
+		map[string]interface{}{"reps": 8, "weight": float64(70)},
+	}, bench[0].Extra["sets"])
+	assert.Equal(t, map[string]interface{}{"device": "watch"}, bench[0].Extra["metadata"])
+
+	metrics, err := repo.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, metrics.DataTypeMismatches["sets"])
+	assert.EqualValues(t, 4, metrics.NullValues["metadata"])
+
+	hasSets := Condition{Field: "sets", Operator: OperatorIsNotNull}
+	tests := []struct {
+		name       string
+		conditions []Condition
+		expected   []string
+	}{
+		{name: "any element", conditions: []Condition{{Field: "sets.reps", Operator: OperatorGreaterThan, Value: 10}}, expected: []string{"Bench press"}},
+		{name: "no element", conditions: []Condition{hasSets, {Field: "sets.reps", Operator: OperatorNotEqual, Value: 8}}, expected: []string{"Squat"}},
+		{name: "indexed element", conditions: []Condition{{Field: "sets[0].reps", Operator: OperatorEqual, Value: 5}}, expected: []string{"Squat"}},
+		{name: "map key", conditions: []Condition{{Field: "metadata['device']", Operator: OperatorEqual, Value: "watch"}}, expected: []string{"Bench press"}},
+		{name: "missing map key", conditions: []Condition{{Field: "metadata[\"gym\"]", Operator: OperatorIsNotNull}}, expected: []string{"Squat"}},
+		{name: "missing struct value", conditions: []Condition{hasSets, {Field: "sets.weight", Operator: OperatorIsNull}}, expected: []string{"Squat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := repo.QueryWithFilter(ctx, Filter{Conditions: tt.conditions})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, exerciseNames(rows))
+		})
+	}
+
+	// Conditional mutations accept paths and assign nested values
+	result, err := repo.UpdateWhere(ctx,
+		Filter{Conditions: []Condition{{Field: "metadata['device']", Operator: OperatorEqual, Value: "phone"}}},
+		map[string]interface{}{"metadata": map[string]interface{}{"device": "watch"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Affected)
+	watch, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "metadata['device']", Operator: OperatorEqual, Value: "watch"}}})
+	require.NoError(t, err)
+	assert.Len(t, watch, 2)
+
+	_, err = repo.UpdateWhere(ctx,
+		Filter{Conditions: []Condition{{Field: "sets.load", Operator: OperatorEqual, Value: 1}}},
+		map[string]interface{}{"metadata": nil})
+	assert.ErrorContains(t, err, "unknown column sets.load")
+}
+
+func TestDeltaLakeRepository_NestedColumnErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	evolveWith(t, repo, strengthFields()...)
+
+	tests := []struct {
+		name     string
+		sets     []interface{}
+		metadata map[string]interface{}
+		expected string
+	}{
+		{name: "element type", sets: []interface{}{map[string]interface{}{"reps": 10}, map[string]interface{}{"reps": "many"}}, expected: "column sets[1].reps expects a int value"},
+		{name: "unknown struct field", sets: []interface{}{map[string]interface{}{"reps": 10, "tempo": "slow"}}, expected: "column sets[0] has no field tempo"},
+		{name: "null struct field", sets: []interface{}{map[string]interface{}{"weight": 20}}, expected: "column sets[0].reps cannot be null"},
+		{name: "map value", metadata: map[string]interface{}{"device": []interface{}{"watch"}}, expected: "column metadata['device'] expects a string value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.Insert(nestedExercise("Deadlift", tt.sets, tt.metadata))
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+
+	err := repo.Insert(loader.Exercise{Name: "Deadlift", Extra: map[string]interface{}{"sets": "3x5"}})
+	assert.ErrorContains(t, err, "column sets expects an array")
+}
+
+func TestDeltaLakeRepository_NestedSchemaEvolution(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	evolveWith(t, repo, strengthFields()...)
+
+	invalid := []struct {
+		field    Field
+		expected string
+	}{
+		{field: Field{Name: "tags", Type: FieldTypeArray, Nullable: true}, expected: "requires an element type"},
+		{field: Field{Name: "scores", Type: FieldTypeMap, Nullable: true, Key: &Field{Type: FieldTypeInt}, Value: &Field{Type: FieldTypeInt}}, expected: "must have string keys"},
+		{field: Field{Name: "location", Type: FieldTypeStruct, Nullable: true}, expected: "requires at least one field"},
+		{field: Field{Name: "mood", Type: "emotion", Nullable: true}, expected: "unknown type"},
+	}
+	for _, tt := range invalid {
+		schema, err := repo.GetCurrentSchema(context.Background())
+		require.NoError(t, err)
+		schema.Fields = append(schema.Fields, tt.field)
+		assert.ErrorContains(t, repo.EvolveSchema(context.Background(), schema), tt.expected)
+	}
+
+	// Struct fields can be added when nullable, and nested types widened
+	sets := strengthFields()[0]
+	sets.Element = &Field{Type: FieldTypeStruct, Fields: []Field{
+		{Name: "reps", Type: FieldTypeFloat},
+		{Name: "weight", Type: FieldTypeFloat, Nullable: true},
+		{Name: "rpe", Type: FieldTypeInt, Nullable: true},
+	}}
+	evolveWith(t, repo, sets)
+
+	sets.Element = &Field{Type: FieldTypeStruct, Fields: []Field{
+		{Name: "reps", Type: FieldTypeFloat},
+		{Name: "tempo", Type: FieldTypeString},
+	}}
+	schema, err := repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	schema.Fields[len(schema.Fields)-2] = sets
+	assert.ErrorContains(t, repo.EvolveSchema(context.Background(), schema), "new field sets[].tempo must be nullable")
+}
+
+func TestParseColumnPath(t *testing.T) {
+	column, segments, err := parseColumnPath("sets[2].reps")
+	require.NoError(t, err)
+	assert.Equal(t, "sets", column)
+	assert.Equal(t, []pathSegment{{index: 2, isIndex: true}, {key: "reps"}}, segments)
+
+	column, segments, err = parseColumnPath("metadata['device.id']")
+	require.NoError(t, err)
+	assert.Equal(t, "metadata", column)
+	assert.Equal(t, []pathSegment{{key: "device.id"}}, segments)
+
+	for _, path := range []string{".reps", "sets..reps", "sets[0", "sets[-1]", "sets[x]"} {
+		_, _, err := parseColumnPath(path)
+		assert.Error(t, err, path)
+	}
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Outlier detection for data quality metrics
+
+const (
+	defaultIQRMultiplier = 1.5
+	defaultZScoreCutoff  = 3.0
+	minIQRSamples        = 4
+	minZScoreSamples     = 3
+)
+
+// OutlierDetector flags the outlying values of a numeric column, returning one
+// flag per value
+type OutlierDetector interface {
+	Detect(values []float64) []bool
+}
+
+// OutlierDetectorFactory builds the detector of a rule for the rows of a
+// group; group is empty when the rule has no GroupBy column
+type OutlierDetectorFactory func(rule OutlierRule, group string) (OutlierDetector, error)
+
+var outlierDetectors = map[OutlierMethod]OutlierDetectorFactory{
+	OutlierMethodFixed:  newFixedOutlierDetector,
+	OutlierMethodIQR:    newIQROutlierDetector,
+	OutlierMethodZScore: newZScoreOutlierDetector,
+}
+
+// RegisterOutlierDetector makes a detection method available to outlier
+// rules. It is not safe for concurrent use and should be called during
+// initialization.
+func RegisterOutlierDetector(method OutlierMethod, factory OutlierDetectorFactory) {
+	outlierDetectors[method] = factory
+}
+
+// defaultOutlierRules flags sessions longer than 4 hours or burning more than
+// 2000 calories
+func defaultOutlierRules() []OutlierRule {
+	maxDuration, maxCalories := 240.0, 2000.0
+	return []OutlierRule{
+		{Column: "duration", Method: OutlierMethodFixed, OutlierBounds: OutlierBounds{Max: &maxDuration}},
+		{Column: "calories", Method: OutlierMethodFixed, OutlierBounds: OutlierBounds{Max: &maxCalories}},
+	}
+}
+
+// GetOutlierRules returns the outlier rules of the table
+func (d *DeltaLakeRepository) GetOutlierRules(ctx context.Context) ([]OutlierRule, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	rules := make([]OutlierRule, len(d.outlierRules))
+	copy(rules, d.outlierRules)
+	return rules, nil
+}
+
+// SetOutlierRules replaces the outlier rules of the table
+func (d *DeltaLakeRepository) SetOutlierRules(ctx context.Context, rules []OutlierRule) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for i, rule := range rules {
+		if err := d.validateOutlierRule(rule); err != nil {
+			return fmt.Errorf("invalid outlier rule %d: %w", i, err)
+		}
+	}
+
+	d.outlierRules = make([]OutlierRule, len(rules))
+	copy(d.outlierRules, rules)
+	return d.saveMetadata()
+}
+
+// validateOutlierRule checks that a rule refers to schema fields and that its
+// detectors can be built
+func (d *DeltaLakeRepository) validateOutlierRule(rule OutlierRule) error {
+	if _, ok := d.schemaField(rule.Column); !ok {
+		return fmt.Errorf("unknown column %q", rule.Column)
+	}
+	if rule.GroupBy != "" {
+		if _, ok := d.schemaField(rule.GroupBy); !ok {
+			return fmt.Errorf("unknown group by column %q", rule.GroupBy)
+		}
+	} else if len(rule.Baselines) > 0 {
+		return fmt.Errorf("baselines require a group by column")
+	}
+
+	factory, ok := outlierDetectors[rule.Method]
+	if !ok {
+		return fmt.Errorf("unknown outlier method %q", rule.Method)
+	}
+	if _, err := factory(rule, ""); err != nil {
+		return err
+	}
+	for group := range rule.Baselines {
+		if _, err := factory(rule, group); err != nil {
+			return fmt.Errorf("baseline %q: %w", group, err)
+		}
+	}
+	return nil
+}
+
+// schemaField returns the field of the current schema with the given name
+func (d *DeltaLakeRepository) schemaField(name string) (Field, bool) {
+	for _, field := range d.currentSchema.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// detectOutliers applies the rules and returns the sorted IDs of the flagged
+// records per column
+func (d *DeltaLakeRepository) detectOutliers(rules []OutlierRule, exercises []loader.Exercise) (map[string][]int, error) {
+	flagged := make(map[string]map[int]bool)
+	for _, rule := range rules {
+		field, ok := d.schemaField(rule.Column)
+		if !ok {
+			continue
+		}
+		groupField, grouped := d.schemaField(rule.GroupBy)
+
+		factory, ok := outlierDetectors[rule.Method]
+		if !ok {
+			return nil, fmt.Errorf("unknown outlier method %q", rule.Method)
+		}
+
+		// Split the numeric values of the column into groups
+		groups := make(map[string][]int)
+		values := make([]float64, len(exercises))
+		for i, exercise := range exercises {
+			value, ok := numericValue(schemaFieldValue(exercise, field))
+			if !ok {
+				continue
+			}
+			values[i] = value
+
+			var group string
+			if grouped {
+				if groupValue := schemaFieldValue(exercise, groupField); !isNullValue(groupValue) {
+					group = valueText(groupValue)
+				}
+			}
+			groups[group] = append(groups[group], i)
+		}
+
+		for group, positions := range groups {
+			detector, err := factory(rule, group)
+			if err != nil {
+				return nil, fmt.Errorf("outlier rule for %s: %w", rule.Column, err)
+			}
+
+			groupValues := make([]float64, len(positions))
+			for i, position := range positions {
+				groupValues[i] = values[position]
+			}
+			for i, outlier := range detector.Detect(groupValues) {
+				if !outlier {
+					continue
+				}
+				if flagged[rule.Column] == nil {
+					flagged[rule.Column] = make(map[int]bool)
+				}
+				flagged[rule.Column][exercises[positions[i]].ID] = true
+			}
+		}
+	}
+
+	outliers := make(map[string][]int, len(flagged))
+	for column, ids := range flagged {
+		for id := range ids {
+			outliers[column] = append(outliers[column], id)
+		}
+		sort.Ints(outliers[column])
+	}
+	return outliers, nil
+}
+
+// fixedOutlierDetector flags values outside fixed bounds
+type fixedOutlierDetector struct {
+	bounds OutlierBounds
+}
+
+func newFixedOutlierDetector(rule OutlierRule, group string) (OutlierDetector, error) {
+	bounds := rule.OutlierBounds
+	if baseline, ok := rule.Baselines[group]; ok {
+		bounds = baseline
+	}
+	if bounds.Min == nil && bounds.Max == nil && len(rule.Baselines) == 0 {
+		return nil, fmt.Errorf("fixed outlier detection requires min or max")
+	}
+	if bounds.Min != nil && bounds.Max != nil && *bounds.Min > *bounds.Max {
+		return nil, fmt.Errorf("min %v is greater than max %v", *bounds.Min, *bounds.Max)
+	}
+	return fixedOutlierDetector{bounds: bounds}, nil
+}
+
+func (f fixedOutlierDetector) Detect(values []float64) []bool {
+	flags := make([]bool, len(values))
+	for i, value := range values {
+		flags[i] = (f.bounds.Min != nil && value < *f.bounds.Min) || (f.bounds.Max != nil && value > *f.bounds.Max)
+	}
+	return flags
+}
+
+// iqrOutlierDetector flags values beyond multiplier interquartile ranges from
+// the first and third quartiles
+type iqrOutlierDetector struct {
+	multiplier float64
+}
+
+func newIQROutlierDetector(rule OutlierRule, group string) (OutlierDetector, error) {
+	if rule.Threshold < 0 {
+		return nil, fmt.Errorf("threshold must not be negative")
+	}
+	multiplier := rule.Threshold
+	if multiplier == 0 {
+		multiplier = defaultIQRMultiplier
+	}
+	return iqrOutlierDetector{multiplier: multiplier}, nil
+}
+
+func (q iqrOutlierDetector) Detect(values []float64) []bool {
+	flags := make([]bool, len(values))
+	if len(values) < minIQRSamples {
+		return flags
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	spread := (q3 - q1) * q.multiplier
+	for i, value := range values {
+		flags[i] = value < q1-spread || value > q3+spread
+	}
+	return flags
+}
+
+// zScoreOutlierDetector flags values more than cutoff standard deviations from
+// the mean
+type zScoreOutlierDetector struct {
+	cutoff float64
+}
+
+func newZScoreOutlierDetector(rule OutlierRule, group string) (OutlierDetector, error) {
+	if rule.Threshold < 0 {
+		return nil, fmt.Errorf("threshold must not be negative")
+	}
+	cutoff := rule.Threshold
+	if cutoff == 0 {
+		cutoff = defaultZScoreCutoff
+	}
+	return zScoreOutlierDetector{cutoff: cutoff}, nil
+}
+
+func (z zScoreOutlierDetector) Detect(values []float64) []bool {
+	flags := make([]bool, len(values))
+	if len(values) < minZScoreSamples {
+		return flags
+	}
+
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	stddev := math.Sqrt(squares / float64(len(values)))
+	if stddev == 0 {
+		return flags
+	}
+
+	for i, value := range values {
+		flags[i] = math.Abs(value-mean)/stddev > z.cutoff
+	}
+	return flags
+}
+
+// quantile returns the q-th quantile of sorted values by linear interpolation
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	fraction := position - float64(lower)
+	return sorted[lower] + (sorted[upper]-sorted[lower])*fraction
+}
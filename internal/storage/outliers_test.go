@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestOutlierDetectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     OutlierRule
+		values   []float64
+		expected []bool
+	}{
+		{
+			name:     "fixed bounds",
+			rule:     OutlierRule{Method: OutlierMethodFixed, OutlierBounds: OutlierBounds{Min: floatPtr(5), Max: floatPtr(60)}},
+			values:   []float64{1, 5, 30, 60, 61},
+			expected: []bool{true, false, false, false, true},
+		},
+		{
+			name:     "iqr default multiplier",
+			rule:     OutlierRule{Method: OutlierMethodIQR},
+			values:   []float64{10, 12, 11, 13, 12, 100},
+			expected: []bool{false, false, false, false, false, true},
+		},
+		{
+			name:     "iqr needs enough samples",
+			rule:     OutlierRule{Method: OutlierMethodIQR},
+			values:   []float64{10, 12, 100},
+			expected: []bool{false, false, false},
+		},
+		{
+			name:     "z-score default cutoff",
+			rule:     OutlierRule{Method: OutlierMethodZScore},
+			values:   []float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 50},
+			expected: []bool{false, false, false, false, false, false, false, false, false, false},
+		},
+		{
+			name:     "z-score custom cutoff",
+			rule:     OutlierRule{Method: OutlierMethodZScore, Threshold: 2},
+			values:   []float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 50},
+			expected: []bool{false, false, false, false, false, false, false, false, false, true},
+		},
+		{
+			name:     "z-score constant values",
+			rule:     OutlierRule{Method: OutlierMethodZScore},
+			values:   []float64{7, 7, 7, 7},
+			expected: []bool{false, false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector, err := outlierDetectors[tt.rule.Method](tt.rule, "")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, detector.Detect(tt.values))
+		})
+	}
+}
+
+func TestDeltaLakeRepository_OutlierRules(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+
+	exercises := append(sampleExercises(),
+		loader.Exercise{Name: "Long Ride", Type: "cardio", Duration: 180, Calories: 1500, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+		loader.Exercise{Name: "Long Stretch", Type: "flexibility", Duration: 180, Calories: 200, Date: time.Date(2024, 1, 18, 0, 0, 0, 0, time.UTC)},
+	)
+	require.NoError(t, repo.InsertBatch(exercises))
+
+	ids := make(map[string]int)
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	for _, exercise := range all {
+		ids[exercise.Name] = exercise.ID
+	}
+
+	// The default thresholds flag nothing here
+	metrics, err := repo.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics.Outliers)
+
+	// A 3-hour cardio session is normal, a 3-hour stretch is not
+	require.NoError(t, repo.SetOutlierRules(ctx, []OutlierRule{
+		{
+			Column:  "duration",
+			Method:  OutlierMethodFixed,
+			GroupBy: "type",
+			Baselines: map[string]OutlierBounds{
+				"cardio":      {Max: floatPtr(240)},
+				"flexibility": {Max: floatPtr(90)},
+			},
+		},
+		{Column: "calories", Method: OutlierMethodIQR},
+	}))
+
+	metrics, err = repo.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{ids["Long Stretch"]}, metrics.Outliers["duration"])
+	assert.Equal(t, []int{ids["Long Ride"]}, metrics.Outliers["calories"])
+	assert.Equal(t, map[string]int64{"duration": 1, "calories": 1}, metrics.OutlierCounts)
+
+	// Rules are persisted with the table
+	require.NoError(t, repo.Close())
+	reopened, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { reopened.Close() })
+
+	rules, err := reopened.GetOutlierRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "type", rules[0].GroupBy)
+	assert.Equal(t, 90.0, *rules[0].Baselines["flexibility"].Max)
+
+	// Invalid rules are rejected
+	invalid := []OutlierRule{
+		{Column: "heart_rate", Method: OutlierMethodIQR},
+		{Column: "duration", Method: "magic"},
+		{Column: "duration", Method: OutlierMethodFixed},
+		{Column: "duration", Method: OutlierMethodZScore, Threshold: -1},
+		{Column: "duration", Method: OutlierMethodIQR, Baselines: map[string]OutlierBounds{"cardio": {}}},
+	}
+	for _, rule := range invalid {
+		assert.Error(t, reopened.SetOutlierRules(ctx, []OutlierRule{rule}), "rule %+v", rule)
+	}
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Scheduled data quality checks for DeltaLakeRepository
+
+const (
+	qualityHistoryFile     = "quality_history.jsonl"
+	qualityWebhookTimeout  = 10 * time.Second
+	qualityCheckFailedType = "data_quality.check_failed"
+
+	// defaultMinQualityCheckInterval is the shortest schedule allowed unless
+	// DeltaConfig sets another
+	defaultMinQualityCheckInterval = time.Minute
+)
+
+// qualityScheduler runs the quality checks of a repository on an interval
+type qualityScheduler struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// qualityAlert is the webhook payload sent when a check fails
+type qualityAlert struct {
+	Event  string              `json:"event"`
+	Table  string              `json:"table"`
+	Failed []ExpectationResult `json:"failed"`
+	Result *QualityCheckResult `json:"result"`
+}
+
+// MarshalJSON encodes the interval as a duration string such as "1h0m0s"
+func (c QualityCheckConfig) MarshalJSON() ([]byte, error) {
+	type plain QualityCheckConfig
+	encoded := struct {
+		plain
+		Interval string `json:"interval,omitempty"`
+	}{plain: plain(c)}
+	if c.Interval != 0 {
+		encoded.Interval = c.Interval.String()
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes the interval from a duration string such as "1h" or
+// a number of seconds
+func (c *QualityCheckConfig) UnmarshalJSON(data []byte) error {
+	type plain QualityCheckConfig
+	decoded := struct {
+		*plain
+		Interval json.RawMessage `json:"interval"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	c.Interval = 0
+	if len(decoded.Interval) == 0 || string(decoded.Interval) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(decoded.Interval, &text); err == nil {
+		interval, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid interval %q: %w", text, err)
+		}
+		c.Interval = interval
+		return nil
+	}
+	var seconds float64
+	if err := json.Unmarshal(decoded.Interval, &seconds); err != nil {
+		return fmt.Errorf("interval must be a duration such as \"1h\" or a number of seconds")
+	}
+	c.Interval = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// minQualityCheckInterval returns the shortest interval checks can be
+// scheduled at
+func (d *DeltaLakeRepository) minQualityCheckInterval() time.Duration {
+	if d.config.MinQualityCheckInterval > 0 {
+		return d.config.MinQualityCheckInterval
+	}
+	return defaultMinQualityCheckInterval
+}
+
+// GetQualityChecks returns the quality check configuration of the table
+func (d *DeltaLakeRepository) GetQualityChecks(ctx context.Context) (*QualityCheckConfig, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	config := QualityCheckConfig{Expectations: []QualityExpectation{}}
+	if d.qualityChecks != nil {
+		config = *d.qualityChecks
+		config.Expectations = make([]QualityExpectation, len(d.qualityChecks.Expectations))
+		copy(config.Expectations, d.qualityChecks.Expectations)
+	}
+	return &config, nil
+}
+
+// SetQualityChecks replaces the quality check configuration and reschedules
+// the checks
+func (d *DeltaLakeRepository) SetQualityChecks(ctx context.Context, config QualityCheckConfig) error {
+	d.mutex.Lock()
+	if err := d.validateQualityChecks(config); err != nil {
+		d.mutex.Unlock()
+		return fmt.Errorf("invalid quality checks: %w", err)
+	}
+
+	config.Expectations = append([]QualityExpectation{}, config.Expectations...)
+	d.qualityChecks = &config
+	err := d.saveMetadata()
+	d.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The lock is released first since a running check holds a read lock
+	d.scheduleQualityChecks(config.Interval)
+	return nil
+}
+
+// validateQualityChecks checks expectations against the current schema
+func (d *DeltaLakeRepository) validateQualityChecks(config QualityCheckConfig) error {
+	if config.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if minimum := d.minQualityCheckInterval(); config.Interval > 0 && config.Interval < minimum {
+		return fmt.Errorf("interval %s is shorter than the minimum of %s", config.Interval, minimum)
+	}
+	if config.WebhookURL != "" {
+		parsed, err := url.Parse(config.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhook url must be an absolute http or https url")
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, expectation := range config.Expectations {
+		if expectation.Name == "" {
+			return fmt.Errorf("expectation name is required")
+		}
+		if names[expectation.Name] {
+			return fmt.Errorf("duplicate expectation %s", expectation.Name)
+		}
+		names[expectation.Name] = true
+
+		switch expectation.Metric {
+		case QualityMetricCompleteness, QualityMetricValidity, QualityMetricConsistency,
+			QualityMetricTotalRecords, QualityMetricInvalidRecords, QualityMetricConstraintViolations:
+			if len(expectation.Columns) > 0 {
+				return fmt.Errorf("expectation %s: metric %s does not take columns", expectation.Name, expectation.Metric)
+			}
+		case QualityMetricDuplicateRecords, QualityMetricNullValues, QualityMetricOutliers, QualityMetricDataTypeMismatches:
+			for _, column := range expectation.Columns {
+				if _, ok := d.schemaField(column); !ok {
+					return fmt.Errorf("expectation %s: unknown column %q", expectation.Name, column)
+				}
+			}
+		default:
+			return fmt.Errorf("expectation %s: unknown metric %q", expectation.Name, expectation.Metric)
+		}
+
+		switch expectation.Operator {
+		case OperatorEqual, OperatorNotEqual, OperatorGreaterThan, OperatorGreaterThanOrEqual,
+			OperatorLessThan, OperatorLessThanOrEqual:
+		default:
+			return fmt.Errorf("expectation %s: unsupported operator %q", expectation.Name, expectation.Operator)
+		}
+	}
+	return nil
+}
+
+// RunQualityChecks computes the data quality metrics, evaluates the
+// expectations, records the run in the history and sends an alert to the
+// webhook if an expectation fails
+func (d *DeltaLakeRepository) RunQualityChecks(ctx context.Context) (*QualityCheckResult, error) {
+	result, webhookURL := d.evaluateQualityChecks()
+
+	if !result.Passed && webhookURL != "" {
+		if err := d.sendQualityAlert(ctx, webhookURL, result); err != nil {
+			result.AlertError = err.Error()
+		}
+	}
+
+	if err := d.appendQualityHistory(result); err != nil {
+		return result, fmt.Errorf("failed to record quality check: %w", err)
+	}
+	if result.Error != "" {
+		return result, fmt.Errorf("quality check failed: %s", result.Error)
+	}
+	return result, nil
+}
+
+// evaluateQualityChecks runs the checks against the current version. Errors
+// are reported on the result so that failed runs are recorded and alerted too.
+func (d *DeltaLakeRepository) evaluateQualityChecks() (*QualityCheckResult, string) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	result := &QualityCheckResult{
+		RunAt:        time.Now(),
+		Version:      d.currentVersion,
+		Expectations: []ExpectationResult{},
+	}
+
+	var config QualityCheckConfig
+	if d.qualityChecks != nil {
+		config = *d.qualityChecks
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to get data for quality analysis: %v", err)
+		return result, config.WebhookURL
+	}
+	metrics, err := d.computeDataQualityMetrics(exercises)
+	if err != nil {
+		result.Error = err.Error()
+		return result, config.WebhookURL
+	}
+	result.Metrics = metrics
+
+	result.Passed = true
+	for _, expectation := range config.Expectations {
+		actual := qualityMetricValue(expectation, metrics)
+		if expectation.Metric == QualityMetricDuplicateRecords && len(expectation.Columns) > 0 {
+			actual = float64(countDuplicates(d.columnViews(exercises), expectation.Columns))
+		}
+
+		passed := compareQualityValue(actual, expectation.Operator, expectation.Value)
+		result.Passed = result.Passed && passed
+		result.Expectations = append(result.Expectations, ExpectationResult{
+			QualityExpectation: expectation,
+			Actual:             actual,
+			Passed:             passed,
+		})
+	}
+
+	return result, config.WebhookURL
+}
+
+// qualityMetricValue extracts the value of an expectation's metric, summing
+// per-column metrics over its columns, or over all columns when none are given
+func qualityMetricValue(expectation QualityExpectation, metrics *DataQualityMetrics) float64 {
+	sumColumns := func(values map[string]int64) float64 {
+		var total int64
+		if len(expectation.Columns) == 0 {
+			for _, value := range values {
+				total += value
+			}
+		}
+		for _, column := range expectation.Columns {
+			total += values[column]
+		}
+		return float64(total)
+	}
+
+	switch expectation.Metric {
+	case QualityMetricCompleteness:
+		return metrics.CompletenessScore
+	case QualityMetricValidity:
+		return metrics.ValidityScore
+	case QualityMetricConsistency:
+		return metrics.ConsistencyScore
+	case QualityMetricTotalRecords:
+		return float64(metrics.TotalRecords)
+	case QualityMetricInvalidRecords:
+		return float64(metrics.InvalidRecords)
+	case QualityMetricDuplicateRecords:
+		return float64(metrics.DuplicateRecords)
+	case QualityMetricNullValues:
+		return sumColumns(metrics.NullValues)
+	case QualityMetricOutliers:
+		return sumColumns(metrics.OutlierCounts)
+	case QualityMetricDataTypeMismatches:
+		return sumColumns(metrics.DataTypeMismatches)
+	case QualityMetricConstraintViolations:
+		return sumColumns(metrics.ConstraintViolations)
+	default:
+		return 0
+	}
+}
+
+// countDuplicates counts the rows whose key columns repeat an earlier row;
+// rows with a null key column are never duplicates
+func countDuplicates(exercises []loader.Exercise, columns []string) int64 {
+	var duplicates int64
+	seen := make(map[string]bool)
+	for _, exercise := range exercises {
+		key, ok := columnsKey(exercise, columns)
+		if !ok {
+			continue
+		}
+		if seen[key] {
+			duplicates++
+		} else {
+			seen[key] = true
+		}
+	}
+	return duplicates
+}
+
+// compareQualityValue applies a comparison operator to a metric value
+func compareQualityValue(actual float64, operator Operator, expected float64) bool {
+	cmp := compareFloats(actual, expected)
+	switch operator {
+	case OperatorEqual:
+		return cmp == 0
+	case OperatorNotEqual:
+		return cmp != 0
+	case OperatorGreaterThan:
+		return cmp > 0
+	case OperatorGreaterThanOrEqual:
+		return cmp >= 0
+	case OperatorLessThan:
+		return cmp < 0
+	case OperatorLessThanOrEqual:
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// sendQualityAlert posts a failed check to the webhook
+func (d *DeltaLakeRepository) sendQualityAlert(ctx context.Context, webhookURL string, result *QualityCheckResult) error {
+	alert := qualityAlert{
+		Event:  qualityCheckFailedType,
+		Table:  d.tableName(),
+		Failed: []ExpectationResult{},
+		Result: result,
+	}
+	for _, expectation := range result.Expectations {
+		if !expectation.Passed {
+			alert.Failed = append(alert.Failed, expectation)
+		}
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, qualityWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tableName returns the name of the table for alerts
+func (d *DeltaLakeRepository) tableName() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.metadata.Name
+}
+
+// GetQualityHistory returns the recorded quality check runs between from and
+// to, oldest first; zero bounds are open
+func (d *DeltaLakeRepository) GetQualityHistory(ctx context.Context, from, to time.Time) ([]QualityCheckResult, error) {
+	d.historyMutex.Lock()
+	defer d.historyMutex.Unlock()
+
+	history := make([]QualityCheckResult, 0)
+
+	file, err := os.Open(d.qualityHistoryPath())
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open quality history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var result QualityCheckResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal quality check: %w", err)
+		}
+		if !from.IsZero() && result.RunAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && result.RunAt.After(to) {
+			continue
+		}
+		history = append(history, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quality history: %w", err)
+	}
+
+	return history, nil
+}
+
+// appendQualityHistory appends a run to the history file
+func (d *DeltaLakeRepository) appendQualityHistory(result *QualityCheckResult) error {
+	d.historyMutex.Lock()
+	defer d.historyMutex.Unlock()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quality check: %w", err)
+	}
+
+	file, err := os.OpenFile(d.qualityHistoryPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open quality history: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func (d *DeltaLakeRepository) qualityHistoryPath() string {
+	return filepath.Join(d.basePath, "_delta_log", qualityHistoryFile)
+}
+
+// scheduleQualityChecks replaces the running scheduler with one for the given
+// interval; a zero interval only stops it. Intervals below the minimum, such
+// as ones persisted before it was raised, run at the minimum.
+func (d *DeltaLakeRepository) scheduleQualityChecks(interval time.Duration) {
+	d.schedulerMutex.Lock()
+	defer d.schedulerMutex.Unlock()
+
+	if d.qualityScheduler != nil {
+		d.qualityScheduler.cancel()
+		<-d.qualityScheduler.done
+		d.qualityScheduler = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	if minimum := d.minQualityCheckInterval(); interval < minimum {
+		interval = minimum
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := &qualityScheduler{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	d.qualityScheduler = scheduler
+
+	go func() {
+		defer close(scheduler.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Failed runs are recorded in the history and alerted
+				d.RunQualityChecks(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the alerts posted to it
+type webhookReceiver struct {
+	mu     sync.Mutex
+	alerts []qualityAlert
+	status int
+}
+
+func newWebhookReceiver(t *testing.T, status int) (*webhookReceiver, *httptest.Server) {
+	receiver := &webhookReceiver{status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert qualityAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err == nil {
+			receiver.mu.Lock()
+			receiver.alerts = append(receiver.alerts, alert)
+			receiver.mu.Unlock()
+		}
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(server.Close)
+	return receiver, server
+}
+
+func (r *webhookReceiver) received() []qualityAlert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]qualityAlert{}, r.alerts...)
+}
+
+func TestDeltaLakeRepository_RunQualityChecks(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	receiver, server := newWebhookReceiver(t, http.StatusNoContent)
+	require.NoError(t, repo.SetQualityChecks(ctx, QualityCheckConfig{
+		Expectations: []QualityExpectation{
+			{Name: "complete", Metric: QualityMetricCompleteness, Operator: OperatorGreaterThanOrEqual, Value: 99},
+			{Name: "no_duplicates", Metric: QualityMetricDuplicateRecords, Columns: []string{"name", "date"}, Operator: OperatorEqual, Value: 0},
+			{Name: "descriptions", Metric: QualityMetricNullValues, Columns: []string{"description"}, Operator: OperatorLessThanOrEqual, Value: 1},
+		},
+		WebhookURL: server.URL,
+	}))
+
+	result, err := repo.RunQualityChecks(ctx)
+	require.NoError(t, err)
+	assert.False(t, result.Passed)
+	assert.Empty(t, result.AlertError)
+	require.Len(t, result.Expectations, 3)
+	assert.False(t, result.Expectations[0].Passed)
+	assert.InDelta(t, 27.0/28.0*100, result.Expectations[0].Actual, 0.001)
+	assert.True(t, result.Expectations[1].Passed)
+	assert.True(t, result.Expectations[2].Passed)
+	require.NotNil(t, result.Metrics)
+	assert.Equal(t, int64(4), result.Metrics.TotalRecords)
+
+	alerts := receiver.received()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, qualityCheckFailedType, alerts[0].Event)
+	assert.Equal(t, "exercises", alerts[0].Table)
+	require.Len(t, alerts[0].Failed, 1)
+	assert.Equal(t, "complete", alerts[0].Failed[0].Name)
+
+	// Passing runs are recorded without alerting
+	require.NoError(t, repo.SetQualityChecks(ctx, QualityCheckConfig{
+		Expectations: []QualityExpectation{
+			{Name: "complete", Metric: QualityMetricCompleteness, Operator: OperatorGreaterThanOrEqual, Value: 95},
+		},
+		WebhookURL: server.URL,
+	}))
+	result, err = repo.RunQualityChecks(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Passed)
+	assert.Len(t, receiver.received(), 1)
+
+	history, err := repo.GetQualityHistory(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.False(t, history[0].Passed)
+	assert.True(t, history[1].Passed)
+
+	history, err = repo.GetQualityHistory(ctx, history[1].RunAt, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	// Webhook failures are reported on the result
+	_, failing := newWebhookReceiver(t, http.StatusInternalServerError)
+	require.NoError(t, repo.SetQualityChecks(ctx, QualityCheckConfig{
+		Expectations: []QualityExpectation{
+			{Name: "big", Metric: QualityMetricTotalRecords, Operator: OperatorGreaterThan, Value: 100},
+		},
+		WebhookURL: failing.URL,
+	}))
+	result, err = repo.RunQualityChecks(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, result.AlertError, "webhook returned status 500")
+}
+
+func TestDeltaLakeRepository_ScheduledQualityChecks(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	// The minimum interval is persisted with the configuration
+	repo, err := NewDeltaLakeRepository(path, &DeltaConfig{MinQualityCheckInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	receiver, server := newWebhookReceiver(t, http.StatusOK)
+	require.NoError(t, repo.SetQualityChecks(ctx, QualityCheckConfig{
+		Interval: 10 * time.Millisecond,
+		Expectations: []QualityExpectation{
+			{Name: "no_outliers", Metric: QualityMetricOutliers, Operator: OperatorEqual, Value: 0},
+			{Name: "valid", Metric: QualityMetricValidity, Operator: OperatorEqual, Value: 100},
+			{Name: "at_least_ten", Metric: QualityMetricTotalRecords, Operator: OperatorGreaterThanOrEqual, Value: 10},
+		},
+		WebhookURL: server.URL,
+	}))
+
+	require.Eventually(t, func() bool {
+		history, err := repo.GetQualityHistory(ctx, time.Time{}, time.Time{})
+		return err == nil && len(history) >= 2
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.NotEmpty(t, receiver.received())
+
+	// The schedule is persisted and resumes when the table is reopened
+	require.NoError(t, repo.Close())
+	history, err := repo.GetQualityHistory(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	runs := len(history)
+
+	reopened, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { reopened.Close() })
+
+	config, err := reopened.GetQualityChecks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Millisecond, config.Interval)
+	require.Len(t, config.Expectations, 3)
+
+	require.Eventually(t, func() bool {
+		history, err := reopened.GetQualityHistory(ctx, time.Time{}, time.Time{})
+		return err == nil && len(history) > runs
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// A zero interval stops scheduling
+	require.NoError(t, reopened.SetQualityChecks(ctx, QualityCheckConfig{}))
+	history, err = reopened.GetQualityHistory(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	runs = len(history)
+	time.Sleep(50 * time.Millisecond)
+	history, err = reopened.GetQualityHistory(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, history, runs)
+}
+
+func TestDeltaLakeRepository_SetQualityChecks_Invalid(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		config QualityCheckConfig
+	}{
+		{name: "negative interval", config: QualityCheckConfig{Interval: -time.Second}},
+		{name: "interval below minimum", config: QualityCheckConfig{Interval: time.Second}},
+		{name: "relative webhook", config: QualityCheckConfig{WebhookURL: "/alerts"}},
+		{name: "missing name", config: QualityCheckConfig{Expectations: []QualityExpectation{{Metric: QualityMetricValidity, Operator: OperatorEqual}}}},
+		{name: "duplicate name", config: QualityCheckConfig{Expectations: []QualityExpectation{
+			{Name: "a", Metric: QualityMetricValidity, Operator: OperatorEqual},
+			{Name: "a", Metric: QualityMetricValidity, Operator: OperatorEqual},
+		}}},
+		{name: "unknown metric", config: QualityCheckConfig{Expectations: []QualityExpectation{{Name: "a", Metric: "freshness", Operator: OperatorEqual}}}},
+		{name: "unknown column", config: QualityCheckConfig{Expectations: []QualityExpectation{{Name: "a", Metric: QualityMetricNullValues, Columns: []string{"heart_rate"}, Operator: OperatorEqual}}}},
+		{name: "columns on score", config: QualityCheckConfig{Expectations: []QualityExpectation{{Name: "a", Metric: QualityMetricValidity, Columns: []string{"name"}, Operator: OperatorEqual}}}},
+		{name: "unsupported operator", config: QualityCheckConfig{Expectations: []QualityExpectation{{Name: "a", Metric: QualityMetricValidity, Operator: OperatorLike}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, repo.SetQualityChecks(ctx, tt.config))
+		})
+	}
+}
+
+func TestQualityCheckConfig_JSON(t *testing.T) {
+	tests := []struct {
+		body     string
+		interval time.Duration
+	}{
+		{`{"interval": "1h30m"}`, 90 * time.Minute},
+		{`{"interval": 3600}`, time.Hour},
+		{`{"interval": 0.5}`, 500 * time.Millisecond},
+		{`{"interval": null}`, 0},
+		{`{}`, 0},
+	}
+	for _, tt := range tests {
+		var config QualityCheckConfig
+		require.NoError(t, json.Unmarshal([]byte(tt.body), &config), tt.body)
+		assert.Equal(t, tt.interval, config.Interval, tt.body)
+	}
+
+	var config QualityCheckConfig
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"interval": "hourly"}`), &config), `invalid interval "hourly"`)
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"interval": true}`), &config), "number of seconds")
+
+	encoded, err := json.Marshal(QualityCheckConfig{Interval: time.Hour, WebhookURL: "http://example.com/alerts"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"interval": "1h0m0s", "expectations": null, "webhook_url": "http://example.com/alerts"}`, string(encoded))
+	require.NoError(t, json.Unmarshal(encoded, &config))
+	assert.Equal(t, time.Hour, config.Interval)
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+const (
+	// defaultQueryCacheMaxEntries is the default number of cached query results
+	defaultQueryCacheMaxEntries = 1000
+	// defaultQueryCacheMaxBytes is the default memory budget of the query cache (64MB)
+	defaultQueryCacheMaxBytes = 64 * 1024 * 1024
+
+	// Approximate in-memory footprint of cached values, excluding string contents
+	exerciseBaseSize    = 128
+	aggregationBaseSize = 64
+	aggregationValue    = 48
+)
+
+// queryCache is an LRU cache of query results keyed by normalized query text.
+// Entries belong to a single table version: storing a result for a newer
+// version drops everything cached for older ones, so every commit invalidates
+// the cache without explicit bookkeeping.
+type queryCache struct {
+	maxEntries int
+	maxBytes   int64
+	usedBytes  int64
+	version    int64
+	entries    map[string]*list.Element
+	order      *list.List
+	mutex      sync.Mutex
+}
+
+// queryCacheEntry is a single cached result
+type queryCacheEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+// newQueryCache creates a cache from the repository configuration. It returns
+// nil when caching is disabled with a negative memory limit.
+func newQueryCache(config *DeltaConfig) *queryCache {
+	maxEntries := defaultQueryCacheMaxEntries
+	maxBytes := int64(defaultQueryCacheMaxBytes)
+
+	if config != nil {
+		if config.QueryCacheMaxBytes < 0 || config.QueryCacheMaxEntries < 0 {
+			return nil
+		}
+		if config.QueryCacheMaxEntries > 0 {
+			maxEntries = config.QueryCacheMaxEntries
+		}
+		if config.QueryCacheMaxBytes > 0 {
+			maxBytes = config.QueryCacheMaxBytes
+		}
+	}
+
+	return &queryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		version:    -1,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the cached result of a query at the given table version
+func (c *queryCache) get(version int64, key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version != c.version {
+		return nil, false
+	}
+
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*queryCacheEntry).value, true
+}
+
+// put stores the result of a query at the given table version, evicting the
+// least recently used entries to stay within the configured limits
+func (c *queryCache) put(version int64, key string, value interface{}) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version < c.version {
+		return
+	}
+	if version > c.version {
+		c.clearLocked()
+		c.version = version
+	}
+
+	size := estimateResultSize(value)
+	if size > c.maxBytes {
+		return
+	}
+
+	if element, exists := c.entries[key]; exists {
+		c.removeLocked(element)
+	}
+
+	element := c.order.PushFront(&queryCacheEntry{key: key, value: value, size: size})
+	c.entries[key] = element
+	c.usedBytes += size
+
+	for c.order.Len() > c.maxEntries || c.usedBytes > c.maxBytes {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+// entryCount returns the number of cached entries
+func (c *queryCache) entryCount() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// clearLocked drops every entry. The caller must hold the cache mutex.
+func (c *queryCache) clearLocked() {
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.usedBytes = 0
+}
+
+// removeLocked drops a single entry. The caller must hold the cache mutex.
+func (c *queryCache) removeLocked(element *list.Element) {
+	entry := c.order.Remove(element).(*queryCacheEntry)
+	delete(c.entries, entry.key)
+	c.usedBytes -= entry.size
+}
+
+// estimateResultSize approximates the memory held by a cached result
+func estimateResultSize(value interface{}) int64 {
+	var size int64
+
+	switch v := value.(type) {
+	case []loader.Exercise:
+		for _, exercise := range v {
+			size += exerciseBaseSize + int64(len(exercise.Name)+len(exercise.Type)+len(exercise.Description))
+		}
+	case []AggregationResult:
+		for _, result := range v {
+			size += aggregationBaseSize + int64(len(result.Values))*aggregationValue
+		}
+	}
+
+	return size
+}
+
+// copyExercises returns a deep copy of a result slice, extra columns
+// included, so callers cannot modify cached data
+func copyExercises(exercises []loader.Exercise) []loader.Exercise {
+	result := make([]loader.Exercise, len(exercises))
+	copy(result, exercises)
+	for i := range result {
+		if result[i].Extra != nil {
+			result[i].Extra = copyValue(result[i].Extra).(map[string]interface{})
+		}
+	}
+	return result
+}
+
+// copyValue returns a deep copy of a column value, copying the maps and
+// slices of nested values
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+// copyAggregationResults returns a deep copy of aggregation results
+func copyAggregationResults(results []AggregationResult) []AggregationResult {
+	copied := make([]AggregationResult, len(results))
+	for i, result := range results {
+		values := make(map[string]interface{}, len(result.Values))
+		for k, v := range result.Values {
+			values[k] = copyValue(v)
+		}
+		copied[i] = AggregationResult{Window: result.Window, Values: values}
+	}
+	return copied
+}
@@ -0,0 +1,777 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Query planning and execution for DeltaLakeRepository
+
+// queryPlan describes how a filter is executed against a table version
+type queryPlan struct {
+	filter           Filter
+	index            string
+	indexCondition   *Condition
+	candidates       []int
+	fullScan         bool
+	partitionsTotal  int
+	partitionsPruned int
+}
+
+// indexLookup maps normalized column values to record positions for one table version
+type indexLookup struct {
+	version   int64
+	column    string
+	timeKeys  bool
+	positions map[string][]int
+}
+
+// executeQuery plans and runs a filter against the current version and
+// records the execution in the query statistics. Results are served from the
+// query cache when the same query already ran against the current version.
+func (d *DeltaLakeRepository) executeQuery(filter Filter) ([]loader.Exercise, error) {
+	exec := startQuery(describeFilter(filter))
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if cached, ok := d.queryCache.get(d.currentVersion, exec.query); ok {
+		result := copyExercises(cached.([]loader.Exercise))
+		exec.recordsReturned = int64(len(result))
+		exec.cacheHit = true
+		d.finishQuery(exec)
+		return result, nil
+	}
+
+	result, explanation, err := d.runQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	d.queryCache.put(d.currentVersion, exec.query, copyExercises(result))
+
+	exec.recordsScanned = explanation.RecordsScanned
+	exec.recordsReturned = explanation.ActualRows
+	exec.partitionsPruned = int64(explanation.PartitionsPruned)
+	exec.indexUsed = explanation.IndexUsed
+	d.finishQuery(exec)
+
+	return result, nil
+}
+
+// runQuery reads the current version, plans the filter and executes the plan,
+// timing every stage. The caller must hold the repository read lock.
+func (d *DeltaLakeRepository) runQuery(filter Filter) ([]loader.Exercise, *QueryExplanation, error) {
+	explanation := &QueryExplanation{
+		Query:   describeFilter(filter),
+		Version: d.currentVersion,
+		Stages:  []QueryStage{},
+	}
+
+	begin := time.Now()
+	stageStart := begin
+	addStage := func(name string, rowsIn, rowsOut int) {
+		now := time.Now()
+		explanation.Stages = append(explanation.Stages, QueryStage{
+			Name:     name,
+			RowsIn:   int64(rowsIn),
+			RowsOut:  int64(rowsOut),
+			Duration: now.Sub(stageStart),
+		})
+		stageStart = now
+	}
+
+	exercises, err := d.getAllFromFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	explanation.FilesTotal = len(d.currentDataFiles())
+	addStage("read", len(exercises), len(exercises))
+
+	views := d.columnViews(exercises)
+	plan := d.planQuery(views, filter)
+	candidates := len(exercises)
+	if !plan.fullScan {
+		candidates = len(plan.candidates)
+	}
+
+	explanation.PartitionsTotal = plan.partitionsTotal
+	explanation.PartitionsPruned = plan.partitionsPruned
+	explanation.IndexUsed = plan.index
+	if plan.indexCondition != nil {
+		explanation.IndexCondition = describeCondition(*plan.indexCondition)
+	}
+	explanation.FullScan = plan.fullScan
+	explanation.EstimatedRows = d.estimateRows(candidates, plan)
+
+	// A data file is pruned when planning leaves no candidate rows in it
+	if candidates == 0 {
+		explanation.FilesPruned = explanation.FilesTotal
+	} else {
+		explanation.FilesScanned = explanation.FilesTotal
+	}
+	addStage("plan", len(exercises), candidates)
+
+	result := make([]loader.Exercise, 0)
+	scanned := 0
+	scan := func(position int) {
+		scanned++
+		if d.matchesFilter(views[position], filter) {
+			result = append(result, exercises[position])
+		}
+	}
+
+	if plan.fullScan {
+		for position := range exercises {
+			scan(position)
+		}
+	} else {
+		for _, position := range plan.candidates {
+			scan(position)
+		}
+	}
+	addStage("filter", scanned, len(result))
+
+	if len(filter.SortBy) > 0 {
+		result = d.applySorting(result, filter.SortBy)
+		addStage("sort", len(result), len(result))
+	}
+
+	if filter.Limit != nil || filter.Offset != nil {
+		matched := len(result)
+		result = d.applyPagination(result, filter.Limit, filter.Offset)
+		addStage("limit", matched, len(result))
+	}
+
+	explanation.RecordsScanned = int64(scanned)
+	explanation.ActualRows = int64(len(result))
+	explanation.TotalTime = time.Since(begin)
+
+	return result, explanation, nil
+}
+
+// currentDataFiles returns the data files of the current version
+func (d *DeltaLakeRepository) currentDataFiles() []string {
+	dataPath := filepath.Join(d.basePath, d.dataFileOf(d.currentVersion))
+
+	if _, err := os.Stat(dataPath); err != nil {
+		return []string{}
+	}
+	return []string{dataPath}
+}
+
+// finishQuery completes the measurement of a query and records it
+func (d *DeltaLakeRepository) finishQuery(exec *queryExecution) {
+	exec.duration = time.Since(exec.startTime)
+	d.queryStats.record(*exec)
+}
+
+// planQuery prunes partitions and chooses an index for a filter.
+// The caller must hold the repository read lock.
+func (d *DeltaLakeRepository) planQuery(exercises []loader.Exercise, filter Filter) *queryPlan {
+	plan := &queryPlan{filter: filter, fullScan: true}
+
+	partitionCandidates := d.prunePartitions(exercises, filter, plan)
+	if partitionCandidates != nil {
+		plan.fullScan = false
+		plan.candidates = partitionCandidates
+	}
+
+	indexName, condition, indexCandidates := d.chooseIndex(exercises, filter)
+	if indexName == "" {
+		return plan
+	}
+
+	plan.index = indexName
+	plan.indexCondition = condition
+	if plan.fullScan {
+		plan.candidates = indexCandidates
+	} else {
+		plan.candidates = intersectPositions(plan.candidates, indexCandidates)
+	}
+	plan.fullScan = false
+
+	return plan
+}
+
+// partitionFields returns the columns the table is partitioned by
+func (d *DeltaLakeRepository) partitionFields() []string {
+	if d.config != nil && len(d.config.PartitionFields) > 0 {
+		return d.config.PartitionFields
+	}
+	if d.metadata != nil {
+		return d.metadata.PartitionFields
+	}
+	return nil
+}
+
+// prunePartitions groups records by their partition values and skips every
+// partition whose values cannot satisfy the filter. It returns the positions of
+// records in the remaining partitions, or nil when the table is not partitioned.
+func (d *DeltaLakeRepository) prunePartitions(exercises []loader.Exercise, filter Filter, plan *queryPlan) []int {
+	fields := d.partitionFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	isPartitionField := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		isPartitionField[field] = true
+	}
+
+	var partitionConditions []Condition
+	for _, condition := range filter.Conditions {
+		if isPartitionField[condition.Field] {
+			partitionConditions = append(partitionConditions, condition)
+		}
+	}
+
+	partitions := make(map[string][]int)
+	order := make([]string, 0)
+	for position, exercise := range exercises {
+		key := partitionKey(exercise, fields)
+		if _, exists := partitions[key]; !exists {
+			order = append(order, key)
+		}
+		partitions[key] = append(partitions[key], position)
+	}
+
+	plan.partitionsTotal = len(partitions)
+	candidates := make([]int, 0, len(exercises))
+	for _, key := range order {
+		positions := partitions[key]
+
+		// Every record in a partition shares its partition values, so the first
+		// record decides for the whole partition
+		representative := exercises[positions[0]]
+		pruned := false
+		for _, condition := range partitionConditions {
+			if !d.matchesCondition(representative, condition) {
+				pruned = true
+				break
+			}
+		}
+
+		if pruned {
+			plan.partitionsPruned++
+			continue
+		}
+		candidates = append(candidates, positions...)
+	}
+
+	return candidates
+}
+
+// partitionKey builds the partition identifier of a record
+func partitionKey(exercise loader.Exercise, fields []string) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		value, _ := exerciseFieldValue(exercise, field)
+		parts[i] = field + "=" + indexKey(value)
+	}
+	return strings.Join(parts, "/")
+}
+
+// chooseIndex returns the first index (by name) whose leading column has an
+// equality or IN condition, together with the positions it matches
+func (d *DeltaLakeRepository) chooseIndex(exercises []loader.Exercise, filter Filter) (string, *Condition, []int) {
+	if len(d.indexes) == 0 {
+		return "", nil, nil
+	}
+
+	names := make([]string, 0, len(d.indexes))
+	for name := range d.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		index := d.indexes[name]
+		if len(index.Columns) == 0 {
+			continue
+		}
+
+		for i := range filter.Conditions {
+			condition := filter.Conditions[i]
+			if condition.Field != index.Columns[0] {
+				continue
+			}
+			if condition.Operator != OperatorEqual && condition.Operator != OperatorIn {
+				continue
+			}
+
+			lookup := d.getIndexLookup(name, index.Columns[0], exercises)
+			return name, &condition, lookup.match(condition)
+		}
+	}
+
+	return "", nil, nil
+}
+
+// getIndexLookup returns the lookup structure of an index for the current
+// version, building it on first use after each commit
+func (d *DeltaLakeRepository) getIndexLookup(name, column string, exercises []loader.Exercise) *indexLookup {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	if lookup, exists := d.indexLookups[name]; exists && lookup.version == d.currentVersion && lookup.column == column {
+		return lookup
+	}
+
+	lookup := &indexLookup{
+		version:   d.currentVersion,
+		column:    column,
+		positions: make(map[string][]int),
+	}
+
+	for position, exercise := range exercises {
+		value, _ := exerciseFieldValue(exercise, column)
+		if _, isTime := value.(time.Time); isTime {
+			lookup.timeKeys = true
+		}
+		key := indexKey(value)
+		lookup.positions[key] = append(lookup.positions[key], position)
+	}
+
+	d.indexLookups[name] = lookup
+	return lookup
+}
+
+// match returns the sorted positions of records satisfying an equality or IN condition
+func (l *indexLookup) match(condition Condition) []int {
+	values := []interface{}{condition.Value}
+	if condition.Operator == OperatorIn {
+		values = toValueSlice(condition.Value)
+	}
+
+	seen := make(map[int]bool)
+	positions := make([]int, 0)
+	for _, value := range values {
+		if l.timeKeys {
+			if t, ok := toTime(value); ok {
+				value = t
+			}
+		}
+
+		for _, position := range l.positions[indexKey(value)] {
+			if !seen[position] {
+				seen[position] = true
+				positions = append(positions, position)
+			}
+		}
+	}
+
+	sort.Ints(positions)
+	return positions
+}
+
+// intersectPositions returns the positions present in both sorted slices
+func intersectPositions(left, right []int) []int {
+	inRight := make(map[int]bool, len(right))
+	for _, position := range right {
+		inRight[position] = true
+	}
+
+	result := make([]int, 0)
+	for _, position := range left {
+		if inRight[position] {
+			result = append(result, position)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// Selectivities assumed for conditions the plan does not resolve exactly
+const (
+	selectivityEqual    = 0.1
+	selectivityRange    = 0.33
+	selectivityBetween  = 0.25
+	selectivityLike     = 0.25
+	selectivityNegation = 0.9
+	selectivityNull     = 0.05
+)
+
+// estimateRows estimates the result size of a plan. Partition and index
+// conditions are already exact in the candidate count, every other condition
+// applies a fixed selectivity, and LIMIT/OFFSET cap the estimate.
+func (d *DeltaLakeRepository) estimateRows(candidates int, plan *queryPlan) int64 {
+	isPartitionField := make(map[string]bool)
+	for _, field := range d.partitionFields() {
+		isPartitionField[field] = true
+	}
+
+	estimate := float64(candidates)
+	for _, condition := range plan.filter.Conditions {
+		if plan.partitionsTotal > 0 && isPartitionField[condition.Field] {
+			continue
+		}
+		if plan.indexCondition != nil && reflect.DeepEqual(condition, *plan.indexCondition) {
+			continue
+		}
+		estimate *= conditionSelectivity(condition)
+	}
+
+	rows := int64(math.Round(estimate))
+	if plan.filter.Offset != nil && *plan.filter.Offset > 0 {
+		rows -= int64(*plan.filter.Offset)
+		if rows < 0 {
+			rows = 0
+		}
+	}
+	if plan.filter.Limit != nil && *plan.filter.Limit >= 0 && rows > int64(*plan.filter.Limit) {
+		rows = int64(*plan.filter.Limit)
+	}
+
+	return rows
+}
+
+// conditionSelectivity returns the fraction of rows a condition is assumed to keep
+func conditionSelectivity(condition Condition) float64 {
+	switch condition.Operator {
+	case OperatorEqual:
+		return selectivityEqual
+	case OperatorIn:
+		return math.Min(1, selectivityEqual*float64(len(toValueSlice(condition.Value))))
+	case OperatorGreaterThan, OperatorGreaterThanOrEqual, OperatorLessThan, OperatorLessThanOrEqual:
+		return selectivityRange
+	case OperatorBetween:
+		return selectivityBetween
+	case OperatorLike:
+		return selectivityLike
+	case OperatorNotEqual, OperatorNotIn, OperatorNotLike:
+		return selectivityNegation
+	case OperatorIsNull:
+		return selectivityNull
+	case OperatorIsNotNull:
+		return 1 - selectivityNull
+	default:
+		return 1
+	}
+}
+
+// describeFilter renders a filter as a normalized SQL statement. Conditions are
+// sorted so that logically identical filters produce the same text.
+func describeFilter(filter Filter) string {
+	var builder strings.Builder
+	builder.WriteString("SELECT * FROM exercises")
+
+	if len(filter.Conditions) > 0 {
+		clauses := make([]string, len(filter.Conditions))
+		for i, condition := range filter.Conditions {
+			clauses[i] = describeCondition(condition)
+		}
+		sort.Strings(clauses)
+		builder.WriteString(" WHERE ")
+		builder.WriteString(strings.Join(clauses, " AND "))
+	}
+
+	if len(filter.SortBy) > 0 {
+		orders := make([]string, len(filter.SortBy))
+		for i, sortField := range filter.SortBy {
+			order := "ASC"
+			if sortField.Order == SortOrderDesc {
+				order = "DESC"
+			}
+			orders[i] = sortField.Field + " " + order
+		}
+		builder.WriteString(" ORDER BY ")
+		builder.WriteString(strings.Join(orders, ", "))
+	}
+
+	if filter.Limit != nil {
+		builder.WriteString(fmt.Sprintf(" LIMIT %d", *filter.Limit))
+	}
+	if filter.Offset != nil {
+		builder.WriteString(fmt.Sprintf(" OFFSET %d", *filter.Offset))
+	}
+
+	return builder.String()
+}
+
+// describeCondition renders a single condition as SQL
+func describeCondition(condition Condition) string {
+	switch condition.Operator {
+	case OperatorEqual:
+		return fmt.Sprintf("%s = %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorNotEqual:
+		return fmt.Sprintf("%s != %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorGreaterThan:
+		return fmt.Sprintf("%s > %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorGreaterThanOrEqual:
+		return fmt.Sprintf("%s >= %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorLessThan:
+		return fmt.Sprintf("%s < %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorLessThanOrEqual:
+		return fmt.Sprintf("%s <= %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorIn, OperatorNotIn:
+		values := toValueSlice(condition.Value)
+		literals := make([]string, len(values))
+		for i, value := range values {
+			literals[i] = formatLiteral(value)
+		}
+		keyword := "IN"
+		if condition.Operator == OperatorNotIn {
+			keyword = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", condition.Field, keyword, strings.Join(literals, ", "))
+	case OperatorLike:
+		return fmt.Sprintf("%s LIKE %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorNotLike:
+		return fmt.Sprintf("%s NOT LIKE %s", condition.Field, formatLiteral(condition.Value))
+	case OperatorIsNull:
+		return fmt.Sprintf("%s IS NULL", condition.Field)
+	case OperatorIsNotNull:
+		return fmt.Sprintf("%s IS NOT NULL", condition.Field)
+	case OperatorBetween:
+		bounds := toValueSlice(condition.Value)
+		if len(bounds) == 2 {
+			return fmt.Sprintf("%s BETWEEN %s AND %s", condition.Field, formatLiteral(bounds[0]), formatLiteral(bounds[1]))
+		}
+	}
+
+	return fmt.Sprintf("%s %s %s", condition.Field, condition.Operator, formatLiteral(condition.Value))
+}
+
+// formatLiteral renders a value as a SQL literal
+func formatLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return "'" + v.UTC().Format(time.RFC3339) + "'"
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	if number, ok := numericValue(value); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprintf("'%v'", value)
+}
+
+// Value helpers shared by filtering, sorting and indexing
+
+// compareValues compares two values, returning -1, 0 or 1. Numbers are
+// compared numerically, times chronologically (accepting RFC3339 or YYYY-MM-DD
+// strings on the right-hand side) and everything else as strings. The boolean
+// result is false when the values cannot be compared.
+func compareValues(left, right interface{}) (int, bool) {
+	if left == nil || right == nil {
+		return 0, false
+	}
+
+	if l, ok := numericValue(left); ok {
+		r, ok := toFloat(right)
+		if !ok {
+			return 0, false
+		}
+		return compareFloats(l, r), true
+	}
+
+	if l, ok := left.(time.Time); ok {
+		r, ok := toTime(right)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l.Before(r):
+			return -1, true
+		case l.After(r):
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	if l, ok := left.(bool); ok {
+		r, ok := right.(bool)
+		if !ok {
+			parsed, err := strconv.ParseBool(fmt.Sprint(right))
+			if err != nil {
+				return 0, false
+			}
+			r = parsed
+		}
+		switch {
+		case l == r:
+			return 0, true
+		case !l:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(left), fmt.Sprint(right)), true
+}
+
+// compareFloats compares two floats, returning -1, 0 or 1
+func compareFloats(left, right float64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// numericValue converts numeric Go types (but not strings) to float64
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// toFloat converts numbers and numeric strings to float64
+func toFloat(value interface{}) (float64, bool) {
+	if number, ok := numericValue(value); ok {
+		return number, true
+	}
+	if str, ok := value.(string); ok {
+		number, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// toTime converts times and RFC3339 or YYYY-MM-DD strings to time.Time
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// toValueSlice converts a slice of any element type to []interface{}
+func toValueSlice(value interface{}) []interface{} {
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
+
+// containsValue reports whether any of the values equals the target
+func containsValue(values []interface{}, target interface{}) bool {
+	for _, value := range values {
+		if cmp, ok := compareValues(target, value); ok && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isNullValue reports whether a column value should be treated as NULL
+func isNullValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case time.Time:
+		return v.IsZero()
+	default:
+		return false
+	}
+}
+
+// indexKey normalizes a value for use as a hash key
+func indexKey(value interface{}) string {
+	if number, ok := numericValue(value); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// matchLike implements SQL LIKE matching where % matches any sequence of
+// characters and _ matches a single character
+func matchLike(value, pattern string) bool {
+	str := []rune(value)
+	pat := []rune(pattern)
+
+	s, p := 0, 0
+	starPattern, starString := -1, 0
+	for s < len(str) {
+		switch {
+		case p < len(pat) && pat[p] == '%':
+			starPattern = p
+			starString = s
+			p++
+		case p < len(pat) && (pat[p] == '_' || pat[p] == str[s]):
+			s++
+			p++
+		case starPattern != -1:
+			p = starPattern + 1
+			starString++
+			s = starString
+		default:
+			return false
+		}
+	}
+
+	for p < len(pat) && pat[p] == '%' {
+		p++
+	}
+	return p == len(pat)
+}
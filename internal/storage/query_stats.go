@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultQueryStatsWindow is the number of recent executions used for latency statistics
+	defaultQueryStatsWindow = 1000
+	// topQueriesLimit is the number of slowest distinct queries reported in QueryStats
+	topQueriesLimit = 10
+)
+
+// queryExecution captures the measurements of a single read against the table
+type queryExecution struct {
+	query            string
+	startTime        time.Time
+	duration         time.Duration
+	recordsScanned   int64
+	recordsReturned  int64
+	partitionsPruned int64
+	indexUsed        string
+	cacheHit         bool
+}
+
+// startQuery begins measuring a query execution
+func startQuery(query string) *queryExecution {
+	return &queryExecution{
+		query:     query,
+		startTime: time.Now(),
+	}
+}
+
+// queryStatsCollector aggregates query executions into QueryStats.
+// Counters are cumulative since the repository was opened, while latencies, the
+// cache hit rate and top queries are computed over a rolling window of the most
+// recent executions.
+type queryStatsCollector struct {
+	windowSize int
+	window     []queryExecution
+	next       int
+
+	totalQueries     int64
+	recordsScanned   int64
+	recordsReturned  int64
+	partitionsPruned int64
+	indexUsage       map[string]int64
+	lastUpdated      time.Time
+
+	mutex sync.Mutex
+}
+
+// newQueryStatsCollector creates a collector keeping the given number of executions
+func newQueryStatsCollector(windowSize int) *queryStatsCollector {
+	if windowSize <= 0 {
+		windowSize = defaultQueryStatsWindow
+	}
+
+	return &queryStatsCollector{
+		windowSize: windowSize,
+		window:     make([]queryExecution, 0, windowSize),
+		indexUsage: make(map[string]int64),
+	}
+}
+
+// record adds a finished execution to the collector
+func (c *queryStatsCollector) record(exec queryExecution) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.totalQueries++
+	c.recordsScanned += exec.recordsScanned
+	c.recordsReturned += exec.recordsReturned
+	c.partitionsPruned += exec.partitionsPruned
+	if exec.indexUsed != "" {
+		c.indexUsage[exec.indexUsed]++
+	}
+	c.lastUpdated = time.Now()
+
+	// Overwrite the oldest entry once the window is full
+	if len(c.window) < c.windowSize {
+		c.window = append(c.window, exec)
+	} else {
+		c.window[c.next] = exec
+	}
+	c.next = (c.next + 1) % c.windowSize
+}
+
+// snapshot computes QueryStats from the collected executions
+func (c *queryStatsCollector) snapshot() *QueryStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := &QueryStats{
+		TotalQueries:     c.totalQueries,
+		IndexUsage:       make(map[string]int64, len(c.indexUsage)),
+		PartitionsPruned: c.partitionsPruned,
+		RecordsScanned:   c.recordsScanned,
+		RecordsReturned:  c.recordsReturned,
+		TopQueries:       []QueryInfo{},
+		LastUpdated:      c.lastUpdated,
+	}
+
+	for name, uses := range c.indexUsage {
+		stats.IndexUsage[name] = uses
+	}
+
+	if len(c.window) == 0 {
+		return stats
+	}
+
+	latencies := make([]time.Duration, len(c.window))
+	var total time.Duration
+	var cacheHits int
+	for i, exec := range c.window {
+		latencies[i] = exec.duration
+		total += exec.duration
+		if exec.cacheHit {
+			cacheHits++
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.AverageLatency = total / time.Duration(len(latencies))
+	stats.CacheHitRate = float64(cacheHits) / float64(len(c.window))
+	stats.P95Latency = latencies[percentileIndex(len(latencies), 0.95)]
+	stats.TopQueries = c.topQueries()
+
+	return stats
+}
+
+// topQueries returns the slowest distinct queries in the window, keeping the
+// slowest execution of each query together with how often it ran
+func (c *queryStatsCollector) topQueries() []QueryInfo {
+	byQuery := make(map[string]*QueryInfo)
+	for _, exec := range c.window {
+		info, exists := byQuery[exec.query]
+		if !exists {
+			info = &QueryInfo{SQL: exec.query}
+			byQuery[exec.query] = info
+		}
+
+		info.Count++
+		if exec.duration >= info.ExecutionTime {
+			info.ExecutionTime = exec.duration
+			info.RecordsRead = exec.recordsScanned
+			info.Timestamp = exec.startTime
+		}
+	}
+
+	queries := make([]QueryInfo, 0, len(byQuery))
+	for _, info := range byQuery {
+		queries = append(queries, *info)
+	}
+
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].ExecutionTime != queries[j].ExecutionTime {
+			return queries[i].ExecutionTime > queries[j].ExecutionTime
+		}
+		return queries[i].SQL < queries[j].SQL
+	})
+
+	if len(queries) > topQueriesLimit {
+		queries = queries[:topQueriesLimit]
+	}
+
+	return queries
+}
+
+// percentileIndex returns the index of the given percentile in a sorted slice of length n
+func percentileIndex(n int, percentile float64) int {
+	index := int(math.Ceil(float64(n)*percentile)) - 1
+	if index < 0 {
+		return 0
+	}
+	if index >= n {
+		return n - 1
+	}
+	return index
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Data files store rows as JSON objects keyed by physical column name and are
+// read through a schema: columns missing from a row take their default value,
+// values are converted to the column types, and columns that are not bound to
+// an Exercise field, or were widened, are kept in Exercise.Extra under their
+// logical name. A column is bound by its physical name, so a renamed column
+// stays in its Exercise field.
+
+// exerciseFieldNames are the columns of the Exercise fields in their order
+var exerciseFieldNames = []string{"id", "name", "type", "duration", "calories", "date", "description"}
+
+// exerciseFieldTypes are the column types of the Exercise fields
+var exerciseFieldTypes = map[string]FieldType{
+	"id":          FieldTypeInt,
+	"name":        FieldTypeString,
+	"type":        FieldTypeString,
+	"duration":    FieldTypeInt,
+	"calories":    FieldTypeInt,
+	"date":        FieldTypeTimestamp,
+	"description": FieldTypeString,
+}
+
+// rowToExercise reads a stored row through a schema. Values that cannot be
+// converted to their column type are kept as they are.
+func rowToExercise(row map[string]interface{}, schema *Schema) loader.Exercise {
+	var exercise loader.Exercise
+	for _, field := range schema.Fields {
+		value, present := row[field.physicalName()]
+		if !present {
+			value = field.DefaultValue
+		}
+		if converted, err := convertField(value, field, field.Name, false); err == nil {
+			value = converted
+		}
+
+		if name, fieldType, bound := exerciseFieldOf(field, schema); bound {
+			if native, ok := convertValue(value, fieldType); ok {
+				setExerciseFieldValue(&exercise, name, native)
+			}
+			if field.Type == fieldType {
+				continue
+			}
+		}
+
+		if exercise.Extra == nil {
+			exercise.Extra = make(map[string]interface{})
+		}
+		exercise.Extra[field.Name] = value
+	}
+	return exercise
+}
+
+// exerciseToRow returns the row stored for an exercise under a schema. A
+// column takes its value from Extra, or else from the Exercise field it is
+// bound to; columns without a value are left out so that they read as their
+// default.
+func exerciseToRow(exercise loader.Exercise, schema *Schema) map[string]interface{} {
+	row := make(map[string]interface{}, len(schema.Fields))
+	for _, field := range schema.Fields {
+		value, ok := exercise.Extra[field.Name]
+		if !ok {
+			name, _, bound := exerciseFieldOf(field, schema)
+			if !bound {
+				continue
+			}
+			value, _ = exerciseStructValue(exercise, name)
+		}
+		if converted, err := convertField(value, field, field.Name, false); err == nil {
+			value = converted
+		}
+		row[field.physicalName()] = value
+	}
+	return row
+}
+
+// exerciseFieldOf returns the Exercise field bound to a column and its native
+// type: the field named like the column's physical name, so that it stays bound
+// when the column is renamed, or else the field named like the column when no
+// other column is bound to it.
+func exerciseFieldOf(field Field, schema *Schema) (string, FieldType, bool) {
+	if fieldType, ok := exerciseFieldTypes[field.physicalName()]; ok {
+		return field.physicalName(), fieldType, true
+	}
+	fieldType, ok := exerciseFieldTypes[field.Name]
+	if !ok {
+		return "", "", false
+	}
+	for _, other := range schema.Fields {
+		if other.physicalName() == field.Name {
+			return "", "", false
+		}
+	}
+	return field.Name, fieldType, true
+}
+
+// renamedFields returns the columns of a schema that hold an Exercise field
+// under another name, keyed by the name of the field
+func renamedFields(schema *Schema) map[string]string {
+	var names map[string]string
+	for _, field := range schema.Fields {
+		name, fieldType, bound := exerciseFieldOf(field, schema)
+		if !bound || name == field.Name || field.Type != fieldType {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]string)
+		}
+		names[name] = field.Name
+	}
+	return names
+}
+
+// columnView returns an exercise with the values of the Exercise fields held
+// by renamed columns also in Extra under the column names, so that filters,
+// expressions and constraints find them by name. Views are only evaluated,
+// never stored or returned.
+func columnView(exercise loader.Exercise, renamed map[string]string) loader.Exercise {
+	if len(renamed) == 0 {
+		return exercise
+	}
+	extra := make(map[string]interface{}, len(exercise.Extra)+len(renamed))
+	for name, value := range exercise.Extra {
+		extra[name] = value
+	}
+	for name, column := range renamed {
+		if _, ok := extra[column]; !ok {
+			extra[column], _ = exerciseStructValue(exercise, name)
+		}
+	}
+	exercise.Extra = extra
+	return exercise
+}
+
+// columnViews returns the views of rows under the current schema; see
+// columnView. The caller must hold the read lock.
+func (d *DeltaLakeRepository) columnViews(rows []loader.Exercise) []loader.Exercise {
+	renamed := renamedFields(d.currentSchema)
+	if len(renamed) == 0 {
+		return rows
+	}
+	views := make([]loader.Exercise, len(rows))
+	for i, row := range rows {
+		views[i] = columnView(row, renamed)
+	}
+	return views
+}
+
+// conformToSchema checks that the extra columns of a written exercise exist
+// in the schema and hold values of their type, nested values included, and
+// that it sets no Exercise field whose column was dropped. It returns the
+// exercise as it will read back. The caller must hold the read lock.
+func (d *DeltaLakeRepository) conformToSchema(exercise loader.Exercise) (loader.Exercise, error) {
+	if err := d.checkUnboundFields(exercise); err != nil {
+		return exercise, err
+	}
+
+	// Columns are checked in order so that the same one is reported every time
+	names := make([]string, 0, len(exercise.Extra))
+	for name := range exercise.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := exercise.Extra[name]
+		field, ok := d.schemaField(name)
+		if !ok {
+			return exercise, &UnknownColumnError{Column: name}
+		}
+		if value == nil {
+			if !field.Nullable {
+				return exercise, fmt.Errorf("column %s cannot be null", name)
+			}
+			continue
+		}
+		if _, err := convertField(value, field, name, true); err != nil {
+			return exercise, err
+		}
+	}
+
+	return rowToExercise(exerciseToRow(exercise, d.currentSchema), d.currentSchema), nil
+}
+
+// checkUnboundFields reports an error when an exercise sets an Exercise field
+// that no column of the current schema is bound to, as its value would not be
+// stored. IDs identify rows whatever the schema. The caller must hold the read
+// lock.
+func (d *DeltaLakeRepository) checkUnboundFields(exercise loader.Exercise) error {
+	bound := make(map[string]bool, len(d.currentSchema.Fields))
+	for _, field := range d.currentSchema.Fields {
+		if name, _, ok := exerciseFieldOf(field, d.currentSchema); ok {
+			bound[name] = true
+		}
+	}
+	for _, name := range exerciseFieldNames {
+		if bound[name] || name == "id" {
+			continue
+		}
+		if value, _ := exerciseStructValue(exercise, name); !isZeroFieldValue(value) {
+			return &UnknownColumnError{Column: name}
+		}
+	}
+	return nil
+}
+
+// UnknownColumnError reports a written value for a column the schema does not
+// have
+type UnknownColumnError struct {
+	Column string
+}
+
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf("unknown column %s", e.Column)
+}
+
+// RowChecker is implemented by repositories that store rows through a schema,
+// so that rows that do not fit it can be rejected on their own before a batch
+// is written
+type RowChecker interface {
+	CheckRow(exercise loader.Exercise) error
+}
+
+// CheckRow reports why an exercise does not fit the current schema, if it
+// does not
+func (d *DeltaLakeRepository) CheckRow(exercise loader.Exercise) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	_, err := d.conformToSchema(exercise)
+	return err
+}
+
+// CheckRecords adds to every readable record that does not fit the schema of
+// a repository the reason why, so that it is quarantined on its own rather
+// than failing the batch it is written with
+func CheckRecords(repo ExerciseRepository, records []loader.SourceRecord) {
+	checker, ok := repo.(RowChecker)
+	if !ok {
+		return
+	}
+	for i, record := range records {
+		if record.Errors.HasErrors() {
+			continue
+		}
+		if err := checker.CheckRow(record.Exercise); err != nil {
+			records[i].Errors = append(record.Errors, rowError(err))
+		}
+	}
+}
+
+// rowError converts the reason a row does not fit the schema to the error of
+// the column it concerns
+func rowError(err error) loader.ValidationError {
+	var unknown *UnknownColumnError
+	if errors.As(err, &unknown) {
+		return loader.ValidationError{Field: unknown.Column, Message: "is not a column of the table"}
+	}
+	return loader.ValidationError{Field: "record", Message: err.Error()}
+}
+
+// isZeroFieldValue reports whether a value of an Exercise field is unset
+func isZeroFieldValue(value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		return v == 0
+	case string:
+		return v == ""
+	case time.Time:
+		return v.IsZero()
+	}
+	return value == nil
+}
+
+// setExerciseFieldValue sets an Exercise field from a value of its column type
+func setExerciseFieldValue(exercise *loader.Exercise, field string, value interface{}) {
+	switch field {
+	case "id":
+		exercise.ID, _ = value.(int)
+	case "name":
+		exercise.Name, _ = value.(string)
+	case "type":
+		exercise.Type, _ = value.(string)
+	case "duration":
+		exercise.Duration, _ = value.(int)
+	case "calories":
+		exercise.Calories, _ = value.(int)
+	case "date":
+		exercise.Date, _ = value.(time.Time)
+	case "description":
+		exercise.Description, _ = value.(string)
+	}
+}
+
+// convertValue converts a value to a column type, reporting whether it could.
+// Null values convert to any type; nested types are left as they are.
+func convertValue(value interface{}, fieldType FieldType) (interface{}, bool) {
+	if value == nil {
+		return nil, true
+	}
+
+	switch fieldType {
+	case FieldTypeInt:
+		number, ok := toFloat(value)
+		if !ok || number != math.Trunc(number) || math.Abs(number) > 1<<53 {
+			return value, false
+		}
+		return int(number), true
+	case FieldTypeFloat:
+		number, ok := toFloat(value)
+		if !ok {
+			return value, false
+		}
+		return number, true
+	case FieldTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case bool:
+			return strconv.FormatBool(v), true
+		case time.Time:
+			return v.UTC().Format(time.RFC3339Nano), true
+		}
+		if number, ok := numericValue(value); ok {
+			return strconv.FormatFloat(number, 'f', -1, 64), true
+		}
+		return value, false
+	case FieldTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return value, false
+			}
+			return parsed, true
+		}
+		return value, false
+	case FieldTypeTimestamp, FieldTypeDate:
+		t, ok := toTime(value)
+		if !ok {
+			return value, false
+		}
+		return t, true
+	default:
+		return value, true
+	}
+}
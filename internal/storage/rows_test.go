@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evolveWith adds fields to the current schema and replaces the types of
+// existing ones
+func evolveWith(t *testing.T, repo *DeltaLakeRepository, fields ...Field) {
+	t.Helper()
+
+	schema, err := repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	for _, field := range fields {
+		replaced := false
+		for i := range schema.Fields {
+			if schema.Fields[i].Name == field.Name {
+				schema.Fields[i] = field
+				replaced = true
+			}
+		}
+		if !replaced {
+			schema.Fields = append(schema.Fields, field)
+		}
+	}
+	require.NoError(t, repo.EvolveSchema(context.Background(), schema))
+}
+
+func TestDeltaLakeRepository_AddedColumns(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	evolveWith(t, repo,
+		Field{Name: "intensity", Type: FieldTypeString, Nullable: true, DefaultValue: "moderate"},
+		Field{Name: "heart_rate", Type: FieldTypeInt, Nullable: true},
+	)
+
+	// Existing rows read the default of the added column
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assert.Equal(t, "moderate", all[0].Extra["intensity"])
+	assert.Nil(t, all[0].Extra["heart_rate"])
+
+	// New rows store values for the added columns
+	require.NoError(t, repo.Insert(loader.Exercise{
+		Name: "Rowing", Type: "cardio", Duration: 20, Calories: 200, Date: all[0].Date,
+		Extra: map[string]interface{}{"intensity": "high", "heart_rate": float64(150)},
+	}))
+
+	filter := Filter{Conditions: []Condition{{Field: "heart_rate", Operator: OperatorGreaterThan, Value: 100}}}
+	result, err := repo.UpdateWhere(ctx, filter, map[string]interface{}{"intensity": "peak"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Affected)
+
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	rows, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "intensity", Operator: OperatorEqual, Value: "peak"}}})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "Rowing", rows[0].Name)
+	assert.Equal(t, 150, rows[0].Extra["heart_rate"])
+
+	// Writes are checked against the schema
+	err = repo.Insert(loader.Exercise{Name: "Cycling", Extra: map[string]interface{}{"weather": "sunny"}})
+	assert.ErrorContains(t, err, "unknown column weather")
+	err = repo.Insert(loader.Exercise{Name: "Cycling", Extra: map[string]interface{}{"heart_rate": "fast"}})
+	assert.ErrorContains(t, err, "column heart_rate expects a int value")
+	_, err = repo.UpdateWhere(ctx, filter, map[string]interface{}{"weather": "sunny"})
+	assert.ErrorContains(t, err, "unknown column weather")
+	var unknown *UnknownColumnError
+	assert.ErrorAs(t, repo.CheckRow(loader.Exercise{Name: "Cycling", Extra: map[string]interface{}{"weather": "sunny"}}), &unknown)
+	assert.Equal(t, "weather", unknown.Column)
+
+	// Batches reject the rows that do not fit on their own
+	batch := []loader.Exercise{
+		{Name: "Cycling", Type: "cardio", Duration: 30, Calories: 250, Date: all[0].Date},
+		{Name: "Hiking", Type: "cardio", Duration: 90, Calories: 500, Date: all[0].Date, Extra: map[string]interface{}{"weather": "sunny"}},
+	}
+	batchResult, err := repo.InsertBatchWithOptions(ctx, batch, BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, batchResult.SuccessCount)
+	assert.Equal(t, 1, batchResult.ErrorCount)
+	assert.Equal(t, []BatchError{{Index: 1, Error: "unknown column weather", Record: "ID: 0, Name: Hiking", Column: "weather"}}, batchResult.Errors)
+
+	records := []loader.SourceRecord{{Exercise: batch[0]}, {Exercise: batch[1]}}
+	CheckRecords(repo, records)
+	assert.Empty(t, records[0].Errors)
+	assert.Equal(t, loader.ValidationErrors{{Field: "weather", Message: "is not a column of the table"}}, records[1].Errors)
+}
+
+func TestDeltaLakeRepository_WidenedColumns(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	evolveWith(t, repo, Field{Name: "calories", Type: FieldTypeFloat, Nullable: false})
+
+	// Existing rows are converted to the wider type on read
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assert.Equal(t, 300, all[0].Calories)
+	assert.Equal(t, float64(300), all[0].Extra["calories"])
+
+	require.NoError(t, repo.Insert(loader.Exercise{
+		Name: "Walking", Type: "cardio", Duration: 30, Date: all[0].Date,
+		Extra: map[string]interface{}{"calories": 120.5},
+	}))
+	walking, err := repo.QueryWithFilter(context.Background(), Filter{Conditions: []Condition{{Field: "name", Operator: OperatorEqual, Value: "Walking"}}})
+	require.NoError(t, err)
+	require.Len(t, walking, 1)
+	assert.Equal(t, 120.5, walking[0].Extra["calories"])
+}
+
+func TestDeltaLakeRepository_SchemaHistory(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	before := repo.currentVersion
+
+	evolveWith(t, repo, Field{Name: "intensity", Type: FieldTypeString, Nullable: true, DefaultValue: "moderate"})
+	evolveWith(t, repo, Field{Name: "calories", Type: FieldTypeFloat, Nullable: false})
+
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	history, err := repo.GetSchemaHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for i, schema := range history {
+		assert.EqualValues(t, i+1, schema.ID)
+	}
+	assert.Len(t, history[0].Fields, 7)
+	assert.Len(t, history[1].Fields, 8)
+
+	changes := SchemaChanges(&history[1], &history[2])
+	assert.Equal(t, []string{"calories"}, changes["modified_fields"])
+	assert.Empty(t, changes["added_fields"])
+
+	// Time travel reads a version through the schema it was written with
+	old, err := repo.GetByVersion(ctx, before)
+	require.NoError(t, err)
+	require.Len(t, old, 4)
+	assert.Nil(t, old[0].Extra)
+
+	current, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, "moderate", current[0].Extra["intensity"])
+	assert.Equal(t, float64(300), current[0].Extra["calories"])
+}
+
+func TestDeltaLakeRepository_SchemaCannotDropID(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+
+	schema, err := repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	schema.Fields = schema.Fields[1:]
+	assert.ErrorContains(t, repo.EvolveSchema(context.Background(), schema), "id")
+
+	schema, err = repo.GetCurrentSchema(context.Background())
+	require.NoError(t, err)
+	schema.Fields = append(schema.Fields, schema.Fields[1])
+	assert.ErrorContains(t, repo.EvolveSchema(context.Background(), schema), "listed more than once")
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		value     interface{}
+		fieldType FieldType
+		expected  interface{}
+		ok        bool
+	}{
+		{float64(3), FieldTypeInt, 3, true},
+		{3.5, FieldTypeInt, 3.5, false},
+		{"12", FieldTypeInt, 12, true},
+		{7, FieldTypeFloat, float64(7), true},
+		{42, FieldTypeString, "42", true},
+		{"true", FieldTypeBoolean, true, true},
+		{"maybe", FieldTypeBoolean, "maybe", false},
+		{nil, FieldTypeInt, nil, true},
+		{[]interface{}{1}, FieldTypeArray, []interface{}{1}, true},
+	}
+
+	for _, tt := range tests {
+		converted, ok := convertValue(tt.value, tt.fieldType)
+		assert.Equal(t, tt.ok, ok, "%v as %s", tt.value, tt.fieldType)
+		assert.Equal(t, tt.expected, converted, "%v as %s", tt.value, tt.fieldType)
+	}
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// Schema merging lets a load add the columns its records have and the table
+// does not. The type of each new column is inferred from its values: text is
+// read as the narrowest type every value parses as, JSON objects become
+// structs and JSON arrays become arrays of their unified element type. Values
+// that disagree on a scalar type widen to float or, failing that, string. A
+// column a load added is widened the same way when a later batch of the load
+// has values it cannot hold.
+
+// mergeSchemaLocked adds a nullable column to the schema for every unknown
+// column of the writes and widens the merged columns, those earlier batches of
+// the load added, that cannot hold their values. It returns the operation that
+// records the change, or nil when the schema is unchanged. Added columns are
+// recorded in merged when it is not nil. The caller must hold the write lock
+// and commit a version with the new schema.
+func (d *DeltaLakeRepository) mergeSchemaLocked(writes []loader.Exercise, merged map[string]bool) (*Operation, error) {
+	newSchema, err := d.mergedSchema(writes, merged)
+	if err != nil || newSchema == nil {
+		return nil, err
+	}
+
+	operation, err := d.installSchemaLocked(newSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// mergedSchema returns a copy of the current schema with the unknown columns
+// of the exercises added and the merged columns widened, or nil when neither
+// is needed. The caller must hold the read lock.
+func (d *DeltaLakeRepository) mergedSchema(exercises []loader.Exercise, merged map[string]bool) (*Schema, error) {
+	values := make(map[string][]interface{})
+	for _, exercise := range exercises {
+		for name, value := range exercise.Extra {
+			if _, known := d.schemaField(name); !known || merged[name] {
+				values[name] = append(values[name], value)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	newSchema := *d.currentSchema
+	newSchema.Fields = append([]Field{}, d.currentSchema.Fields...)
+	changed := false
+	for _, name := range names {
+		field, err := inferField(values[name], name)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, known := schemaFieldIndex(&newSchema, name); known {
+			current := newSchema.Fields[i]
+			if holdsValues(current, values[name]) {
+				continue
+			}
+			widened, err := widenField(current, field, name)
+			if err != nil {
+				return nil, err
+			}
+			current.Type, current.Element, current.Fields = widened.Type, widened.Element, widened.Fields
+			newSchema.Fields[i] = completeField(current)
+			changed = true
+			continue
+		}
+
+		field.Name = name
+		newSchema.Fields = append(newSchema.Fields, field)
+		if merged != nil {
+			merged[name] = true
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+	return &newSchema, nil
+}
+
+// schemaFieldIndex returns the position of the top-level field of a schema
+// named name
+func schemaFieldIndex(schema *Schema, name string) (int, bool) {
+	for i, field := range schema.Fields {
+		if field.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// holdsValues reports whether a column holds every value without widening
+func holdsValues(field Field, values []interface{}) bool {
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		if _, err := convertField(value, field, field.Name, true); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// inferField infers a nullable field that holds all the values; path names
+// the column in errors. A column of nulls and empty arrays holds strings.
+func inferField(values []interface{}, path string) (Field, error) {
+	var inferred *Field
+	for _, value := range values {
+		field, ok := inferValueField(value)
+		if !ok {
+			continue
+		}
+		if inferred == nil {
+			inferred = &field
+			continue
+		}
+		widened, err := widenField(*inferred, field, path)
+		if err != nil {
+			return Field{}, err
+		}
+		inferred = &widened
+	}
+	if inferred == nil {
+		return Field{Type: FieldTypeString, Nullable: true}, nil
+	}
+	return completeField(*inferred), nil
+}
+
+// inferValueField infers the field of a single value, reporting false for
+// nulls. Arrays without elements have no element type yet.
+func inferValueField(value interface{}) (Field, bool) {
+	switch v := value.(type) {
+	case nil:
+		return Field{}, false
+	case bool:
+		return Field{Type: FieldTypeBoolean, Nullable: true}, true
+	case string:
+		return Field{Type: inferTextType(v), Nullable: true}, true
+	case time.Time:
+		return Field{Type: FieldTypeTimestamp, Nullable: true}, true
+	case []interface{}:
+		field := Field{Type: FieldTypeArray, Nullable: true}
+		for _, item := range v {
+			element, ok := inferValueField(item)
+			if !ok {
+				continue
+			}
+			if field.Element == nil {
+				field.Element = &element
+				continue
+			}
+			widened, err := widenField(*field.Element, element, "")
+			if err != nil {
+				// Mixed elements can only be kept as text
+				widened = Field{Type: FieldTypeString, Nullable: true}
+			}
+			field.Element = &widened
+		}
+		return field, true
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		field := Field{Type: FieldTypeStruct, Nullable: true}
+		for _, key := range keys {
+			child, ok := inferValueField(v[key])
+			if !ok {
+				child = Field{Type: FieldTypeString, Nullable: true}
+			}
+			child.Name = key
+			field.Fields = append(field.Fields, child)
+		}
+		return field, true
+	}
+
+	if number, ok := numericValue(value); ok {
+		if number == math.Trunc(number) && math.Abs(number) <= 1<<53 {
+			return Field{Type: FieldTypeInt, Nullable: true}, true
+		}
+		return Field{Type: FieldTypeFloat, Nullable: true}, true
+	}
+	return Field{Type: FieldTypeString, Nullable: true}, true
+}
+
+// inferTextType returns the narrowest type a text value parses as
+func inferTextType(text string) FieldType {
+	text = strings.TrimSpace(text)
+	if _, err := strconv.ParseInt(text, 10, 54); err == nil {
+		return FieldTypeInt
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return FieldTypeFloat
+	}
+	if strings.EqualFold(text, "true") || strings.EqualFold(text, "false") {
+		return FieldTypeBoolean
+	}
+	if _, err := time.Parse("2006-01-02", text); err == nil {
+		return FieldTypeDate
+	}
+	if _, ok := toTime(text); ok {
+		return FieldTypeTimestamp
+	}
+	return FieldTypeString
+}
+
+// widenField returns a field that holds the values of both fields
+func widenField(a, b Field, path string) (Field, error) {
+	if a.Type != b.Type && (isNestedType(a.Type) || isNestedType(b.Type)) {
+		return Field{}, fmt.Errorf("column %s has both %s and %s values", path, a.Type, b.Type)
+	}
+
+	widened := Field{Name: a.Name, Type: a.Type, Nullable: true}
+	switch {
+	case a.Type == FieldTypeArray:
+		widened.Element = a.Element
+		if a.Element == nil {
+			widened.Element = b.Element
+		} else if b.Element != nil {
+			element, err := widenField(*a.Element, *b.Element, path+"[]")
+			if err != nil {
+				return Field{}, err
+			}
+			widened.Element = &element
+		}
+	case a.Type == FieldTypeStruct:
+		widened.Fields = append([]Field{}, a.Fields...)
+		for _, child := range b.Fields {
+			existing, ok := structField(widened, child.Name)
+			if !ok {
+				widened.Fields = append(widened.Fields, child)
+				continue
+			}
+			merged, err := widenField(existing, child, path+"."+child.Name)
+			if err != nil {
+				return Field{}, err
+			}
+			for i := range widened.Fields {
+				if widened.Fields[i].Name == child.Name {
+					widened.Fields[i] = merged
+				}
+			}
+		}
+	case a.Type == b.Type:
+	case isNumericType(a.Type) && isNumericType(b.Type):
+		widened.Type = FieldTypeFloat
+	case isTimeType(a.Type) && isTimeType(b.Type):
+		widened.Type = FieldTypeTimestamp
+	default:
+		widened.Type = FieldTypeString
+	}
+	return widened, nil
+}
+
+// completeField gives arrays without an inferred element type string elements
+func completeField(field Field) Field {
+	switch field.Type {
+	case FieldTypeArray:
+		element := Field{Type: FieldTypeString, Nullable: true}
+		if field.Element != nil {
+			element = completeField(*field.Element)
+		}
+		field.Element = &element
+	case FieldTypeStruct:
+		fields := make([]Field, len(field.Fields))
+		for i, child := range field.Fields {
+			fields[i] = completeField(child)
+		}
+		field.Fields = fields
+	}
+	return field
+}
+
+func isNestedType(fieldType FieldType) bool {
+	return fieldType == FieldTypeArray || fieldType == FieldTypeMap || fieldType == FieldTypeStruct
+}
+
+func isNumericType(fieldType FieldType) bool {
+	return fieldType == FieldTypeInt || fieldType == FieldTypeFloat
+}
+
+func isTimeType(fieldType FieldType) bool {
+	return fieldType == FieldTypeDate || fieldType == FieldTypeTimestamp
+}
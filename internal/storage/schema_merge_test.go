@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_BulkLoadMergeSchema(t *testing.T) {
+	basePath := t.TempDir()
+	repo, err := NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+	before := repo.currentVersion
+
+	jsonFile := filepath.Join(t.TempDir(), "exercises.json")
+	content := `[
+  {"name": "Rowing", "type": "cardio", "duration": 20, "calories": 200, "date": "2024-01-20T00:00:00Z",
+   "heart_rate": 150, "device": {"model": "watch"}, "laps": [1.5, 2]},
+  {"name": "Squat", "type": "strength", "duration": 15, "calories": 90, "date": "2024-01-21T00:00:00Z",
+   "heart_rate": 110.5, "device": {"model": "phone", "os": "android"}}
+]`
+	require.NoError(t, os.WriteFile(jsonFile, []byte(content), 0644))
+	source := DataSource{Type: DataSourceFile, Location: jsonFile, Format: DataFormatJSON}
+
+	// Without merging, records with unknown columns are reported on their own
+	result, err := repo.BulkLoad(ctx, source, BulkLoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, result.RecordsLoaded)
+	assert.Equal(t, int64(2), result.RecordsErrored)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, BulkError{Line: 2, Column: "device", Error: "unknown column device", Content: "ID: 0, Name: Rowing"}, result.Errors[0])
+	assert.Equal(t, before, repo.currentVersion)
+
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{MergeSchema: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.RecordsLoaded)
+
+	// The new columns and their values are one commit
+	assert.Equal(t, before+1, result.Version)
+	version := repo.versions[result.Version]
+	assert.Equal(t, repo.currentSchema.ID, version.SchemaID)
+	assert.Equal(t, OperationTypeSchema, version.Operations[0].Type)
+
+	heartRate, ok := repo.schemaField("heart_rate")
+	require.True(t, ok)
+	assert.Equal(t, FieldTypeFloat, heartRate.Type)
+	assert.True(t, heartRate.Nullable)
+	device, ok := repo.schemaField("device")
+	require.True(t, ok)
+	assert.Equal(t, FieldTypeStruct, device.Type)
+	assert.Len(t, device.Fields, 2)
+	laps, ok := repo.schemaField("laps")
+	require.True(t, ok)
+	assert.Equal(t, FieldTypeFloat, laps.Element.Type)
+
+	require.NoError(t, repo.Close())
+	repo, err = NewDeltaLakeRepository(basePath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	rows, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "device.model", Operator: OperatorEqual, Value: "phone"}}})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "Squat", rows[0].Name)
+	assert.Equal(t, 110.5, rows[0].Extra["heart_rate"])
+
+	// Existing rows read the new columns as null
+	old, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "heart_rate", Operator: OperatorIsNull}}})
+	require.NoError(t, err)
+	assert.Len(t, old, 4)
+}
+
+func TestDeltaLakeRepository_BulkLoadMergeSchemaCSV(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+
+	csvFile := filepath.Join(t.TempDir(), "exercises.csv")
+	content := "id,name,type,duration,calories,date,description,heart_rate,pace,outdoor,recorded_on,notes\n" +
+		"1,Morning Run,cardio,30,300,2024-01-15,Easy jog,150,5.5,true,2024-01-15,sunny\n" +
+		"2,Swimming,cardio,45,400,2024-01-16,Laps,,6,false,2024-01-16,12\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(content), 0644))
+
+	source := DataSource{Type: DataSourceFile, Location: csvFile, Format: DataFormatCSV}
+	_, err := repo.BulkLoad(ctx, source, BulkLoadOptions{MergeSchema: true})
+	require.NoError(t, err)
+
+	expected := map[string]FieldType{
+		"heart_rate":  FieldTypeInt,
+		"pace":        FieldTypeFloat,
+		"outdoor":     FieldTypeBoolean,
+		"recorded_on": FieldTypeDate,
+		"notes":       FieldTypeString,
+	}
+	for name, fieldType := range expected {
+		field, ok := repo.schemaField(name)
+		require.True(t, ok, name)
+		assert.Equal(t, fieldType, field.Type, name)
+	}
+
+	rows, err := repo.QueryWithFilter(ctx, Filter{Conditions: []Condition{{Field: "heart_rate", Operator: OperatorGreaterThan, Value: 100}}})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "Morning Run", rows[0].Name)
+	assert.Equal(t, true, rows[0].Extra["outdoor"])
+}
+
+func TestDeltaLakeRepository_BulkLoadMergeSchemaBatches(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.InsertBatch(sampleExercises()))
+
+	// The second batch widens the column the first one added
+	ndjsonFile := filepath.Join(t.TempDir(), "runs.ndjson")
+	content := `{"name": "Run a", "type": "cardio", "heart_rate": 120, "zone": 2}
+{"name": "Run b", "type": "cardio", "heart_rate": 130, "zone": 3}
+{"name": "Run c", "type": "cardio", "heart_rate": 135.5, "zone": "high"}
+`
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(content), 0644))
+	source := DataSource{Type: DataSourceFile, Location: ndjsonFile, Format: DataFormatNDJSON}
+
+	result, err := repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 2, MergeSchema: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.RecordsLoaded)
+
+	heartRate, ok := repo.schemaField("heart_rate")
+	require.True(t, ok)
+	assert.Equal(t, FieldTypeFloat, heartRate.Type)
+	zone, ok := repo.schemaField("zone")
+	require.True(t, ok)
+	assert.Equal(t, FieldTypeString, zone.Type)
+
+	runs, err := repo.QueryWithFilter(ctx, Filter{
+		Conditions: []Condition{{Field: "heart_rate", Operator: OperatorGreaterThan, Value: 100}},
+		SortBy:     []SortField{{Field: "heart_rate"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, []interface{}{float64(120), float64(130), 135.5},
+		[]interface{}{runs[0].Extra["heart_rate"], runs[1].Extra["heart_rate"], runs[2].Extra["heart_rate"]})
+	assert.Equal(t, []interface{}{"2", "3", "high"}, []interface{}{runs[0].Extra["zone"], runs[1].Extra["zone"], runs[2].Extra["zone"]})
+
+	// Columns added by an earlier load keep their type
+	require.NoError(t, os.WriteFile(ndjsonFile, []byte(`{"name": "Run d", "type": "cardio", "zone": 4}
+{"name": "Run e", "type": "cardio", "heart_rate": "fast"}
+`), 0644))
+	result, err = repo.BulkLoad(ctx, source, BulkLoadOptions{BatchSize: 1, MergeSchema: true})
+	assert.ErrorContains(t, err, "column heart_rate expects a float value")
+	assert.Equal(t, int64(1), result.RecordsLoaded)
+	heartRate, _ = repo.schemaField("heart_rate")
+	assert.Equal(t, FieldTypeFloat, heartRate.Type)
+}
+
+func TestDeltaLakeRepository_MergeSchemaErrors(t *testing.T) {
+	repo := newTestDeltaLake(t, nil)
+	ctx := context.Background()
+	require.NoError(t, repo.AddConstraint(ctx, Constraint{
+		Name:       "positive_duration",
+		Type:       ConstraintTypeRange,
+		Expression: "duration > 0",
+	}))
+	schemaID := repo.currentSchema.ID
+
+	exercise := sampleExercises()[0]
+	exercise.ID = 0
+
+	// Values that cannot share a type fail the merge
+	conflicting := []loader.Exercise{exercise, exercise}
+	conflicting[0].Extra = map[string]interface{}{"gear": "shoes"}
+	conflicting[1].Extra = map[string]interface{}{"gear": []interface{}{"shoes"}}
+	_, err := repo.InsertBatchWithOptions(ctx, conflicting, BatchOptions{MergeSchema: true})
+	assert.ErrorContains(t, err, "column gear has both string and array values")
+
+	// A commit that fails keeps the schema it started with
+	invalid := exercise
+	invalid.Duration = -5
+	invalid.Extra = map[string]interface{}{"gear": "shoes"}
+	_, err = repo.InsertBatchWithOptions(ctx, []loader.Exercise{invalid}, BatchOptions{MergeSchema: true})
+	assert.ErrorContains(t, err, "positive_duration")
+	assert.Equal(t, schemaID, repo.currentSchema.ID)
+	_, ok := repo.schemaField("gear")
+	assert.False(t, ok)
+	assert.Len(t, repo.schemas, 1)
+}
+
+func TestInferField(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []interface{}
+		expected Field
+	}{
+		{name: "nulls", values: []interface{}{nil}, expected: Field{Type: FieldTypeString, Nullable: true}},
+		{name: "integers", values: []interface{}{float64(1), "2"}, expected: Field{Type: FieldTypeInt, Nullable: true}},
+		{name: "numbers", values: []interface{}{float64(1), 2.5}, expected: Field{Type: FieldTypeFloat, Nullable: true}},
+		{name: "dates and timestamps", values: []interface{}{"2024-01-15", "2024-01-15T10:00:00Z"}, expected: Field{Type: FieldTypeTimestamp, Nullable: true}},
+		{name: "mixed scalars", values: []interface{}{true, float64(3)}, expected: Field{Type: FieldTypeString, Nullable: true}},
+		{name: "empty array", values: []interface{}{[]interface{}{}}, expected: Field{Type: FieldTypeArray, Nullable: true, Element: &Field{Type: FieldTypeString, Nullable: true}}},
+		{name: "structs", values: []interface{}{
+			map[string]interface{}{"reps": float64(5)},
+			map[string]interface{}{"weight": 20.5},
+		}, expected: Field{Type: FieldTypeStruct, Nullable: true, Fields: []Field{
+			{Name: "reps", Type: FieldTypeInt, Nullable: true},
+			{Name: "weight", Type: FieldTypeFloat, Nullable: true},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, err := inferField(tt.values, "column")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, field)
+		})
+	}
+}
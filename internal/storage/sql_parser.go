@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SQL support for DeltaLakeRepository. Statements are translated into a Filter
+// so they share planning, caching and statistics with QueryWithFilter.
+
+// sqlTokenKind classifies lexical tokens of a SQL statement
+type sqlTokenKind int
+
+const (
+	sqlTokenEOF sqlTokenKind = iota
+	sqlTokenIdent
+	sqlTokenNumber
+	sqlTokenString
+	sqlTokenSymbol
+	sqlTokenParam
+)
+
+// sqlToken is a lexical token with its position in the statement
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+// sqlParser parses a tokenized statement
+type sqlParser struct {
+	tokens    []sqlToken
+	pos       int
+	params    []interface{}
+	nextParam int
+}
+
+// ParseSQL converts a SELECT statement over the exercises table into a Filter.
+// The supported grammar is
+//
+//	SELECT * FROM exercises
+//	  [WHERE condition [AND condition ...]]
+//	  [ORDER BY column [ASC|DESC], ...]
+//	  [LIMIT n] [OFFSET n]
+//
+// where a condition is one of column op value (=, !=, <>, <, <=, >, >=),
+// column [NOT] IN (values), column [NOT] LIKE value, column IS [NOT] NULL or
+// column BETWEEN value AND value. Values are literals or placeholders bound
+// to params, either positional (?) or numbered ($1).
+func ParseSQL(sql string, params ...interface{}) (Filter, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return Filter{}, err
+	}
+
+	parser := &sqlParser{tokens: tokens, params: params}
+	return parser.parseSelect()
+}
+
+// tokenizeSQL splits a statement into tokens
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	runes := []rune(sql)
+	tokens := make([]sqlToken, 0)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenIdent, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenNumber, text: string(runes[start:i]), pos: start})
+		case r == '\'':
+			var builder strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					// A doubled quote is an escaped quote
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						builder.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				builder.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenString, text: builder.String(), pos: start})
+		case r == '?':
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenParam, text: "?", pos: start})
+		case r == '$':
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			if i == start+1 {
+				return nil, fmt.Errorf("invalid placeholder at position %d", start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenParam, text: string(runes[start:i]), pos: start})
+		case strings.ContainsRune("<>!", r):
+			i++
+			if i < len(runes) && (runes[i] == '=' || (r == '<' && runes[i] == '>')) {
+				i++
+			}
+			symbol := string(runes[start:i])
+			if symbol == "!" {
+				return nil, fmt.Errorf("unexpected character '!' at position %d", start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenSymbol, text: symbol, pos: start})
+		case strings.ContainsRune("*,();=-+/", r):
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenSymbol, text: string(r), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, start)
+		}
+	}
+
+	tokens = append(tokens, sqlToken{kind: sqlTokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// parseSelect parses a complete SELECT statement
+func (p *sqlParser) parseSelect() (Filter, error) {
+	filter := Filter{Conditions: []Condition{}}
+
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return filter, err
+	}
+	if !p.symbol("*") {
+		return filter, fmt.Errorf("only SELECT * is supported")
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return filter, err
+	}
+	table := p.next()
+	if table.kind != sqlTokenIdent || !strings.EqualFold(table.text, "exercises") {
+		return filter, fmt.Errorf("unknown table %q", table.text)
+	}
+
+	if p.keyword("WHERE") {
+		for {
+			condition, err := p.parseCondition()
+			if err != nil {
+				return filter, err
+			}
+			filter.Conditions = append(filter.Conditions, condition)
+
+			if p.keyword("OR") {
+				return filter, fmt.Errorf("OR conditions are not supported")
+			}
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return filter, err
+		}
+		for {
+			field, err := p.parseIdent()
+			if err != nil {
+				return filter, err
+			}
+			order := SortOrderAsc
+			if p.keyword("DESC") {
+				order = SortOrderDesc
+			} else {
+				p.keyword("ASC")
+			}
+			filter.SortBy = append(filter.SortBy, SortField{Field: field, Order: order})
+
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.keyword("LIMIT") {
+		limit, err := p.parseCount("LIMIT")
+		if err != nil {
+			return filter, err
+		}
+		filter.Limit = &limit
+	}
+	if p.keyword("OFFSET") {
+		offset, err := p.parseCount("OFFSET")
+		if err != nil {
+			return filter, err
+		}
+		filter.Offset = &offset
+	}
+
+	p.symbol(";")
+	if token := p.peek(); token.kind != sqlTokenEOF {
+		return filter, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+	}
+
+	return filter, nil
+}
+
+// parseCondition parses a single predicate of the WHERE clause
+func (p *sqlParser) parseCondition() (Condition, error) {
+	field, err := p.parseIdent()
+	if err != nil {
+		return Condition{}, err
+	}
+	condition := Condition{Field: field}
+
+	if token := p.peek(); token.kind == sqlTokenSymbol {
+		operators := map[string]Operator{
+			"=":  OperatorEqual,
+			"!=": OperatorNotEqual,
+			"<>": OperatorNotEqual,
+			"<":  OperatorLessThan,
+			"<=": OperatorLessThanOrEqual,
+			">":  OperatorGreaterThan,
+			">=": OperatorGreaterThanOrEqual,
+		}
+		operator, ok := operators[token.text]
+		if !ok {
+			return condition, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+		}
+		p.next()
+		condition.Operator = operator
+		condition.Value, err = p.parseValue()
+		return condition, err
+	}
+
+	switch {
+	case p.keyword("IS"):
+		condition.Operator = OperatorIsNull
+		if p.keyword("NOT") {
+			condition.Operator = OperatorIsNotNull
+		}
+		return condition, p.expectKeyword("NULL")
+	case p.keyword("BETWEEN"):
+		lower, err := p.parseValue()
+		if err != nil {
+			return condition, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return condition, err
+		}
+		upper, err := p.parseValue()
+		if err != nil {
+			return condition, err
+		}
+		condition.Operator = OperatorBetween
+		condition.Value = []interface{}{lower, upper}
+		return condition, nil
+	}
+
+	negated := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		condition.Operator = OperatorIn
+		if negated {
+			condition.Operator = OperatorNotIn
+		}
+		condition.Value, err = p.parseValueList()
+		return condition, err
+	case p.keyword("LIKE"):
+		condition.Operator = OperatorLike
+		if negated {
+			condition.Operator = OperatorNotLike
+		}
+		condition.Value, err = p.parseValue()
+		return condition, err
+	}
+
+	token := p.peek()
+	return condition, fmt.Errorf("expected operator after %s at position %d", field, token.pos)
+}
+
+// parseValueList parses a parenthesized, comma separated list of values
+func (p *sqlParser) parseValueList() ([]interface{}, error) {
+	if !p.symbol("(") {
+		return nil, fmt.Errorf("expected ( at position %d", p.peek().pos)
+	}
+
+	values := make([]interface{}, 0)
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.symbol(")") {
+			return values, nil
+		}
+		if !p.symbol(",") {
+			return nil, fmt.Errorf("expected , or ) at position %d", p.peek().pos)
+		}
+	}
+}
+
+// parseValue parses a literal or a placeholder
+func (p *sqlParser) parseValue() (interface{}, error) {
+	negative := p.symbol("-")
+	token := p.next()
+
+	if negative && token.kind != sqlTokenNumber {
+		return nil, fmt.Errorf("expected number at position %d", token.pos)
+	}
+
+	switch token.kind {
+	case sqlTokenNumber:
+		text := token.text
+		if negative {
+			text = "-" + text
+		}
+		if number, err := strconv.Atoi(text); err == nil {
+			return number, nil
+		}
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", token.text, token.pos)
+		}
+		return number, nil
+	case sqlTokenString:
+		return token.text, nil
+	case sqlTokenParam:
+		return p.bindParam(token)
+	case sqlTokenIdent:
+		switch strings.ToUpper(token.text) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		case "NULL":
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("expected value at position %d", token.pos)
+}
+
+// bindParam returns the parameter referenced by a placeholder
+func (p *sqlParser) bindParam(token sqlToken) (interface{}, error) {
+	index := p.nextParam
+	if token.text == "?" {
+		p.nextParam++
+	} else {
+		number, err := strconv.Atoi(token.text[1:])
+		if err != nil || number < 1 {
+			return nil, fmt.Errorf("invalid placeholder %s", token.text)
+		}
+		index = number - 1
+	}
+
+	if index >= len(p.params) {
+		return nil, fmt.Errorf("missing parameter for placeholder %s at position %d", token.text, token.pos)
+	}
+	return p.params[index], nil
+}
+
+// parseCount parses the non-negative integer of a LIMIT or OFFSET clause
+func (p *sqlParser) parseCount(clause string) (int, error) {
+	value, err := p.parseValue()
+	if err != nil {
+		return 0, err
+	}
+
+	number, ok := numericValue(value)
+	if !ok || number < 0 || number != float64(int(number)) {
+		return 0, fmt.Errorf("%s must be a non-negative integer", clause)
+	}
+	return int(number), nil
+}
+
+// parseIdent parses a column name
+func (p *sqlParser) parseIdent() (string, error) {
+	token := p.next()
+	if token.kind != sqlTokenIdent {
+		return "", fmt.Errorf("expected column name at position %d", token.pos)
+	}
+	return strings.ToLower(token.text), nil
+}
+
+// peek returns the current token without consuming it
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != sqlTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// keyword consumes the current token if it is the given keyword
+func (p *sqlParser) keyword(word string) bool {
+	token := p.peek()
+	if token.kind == sqlTokenIdent && strings.EqualFold(token.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the given keyword or fails
+func (p *sqlParser) expectKeyword(word string) error {
+	if !p.keyword(word) {
+		token := p.peek()
+		return fmt.Errorf("expected %s at position %d", word, token.pos)
+	}
+	return nil
+}
+
+// symbol consumes the current token if it is the given symbol
+func (p *sqlParser) symbol(text string) bool {
+	token := p.peek()
+	if token.kind == sqlTokenSymbol && token.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSQL(t *testing.T) {
+	limit, offset := 10, 5
+
+	tests := []struct {
+		name     string
+		sql      string
+		params   []interface{}
+		expected Filter
+	}{
+		{
+			name:     "select all",
+			sql:      "SELECT * FROM exercises",
+			expected: Filter{Conditions: []Condition{}},
+		},
+		{
+			name: "conditions, ordering and paging",
+			sql:  "select * from exercises where type = 'cardio' and calories >= 200 order by date desc, name limit 10 offset 5;",
+			expected: Filter{
+				Conditions: []Condition{
+					{Field: "type", Operator: OperatorEqual, Value: "cardio"},
+					{Field: "calories", Operator: OperatorGreaterThanOrEqual, Value: 200},
+				},
+				SortBy: []SortField{{Field: "date", Order: SortOrderDesc}, {Field: "name", Order: SortOrderAsc}},
+				Limit:  &limit,
+				Offset: &offset,
+			},
+		},
+		{
+			name: "list, pattern, null and range predicates",
+			sql:  "SELECT * FROM exercises WHERE type NOT IN ('yoga', 'pilates') AND name LIKE 'Run%' AND description IS NOT NULL AND duration BETWEEN 10 AND 45.5",
+			expected: Filter{Conditions: []Condition{
+				{Field: "type", Operator: OperatorNotIn, Value: []interface{}{"yoga", "pilates"}},
+				{Field: "name", Operator: OperatorLike, Value: "Run%"},
+				{Field: "description", Operator: OperatorIsNotNull},
+				{Field: "duration", Operator: OperatorBetween, Value: []interface{}{10, 45.5}},
+			}},
+		},
+		{
+			name:   "placeholders",
+			sql:    "SELECT * FROM exercises WHERE name <> $2 AND calories < ? AND date > '2024-01-01'",
+			params: []interface{}{300, "Yoga"},
+			expected: Filter{Conditions: []Condition{
+				{Field: "name", Operator: OperatorNotEqual, Value: "Yoga"},
+				{Field: "calories", Operator: OperatorLessThan, Value: 300},
+				{Field: "date", Operator: OperatorGreaterThan, Value: "2024-01-01"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseSQL(tt.sql, tt.params...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter)
+		})
+	}
+}
+
+func TestParseSQL_Errors(t *testing.T) {
+	invalid := []string{
+		"DELETE FROM exercises",
+		"SELECT name FROM exercises",
+		"SELECT * FROM users",
+		"SELECT * FROM exercises WHERE type = 'cardio' OR type = 'strength'",
+		"SELECT * FROM exercises WHERE name = 'unterminated",
+		"SELECT * FROM exercises WHERE calories > ?",
+		"SELECT * FROM exercises LIMIT -1",
+		"SELECT * FROM exercises WHERE type",
+		"SELECT * FROM exercises extra",
+	}
+
+	for _, sql := range invalid {
+		_, err := ParseSQL(sql)
+		assert.Error(t, err, sql)
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+)
+
+// ValidationRulesProperty is the table property holding the JSON validation
+// rules of a table; without it the default rules apply
+const ValidationRulesProperty = "validation.rules"
+
+// ValidatorProvider is implemented by repositories that keep validation rules
+// with their data, so that every writer validates against the same rules
+type ValidatorProvider interface {
+	Validator() *loader.Validator
+}
+
+// Validator returns the validator built from the table's rules; it reports
+// the errors of renamed columns under their current names
+func (d *DeltaLakeRepository) Validator() *loader.Validator {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.validator
+}
+
+// GetValidationRules returns the validation rules of the table
+func (d *DeltaLakeRepository) GetValidationRules(ctx context.Context) (*loader.ValidationRules, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	rules := d.validator.Rules()
+	return &rules, nil
+}
+
+// SetValidationRules replaces the validation rules of the table and stores
+// them in its properties
+func (d *DeltaLakeRepository) SetValidationRules(ctx context.Context, rules loader.ValidationRules) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal validation rules: %w", err)
+	}
+	return d.UpdateTableProperties(ctx, map[string]string{ValidationRulesProperty: string(data)})
+}
+
+// validatorFromProperties builds the validator described by the table
+// properties; an empty rules property restores the defaults
+func validatorFromProperties(properties map[string]string) (*loader.Validator, error) {
+	data := properties[ValidationRulesProperty]
+	if data == "" {
+		return loader.NewValidator(), nil
+	}
+
+	rules, err := loader.ParseValidationRules([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	validator, err := loader.NewValidatorWithRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation rules: %w", err)
+	}
+	return validator, nil
+}
+
+// applyTableProperties validates and stores updated table properties. The
+// caller must hold the write lock.
+func (d *DeltaLakeRepository) applyTableProperties(properties map[string]string) error {
+	if data, ok := properties[ValidationRulesProperty]; ok {
+		validator, err := validatorFromProperties(map[string]string{ValidationRulesProperty: data})
+		if err != nil {
+			return err
+		}
+		d.validator = validator.WithFieldNames(renamedFields(d.currentSchema))
+	}
+
+	if d.metadata.Properties == nil {
+		d.metadata.Properties = make(map[string]string)
+	}
+	for k, v := range properties {
+		if k == ValidationRulesProperty && v == "" {
+			delete(d.metadata.Properties, k)
+			continue
+		}
+		d.metadata.Properties[k] = v
+	}
+
+	d.metadata.LastModified = time.Now()
+	return d.saveMetadata()
+}
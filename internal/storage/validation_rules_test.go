@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yang92047111/ducklake-quick-start/internal/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaLakeRepository_ValidationRules(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+
+	circus := loader.Exercise{Name: "Juggling", Type: "circus", Duration: 20, Calories: 100, Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}
+	options := BatchOptions{ValidateFirst: true}
+
+	_, err = repo.InsertBatchWithOptions(ctx, []loader.Exercise{circus}, options)
+	assert.ErrorContains(t, err, "must be one of")
+
+	// Rules set through the table properties apply to batch validation
+	require.NoError(t, repo.UpdateTableProperties(ctx, map[string]string{
+		ValidationRulesProperty: `{"types": ["cardio", "circus"], "type_rules": {"circus": {"duration": {"max": 15}}}}`,
+	}))
+	_, err = repo.InsertBatchWithOptions(ctx, []loader.Exercise{circus}, options)
+	assert.ErrorContains(t, err, "cannot exceed 15 minutes")
+
+	circus.Duration = 10
+	_, err = repo.InsertBatchWithOptions(ctx, []loader.Exercise{circus}, options)
+	require.NoError(t, err)
+
+	metrics, err := repo.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), metrics.InvalidRecords)
+
+	// Invalid rules are rejected and leave the current rules in place
+	assert.Error(t, repo.UpdateTableProperties(ctx, map[string]string{ValidationRulesProperty: `{"types": []}`}))
+	assert.Error(t, repo.UpdateTableProperties(ctx, map[string]string{ValidationRulesProperty: `{"colour": "red"}`}))
+	assert.True(t, repo.Validator().IsValidType("circus"))
+
+	// Rules are persisted with the table
+	require.NoError(t, repo.Close())
+	reopened, err := NewDeltaLakeRepository(path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { reopened.Close() })
+
+	rules, err := reopened.GetValidationRules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cardio", "circus"}, rules.Types)
+	assert.Equal(t, 15, *rules.TypeRules["circus"].Duration.Max)
+
+	// Clearing the property restores the defaults
+	require.NoError(t, reopened.UpdateTableProperties(ctx, map[string]string{ValidationRulesProperty: ""}))
+	assert.False(t, reopened.Validator().IsValidType("circus"))
+	metadata, err := reopened.GetTableMetadata(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, metadata.Properties, ValidationRulesProperty)
+
+	metrics, err = reopened.GetDataQualityMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), metrics.InvalidRecords)
+
+	require.NoError(t, reopened.SetValidationRules(ctx, loader.ValidationRules{
+		Types:       []string{"circus"},
+		Name:        loader.NameRules{MinLength: 1, MaxLength: 10},
+		Description: loader.DescriptionRules{MaxLength: 10},
+	}))
+	assert.Equal(t, []string{"circus"}, reopened.Validator().Types())
+}